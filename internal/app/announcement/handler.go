@@ -0,0 +1,128 @@
+package announcement
+
+import (
+	"net/http"
+	"strconv"
+
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	GetActive(c *gin.Context)
+	List(c *gin.Context)
+	Create(c *gin.Context)
+	Expire(c *gin.Context)
+	Delete(c *gin.Context)
+}
+
+type handler struct {
+	service Service
+}
+
+func NewHandler(service Service) Handler {
+	return &handler{service: service}
+}
+
+// @Summary Get active announcements
+// @Description Get the site-wide announcements shown right now, newest first
+// @Tags Announcement
+// @Produce json
+// @Success 200 {object} AnnouncementListResponse
+// @Router /api/announcements [get]
+func (h *handler) GetActive(c *gin.Context) {
+	announcements, err := h.service.Active(c.Request.Context())
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get announcements")
+		return
+	}
+	c.JSON(http.StatusOK, AnnouncementListResponse{Announcements: announcements})
+}
+
+// @Summary List announcements
+// @Description List the latest announcements, including scheduled and expired ones
+// @Tags Announcement
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} AnnouncementListResponse
+// @Router /api/admin/announcements [get]
+func (h *handler) List(c *gin.Context) {
+	announcements, err := h.service.List()
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to list announcements")
+		return
+	}
+	c.JSON(http.StatusOK, AnnouncementListResponse{Announcements: announcements})
+}
+
+// @Summary Create announcement
+// @Description Create an announcement, shown at once or from starts_at until expires_at. Connected clients get an announcement event when it starts.
+// @Tags Announcement
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body CreateAnnouncementRequest true "Announcement"
+// @Success 201 {object} Announcement
+// @Failure 400 {object} ErrorResponse
+// @Router /api/admin/announcements [post]
+func (h *handler) Create(c *gin.Context) {
+	var req CreateAnnouncementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	a, err := h.service.Create(c.Request.Context(), req)
+	if err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, a)
+}
+
+// @Summary Expire announcement
+// @Description End an announcement now; connected clients are told to take it down
+// @Tags Announcement
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Announcement ID"
+// @Success 200 {object} Announcement
+// @Failure 404 {object} ErrorResponse
+// @Router /api/admin/announcements/{id}/expire [post]
+func (h *handler) Expire(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid announcement ID")
+		return
+	}
+
+	a, err := h.service.Expire(c.Request.Context(), id)
+	if err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, a)
+}
+
+// @Summary Delete announcement
+// @Description Delete an announcement
+// @Tags Announcement
+// @Security ApiKeyAuth
+// @Param id path int true "Announcement ID"
+// @Success 204
+// @Failure 404 {object} ErrorResponse
+// @Router /api/admin/announcements/{id} [delete]
+func (h *handler) Delete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid announcement ID")
+		return
+	}
+
+	if err := h.service.Delete(c.Request.Context(), id); err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
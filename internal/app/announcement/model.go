@@ -0,0 +1,40 @@
+package announcement
+
+import (
+	"time"
+
+	"backend/internal/utils"
+)
+
+// Announcement is a site-wide notice shown from StartsAt until ExpiresAt.
+// PublishedAt is set once it has been pushed to connected clients.
+type Announcement struct {
+	ID          uint64     `json:"id" gorm:"primaryKey"`
+	Text        string     `json:"text" gorm:"type:text;not null"`
+	Level       string     `json:"level" gorm:"not null;default:info"`
+	StartsAt    time.Time  `json:"starts_at" gorm:"not null;index"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" gorm:"index"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Active reports whether the announcement is shown at now.
+func (a *Announcement) Active(now time.Time) bool {
+	return !a.StartsAt.After(now) && (a.ExpiresAt == nil || a.ExpiresAt.After(now))
+}
+
+// CreateAnnouncementRequest schedules an announcement. Without starts_at it
+// is shown at once; without expires_at it stays until expired by hand.
+type CreateAnnouncementRequest struct {
+	Text      string     `json:"text" binding:"required"`
+	Level     string     `json:"level,omitempty"`
+	StartsAt  *time.Time `json:"starts_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type AnnouncementListResponse struct {
+	Announcements []*Announcement `json:"announcements"`
+}
+
+type ErrorResponse = utils.ErrorResponse
@@ -0,0 +1,80 @@
+package announcement
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	Create(a *Announcement) error
+	GetByID(id uint64) (*Announcement, error)
+	ListActive(now time.Time) ([]*Announcement, error)
+	ListAll(limit int) ([]*Announcement, error)
+	Expire(id uint64, at time.Time) (*Announcement, error)
+	Delete(id uint64) (bool, error)
+	MarkDuePublished(now time.Time) ([]*Announcement, error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) Create(a *Announcement) error {
+	return r.db.Create(a).Error
+}
+
+func (r *repository) GetByID(id uint64) (*Announcement, error) {
+	var a Announcement
+	err := r.db.Where("id = ?", id).First(&a).Error
+	return &a, err
+}
+
+func (r *repository) ListActive(now time.Time) ([]*Announcement, error) {
+	var announcements []*Announcement
+	err := r.db.Where("starts_at <= ? AND (expires_at IS NULL OR expires_at > ?)", now, now).
+		Order("starts_at DESC, id DESC").
+		Find(&announcements).Error
+	return announcements, err
+}
+
+func (r *repository) ListAll(limit int) ([]*Announcement, error) {
+	var announcements []*Announcement
+	err := r.db.Order("id DESC").Limit(limit).Find(&announcements).Error
+	return announcements, err
+}
+
+// Expire ends an announcement at at, unless it has already ended earlier.
+func (r *repository) Expire(id uint64, at time.Time) (*Announcement, error) {
+	err := r.db.Model(&Announcement{}).
+		Where("id = ? AND (expires_at IS NULL OR expires_at > ?)", id, at).
+		Updates(map[string]interface{}{"expires_at": at, "updated_at": at}).Error
+	if err != nil {
+		return nil, err
+	}
+	return r.GetByID(id)
+}
+
+func (r *repository) Delete(id uint64) (bool, error) {
+	result := r.db.Where("id = ?", id).Delete(&Announcement{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// MarkDuePublished claims the announcements that have started, are not over
+// and were not pushed yet. The UPDATE claims each one exactly once, so only
+// one instance pushes it.
+func (r *repository) MarkDuePublished(now time.Time) ([]*Announcement, error) {
+	var announcements []*Announcement
+	err := r.db.Raw(`
+		UPDATE announcements SET published_at = ?
+		WHERE published_at IS NULL
+		  AND starts_at <= ?
+		  AND (expires_at IS NULL OR expires_at > ?)
+		RETURNING *
+	`, now, now, now).Scan(&announcements).Error
+	return announcements, err
+}
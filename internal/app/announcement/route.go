@@ -0,0 +1,17 @@
+package announcement
+
+import "github.com/gin-gonic/gin"
+
+func RegisterRoutes(rg *gin.RouterGroup, handler Handler) {
+	rg.GET("/announcements", handler.GetActive)
+}
+
+func RegisterAdminRoutes(rg *gin.RouterGroup, handler Handler) {
+	announcements := rg.Group("/announcements")
+	{
+		announcements.GET("", handler.List)
+		announcements.POST("", handler.Create)
+		announcements.POST("/:id/expire", handler.Expire)
+		announcements.DELETE("/:id", handler.Delete)
+	}
+}
@@ -0,0 +1,182 @@
+package announcement
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"backend/internal/providers/redis"
+	"backend/internal/utils"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	activeCacheKey = "announcements:active"
+	// Scheduled announcements show up in the list at most this late; the
+	// websocket push comes from the publish job.
+	activeCacheTTL = 30 * time.Second
+
+	maxTextLength = 2000
+	listLimit     = 100
+)
+
+var levels = map[string]bool{"info": true, "warning": true, "critical": true}
+
+type Service interface {
+	Create(ctx context.Context, req CreateAnnouncementRequest) (*Announcement, error)
+	Active(ctx context.Context) ([]*Announcement, error)
+	List() ([]*Announcement, error)
+	Expire(ctx context.Context, id uint64) (*Announcement, error)
+	Delete(ctx context.Context, id uint64) error
+	// PublishDue pushes the announcements that have started since the last
+	// call to every connected client and returns how many it pushed.
+	PublishDue(ctx context.Context) (int, error)
+}
+
+type service struct {
+	repo     Repository
+	redisP   *redis.RedisProvider
+	eventBus *utils.EventBus
+	logger   *zap.SugaredLogger
+}
+
+func NewService(repo Repository, redisP *redis.RedisProvider, eventBus *utils.EventBus, logger *zap.Logger) Service {
+	return &service{repo: repo, redisP: redisP, eventBus: eventBus, logger: logger.Sugar()}
+}
+
+func (s *service) Create(ctx context.Context, req CreateAnnouncementRequest) (*Announcement, error) {
+	text := strings.TrimSpace(req.Text)
+	if n := utf8.RuneCountInString(text); n < 1 || n > maxTextLength {
+		return nil, utils.Invalid("text", "announcement text must be between 1 and %d characters, got %d", maxTextLength, n)
+	}
+	level := req.Level
+	if level == "" {
+		level = "info"
+	}
+	if !levels[level] {
+		return nil, utils.Invalid("level", "level must be info, warning or critical, got %q", level)
+	}
+
+	now := time.Now()
+	startsAt := now
+	if req.StartsAt != nil && req.StartsAt.After(now) {
+		startsAt = *req.StartsAt
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(startsAt) {
+		return nil, utils.Invalid("expires_at", "expires_at must be after the announcement starts")
+	}
+
+	a := &Announcement{Text: text, Level: level, StartsAt: startsAt, ExpiresAt: req.ExpiresAt}
+	if err := s.repo.Create(a); err != nil {
+		return nil, fmt.Errorf("failed to create announcement: %w", err)
+	}
+	s.redisP.CachedDel(ctx, activeCacheKey)
+
+	if !startsAt.After(now) {
+		if _, err := s.PublishDue(ctx); err != nil {
+			s.logger.Warnw("Failed to publish announcement", "announcement_id", a.ID, "error", err)
+		}
+	}
+	return a, nil
+}
+
+func (s *service) Active(ctx context.Context) ([]*Announcement, error) {
+	var announcements []*Announcement
+	data, err := s.redisP.CachedGet(ctx, activeCacheKey)
+	if err != nil || json.Unmarshal([]byte(data), &announcements) != nil {
+		announcements, err = s.repo.ListActive(time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list announcements: %w", err)
+		}
+		if data, err := json.Marshal(announcements); err == nil {
+			s.redisP.CachedSet(ctx, activeCacheKey, data, activeCacheTTL)
+		}
+	}
+
+	// A cached entry may have expired since it was cached.
+	now := time.Now()
+	active := make([]*Announcement, 0, len(announcements))
+	for _, a := range announcements {
+		if a.Active(now) {
+			active = append(active, a)
+		}
+	}
+	return active, nil
+}
+
+func (s *service) List() ([]*Announcement, error) {
+	announcements, err := s.repo.ListAll(listLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list announcements: %w", err)
+	}
+	if announcements == nil {
+		announcements = []*Announcement{}
+	}
+	return announcements, nil
+}
+
+func (s *service) Expire(ctx context.Context, id uint64) (*Announcement, error) {
+	a, err := s.repo.Expire(id, time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.NotFound("announcement")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire announcement: %w", err)
+	}
+	s.redisP.CachedDel(ctx, activeCacheKey)
+	s.publish(ctx, a, false)
+	return a, nil
+}
+
+func (s *service) Delete(ctx context.Context, id uint64) error {
+	a, err := s.repo.GetByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.NotFound("announcement")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get announcement: %w", err)
+	}
+	if _, err := s.repo.Delete(id); err != nil {
+		return fmt.Errorf("failed to delete announcement: %w", err)
+	}
+	s.redisP.CachedDel(ctx, activeCacheKey)
+	if a.PublishedAt != nil && a.Active(time.Now()) {
+		s.publish(ctx, a, false)
+	}
+	return nil
+}
+
+func (s *service) PublishDue(ctx context.Context) (int, error) {
+	due, err := s.repo.MarkDuePublished(time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim due announcements: %w", err)
+	}
+	if len(due) == 0 {
+		return 0, nil
+	}
+	s.redisP.CachedDel(ctx, activeCacheKey)
+	for _, a := range due {
+		s.publish(ctx, a, true)
+	}
+	return len(due), nil
+}
+
+// publish tells clients to show the announcement, or with active false to
+// take it down.
+func (s *service) publish(ctx context.Context, a *Announcement, active bool) {
+	s.eventBus.PublishWithContext(ctx, utils.Announcement{
+		ID:        a.ID,
+		Text:      a.Text,
+		Level:     a.Level,
+		StartsAt:  a.StartsAt,
+		ExpiresAt: a.ExpiresAt,
+		Active:    active,
+		Timestamp: time.Now().Unix(),
+	})
+}
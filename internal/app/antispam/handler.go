@@ -0,0 +1,30 @@
+package antispam
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	GetFormToken(c *gin.Context)
+}
+
+type handler struct {
+	service Service
+}
+
+func NewHandler(service Service) Handler {
+	return &handler{service: service}
+}
+
+// @Summary Get form token
+// @Description Get a signed, timestamped token for the thread or reply form. Send it back as form_token when posting; posts sent without one, or sooner than min_delay_ms after it was issued, are more likely to be taken for spam.
+// @Tags Antispam
+// @Produce json
+// @Success 200 {object} FormTokenResponse
+// @Router /api/form-token [get]
+func (h *handler) GetFormToken(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, h.service.IssueToken())
+}
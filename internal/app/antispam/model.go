@@ -0,0 +1,28 @@
+package antispam
+
+// Signals are what a posting request tells about its sender, besides the
+// post itself.
+type Signals struct {
+	// Honeypot is the value of the hidden website field; a person never
+	// sees it and leaves it empty.
+	Honeypot  string
+	FormToken string
+	UserAgent string
+}
+
+// Verdict is the scorer's judgement on a request. Reasons name the checks
+// that added to Score; they are logged, never shown to the client.
+type Verdict struct {
+	Score    int
+	Reasons  []string
+	Rejected bool
+}
+
+// FormTokenResponse is handed to the posting form when it is shown. The
+// token goes back as form_token; a post sent less than min_delay_ms after
+// the token was issued counts against the poster.
+type FormTokenResponse struct {
+	Token      string `json:"token"`
+	MinDelayMs int64  `json:"min_delay_ms"`
+	ExpiresIn  int64  `json:"expires_in"`
+}
@@ -0,0 +1,7 @@
+package antispam
+
+import "github.com/gin-gonic/gin"
+
+func RegisterRoutes(rg *gin.RouterGroup, handler Handler) {
+	rg.GET("/form-token", handler.GetFormToken)
+}
@@ -0,0 +1,115 @@
+package antispam
+
+import (
+	"strings"
+	"time"
+)
+
+// The weights of the checks. A filled honeypot alone crosses the default
+// threshold; a missing token or an odd user agent alone does not, so a
+// client that predates form tokens can still post from a browser.
+const (
+	weightHoneypot     = 100
+	weightNoToken      = 40
+	weightBadToken     = 60
+	weightTooFast      = 60
+	weightExpiredToken = 20
+	weightNoUserAgent  = 40
+	weightBotUserAgent = 50
+	weightOddUserAgent = 20
+)
+
+// botAgents are user agent fragments of HTTP libraries, crawlers and
+// headless browsers, lowercased.
+var botAgents = []string{
+	"curl/", "wget/", "python-requests", "python-urllib", "aiohttp", "httpx",
+	"go-http-client", "okhttp", "java/", "apache-httpclient", "libwww-perl",
+	"node-fetch", "axios/", "undici", "scrapy", "headlesschrome", "phantomjs",
+	"selenium", "puppeteer", "playwright", "bot/", "spider", "crawler",
+}
+
+type Service interface {
+	// IssueToken returns a form token stamped with the current time.
+	IssueToken() *FormTokenResponse
+	// Score rates a posting request; a verdict with Rejected set must not
+	// be accepted.
+	Score(s Signals) Verdict
+}
+
+type service struct {
+	tokens    formTokenSigner
+	minDelay  time.Duration
+	tokenTTL  time.Duration
+	threshold int
+	now       func() time.Time
+}
+
+// NewService returns the spam scorer. Form tokens are signed with a key
+// derived from sessionSecret and are good for tokenTTL; a post sent sooner
+// than minDelay after its token was issued looks automated. Requests that
+// score threshold or more are rejected; a threshold of 0 turns rejection
+// off.
+func NewService(sessionSecret []byte, minDelay, tokenTTL time.Duration, threshold int) Service {
+	return &service{
+		tokens:    newFormTokenSigner(sessionSecret),
+		minDelay:  minDelay,
+		tokenTTL:  tokenTTL,
+		threshold: threshold,
+		now:       time.Now,
+	}
+}
+
+func (s *service) IssueToken() *FormTokenResponse {
+	return &FormTokenResponse{
+		Token:      s.tokens.sign(s.now()),
+		MinDelayMs: s.minDelay.Milliseconds(),
+		ExpiresIn:  int64(s.tokenTTL.Seconds()),
+	}
+}
+
+func (s *service) Score(sig Signals) Verdict {
+	var v Verdict
+	add := func(weight int, reason string) {
+		v.Score += weight
+		v.Reasons = append(v.Reasons, reason)
+	}
+
+	if strings.TrimSpace(sig.Honeypot) != "" {
+		add(weightHoneypot, "honeypot")
+	}
+
+	if sig.FormToken == "" {
+		add(weightNoToken, "no_form_token")
+	} else if issuedAt, ok := s.tokens.issuedAt(sig.FormToken); !ok {
+		add(weightBadToken, "bad_form_token")
+	} else if age := s.now().Sub(issuedAt); age < s.minDelay {
+		// A token from the future is as forged as a bad signature, and is
+		// caught here too.
+		add(weightTooFast, "too_fast")
+	} else if age > s.tokenTTL {
+		add(weightExpiredToken, "expired_form_token")
+	}
+
+	ua := strings.ToLower(strings.TrimSpace(sig.UserAgent))
+	switch {
+	case ua == "":
+		add(weightNoUserAgent, "no_user_agent")
+	case containsAny(ua, botAgents):
+		add(weightBotUserAgent, "bot_user_agent")
+	case !strings.HasPrefix(ua, "mozilla/") || len(ua) < 40:
+		// Every mainstream browser sends a long Mozilla/5.0 (...) string.
+		add(weightOddUserAgent, "odd_user_agent")
+	}
+
+	v.Rejected = s.threshold > 0 && v.Score >= s.threshold
+	return v
+}
+
+func containsAny(s string, fragments []string) bool {
+	for _, f := range fragments {
+		if strings.Contains(s, f) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package apikey
+
+import (
+	"net/http"
+	"strconv"
+
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	Create(c *gin.Context)
+	List(c *gin.Context)
+	Revoke(c *gin.Context)
+	Usage(c *gin.Context)
+}
+
+type handler struct {
+	service Service
+}
+
+func NewHandler(service Service) Handler {
+	return &handler{service: service}
+}
+
+// @Summary Issue API key
+// @Description Issue a read-only API key for a third-party client. The plaintext key is returned only once.
+// @Tags APIKey
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body CreateAPIKeyRequest true "API key request"
+// @Success 201 {object} CreateAPIKeyResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/admin/api-keys [post]
+func (h *handler) Create(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	key, raw, err := h.service.Issue(req.Name, req.QuotaPerMinute, req.QuotaPerDay)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateAPIKeyResponse{APIKey: key, Key: raw})
+}
+
+// @Summary List API keys
+// @Description List all issued third-party API keys
+// @Tags APIKey
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} APIKeyListResponse
+// @Router /api/admin/api-keys [get]
+func (h *handler) List(c *gin.Context) {
+	keys, err := h.service.List()
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to list api keys")
+		return
+	}
+	c.JSON(http.StatusOK, APIKeyListResponse{APIKeys: keys})
+}
+
+// @Summary Revoke API key
+// @Description Revoke a third-party API key
+// @Tags APIKey
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "API key ID"
+// @Success 204
+// @Failure 404 {object} ErrorResponse
+// @Router /api/admin/api-keys/{id} [delete]
+func (h *handler) Revoke(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid api key ID")
+		return
+	}
+
+	if err := h.service.Revoke(c.Request.Context(), id); err != nil {
+		utils.RespondError(c, http.StatusNotFound, "api key not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Get API key usage
+// @Description Get request counts for an API key
+// @Tags APIKey
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "API key ID"
+// @Param days query int false "Number of days" default(7)
+// @Success 200 {object} UsageResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/admin/api-keys/{id}/usage [get]
+func (h *handler) Usage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid api key ID")
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil {
+		days = 7
+	}
+
+	usage, err := h.service.Usage(c.Request.Context(), id, days)
+	if err != nil {
+		utils.RespondError(c, http.StatusNotFound, "api key not found")
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
@@ -0,0 +1,59 @@
+package apikey
+
+import (
+	"time"
+
+	"backend/internal/utils"
+)
+
+type APIKey struct {
+	ID             uint64     `json:"id" gorm:"primaryKey"`
+	Name           string     `json:"name" gorm:"not null"`
+	Prefix         string     `json:"prefix" gorm:"type:varchar(16);not null"`
+	KeyHash        string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	QuotaPerMinute int        `json:"quota_per_minute" gorm:"not null;default:60"`
+	QuotaPerDay    int        `json:"quota_per_day" gorm:"not null;default:10000"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
+	UpdatedAt      time.Time  `json:"updated_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+type QuotaStatus struct {
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+type CreateAPIKeyRequest struct {
+	Name           string `json:"name" binding:"required,min=1,max=100"`
+	QuotaPerMinute int    `json:"quota_per_minute"`
+	QuotaPerDay    int    `json:"quota_per_day"`
+}
+
+type CreateAPIKeyResponse struct {
+	APIKey *APIKey `json:"api_key"`
+	Key    string  `json:"key"`
+}
+
+type APIKeyListResponse struct {
+	APIKeys []*APIKey `json:"api_keys"`
+}
+
+type DailyUsage struct {
+	Date     string `json:"date"`
+	Requests int64  `json:"requests"`
+}
+
+type UsageResponse struct {
+	APIKeyID      uint64       `json:"api_key_id"`
+	CurrentMinute int64        `json:"current_minute"`
+	Total         int64        `json:"total"`
+	Daily         []DailyUsage `json:"daily"`
+}
+
+type ErrorResponse = utils.ErrorResponse
@@ -0,0 +1,61 @@
+package apikey
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	Create(key *APIKey) error
+	GetAll() ([]*APIKey, error)
+	GetByID(id uint64) (*APIKey, error)
+	GetByHash(hash string) (*APIKey, error)
+	Revoke(id uint64) error
+	TouchLastUsed(id uint64, at time.Time) error
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) Create(key *APIKey) error {
+	return r.db.Create(key).Error
+}
+
+func (r *repository) GetAll() ([]*APIKey, error) {
+	var keys []*APIKey
+	err := r.db.Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+func (r *repository) GetByID(id uint64) (*APIKey, error) {
+	var key APIKey
+	err := r.db.Where("id = ?", id).First(&key).Error
+	return &key, err
+}
+
+func (r *repository) GetByHash(hash string) (*APIKey, error) {
+	var key APIKey
+	err := r.db.Where("key_hash = ?", hash).First(&key).Error
+	return &key, err
+}
+
+func (r *repository) Revoke(id uint64) error {
+	return r.db.Model(&APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{
+			"revoked_at": time.Now().UTC(),
+			"updated_at": time.Now().UTC(),
+		}).Error
+}
+
+func (r *repository) TouchLastUsed(id uint64, at time.Time) error {
+	return r.db.Model(&APIKey{}).
+		Where("id = ?", id).
+		Update("last_used_at", at).Error
+}
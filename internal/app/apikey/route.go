@@ -0,0 +1,13 @@
+package apikey
+
+import "github.com/gin-gonic/gin"
+
+func RegisterRoutes(rg *gin.RouterGroup, handler Handler) {
+	keys := rg.Group("/api-keys")
+	{
+		keys.POST("", handler.Create)
+		keys.GET("", handler.List)
+		keys.DELETE("/:id", handler.Revoke)
+		keys.GET("/:id/usage", handler.Usage)
+	}
+}
@@ -0,0 +1,207 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/internal/providers/redis"
+
+	"go.uber.org/zap"
+)
+
+const (
+	keyPrefix         = "404k_"
+	keyCacheTTL       = time.Minute
+	defaultPerMinute  = 60
+	defaultPerDay     = 10000
+	usageRetentionTTL = 31 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidKey    = errors.New("invalid api key")
+	ErrRevokedKey    = errors.New("api key has been revoked")
+	ErrQuotaExceeded = errors.New("api key quota exceeded")
+)
+
+type Service interface {
+	Issue(name string, perMinute, perDay int) (*APIKey, string, error)
+	List() ([]*APIKey, error)
+	Revoke(ctx context.Context, id uint64) error
+	Authorize(ctx context.Context, rawKey string) (*APIKey, *QuotaStatus, error)
+	Usage(ctx context.Context, id uint64, days int) (*UsageResponse, error)
+}
+
+type service struct {
+	repo   Repository
+	redisP *redis.RedisProvider
+	logger *zap.SugaredLogger
+}
+
+func NewService(repo Repository, redisP *redis.RedisProvider, logger *zap.Logger) Service {
+	return &service{
+		repo:   repo,
+		redisP: redisP,
+		logger: logger.Sugar(),
+	}
+}
+
+func (s *service) Issue(name string, perMinute, perDay int) (*APIKey, string, error) {
+	if perMinute <= 0 {
+		perMinute = defaultPerMinute
+	}
+	if perDay <= 0 {
+		perDay = defaultPerDay
+	}
+
+	raw, err := generateKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+
+	key := &APIKey{
+		Name:           name,
+		Prefix:         raw[:len(keyPrefix)+6],
+		KeyHash:        hashKey(raw),
+		QuotaPerMinute: perMinute,
+		QuotaPerDay:    perDay,
+		CreatedAt:      time.Now().UTC(),
+		UpdatedAt:      time.Now().UTC(),
+	}
+	if err := s.repo.Create(key); err != nil {
+		return nil, "", fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	s.logger.Infow("API key issued", "api_key_id", key.ID, "name", name, "prefix", key.Prefix)
+	return key, raw, nil
+}
+
+func (s *service) List() ([]*APIKey, error) {
+	return s.repo.GetAll()
+}
+
+func (s *service) Revoke(ctx context.Context, id uint64) error {
+	key, err := s.repo.GetByID(id)
+	if err != nil {
+		return fmt.Errorf("api key not found: %w", err)
+	}
+	if err := s.repo.Revoke(id); err != nil {
+		return err
+	}
+	s.redisP.Del(ctx, cacheKey(key.KeyHash))
+	s.logger.Infow("API key revoked", "api_key_id", id, "prefix", key.Prefix)
+	return nil
+}
+
+func (s *service) Authorize(ctx context.Context, rawKey string) (*APIKey, *QuotaStatus, error) {
+	hash := hashKey(rawKey)
+
+	key, err := s.lookup(ctx, hash)
+	if err != nil {
+		return nil, nil, ErrInvalidKey
+	}
+	if key.RevokedAt != nil {
+		return key, nil, ErrRevokedKey
+	}
+
+	now := time.Now().UTC()
+	minuteKey := fmt.Sprintf("apikey:%d:usage:minute:%d", key.ID, now.Unix()/60)
+	dayKey := fmt.Sprintf("apikey:%d:usage:day:%s", key.ID, now.Format("2006-01-02"))
+	totalKey := fmt.Sprintf("apikey:%d:usage:total", key.ID)
+
+	pipe := s.redisP.Client.TxPipeline()
+	minuteCmd := pipe.Incr(ctx, minuteKey)
+	pipe.Expire(ctx, minuteKey, 2*time.Minute)
+	dayCmd := pipe.Incr(ctx, dayKey)
+	pipe.Expire(ctx, dayKey, usageRetentionTTL)
+	pipe.Incr(ctx, totalKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		s.logger.Warnw("Failed to record api key usage, allowing request", "api_key_id", key.ID, "error", err)
+		return key, &QuotaStatus{Limit: key.QuotaPerMinute, Remaining: key.QuotaPerMinute}, nil
+	}
+
+	minuteCount := int(minuteCmd.Val())
+	dayCount := int(dayCmd.Val())
+
+	if minuteCount == 1 {
+		if err := s.repo.TouchLastUsed(key.ID, now); err != nil {
+			s.logger.Warnw("Failed to update api key last_used_at", "api_key_id", key.ID, "error", err)
+		}
+	}
+
+	if dayCount > key.QuotaPerDay {
+		midnight := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+		return key, &QuotaStatus{Limit: key.QuotaPerDay, Remaining: 0, RetryAfter: midnight.Sub(now)}, ErrQuotaExceeded
+	}
+	if minuteCount > key.QuotaPerMinute {
+		nextMinute := now.Truncate(time.Minute).Add(time.Minute)
+		return key, &QuotaStatus{Limit: key.QuotaPerMinute, Remaining: 0, RetryAfter: nextMinute.Sub(now)}, ErrQuotaExceeded
+	}
+
+	return key, &QuotaStatus{Limit: key.QuotaPerMinute, Remaining: key.QuotaPerMinute - minuteCount}, nil
+}
+
+func (s *service) Usage(ctx context.Context, id uint64, days int) (*UsageResponse, error) {
+	if _, err := s.repo.GetByID(id); err != nil {
+		return nil, fmt.Errorf("api key not found: %w", err)
+	}
+	if days < 1 || days > 31 {
+		days = 7
+	}
+
+	now := time.Now().UTC()
+	resp := &UsageResponse{APIKeyID: id, Daily: make([]DailyUsage, 0, days)}
+
+	resp.CurrentMinute, _ = s.redisP.Get(ctx, fmt.Sprintf("apikey:%d:usage:minute:%d", id, now.Unix()/60)).Int64()
+	resp.Total, _ = s.redisP.Get(ctx, fmt.Sprintf("apikey:%d:usage:total", id)).Int64()
+
+	for i := 0; i < days; i++ {
+		date := now.AddDate(0, 0, -i).Format("2006-01-02")
+		count, _ := s.redisP.Get(ctx, fmt.Sprintf("apikey:%d:usage:day:%s", id, date)).Int64()
+		resp.Daily = append(resp.Daily, DailyUsage{Date: date, Requests: count})
+	}
+
+	return resp, nil
+}
+
+func (s *service) lookup(ctx context.Context, hash string) (*APIKey, error) {
+	cached, err := s.redisP.Get(ctx, cacheKey(hash)).Result()
+	if err == nil && cached != "" {
+		var key APIKey
+		if json.Unmarshal([]byte(cached), &key) == nil {
+			return &key, nil
+		}
+	}
+
+	key, err := s.repo.GetByHash(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, err := json.Marshal(key); err == nil {
+		s.redisP.SetEX(ctx, cacheKey(hash), data, keyCacheTTL)
+	}
+	return key, nil
+}
+
+func cacheKey(hash string) string {
+	return fmt.Sprintf("apikey:hash:%s", hash)
+}
+
+func hashKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateKey() (string, error) {
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return keyPrefix + hex.EncodeToString(bytes), nil
+}
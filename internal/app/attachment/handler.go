@@ -3,6 +3,8 @@ package attachment
 import (
 	"net/http"
 
+	"backend/internal/utils"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -42,12 +44,12 @@ func (h *handler) GetAttachments(c *gin.Context) {
 	} else if messageID != "" {
 		attachments, err = h.service.GetByMessageID(c.Request.Context(), parseUint64(messageID))
 	} else {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "thread_id or message_id required"})
+		utils.RespondError(c, http.StatusBadRequest, "thread_id or message_id required")
 		return
 	}
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		utils.RespondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -66,12 +68,12 @@ func (h *handler) GetAttachments(c *gin.Context) {
 func (h *handler) DeleteTemporary(c *gin.Context) {
 	fileID := c.Query("file_id")
 	if fileID == "" {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "file_id required"})
+		utils.RespondError(c, http.StatusBadRequest, "file_id required")
 		return
 	}
 
 	if err := h.service.DeleteTemporary(c.Request.Context(), fileID); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		utils.RespondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -1,18 +1,23 @@
 package attachment
 
-import "time"
+import (
+	"time"
+
+	"backend/internal/utils"
+)
 
 type Attachment struct {
-	ID          uint64    `json:"id" gorm:"primaryKey"`
-	ThreadID    *uint64   `json:"thread_id,omitempty" gorm:"index"`
-	MessageID   *uint64   `json:"message_id,omitempty" gorm:"index"`
-	FileID      string    `json:"file_id" gorm:"type:varchar(36);not null"`
-	FileName    string    `json:"file_name" gorm:"not null"`
-	FileURL     string    `json:"file_url" gorm:"not null"`
-	FileSize    int64     `json:"file_size" gorm:"not null"`
-	ContentType string    `json:"content_type" gorm:"type:varchar(100);not null"`
-	ObjectName  string    `json:"object_name" gorm:"type:varchar(500);not null"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          uint64     `json:"id" gorm:"primaryKey"`
+	ThreadID    *uint64    `json:"thread_id,omitempty" gorm:"index"`
+	MessageID   *uint64    `json:"message_id,omitempty" gorm:"index"`
+	FileID      string     `json:"file_id" gorm:"type:varchar(36);not null"`
+	FileName    string     `json:"file_name" gorm:"not null"`
+	FileURL     string     `json:"file_url" gorm:"not null"`
+	FileSize    int64      `json:"file_size" gorm:"not null"`
+	ContentType string     `json:"content_type" gorm:"type:varchar(100);not null"`
+	ObjectName  string     `json:"object_name" gorm:"type:varchar(500);not null"`
+	MissingAt   *time.Time `json:"missing_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
 }
 
 func (Attachment) TableName() string {
@@ -47,6 +52,4 @@ type DeleteTemporaryResponse struct {
 	Success bool `json:"success"`
 }
 
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
+type ErrorResponse = utils.ErrorResponse
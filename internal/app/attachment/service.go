@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 
+	"backend/internal/app/board"
 	"backend/internal/providers/minio"
+	"backend/internal/utils"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -28,6 +30,10 @@ type Service interface {
 	DeleteByThreadID(ctx context.Context, threadID uint64) error
 	DeleteByMessageID(ctx context.Context, messageID uint64) error
 	DeleteAllByThreadID(ctx context.Context, threadID uint64) error
+	// CheckPolicy refuses attachments the board's file policy does not
+	// allow. Uploads are checked against it only when they name the board,
+	// so posts check again when they link them.
+	CheckPolicy(ctx context.Context, fileIDs []string, b *board.Board) error
 }
 
 type service struct {
@@ -145,6 +151,27 @@ func (s *service) GetByFileIDs(ctx context.Context, fileIDs []string) ([]*Attach
 	return attachments, err
 }
 
+func (s *service) CheckPolicy(ctx context.Context, fileIDs []string, b *board.Board) error {
+	var policy minio.FilePolicy
+	if s.minioP != nil {
+		policy = s.minioP.DefaultPolicy()
+	}
+	policy = b.FilePolicy(policy)
+	if err := policy.ValidateCount(len(fileIDs)); err != nil {
+		return utils.Invalid("attachment_ids", "%s", err)
+	}
+	attachments, err := s.GetByFileIDs(ctx, fileIDs)
+	if err != nil {
+		return fmt.Errorf("failed to get attachments: %w", err)
+	}
+	for _, att := range attachments {
+		if err := policy.ValidateFile(att.FileName, att.FileSize, att.ContentType); err != nil {
+			return utils.Invalid("attachment_ids", "%s", err)
+		}
+	}
+	return nil
+}
+
 func (s *service) UpdateObjectName(ctx context.Context, id uint64, objectName, fileURL string) error {
 	return s.db.WithContext(ctx).
 		Model(&Attachment{}).
@@ -0,0 +1,49 @@
+package backup
+
+import (
+	"fmt"
+
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	ExportBoard(c *gin.Context)
+}
+
+type handler struct {
+	service Service
+}
+
+func NewHandler(service Service) Handler {
+	return &handler{service: service}
+}
+
+// @Summary Export a board
+// @Description Stream a board's threads, messages and attachment metadata as newline-delimited JSON, for offsite backups or moving the board to another instance. The first line describes the board; every thread is followed by its messages, and every post by its attachments. Soft-deleted posts are included. Files themselves are not, only their object names and URLs.
+// @Tags Backup
+// @Produce application/x-ndjson
+// @Security ApiKeyAuth
+// @Param slug path string true "Board slug"
+// @Success 200 {object} Record
+// @Failure 404 {object} ErrorResponse
+// @Router /api/admin/boards/{slug}/export [get]
+func (h *handler) ExportBoard(c *gin.Context) {
+	slug := c.Param("slug")
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.ndjson"`, slug))
+
+	if _, err := h.service.Export(c.Request.Context(), slug, c.Writer); err != nil {
+		// Once lines went out the status is sent; the client sees a
+		// truncated stream instead.
+		if !c.Writer.Written() {
+			c.Header("Content-Type", "")
+			c.Header("Content-Disposition", "")
+			utils.WriteError(c, err)
+			return
+		}
+		c.Error(err)
+		c.Abort()
+	}
+}
@@ -0,0 +1,591 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"backend/internal/app/attachment"
+	"backend/internal/app/board"
+	"backend/internal/app/linkpreview"
+	"backend/internal/app/markup"
+	"backend/internal/app/message"
+	"backend/internal/app/session"
+	"backend/internal/app/thread"
+	"backend/internal/app/user"
+	"backend/internal/providers/minio"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ImportOptions tells Import where a dump goes and what to do with its
+// files.
+type ImportOptions struct {
+	// Board is the slug to import into. It may be left empty for a 404chan
+	// export, whose own board is then used, and created if missing.
+	Board string
+	// Reupload downloads every file from its URL and stores it again in
+	// MinIO. Without it 404chan attachments keep their object names, which
+	// only works when restoring onto the same storage, and 4chan files are
+	// left out.
+	Reupload bool
+	// FilesURL is where the files of a 4chan dump are, e.g.
+	// https://i.4cdn.org/g; each one is FilesURL/<tim><ext>.
+	FilesURL string
+	// MaxFileSize skips larger files when reuploading.
+	MaxFileSize int64
+}
+
+type ImportResult struct {
+	Users        int `json:"users"`
+	Threads      int `json:"threads"`
+	Messages     int `json:"messages"`
+	Attachments  int `json:"attachments"`
+	SkippedFiles int `json:"skipped_files"`
+}
+
+// fourChanThread is a thread as served by the 4chan read-only API
+// (/<board>/thread/<no>.json) and the archivers that mirror it.
+type fourChanThread struct {
+	Posts []fourChanPost `json:"posts"`
+}
+
+type fourChanPost struct {
+	No         uint64 `json:"no"`
+	Resto      uint64 `json:"resto"`
+	Time       int64  `json:"time"`
+	Name       string `json:"name"`
+	Sub        string `json:"sub"`
+	Com        string `json:"com"`
+	ID         string `json:"id"`
+	Tim        int64  `json:"tim"`
+	Ext        string `json:"ext"`
+	Filename   string `json:"filename"`
+	Fsize      int64  `json:"fsize"`
+	Archived   int    `json:"archived"`
+	ArchivedOn int64  `json:"archived_on"`
+}
+
+// importUserPrefix marks the users Import creates. They stand in for the
+// dump's posters and never get a usable session.
+const importUserPrefix = "import:"
+
+var (
+	quotePattern = regexp.MustCompile(`>>(\d+)`)
+	breakPattern = regexp.MustCompile(`(?i)<br\s*/?>`)
+	tagPattern   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// importer holds the state of one Import run: the source IDs seen so far
+// and what they became here. quotes maps what the dump's >>quotes refer to,
+// post numbers or, in version 1 exports, post IDs, to the new post numbers.
+type importer struct {
+	tx      *gorm.DB
+	storage *minio.MinioProvider
+	client  *http.Client
+	opts    ImportOptions
+	board   *board.Board
+
+	sessions map[string]uint64
+	threads  map[uint64]uint64
+	messages map[uint64]uint64
+	quotes   map[uint64]uint64
+	result   ImportResult
+}
+
+func (s *service) Import(ctx context.Context, r io.Reader, opts ImportOptions) (ImportResult, error) {
+	if opts.Reupload && s.storage == nil {
+		return ImportResult{}, errors.New("reuploading files needs MinIO, which is not configured")
+	}
+
+	started := time.Now()
+	var result ImportResult
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		imp := &importer{
+			tx:       tx,
+			storage:  s.storage,
+			client:   &http.Client{Timeout: time.Minute},
+			opts:     opts,
+			sessions: make(map[string]uint64),
+			threads:  make(map[uint64]uint64),
+			messages: make(map[uint64]uint64),
+			quotes:   make(map[uint64]uint64),
+		}
+		defer func() { result = imp.result }()
+
+		dec := json.NewDecoder(r)
+		for n := 1; ; n++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("value %d: %w", n, err)
+			}
+			if err := imp.value(raw); err != nil {
+				return fmt.Errorf("value %d: %w", n, err)
+			}
+		}
+	})
+	if err != nil {
+		return result, err
+	}
+
+	s.logger.Infow("Dump imported", "result", result, "duration", time.Since(started).String())
+	return result, nil
+}
+
+// value imports one JSON value of the dump: a line of a 404chan export or a
+// whole 4chan thread.
+func (imp *importer) value(raw json.RawMessage) error {
+	var probe struct {
+		Kind  string          `json:"kind"`
+		Posts json.RawMessage `json:"posts"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return err
+	}
+	switch {
+	case probe.Kind != "":
+		var rec Record
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			return err
+		}
+		return imp.record(rec)
+	case probe.Posts != nil:
+		var t fourChanThread
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return err
+		}
+		return imp.fourChanThread(t)
+	}
+	return errors.New("neither a 404chan export line nor a 4chan thread")
+}
+
+func (imp *importer) record(rec Record) error {
+	switch {
+	case rec.Kind == KindBoard && rec.Board != nil:
+		if rec.Board.FormatVersion > FormatVersion {
+			return fmt.Errorf("export format %d is newer than this version understands (%d)", rec.Board.FormatVersion, FormatVersion)
+		}
+		return imp.useBoard(rec.Board)
+	case rec.Kind == KindThread && rec.Thread != nil:
+		return imp.thread(rec.Thread)
+	case rec.Kind == KindMessage && rec.Message != nil:
+		return imp.message(rec.Message)
+	case rec.Kind == KindAttachment && rec.Attachment != nil:
+		return imp.attachment(rec.Attachment)
+	}
+	return fmt.Errorf("unknown or empty %q record", rec.Kind)
+}
+
+// useBoard picks the board to import into: the one in the options, or else
+// the exported one, created from rec when this instance has no such board.
+// rec may be nil for dumps that do not describe their board.
+func (imp *importer) useBoard(rec *BoardRecord) error {
+	if imp.board != nil {
+		return nil
+	}
+	slug := imp.opts.Board
+	if slug == "" && rec != nil {
+		slug = rec.Slug
+	}
+	if slug == "" {
+		return errors.New("no board to import into, set IMPORT_BOARD")
+	}
+
+	var b board.Board
+	err := imp.tx.Where("slug = ?", slug).Take(&b).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) && rec != nil && imp.opts.Board == "" {
+		b = board.Board{Slug: rec.Slug, Title: rec.Title, Description: rec.Description, IsNSFW: rec.IsNSFW, MathEnabled: rec.MathEnabled}
+		err = imp.tx.Create(&b).Error
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("board %q does not exist", slug)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get board: %w", err)
+	}
+	imp.board = &b
+	return nil
+}
+
+func (imp *importer) thread(rec *ThreadRecord) error {
+	if err := imp.useBoard(nil); err != nil {
+		return err
+	}
+	sessionID, err := imp.session(fmt.Sprintf("404chan:%d", rec.UserID))
+	if err != nil {
+		return err
+	}
+	postNo, err := imp.postNo(rec.PostNo, rec.ID)
+	if err != nil {
+		return err
+	}
+
+	content := imp.remapQuotes(rec.Content)
+	t := thread.Thread{
+		BoardID:            imp.board.ID,
+		PostNo:             postNo,
+		Title:              rec.Title,
+		Content:            content,
+		Segments:           markup.Parse(content, imp.board.Markup()),
+		CreatedBySessionID: sessionID,
+		AuthorNickname:     rec.AuthorNickname,
+		CreatedAt:          rec.CreatedAt,
+		UpdatedAt:          rec.UpdatedAt,
+		ArchivedAt:         rec.ArchivedAt,
+		EditedAt:           rec.EditedAt,
+		DeletedAt:          rec.DeletedAt,
+		DeletedBy:          rec.DeletedBy,
+	}
+	if err := imp.tx.Create(&t).Error; err != nil {
+		return fmt.Errorf("failed to create thread %d: %w", rec.ID, err)
+	}
+	imp.threads[rec.ID] = t.ID
+	imp.result.Threads++
+
+	// Threads without a bump time get theirs from their last reply when the
+	// counters are rebuilt.
+	if rec.BumpAt != nil {
+		return imp.tx.Create(&thread.ThreadActivity{ThreadID: t.ID, BumpAt: *rec.BumpAt, CreatedAt: t.CreatedAt, UpdatedAt: t.CreatedAt}).Error
+	}
+	return nil
+}
+
+func (imp *importer) message(rec *MessageRecord) error {
+	threadID, ok := imp.threads[rec.ThreadID]
+	if !ok {
+		return fmt.Errorf("message %d belongs to thread %d, which is not in the dump before it", rec.ID, rec.ThreadID)
+	}
+	sessionID, err := imp.session(fmt.Sprintf("404chan:%d", rec.UserID))
+	if err != nil {
+		return err
+	}
+	postNo, err := imp.postNo(rec.PostNo, rec.ID)
+	if err != nil {
+		return err
+	}
+
+	content := imp.remapQuotes(rec.Content)
+	m := message.Message{
+		ThreadID:           threadID,
+		PostNo:             postNo,
+		CreatedBySessionID: sessionID,
+		Content:            content,
+		Segments:           markup.Parse(content, imp.board.Markup()),
+		Embeds:             linkpreview.Embeds(content),
+		CreatedAt:          rec.CreatedAt,
+		UpdatedAt:          rec.UpdatedAt,
+		DeletedAt:          rec.DeletedAt,
+		DeletedBy:          rec.DeletedBy,
+		AuthorNickname:     rec.AuthorNickname,
+		IsAuthor:           rec.IsAuthor,
+	}
+	if rec.ParentID != nil {
+		if parentID, ok := imp.messages[*rec.ParentID]; ok {
+			m.ParentID = &parentID
+		}
+	}
+	if err := imp.tx.Create(&m).Error; err != nil {
+		return fmt.Errorf("failed to create message %d: %w", rec.ID, err)
+	}
+	imp.messages[rec.ID] = m.ID
+	imp.result.Messages++
+	return nil
+}
+
+func (imp *importer) attachment(rec *AttachmentRecord) error {
+	a := attachment.Attachment{
+		FileID:      uuid.New().String(),
+		FileName:    rec.FileName,
+		FileURL:     rec.FileURL,
+		FileSize:    rec.FileSize,
+		ContentType: rec.ContentType,
+		ObjectName:  rec.ObjectName,
+		MissingAt:   rec.MissingAt,
+		CreatedAt:   rec.CreatedAt,
+	}
+	if rec.ThreadID != nil {
+		id, ok := imp.threads[*rec.ThreadID]
+		if !ok {
+			return fmt.Errorf("attachment %d belongs to thread %d, which is not in the dump", rec.ID, *rec.ThreadID)
+		}
+		a.ThreadID = &id
+	}
+	if rec.MessageID != nil {
+		id, ok := imp.messages[*rec.MessageID]
+		if !ok {
+			return fmt.Errorf("attachment %d belongs to message %d, which is not in the dump", rec.ID, *rec.MessageID)
+		}
+		a.MessageID = &id
+	}
+
+	if imp.opts.Reupload {
+		uploaded, ok := imp.reupload(rec.FileURL, rec.FileName)
+		if !ok {
+			return nil
+		}
+		a.FileURL, a.FileSize, a.ContentType, a.ObjectName = uploaded.URL, uploaded.Size, uploaded.ContentType, uploaded.ObjectName
+		a.MissingAt = nil
+	}
+	if err := imp.tx.Create(&a).Error; err != nil {
+		return fmt.Errorf("failed to create attachment %d: %w", rec.ID, err)
+	}
+	imp.result.Attachments++
+	return nil
+}
+
+// fourChanThread imports a 4chan thread. Posters are told apart by their
+// thread-local ID where the board shows one; without it every post is by
+// the same anonymous user.
+func (imp *importer) fourChanThread(src fourChanThread) error {
+	if len(src.Posts) == 0 {
+		return errors.New("thread has no posts")
+	}
+	if err := imp.useBoard(nil); err != nil {
+		return err
+	}
+
+	op := src.Posts[0]
+	if op.Resto != 0 {
+		return fmt.Errorf("post %d is a reply, not the opening post", op.No)
+	}
+	sessionID, err := imp.session("4chan:" + op.ID)
+	if err != nil {
+		return err
+	}
+	postNo, err := imp.postNo(op.No, 0)
+	if err != nil {
+		return err
+	}
+	createdAt := time.Unix(op.Time, 0).UTC()
+	content := imp.remapQuotes(fourChanText(op.Com))
+	t := thread.Thread{
+		BoardID:            imp.board.ID,
+		PostNo:             postNo,
+		Title:              fourChanTitle(op, content),
+		Content:            content,
+		Segments:           markup.Parse(content, imp.board.Markup()),
+		CreatedBySessionID: sessionID,
+		AuthorNickname:     fourChanName(op.Name),
+		CreatedAt:          createdAt,
+		UpdatedAt:          createdAt,
+	}
+	if op.Archived == 1 && op.ArchivedOn > 0 {
+		archivedAt := time.Unix(op.ArchivedOn, 0).UTC()
+		t.ArchivedAt = &archivedAt
+	}
+	if err := imp.tx.Create(&t).Error; err != nil {
+		return fmt.Errorf("failed to create thread %d: %w", op.No, err)
+	}
+	imp.threads[op.No] = t.ID
+	imp.result.Threads++
+	if err := imp.fourChanFile(op, &t.ID, nil, createdAt); err != nil {
+		return err
+	}
+
+	for _, post := range src.Posts[1:] {
+		sessionID, err := imp.session("4chan:" + post.ID)
+		if err != nil {
+			return err
+		}
+		postNo, err := imp.postNo(post.No, 0)
+		if err != nil {
+			return err
+		}
+		postedAt := time.Unix(post.Time, 0).UTC()
+		content := imp.remapQuotes(fourChanText(post.Com))
+		m := message.Message{
+			ThreadID:           t.ID,
+			PostNo:             postNo,
+			CreatedBySessionID: sessionID,
+			Content:            content,
+			Segments:           markup.Parse(content, imp.board.Markup()),
+			Embeds:             linkpreview.Embeds(content),
+			CreatedAt:          postedAt,
+			UpdatedAt:          postedAt,
+			AuthorNickname:     fourChanName(post.Name),
+			IsAuthor:           op.ID != "" && post.ID == op.ID,
+		}
+		if err := imp.tx.Create(&m).Error; err != nil {
+			return fmt.Errorf("failed to create message %d: %w", post.No, err)
+		}
+		imp.messages[post.No] = m.ID
+		imp.result.Messages++
+		if err := imp.fourChanFile(post, &t.ID, &m.ID, postedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fourChanFile reuploads the post's file, if it has one and reuploading is
+// on; a 4chan file has no copy in our storage to point at otherwise.
+func (imp *importer) fourChanFile(post fourChanPost, threadID, messageID *uint64, createdAt time.Time) error {
+	if post.Tim == 0 {
+		return nil
+	}
+	if !imp.opts.Reupload || imp.opts.FilesURL == "" {
+		imp.result.SkippedFiles++
+		return nil
+	}
+	name := post.Filename + post.Ext
+	url := strings.TrimSuffix(imp.opts.FilesURL, "/") + "/" + strconv.FormatInt(post.Tim, 10) + post.Ext
+	uploaded, ok := imp.reupload(url, name)
+	if !ok {
+		return nil
+	}
+	err := imp.tx.Create(&attachment.Attachment{
+		ThreadID:    threadID,
+		MessageID:   messageID,
+		FileID:      uuid.New().String(),
+		FileName:    name,
+		FileURL:     uploaded.URL,
+		FileSize:    uploaded.Size,
+		ContentType: uploaded.ContentType,
+		ObjectName:  uploaded.ObjectName,
+		CreatedAt:   createdAt,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to create attachment for post %d: %w", post.No, err)
+	}
+	imp.result.Attachments++
+	return nil
+}
+
+// reupload copies the file at url into MinIO. A file that cannot be fetched
+// or is too large is skipped and counted, not fatal: the post is imported
+// without it.
+func (imp *importer) reupload(url, fileName string) (*minio.UploadedFile, bool) {
+	data, err := imp.download(url)
+	if err != nil {
+		imp.result.SkippedFiles++
+		return nil, false
+	}
+	fileID := uuid.New().String()
+	objectName := "import/" + fileID + strings.ToLower(path.Ext(fileName))
+	uploaded, err := imp.storage.UploadFromReader(bytes.NewReader(data), objectName,
+		minio.ResolveContentType(fileName, data), int64(len(data)))
+	if err != nil {
+		imp.result.SkippedFiles++
+		return nil, false
+	}
+	return uploaded, true
+}
+
+func (imp *importer) download(url string) ([]byte, error) {
+	resp, err := imp.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	body := io.Reader(resp.Body)
+	if imp.opts.MaxFileSize > 0 {
+		body = io.LimitReader(resp.Body, imp.opts.MaxFileSize+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if imp.opts.MaxFileSize > 0 && int64(len(data)) > imp.opts.MaxFileSize {
+		return nil, fmt.Errorf("GET %s: larger than %d bytes", url, imp.opts.MaxFileSize)
+	}
+	return data, nil
+}
+
+// session returns the session standing in for the dump's poster key,
+// creating an anonymous user for a key seen for the first time.
+func (imp *importer) session(key string) (uint64, error) {
+	if id, ok := imp.sessions[key]; ok {
+		return id, nil
+	}
+	now := time.Now()
+	u := user.User{IP: importUserPrefix + uuid.New().String()}
+	if err := imp.tx.Create(&u).Error; err != nil {
+		return 0, fmt.Errorf("failed to create user: %w", err)
+	}
+	sess := session.Session{SessionKey: uuid.New().String(), StartedAt: now, EndedAt: &now, UserID: u.ID}
+	if err := imp.tx.Create(&sess).Error; err != nil {
+		return 0, fmt.Errorf("failed to create session: %w", err)
+	}
+	imp.sessions[key] = sess.ID
+	imp.result.Users++
+	return sess.ID, nil
+}
+
+// postNo gives the next post the next number on the board and remembers it
+// for the quotes of later posts, under the source post number or, for
+// version 1 exports which have none, the source ID.
+func (imp *importer) postNo(sourceNo, sourceID uint64) (uint64, error) {
+	postNo, err := board.NextPostNo(imp.tx, imp.board.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to number post: %w", err)
+	}
+	if sourceNo == 0 {
+		sourceNo = sourceID
+	}
+	imp.quotes[sourceNo] = postNo
+	return postNo, nil
+}
+
+// remapQuotes points >>quotes of posts already imported at their new post
+// numbers. Quotes of posts outside the dump are left as they are.
+func (imp *importer) remapQuotes(text string) string {
+	return quotePattern.ReplaceAllStringFunc(text, func(quote string) string {
+		no, err := strconv.ParseUint(quote[2:], 10, 64)
+		if err != nil {
+			return quote
+		}
+		if postNo, ok := imp.quotes[no]; ok {
+			return ">>" + strconv.FormatUint(postNo, 10)
+		}
+		return quote
+	})
+}
+
+// fourChanText turns a 4chan comment, which is HTML, into plain text.
+func fourChanText(com string) string {
+	text := breakPattern.ReplaceAllString(com, "\n")
+	text = tagPattern.ReplaceAllString(text, "")
+	return strings.TrimSpace(html.UnescapeString(text))
+}
+
+// fourChanTitle is the thread's subject, or else the start of its text.
+func fourChanTitle(op fourChanPost, content string) string {
+	if sub := strings.TrimSpace(html.UnescapeString(op.Sub)); sub != "" {
+		return sub
+	}
+	first, _, _ := strings.Cut(content, "\n")
+	if first = strings.TrimSpace(first); first == "" {
+		return "№" + strconv.FormatUint(op.No, 10)
+	}
+	if utf8.RuneCountInString(first) > 64 {
+		first = string([]rune(first)[:64]) + "…"
+	}
+	return first
+}
+
+func fourChanName(name string) string {
+	name = strings.TrimSpace(html.UnescapeString(name))
+	if name == "" || name == "Anonymous" {
+		return "Аноним"
+	}
+	return name
+}
@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"time"
+
+	"backend/internal/utils"
+)
+
+// FormatVersion is written into every export and goes up when a record
+// changes shape in a way an importer has to know about. Version 2 added
+// post numbers, which >>quotes refer to; in version 1 they quoted post IDs.
+const FormatVersion = 2
+
+// Record kinds, in the order they appear in an export: the board first, then
+// each thread followed by its messages. Attachments come right after the
+// thread or message they belong to.
+const (
+	KindBoard      = "board"
+	KindThread     = "thread"
+	KindMessage    = "message"
+	KindAttachment = "attachment"
+)
+
+// Record is one line of an export. Kind tells which of the other fields is
+// set.
+type Record struct {
+	Kind       string            `json:"kind"`
+	Board      *BoardRecord      `json:"board,omitempty"`
+	Thread     *ThreadRecord     `json:"thread,omitempty"`
+	Message    *MessageRecord    `json:"message,omitempty"`
+	Attachment *AttachmentRecord `json:"attachment,omitempty"`
+}
+
+type BoardRecord struct {
+	FormatVersion int       `json:"format_version"`
+	ExportedAt    time.Time `json:"exported_at"`
+	Slug          string    `json:"slug"`
+	Title         string    `json:"title"`
+	Description   *string   `json:"description,omitempty"`
+	IsNSFW        bool      `json:"is_nsfw"`
+	MathEnabled   bool      `json:"math_enabled,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ThreadRecord and MessageRecord carry the poster's user ID so posts by the
+// same user can be told apart, but nothing that identifies them further.
+// Soft-deleted posts are included with their deleted_at.
+type ThreadRecord struct {
+	ID             uint64     `json:"id"`
+	PostNo         uint64     `json:"post_no"`
+	UserID         uint64     `json:"user_id"`
+	Title          string     `json:"title"`
+	Content        string     `json:"content"`
+	AuthorNickname string     `json:"author_nickname"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	BumpAt         *time.Time `json:"bump_at,omitempty"`
+	ArchivedAt     *time.Time `json:"archived_at,omitempty"`
+	EditedAt       *time.Time `json:"edited_at,omitempty"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy      *string    `json:"deleted_by,omitempty"`
+}
+
+type MessageRecord struct {
+	ID             uint64     `json:"id"`
+	ThreadID       uint64     `json:"thread_id"`
+	PostNo         uint64     `json:"post_no"`
+	ParentID       *uint64    `json:"parent_id,omitempty"`
+	UserID         uint64     `json:"user_id"`
+	Content        string     `json:"content"`
+	AuthorNickname string     `json:"author_nickname"`
+	IsAuthor       bool       `json:"is_author"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy      *string    `json:"deleted_by,omitempty"`
+}
+
+// AttachmentRecord describes a file; the file itself stays in MinIO under
+// ObjectName and can be fetched from FileURL.
+type AttachmentRecord struct {
+	ID          uint64     `json:"id"`
+	ThreadID    *uint64    `json:"thread_id,omitempty"`
+	MessageID   *uint64    `json:"message_id,omitempty"`
+	FileName    string     `json:"file_name"`
+	FileURL     string     `json:"file_url"`
+	FileSize    int64      `json:"file_size"`
+	ContentType string     `json:"content_type"`
+	ObjectName  string     `json:"object_name"`
+	MissingAt   *time.Time `json:"missing_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// ExportResult counts what an export wrote.
+type ExportResult struct {
+	Threads     int `json:"threads"`
+	Messages    int `json:"messages"`
+	Attachments int `json:"attachments"`
+}
+
+type ErrorResponse = utils.ErrorResponse
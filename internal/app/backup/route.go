@@ -0,0 +1,7 @@
+package backup
+
+import "github.com/gin-gonic/gin"
+
+func RegisterAdminRoutes(rg *gin.RouterGroup, handler Handler) {
+	rg.GET("/boards/:slug/export", handler.ExportBoard)
+}
@@ -0,0 +1,219 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"backend/internal/app/board"
+	"backend/internal/db/resolver"
+	"backend/internal/providers/minio"
+	"backend/internal/utils"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// exportBatch is how many threads are loaded, with all their messages and
+// attachments, per round trip.
+const exportBatch = 50
+
+type Service interface {
+	// Export writes the board's threads, messages and attachment metadata to
+	// w as newline-delimited JSON Records. Output is flushed after every
+	// batch when w is an http.Flusher, so a long export streams.
+	Export(ctx context.Context, slug string, w io.Writer) (ExportResult, error)
+	// Import recreates the threads, messages and files of a dump read from
+	// r, all or nothing. It understands 404chan exports and 4chan API thread
+	// JSON, one or more values one after another. Posters become anonymous
+	// users, and posts get new IDs and post numbers, with >>quotes and
+	// replies remapped. The caller rebuilds the counters afterwards.
+	Import(ctx context.Context, r io.Reader, opts ImportOptions) (ImportResult, error)
+}
+
+type service struct {
+	db      *gorm.DB
+	storage *minio.MinioProvider
+	logger  *zap.SugaredLogger
+}
+
+// NewService returns the backup service; storage may be nil when files are
+// not reuploaded.
+func NewService(db *gorm.DB, storage *minio.MinioProvider, logger *zap.Logger) Service {
+	return &service{
+		db:      db,
+		storage: storage,
+		logger:  logger.Sugar(),
+	}
+}
+
+// Export runs in one read-only REPEATABLE READ transaction, so however long
+// it streams the dump is a single snapshot: no thread is seen twice and no
+// message is missing its thread or parent.
+func (s *service) Export(ctx context.Context, slug string, w io.Writer) (ExportResult, error) {
+	var result ExportResult
+	err := resolver.Read(s.db).WithContext(ctx).Transaction(func(db *gorm.DB) error {
+		var err error
+		result, err = s.export(ctx, db, slug, w)
+		return err
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	return result, err
+}
+
+func (s *service) export(ctx context.Context, db *gorm.DB, slug string, w io.Writer) (ExportResult, error) {
+	var result ExportResult
+
+	var b board.Board
+	if err := db.Where("slug = ?", slug).Take(&b).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return result, utils.NotFound("board")
+	} else if err != nil {
+		return result, fmt.Errorf("failed to get board: %w", err)
+	}
+
+	started := time.Now()
+	enc := json.NewEncoder(w)
+	err := enc.Encode(Record{Kind: KindBoard, Board: &BoardRecord{
+		FormatVersion: FormatVersion,
+		ExportedAt:    started.UTC(),
+		Slug:          b.Slug,
+		Title:         b.Title,
+		Description:   b.Description,
+		IsNSFW:        b.IsNSFW,
+		MathEnabled:   b.MathEnabled,
+		CreatedAt:     b.CreatedAt,
+	}})
+	if err != nil {
+		return result, err
+	}
+
+	var lastID uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		threads, err := s.threadBatch(db, b.ID, lastID)
+		if err != nil {
+			return result, err
+		}
+		if len(threads) == 0 {
+			break
+		}
+		lastID = threads[len(threads)-1].ID
+
+		if err := s.writeBatch(db, enc, threads, &result); err != nil {
+			return result, err
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+
+	s.logger.Infow("Board exported", "board", slug, "result", result, "duration", time.Since(started).String())
+	return result, nil
+}
+
+func (s *service) threadBatch(db *gorm.DB, boardID, afterID uint64) ([]*ThreadRecord, error) {
+	var threads []*ThreadRecord
+	err := db.Table("threads").
+		Select(`
+			threads.id, threads.post_no, sessions.user_id, threads.title, threads.content,
+			threads.author_nickname, threads.created_at, threads.updated_at,
+			threads_activity.bump_at, threads.archived_at, threads.edited_at,
+			threads.deleted_at, threads.deleted_by
+		`).
+		Joins("JOIN sessions ON sessions.id = threads.created_by_session_id").
+		Joins("LEFT JOIN threads_activity ON threads_activity.thread_id = threads.id").
+		Where("threads.board_id = ? AND threads.id > ?", boardID, afterID).
+		Order("threads.id").
+		Limit(exportBatch).
+		Scan(&threads).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load threads: %w", err)
+	}
+	return threads, nil
+}
+
+// writeBatch writes each thread of the batch followed by its messages, each
+// post followed by its attachments.
+func (s *service) writeBatch(db *gorm.DB, enc *json.Encoder, threads []*ThreadRecord, result *ExportResult) error {
+	threadIDs := make([]uint64, len(threads))
+	for i, t := range threads {
+		threadIDs[i] = t.ID
+	}
+
+	var messages []*MessageRecord
+	err := db.Table("messages").
+		Select(`
+			messages.id, messages.thread_id, messages.post_no, messages.parent_id, sessions.user_id,
+			messages.content, messages.author_nickname, messages.is_author,
+			messages.created_at, messages.updated_at, messages.deleted_at, messages.deleted_by
+		`).
+		Joins("JOIN sessions ON sessions.id = messages.created_by_session_id").
+		Where("messages.thread_id IN ?", threadIDs).
+		Order("messages.thread_id, messages.id").
+		Scan(&messages).Error
+	if err != nil {
+		return fmt.Errorf("failed to load messages: %w", err)
+	}
+	messageIDs := make([]uint64, len(messages))
+	byThread := make(map[uint64][]*MessageRecord, len(threads))
+	for i, m := range messages {
+		messageIDs[i] = m.ID
+		byThread[m.ThreadID] = append(byThread[m.ThreadID], m)
+	}
+
+	// An empty IN list matches nothing.
+	var attachments []*AttachmentRecord
+	err = db.Table("attachments").
+		Select("id, thread_id, message_id, file_name, file_url, file_size, content_type, object_name, missing_at, created_at").
+		Where("thread_id IN ? OR message_id IN ?", threadIDs, messageIDs).
+		Order("id").
+		Scan(&attachments).Error
+	if err != nil {
+		return fmt.Errorf("failed to load attachments: %w", err)
+	}
+	ofThread := make(map[uint64][]*AttachmentRecord)
+	ofMessage := make(map[uint64][]*AttachmentRecord)
+	for _, a := range attachments {
+		switch {
+		case a.MessageID != nil:
+			ofMessage[*a.MessageID] = append(ofMessage[*a.MessageID], a)
+		case a.ThreadID != nil:
+			ofThread[*a.ThreadID] = append(ofThread[*a.ThreadID], a)
+		}
+	}
+
+	writeAttachments := func(list []*AttachmentRecord) error {
+		for _, a := range list {
+			if err := enc.Encode(Record{Kind: KindAttachment, Attachment: a}); err != nil {
+				return err
+			}
+			result.Attachments++
+		}
+		return nil
+	}
+	for _, t := range threads {
+		if err := enc.Encode(Record{Kind: KindThread, Thread: t}); err != nil {
+			return err
+		}
+		result.Threads++
+		if err := writeAttachments(ofThread[t.ID]); err != nil {
+			return err
+		}
+		for _, m := range byThread[t.ID] {
+			if err := enc.Encode(Record{Kind: KindMessage, Message: m}); err != nil {
+				return err
+			}
+			result.Messages++
+			if err := writeAttachments(ofMessage[m.ID]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
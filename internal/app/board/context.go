@@ -0,0 +1,17 @@
+package board
+
+import "github.com/gin-gonic/gin"
+
+const moderatorContextKey = "board_moderator"
+
+// SetModerator records who the moderator middleware let through: "admin"
+// for the admin API key or "user:<id>" for a board moderator.
+func SetModerator(c *gin.Context, who string) {
+	c.Set(moderatorContextKey, who)
+}
+
+// ModeratorFrom is who SetModerator recorded, for audit columns such as
+// deleted_by.
+func ModeratorFrom(c *gin.Context) string {
+	return c.GetString(moderatorContextKey)
+}
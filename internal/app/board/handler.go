@@ -1,7 +1,11 @@
 package board
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+
+	"backend/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -9,6 +13,21 @@ import (
 type Handler interface {
 	GetAllBoards(c *gin.Context)
 	GetBoardBySlug(c *gin.Context)
+	CreateBoard(c *gin.Context)
+	UpdateBoard(c *gin.Context)
+	GetBoardHistory(c *gin.Context)
+	RetireBoard(c *gin.Context)
+	ReactivateBoard(c *gin.Context)
+
+	GetRules(c *gin.Context)
+	AddRule(c *gin.Context)
+	UpdateRule(c *gin.Context)
+	DeleteRule(c *gin.Context)
+	ReplaceRules(c *gin.Context)
+
+	GetModerators(c *gin.Context)
+	AddModerator(c *gin.Context)
+	RemoveModerator(c *gin.Context)
 }
 
 type handler struct {
@@ -20,16 +39,17 @@ func NewHandler(service Service) Handler {
 }
 
 // @Summary Get all boards
-// @Description Get a list of all available boards
+// @Description Get a list of all available boards. Retired boards are left out unless include_retired is true.
 // @Tags Board
 // @Accept json
 // @Produce json
+// @Param include_retired query bool false "Include retired boards" default(false)
 // @Success 200 {object} BoardListResponse
 // @Router /api/boards [get]
 func (h *handler) GetAllBoards(c *gin.Context) {
-	boards, err := h.service.GetAllBoards()
+	boards, err := h.service.GetAllBoards(c.Query("include_retired") == "true")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to fetch boards"})
+		utils.RespondError(c, http.StatusInternalServerError, "failed to fetch boards")
 		return
 	}
 	c.JSON(http.StatusOK, BoardListResponse{Boards: boards})
@@ -48,8 +68,332 @@ func (h *handler) GetBoardBySlug(c *gin.Context) {
 	slug := c.Param("slug")
 	board, err := h.service.GetBoardBySlug(slug)
 	if err != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "board not found"})
+		utils.WriteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, board)
+}
+
+// @Summary Create board
+// @Description Create a board. The slug is 1 to 16 lowercase latin letters or digits and must be unused. Connected clients get a board_created event.
+// @Tags Board
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body CreateBoardRequest true "Board"
+// @Success 201 {object} Board
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/admin/boards [post]
+func (h *handler) CreateBoard(c *gin.Context) {
+	var req CreateBoardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	board, err := h.service.CreateBoard(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, ErrSlugTaken) {
+			utils.RespondError(c, http.StatusConflict, err.Error())
+			return
+		}
+		utils.WriteError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, board)
+}
+
+// @Summary Update board
+// @Description Change a board's title, description and limits. version must be the board's current version; limits listed in reset drop back to the site-wide value. Changes apply at once on every instance and are recorded in the board history.
+// @Tags Board
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param slug path string true "Board slug"
+// @Param request body UpdateBoardRequest true "Changes"
+// @Success 200 {object} Board
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/admin/boards/{slug} [patch]
+func (h *handler) UpdateBoard(c *gin.Context) {
+	var req UpdateBoardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	board, err := h.service.UpdateBoard(c.Request.Context(), c.Param("slug"), req)
+	if err != nil {
+		if errors.Is(err, ErrVersionConflict) {
+			utils.RespondError(c, http.StatusConflict, err.Error())
+			return
+		}
+		utils.WriteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, board)
+}
+
+// @Summary Get board history
+// @Description List the latest admin edits of a board, newest first
+// @Tags Board
+// @Produce json
+// @Security ApiKeyAuth
+// @Param slug path string true "Board slug"
+// @Success 200 {object} BoardHistoryResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/admin/boards/{slug}/history [get]
+func (h *handler) GetBoardHistory(c *gin.Context) {
+	changes, err := h.service.GetBoardHistory(c.Param("slug"))
+	if err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, BoardHistoryResponse{Changes: changes})
+}
+
+// @Summary Retire board
+// @Description Retire a board: it stays readable but takes no new threads or messages and is left out of the board list
+// @Tags Board
+// @Produce json
+// @Security ApiKeyAuth
+// @Param slug path string true "Board slug"
+// @Success 200 {object} Board
+// @Failure 404 {object} ErrorResponse
+// @Router /api/admin/boards/{slug}/retire [post]
+func (h *handler) RetireBoard(c *gin.Context) {
+	h.setRetired(c, true)
+}
+
+// @Summary Reactivate board
+// @Description Bring a retired board back
+// @Tags Board
+// @Produce json
+// @Security ApiKeyAuth
+// @Param slug path string true "Board slug"
+// @Success 200 {object} Board
+// @Failure 404 {object} ErrorResponse
+// @Router /api/admin/boards/{slug}/reactivate [post]
+func (h *handler) ReactivateBoard(c *gin.Context) {
+	h.setRetired(c, false)
+}
+
+func (h *handler) setRetired(c *gin.Context, retired bool) {
+	board, err := h.service.SetRetired(c.Request.Context(), c.Param("slug"), retired)
+	if err != nil {
+		utils.WriteError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, board)
 }
+
+// @Summary Get board rules
+// @Description Get the board's rules in display order
+// @Tags Board
+// @Produce json
+// @Param slug path string true "Board slug"
+// @Success 200 {object} RulesResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/boards/{slug}/rules [get]
+func (h *handler) GetRules(c *gin.Context) {
+	rules, err := h.service.GetRules(c.Param("slug"))
+	if err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, RulesResponse{Rules: rules})
+}
+
+// @Summary Add board rule
+// @Description Append a rule to the board's rules. Needs the admin API key or a session of one of the board's moderators.
+// @Tags Board
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param slug path string true "Board slug"
+// @Param request body RuleRequest true "Rule"
+// @Success 201 {object} Rule
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/boards/{slug}/rules [post]
+func (h *handler) AddRule(c *gin.Context) {
+	var req RuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	rule, err := h.service.AddRule(c.Request.Context(), c.Param("slug"), req.Text)
+	if err != nil {
+		if errors.Is(err, ErrRuleLimit) {
+			utils.RespondError(c, http.StatusConflict, err.Error())
+			return
+		}
+		utils.WriteError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+// @Summary Edit board rule
+// @Description Change the text of one of the board's rules. Needs the admin API key or a session of one of the board's moderators.
+// @Tags Board
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param slug path string true "Board slug"
+// @Param id path int true "Rule ID"
+// @Param request body RuleRequest true "Rule"
+// @Success 200 {object} Rule
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/boards/{slug}/rules/{id} [patch]
+func (h *handler) UpdateRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid rule ID")
+		return
+	}
+	var req RuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	rule, err := h.service.UpdateRule(c.Request.Context(), c.Param("slug"), id, req.Text)
+	if err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// @Summary Delete board rule
+// @Description Delete one of the board's rules. Needs the admin API key or a session of one of the board's moderators.
+// @Tags Board
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param slug path string true "Board slug"
+// @Param id path int true "Rule ID"
+// @Success 204
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/boards/{slug}/rules/{id} [delete]
+func (h *handler) DeleteRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid rule ID")
+		return
+	}
+
+	if err := h.service.DeleteRule(c.Request.Context(), c.Param("slug"), id); err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Replace board rules
+// @Description Replace the board's rules with the given texts in the given order; this is also how rules are reordered. Needs the admin API key or a session of one of the board's moderators.
+// @Tags Board
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param slug path string true "Board slug"
+// @Param request body ReplaceRulesRequest true "Rules"
+// @Success 200 {object} RulesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/boards/{slug}/rules [put]
+func (h *handler) ReplaceRules(c *gin.Context) {
+	var req ReplaceRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	rules, err := h.service.ReplaceRules(c.Request.Context(), c.Param("slug"), req.Rules)
+	if err != nil {
+		if errors.Is(err, ErrRuleLimit) {
+			utils.RespondError(c, http.StatusConflict, err.Error())
+			return
+		}
+		utils.WriteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, RulesResponse{Rules: rules})
+}
+
+// @Summary List board moderators
+// @Description List the users who moderate the board
+// @Tags Board
+// @Produce json
+// @Security ApiKeyAuth
+// @Param slug path string true "Board slug"
+// @Success 200 {object} ModeratorListResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/admin/boards/{slug}/moderators [get]
+func (h *handler) GetModerators(c *gin.Context) {
+	moderators, err := h.service.GetModerators(c.Param("slug"))
+	if err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ModeratorListResponse{Moderators: moderators})
+}
+
+// @Summary Add board moderator
+// @Description Make a user a moderator of the board
+// @Tags Board
+// @Security ApiKeyAuth
+// @Param slug path string true "Board slug"
+// @Param user_id path int true "User ID"
+// @Success 204
+// @Failure 404 {object} ErrorResponse
+// @Router /api/admin/boards/{slug}/moderators/{user_id} [put]
+func (h *handler) AddModerator(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid user ID")
+		return
+	}
+
+	if err := h.service.AddModerator(c.Param("slug"), userID); err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Remove board moderator
+// @Description Take a user's moderator rights on the board away
+// @Tags Board
+// @Security ApiKeyAuth
+// @Param slug path string true "Board slug"
+// @Param user_id path int true "User ID"
+// @Success 204
+// @Failure 404 {object} ErrorResponse
+// @Router /api/admin/boards/{slug}/moderators/{user_id} [delete]
+func (h *handler) RemoveModerator(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid user ID")
+		return
+	}
+
+	if err := h.service.RemoveModerator(c.Param("slug"), userID); err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
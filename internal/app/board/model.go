@@ -1,6 +1,13 @@
 package board
 
-import "time"
+import (
+	"strings"
+	"time"
+
+	"backend/internal/app/markup"
+	"backend/internal/providers/minio"
+	"backend/internal/utils"
+)
 
 type Board struct {
 	ID          uint64    `json:"id" gorm:"primaryKey"`
@@ -9,12 +16,270 @@ type Board struct {
 	Description *string   `json:"description,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+
+	AllowedContentTypes *string `json:"allowed_content_types,omitempty" gorm:"type:text"`
+	MaxFileSize         *int64  `json:"max_file_size,omitempty"`
+	MaxFilesPerPost     *int    `json:"max_files_per_post,omitempty"`
+
+	// Unset limits fall back to the runtime setting of the same name.
+	ThreadCooldownSeconds  *int `json:"thread_cooldown_seconds,omitempty"`
+	MessageCooldownSeconds *int `json:"message_cooldown_seconds,omitempty"`
+	BumpLimit              *int `json:"bump_limit,omitempty"`
+	// MaxThreads caps the board's live threads; a new thread past the cap
+	// archives the least recently bumped ones.
+	MaxThreads       *int    `json:"max_threads,omitempty"`
+	MaxMessageLength *int    `json:"max_message_length,omitempty"`
+	DefaultSort      *string `json:"default_sort,omitempty"`
+	// ArchiveRetentionDays is how long archived threads are kept before the
+	// purge job deletes them; 0 keeps them forever. Unset boards use
+	// ARCHIVE_RETENTION.
+	ArchiveRetentionDays *int `json:"archive_retention_days,omitempty"`
+	IsNSFW               bool `json:"is_nsfw" gorm:"column:is_nsfw;not null;default:false"`
+	// IsReadOnly boards can be browsed but take no new threads or messages.
+	IsReadOnly bool `json:"is_readonly" gorm:"column:is_readonly;not null;default:false"`
+	// MathEnabled boards return $...$ in new posts as math segments.
+	MathEnabled bool `json:"math_enabled" gorm:"not null;default:false"`
+	// ProxyPolicy is what the board does with posts from Tor exits and
+	// datacenter networks; unset boards use the proxy_policy setting.
+	ProxyPolicy *string `json:"proxy_policy,omitempty"`
+	// RetiredAt is set on boards an admin retired: they stay readable, take
+	// no new posts and are left out of the board list unless asked for.
+	RetiredAt *time.Time `json:"retired_at,omitempty" gorm:"index"`
+
+	// Version goes up with every admin edit; an edit must name the version it
+	// was made against.
+	Version int `json:"version" gorm:"not null;default:1"`
+
+	// LastPostNo is the number given to the board's latest thread or
+	// message; see NextPostNo.
+	LastPostNo uint64 `json:"-" gorm:"not null;default:0"`
+}
+
+// PostingError tells why the board takes no new threads or messages, or
+// returns nil when it does.
+func (b *Board) PostingError() error {
+	switch {
+	case b.RetiredAt != nil:
+		return ErrRetired
+	case b.IsReadOnly:
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// Markup returns the markup the board's posts are parsed with.
+func (b *Board) Markup() markup.Options {
+	return markup.Options{Math: b.MathEnabled}
+}
+
+// ThreadCooldown returns the board's thread cooldown, or fallback when it
+// has none.
+func (b *Board) ThreadCooldown(fallback time.Duration) time.Duration {
+	if b.ThreadCooldownSeconds == nil {
+		return fallback
+	}
+	return time.Duration(*b.ThreadCooldownSeconds) * time.Second
+}
+
+// MessageCooldown returns the board's message cooldown, or fallback when it
+// has none.
+func (b *Board) MessageCooldown(fallback time.Duration) time.Duration {
+	if b.MessageCooldownSeconds == nil {
+		return fallback
+	}
+	return time.Duration(*b.MessageCooldownSeconds) * time.Second
+}
+
+// BumpLimitOr returns the board's bump limit, or fallback when it has none.
+func (b *Board) BumpLimitOr(fallback int) int {
+	if b.BumpLimit == nil {
+		return fallback
+	}
+	return *b.BumpLimit
+}
+
+// MessageLengthOr returns the board's longest allowed message in
+// characters, or fallback when it has none.
+func (b *Board) MessageLengthOr(fallback int) int {
+	if b.MaxMessageLength == nil {
+		return fallback
+	}
+	return *b.MaxMessageLength
+}
+
+// SortOr returns the order the board's thread list uses when the client
+// asks for none, or fallback when the board has no default.
+func (b *Board) SortOr(fallback string) string {
+	if b.DefaultSort == nil {
+		return fallback
+	}
+	return *b.DefaultSort
+}
+
+// ProxyPolicyOr returns the board's proxy policy, or fallback when it has
+// none.
+func (b *Board) ProxyPolicyOr(fallback string) string {
+	if b.ProxyPolicy == nil {
+		return fallback
+	}
+	return *b.ProxyPolicy
+}
+
+// OriginError tells why the board refuses a post from origin under its
+// proxy policy, or fallback when it has none, or returns nil when it takes
+// it.
+func (b *Board) OriginError(origin utils.Origin, fallback string) error {
+	if !origin.Anonymized() {
+		return nil
+	}
+	switch b.ProxyPolicyOr(fallback) {
+	case ProxyBlock:
+		return ErrProxyBlocked
+	case ProxyCaptcha:
+		if !origin.CaptchaPassed {
+			return ErrCaptchaRequired
+		}
+	}
+	return nil
+}
+
+// Proxy policies: posts from Tor and datacenter addresses are taken,
+// taken with a solved captcha, or refused.
+const (
+	ProxyAllow   = "allow"
+	ProxyCaptcha = "captcha"
+	ProxyBlock   = "block"
+)
+
+var ProxyPolicies = map[string]bool{ProxyAllow: true, ProxyCaptcha: true, ProxyBlock: true}
+
+// Sorts are the thread list orders a board can default to.
+var Sorts = map[string]bool{"new": true, "popular": true, "active": true, "trending": true}
+
+// FilePolicy overlays the board's own file limits on top of base, the
+// global ones.
+func (b *Board) FilePolicy(base minio.FilePolicy) minio.FilePolicy {
+	if b.MaxFileSize != nil && *b.MaxFileSize > 0 {
+		base.MaxFileSize = *b.MaxFileSize
+	}
+	if b.MaxFilesPerPost != nil && *b.MaxFilesPerPost > 0 {
+		base.MaxFiles = *b.MaxFilesPerPost
+	}
+	if types := b.ContentTypes(); types != nil {
+		base.AllowedContentTypes = types
+	}
+	return base
+}
+
+// ContentTypes returns the board's allowed content types, or nil when the
+// board has no restriction of its own.
+func (b *Board) ContentTypes() []string {
+	if b.AllowedContentTypes == nil || strings.TrimSpace(*b.AllowedContentTypes) == "" {
+		return nil
+	}
+	parts := strings.Split(*b.AllowedContentTypes, ",")
+	types := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			types = append(types, p)
+		}
+	}
+	return types
+}
+
+type CreateBoardRequest struct {
+	Slug        string  `json:"slug" binding:"required"`
+	Title       string  `json:"title" binding:"required"`
+	Description *string `json:"description,omitempty"`
+}
+
+// UpdateBoardRequest edits a board. Omitted fields are left as they are;
+// Reset names limits (by their JSON name) to drop back to the site-wide
+// value. An empty description or allowed_content_types clears it.
+type UpdateBoardRequest struct {
+	Version                int      `json:"version" binding:"required"`
+	Title                  *string  `json:"title,omitempty"`
+	Description            *string  `json:"description,omitempty"`
+	AllowedContentTypes    *string  `json:"allowed_content_types,omitempty"`
+	MaxFileSize            *int64   `json:"max_file_size,omitempty"`
+	MaxFilesPerPost        *int     `json:"max_files_per_post,omitempty"`
+	ThreadCooldownSeconds  *int     `json:"thread_cooldown_seconds,omitempty"`
+	MessageCooldownSeconds *int     `json:"message_cooldown_seconds,omitempty"`
+	BumpLimit              *int     `json:"bump_limit,omitempty"`
+	MaxThreads             *int     `json:"max_threads,omitempty"`
+	MaxMessageLength       *int     `json:"max_message_length,omitempty"`
+	DefaultSort            *string  `json:"default_sort,omitempty"`
+	ArchiveRetentionDays   *int     `json:"archive_retention_days,omitempty"`
+	IsNSFW                 *bool    `json:"is_nsfw,omitempty"`
+	IsReadOnly             *bool    `json:"is_readonly,omitempty"`
+	MathEnabled            *bool    `json:"math_enabled,omitempty"`
+	ProxyPolicy            *string  `json:"proxy_policy,omitempty"`
+	Reset                  []string `json:"reset,omitempty"`
+}
+
+// BoardChange records one admin edit of a board: the version it produced
+// and the old and new value of every field it changed.
+type BoardChange struct {
+	ID        uint64                 `json:"id" gorm:"primaryKey"`
+	BoardID   uint64                 `json:"board_id" gorm:"not null;index"`
+	Version   int                    `json:"version" gorm:"not null"`
+	Changes   map[string]FieldChange `json:"changes" gorm:"type:jsonb;serializer:json;not null"`
+	RequestID string                 `json:"request_id,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+type FieldChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+type BoardHistoryResponse struct {
+	Changes []*BoardChange `json:"changes"`
+}
+
+// Rule is one entry of a board's rules, shown in Position order.
+type Rule struct {
+	ID        uint64    `json:"id" gorm:"primaryKey"`
+	BoardID   uint64    `json:"board_id" gorm:"not null;index:idx_board_rules_board_position,priority:1"`
+	Position  int       `json:"position" gorm:"not null;index:idx_board_rules_board_position,priority:2"`
+	Text      string    `json:"text" gorm:"type:text;not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Rule) TableName() string {
+	return "board_rules"
+}
+
+// Moderator lets a user manage a board's rules.
+type Moderator struct {
+	BoardID   uint64    `json:"board_id" gorm:"primaryKey"`
+	UserID    uint64    `json:"user_id" gorm:"primaryKey;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (Moderator) TableName() string {
+	return "board_moderators"
+}
+
+type RuleRequest struct {
+	Text string `json:"text" binding:"required"`
+}
+
+type ReplaceRulesRequest struct {
+	Rules []string `json:"rules"`
+}
+
+type RulesResponse struct {
+	Rules []*Rule `json:"rules"`
+}
+
+type ModeratorListResponse struct {
+	Moderators []*Moderator `json:"moderators"`
 }
 
 type BoardListResponse struct {
 	Boards []*Board `json:"boards"`
 }
 
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
+type ErrorResponse = utils.ErrorResponse
@@ -1,10 +1,47 @@
 package board
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"backend/internal/db/resolver"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NextPostNo takes the next post number of the board, for a thread or
+// message about to be created in tx. The row lock it holds until tx ends
+// keeps numbers unique and in posting order, and a rolled back post gives
+// its number back.
+func NextPostNo(tx *gorm.DB, boardID uint64) (uint64, error) {
+	var postNo uint64
+	err := tx.Raw(`UPDATE boards SET last_post_no = last_post_no + 1 WHERE id = ? RETURNING last_post_no`, boardID).
+		Scan(&postNo).Error
+	if err == nil && postNo == 0 {
+		err = gorm.ErrRecordNotFound
+	}
+	return postNo, err
+}
 
 type Repository interface {
 	GetAllBoards() ([]*Board, error)
 	GetBoardBySlug(slug string) (*Board, error)
+	GetBoardByID(id uint64) (*Board, error)
+	CreateBoard(board *Board) (bool, error)
+	UpdateBoard(board *Board, version int, change *BoardChange) (bool, error)
+	GetBoardHistory(boardID uint64, limit int) ([]*BoardChange, error)
+
+	GetRules(boardID uint64) ([]*Rule, error)
+	CountRules(boardID uint64) (int64, error)
+	AddRule(boardID uint64, text string) (*Rule, error)
+	UpdateRule(boardID, id uint64, text string) (*Rule, error)
+	DeleteRule(boardID, id uint64) (bool, error)
+	ReplaceRules(boardID uint64, texts []string) ([]*Rule, error)
+
+	IsModerator(boardID, userID uint64) (bool, error)
+	GetModerators(boardID uint64) ([]*Moderator, error)
+	AddModerator(boardID, userID uint64) (bool, error)
+	RemoveModerator(boardID, userID uint64) (bool, error)
 }
 
 type repository struct {
@@ -17,7 +54,7 @@ func NewRepository(db *gorm.DB) Repository {
 
 func (r *repository) GetAllBoards() ([]*Board, error) {
 	var boards []*Board
-	err := r.db.
+	err := resolver.Read(r.db).
 		Order("created_at ASC").
 		Find(&boards).Error
 	return boards, err
@@ -25,6 +62,158 @@ func (r *repository) GetAllBoards() ([]*Board, error) {
 
 func (r *repository) GetBoardBySlug(slug string) (*Board, error) {
 	var board Board
-	err := r.db.Where("slug = ?", slug).First(&board).Error
+	err := resolver.Read(r.db).Where("slug = ?", slug).First(&board).Error
+	return &board, err
+}
+
+func (r *repository) GetBoardByID(id uint64) (*Board, error) {
+	var board Board
+	err := r.db.Where("id = ?", id).First(&board).Error
 	return &board, err
 }
+
+// CreateBoard inserts board and reports false, leaving board unsaved, when
+// its slug is already taken.
+func (r *repository) CreateBoard(board *Board) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "slug"}},
+		DoNothing: true,
+	}).Create(board)
+	return result.RowsAffected > 0, result.Error
+}
+
+// UpdateBoard writes board and records change, provided the stored board is
+// still at version. It reports false, writing nothing, when another edit got
+// there first.
+func (r *repository) UpdateBoard(board *Board, version int, change *BoardChange) (bool, error) {
+	updated := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Select writes the nil limits too, so a reset clears the column.
+		result := tx.Model(&Board{}).
+			Where("id = ? AND version = ?", board.ID, version).
+			Select(
+				"Title", "Description", "AllowedContentTypes", "MaxFileSize", "MaxFilesPerPost",
+				"ThreadCooldownSeconds", "MessageCooldownSeconds", "BumpLimit", "MaxThreads",
+				"MaxMessageLength", "DefaultSort", "ArchiveRetentionDays", "IsNSFW", "IsReadOnly", "MathEnabled", "ProxyPolicy", "RetiredAt",
+				"Version", "UpdatedAt",
+			).
+			Updates(board)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		updated = true
+		return tx.Create(change).Error
+	})
+	return updated, err
+}
+
+func (r *repository) GetBoardHistory(boardID uint64, limit int) ([]*BoardChange, error) {
+	var changes []*BoardChange
+	err := r.db.Where("board_id = ?", boardID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&changes).Error
+	return changes, err
+}
+
+func (r *repository) GetRules(boardID uint64) ([]*Rule, error) {
+	var rules []*Rule
+	err := r.db.Where("board_id = ?", boardID).
+		Order("position ASC, id ASC").
+		Find(&rules).Error
+	return rules, err
+}
+
+func (r *repository) CountRules(boardID uint64) (int64, error) {
+	var count int64
+	err := r.db.Model(&Rule{}).Where("board_id = ?", boardID).Count(&count).Error
+	return count, err
+}
+
+// AddRule appends a rule after the board's last one.
+func (r *repository) AddRule(boardID uint64, text string) (*Rule, error) {
+	rule := &Rule{BoardID: boardID, Text: text}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var last int
+		if err := tx.Model(&Rule{}).
+			Select("COALESCE(MAX(position), 0)").
+			Where("board_id = ?", boardID).
+			Scan(&last).Error; err != nil {
+			return err
+		}
+		rule.Position = last + 1
+		return tx.Create(rule).Error
+	})
+	return rule, err
+}
+
+func (r *repository) UpdateRule(boardID, id uint64, text string) (*Rule, error) {
+	result := r.db.Model(&Rule{}).
+		Where("id = ? AND board_id = ?", id, boardID).
+		Updates(map[string]interface{}{"text": text, "updated_at": time.Now()})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var rule Rule
+	err := r.db.Where("id = ?", id).First(&rule).Error
+	return &rule, err
+}
+
+func (r *repository) DeleteRule(boardID, id uint64) (bool, error) {
+	result := r.db.Where("id = ? AND board_id = ?", id, boardID).Delete(&Rule{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ReplaceRules swaps the board's rules for texts, numbered in their order.
+func (r *repository) ReplaceRules(boardID uint64, texts []string) ([]*Rule, error) {
+	rules := make([]*Rule, 0, len(texts))
+	for i, text := range texts {
+		rules = append(rules, &Rule{BoardID: boardID, Position: i + 1, Text: text})
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("board_id = ?", boardID).Delete(&Rule{}).Error; err != nil {
+			return err
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.Create(&rules).Error
+	})
+	return rules, err
+}
+
+func (r *repository) IsModerator(boardID, userID uint64) (bool, error) {
+	var count int64
+	err := r.db.Model(&Moderator{}).
+		Where("board_id = ? AND user_id = ?", boardID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *repository) GetModerators(boardID uint64) ([]*Moderator, error) {
+	var moderators []*Moderator
+	err := r.db.Where("board_id = ?", boardID).
+		Order("created_at ASC").
+		Find(&moderators).Error
+	return moderators, err
+}
+
+// AddModerator reports false when the user does not exist. Adding an
+// existing moderator again is not an error.
+func (r *repository) AddModerator(boardID, userID uint64) (bool, error) {
+	var exists bool
+	if err := r.db.Raw("SELECT EXISTS (SELECT 1 FROM users WHERE id = ?)", userID).Scan(&exists).Error; err != nil || !exists {
+		return false, err
+	}
+	err := r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&Moderator{BoardID: boardID, UserID: userID}).Error
+	return err == nil, err
+}
+
+func (r *repository) RemoveModerator(boardID, userID uint64) (bool, error) {
+	result := r.db.Where("board_id = ? AND user_id = ?", boardID, userID).Delete(&Moderator{})
+	return result.RowsAffected > 0, result.Error
+}
@@ -5,4 +5,31 @@ import "github.com/gin-gonic/gin"
 func RegisterRoutes(rg gin.IRoutes, handler Handler) {
 	rg.GET("/boards", handler.GetAllBoards)
 	rg.GET("/boards/:slug", handler.GetBoardBySlug)
+	rg.GET("/boards/:slug/rules", handler.GetRules)
+}
+
+// RegisterModRoutes registers the rule editing routes; rg must only let
+// board moderators and admins through.
+func RegisterModRoutes(rg *gin.RouterGroup, handler Handler) {
+	rules := rg.Group("/boards/:slug/rules")
+	{
+		rules.POST("", handler.AddRule)
+		rules.PUT("", handler.ReplaceRules)
+		rules.PATCH("/:id", handler.UpdateRule)
+		rules.DELETE("/:id", handler.DeleteRule)
+	}
+}
+
+func RegisterAdminRoutes(rg *gin.RouterGroup, handler Handler) {
+	boards := rg.Group("/boards")
+	{
+		boards.POST("", handler.CreateBoard)
+		boards.PATCH("/:slug", handler.UpdateBoard)
+		boards.GET("/:slug/history", handler.GetBoardHistory)
+		boards.POST("/:slug/retire", handler.RetireBoard)
+		boards.POST("/:slug/reactivate", handler.ReactivateBoard)
+		boards.GET("/:slug/moderators", handler.GetModerators)
+		boards.PUT("/:slug/moderators/:user_id", handler.AddModerator)
+		boards.DELETE("/:slug/moderators/:user_id", handler.RemoveModerator)
+	}
 }
@@ -1,22 +1,606 @@
 package board
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"backend/internal/providers/redis"
+	"backend/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// Boards change only through migrations and admin edits but are read on
+// nearly every request, so they are cached (Redis plus the in-process L1)
+// for longer than listings.
+const boardCacheTTL = 10 * time.Minute
+
+var (
+	// ErrSlugTaken is returned when a new board reuses an existing slug.
+	ErrSlugTaken = errors.New("board slug is already taken")
+	// ErrVersionConflict is returned when an edit names a version the board
+	// has already moved past.
+	ErrVersionConflict = errors.New("board was changed by someone else, reload it and retry")
+	// ErrReadOnly is returned when posting to a read-only board.
+	ErrReadOnly = errors.New("board is read-only")
+	// ErrRetired is returned when posting to a retired board. It wraps
+	// ErrReadOnly, which is what retiring makes a board.
+	ErrRetired = fmt.Errorf("board is retired: %w", ErrReadOnly)
+	// ErrProxyBlocked and ErrCaptchaRequired are returned when the board's
+	// proxy policy refuses a post from Tor or a datacenter.
+	ErrProxyBlocked    = &utils.PolicyError{Code: utils.CodeProxyBlocked, Message: "this board takes no posts from Tor, VPNs or hosting networks"}
+	ErrCaptchaRequired = &utils.PolicyError{Code: utils.CodeCaptcha, Message: "posts from Tor, VPNs or hosting networks need a solved captcha on this board"}
+	// ErrRuleLimit is returned when a board already has maxRules rules.
+	ErrRuleLimit = fmt.Errorf("a board can have at most %d rules", maxRules)
+)
+
+// Slugs end up in URLs and room names, so they are kept to short lowercase
+// latin letters and digits like the seeded boards.
+var slugPattern = regexp.MustCompile(`^[a-z0-9]{1,16}$`)
+
+const (
+	maxTitleLength       = 64
+	maxDescriptionLength = 500
+	maxCooldownSeconds   = 24 * 60 * 60
+	maxMessageLength     = 20000
+	boardHistoryLimit    = 100
+	maxRules             = 30
+	maxRuleLength        = 1000
+)
+
 type Service interface {
-	GetAllBoards() ([]*Board, error)
+	// GetAllBoards lists the boards, leaving out retired ones unless
+	// includeRetired is set.
+	GetAllBoards(includeRetired bool) ([]*Board, error)
 	GetBoardBySlug(slug string) (*Board, error)
+	GetBoardByID(id uint64) (*Board, error)
+	CreateBoard(ctx context.Context, req CreateBoardRequest) (*Board, error)
+	UpdateBoard(ctx context.Context, slug string, req UpdateBoardRequest) (*Board, error)
+	GetBoardHistory(slug string) ([]*BoardChange, error)
+	SetRetired(ctx context.Context, slug string, retired bool) (*Board, error)
+
+	GetRules(slug string) ([]*Rule, error)
+	AddRule(ctx context.Context, slug, text string) (*Rule, error)
+	UpdateRule(ctx context.Context, slug string, id uint64, text string) (*Rule, error)
+	DeleteRule(ctx context.Context, slug string, id uint64) error
+	ReplaceRules(ctx context.Context, slug string, texts []string) ([]*Rule, error)
+
+	IsModerator(slug string, userID uint64) (bool, error)
+	GetModerators(slug string) ([]*Moderator, error)
+	AddModerator(slug string, userID uint64) error
+	RemoveModerator(slug string, userID uint64) error
 }
 
 type service struct {
-	repo Repository
+	repo     Repository
+	redisP   *redis.RedisProvider
+	eventBus *utils.EventBus
 }
 
-func NewService(repo Repository) Service {
-	return &service{repo: repo}
+func NewService(repo Repository, redisP *redis.RedisProvider, eventBus *utils.EventBus) Service {
+	return &service{repo: repo, redisP: redisP, eventBus: eventBus}
 }
 
-func (s *service) GetAllBoards() ([]*Board, error) {
-	return s.repo.GetAllBoards()
+func (s *service) GetAllBoards(includeRetired bool) ([]*Board, error) {
+	var boards []*Board
+	err := s.cached("boards:all", &boards, func() (any, error) {
+		return s.repo.GetAllBoards()
+	})
+	if err != nil || includeRetired {
+		return boards, err
+	}
+	active := make([]*Board, 0, len(boards))
+	for _, b := range boards {
+		if b.RetiredAt == nil {
+			active = append(active, b)
+		}
+	}
+	return active, nil
 }
 
 func (s *service) GetBoardBySlug(slug string) (*Board, error) {
-	return s.repo.GetBoardBySlug(slug)
+	var board *Board
+	return board, s.cached("boards:slug:"+slug, &board, func() (any, error) {
+		return s.repo.GetBoardBySlug(slug)
+	})
+}
+
+func (s *service) GetBoardByID(id uint64) (*Board, error) {
+	var board *Board
+	return board, s.cached(fmt.Sprintf("boards:id:%d", id), &board, func() (any, error) {
+		return s.repo.GetBoardByID(id)
+	})
+}
+
+func (s *service) CreateBoard(ctx context.Context, req CreateBoardRequest) (*Board, error) {
+	slug := strings.TrimSpace(req.Slug)
+	if !slugPattern.MatchString(slug) {
+		return nil, utils.Invalid("slug", "slug must be 1 to 16 lowercase latin letters or digits")
+	}
+	title := strings.TrimSpace(req.Title)
+	if n := utf8.RuneCountInString(title); n < 1 || n > maxTitleLength {
+		return nil, utils.Invalid("title", "title must be between 1 and %d characters, got %d", maxTitleLength, n)
+	}
+	var description *string
+	if req.Description != nil {
+		if d := strings.TrimSpace(*req.Description); d != "" {
+			if n := utf8.RuneCountInString(d); n > maxDescriptionLength {
+				return nil, utils.Invalid("description", "description must be at most %d characters, got %d", maxDescriptionLength, n)
+			}
+			description = &d
+		}
+	}
+
+	board := &Board{Slug: slug, Title: title, Description: description, Version: 1}
+	created, err := s.repo.CreateBoard(board)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create board: %w", err)
+	}
+	if !created {
+		return nil, ErrSlugTaken
+	}
+
+	// The slug may have been looked up before and cached as missing.
+	s.redisP.CachedDel(ctx, "boards:all", "boards:slug:"+slug)
+
+	s.eventBus.PublishWithContext(ctx, utils.BoardCreated{
+		BoardID:     board.ID,
+		Slug:        board.Slug,
+		Title:       board.Title,
+		Description: board.Description,
+		CreatedAt:   board.CreatedAt,
+		Timestamp:   time.Now().Unix(),
+	})
+	return board, nil
+}
+
+// UpdateBoard applies req to the board and bumps its version. The new values
+// reach every instance once the board caches are dropped, without a restart.
+func (s *service) UpdateBoard(ctx context.Context, slug string, req UpdateBoardRequest) (*Board, error) {
+	current, err := s.freshBoard(slug)
+	if err != nil {
+		return nil, err
+	}
+	if req.Version != current.Version {
+		return nil, ErrVersionConflict
+	}
+
+	next := *current
+	if err := req.applyTo(&next); err != nil {
+		return nil, err
+	}
+	return s.save(ctx, current, &next)
+}
+
+// SetRetired retires the board, or brings a retired one back. It is an edit
+// like any other, so it bumps the version and shows up in the history.
+func (s *service) SetRetired(ctx context.Context, slug string, retired bool) (*Board, error) {
+	current, err := s.freshBoard(slug)
+	if err != nil {
+		return nil, err
+	}
+	if retired == (current.RetiredAt != nil) {
+		return current, nil
+	}
+
+	next := *current
+	next.RetiredAt = nil
+	if retired {
+		now := time.Now()
+		next.RetiredAt = &now
+	}
+	return s.save(ctx, current, &next)
+}
+
+// freshBoard reads the board past the cache, as edits must start from the
+// stored version.
+func (s *service) freshBoard(slug string) (*Board, error) {
+	board, err := s.repo.GetBoardBySlug(slug)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.NotFound("board")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get board: %w", err)
+	}
+	return board, nil
+}
+
+// save writes next over current with the next version, records the change
+// and drops the board caches on every instance.
+func (s *service) save(ctx context.Context, current, next *Board) (*Board, error) {
+	changes, err := diffBoards(current, next)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff board: %w", err)
+	}
+	if len(changes) == 0 {
+		return current, nil
+	}
+
+	next.Version = current.Version + 1
+	next.UpdatedAt = time.Now()
+	updated, err := s.repo.UpdateBoard(next, current.Version, &BoardChange{
+		BoardID:   current.ID,
+		Version:   next.Version,
+		Changes:   changes,
+		RequestID: utils.RequestIDFromContext(ctx),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update board: %w", err)
+	}
+	if !updated {
+		return nil, ErrVersionConflict
+	}
+
+	s.redisP.CachedDel(ctx, "boards:all", "boards:slug:"+current.Slug, fmt.Sprintf("boards:id:%d", current.ID))
+	return next, nil
+}
+
+func (s *service) GetBoardHistory(slug string) ([]*BoardChange, error) {
+	board, err := s.GetBoardBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := s.repo.GetBoardHistory(board.ID, boardHistoryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get board history: %w", err)
+	}
+	if changes == nil {
+		changes = []*BoardChange{}
+	}
+	return changes, nil
+}
+
+func (s *service) GetRules(slug string) ([]*Rule, error) {
+	board, err := s.GetBoardBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*Rule
+	err = s.cached(rulesCacheKey(board.ID), &rules, func() (any, error) {
+		rules, err := s.repo.GetRules(board.ID)
+		if rules == nil {
+			rules = []*Rule{}
+		}
+		return rules, err
+	})
+	return rules, err
+}
+
+func (s *service) AddRule(ctx context.Context, slug, text string) (*Rule, error) {
+	board, text, err := s.ruleTarget(slug, text)
+	if err != nil {
+		return nil, err
+	}
+	count, err := s.repo.CountRules(board.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count rules: %w", err)
+	}
+	if count >= maxRules {
+		return nil, ErrRuleLimit
+	}
+	rule, err := s.repo.AddRule(board.ID, text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add rule: %w", err)
+	}
+	s.redisP.CachedDel(ctx, rulesCacheKey(board.ID))
+	return rule, nil
+}
+
+func (s *service) UpdateRule(ctx context.Context, slug string, id uint64, text string) (*Rule, error) {
+	board, text, err := s.ruleTarget(slug, text)
+	if err != nil {
+		return nil, err
+	}
+	rule, err := s.repo.UpdateRule(board.ID, id, text)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.NotFound("rule")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update rule: %w", err)
+	}
+	s.redisP.CachedDel(ctx, rulesCacheKey(board.ID))
+	return rule, nil
+}
+
+func (s *service) DeleteRule(ctx context.Context, slug string, id uint64) error {
+	board, err := s.GetBoardBySlug(slug)
+	if err != nil {
+		return err
+	}
+	deleted, err := s.repo.DeleteRule(board.ID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete rule: %w", err)
+	}
+	if !deleted {
+		return utils.NotFound("rule")
+	}
+	s.redisP.CachedDel(ctx, rulesCacheKey(board.ID))
+	return nil
+}
+
+// ReplaceRules sets the board's whole rule list, which is also how rules are
+// reordered.
+func (s *service) ReplaceRules(ctx context.Context, slug string, texts []string) ([]*Rule, error) {
+	board, err := s.GetBoardBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+	if len(texts) > maxRules {
+		return nil, ErrRuleLimit
+	}
+	cleaned := make([]string, 0, len(texts))
+	for _, text := range texts {
+		text, err := validRule(text)
+		if err != nil {
+			return nil, err
+		}
+		cleaned = append(cleaned, text)
+	}
+	rules, err := s.repo.ReplaceRules(board.ID, cleaned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replace rules: %w", err)
+	}
+	s.redisP.CachedDel(ctx, rulesCacheKey(board.ID))
+	return rules, nil
+}
+
+// ruleTarget resolves the board a rule belongs to and validates its text.
+func (s *service) ruleTarget(slug, text string) (*Board, string, error) {
+	board, err := s.GetBoardBySlug(slug)
+	if err != nil {
+		return nil, "", err
+	}
+	text, err = validRule(text)
+	return board, text, err
+}
+
+func validRule(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if n := utf8.RuneCountInString(text); n < 1 || n > maxRuleLength {
+		return "", utils.Invalid("text", "rule text must be between 1 and %d characters, got %d", maxRuleLength, n)
+	}
+	return text, nil
+}
+
+func rulesCacheKey(boardID uint64) string {
+	return fmt.Sprintf("boards:rules:%d", boardID)
+}
+
+func (s *service) IsModerator(slug string, userID uint64) (bool, error) {
+	board, err := s.GetBoardBySlug(slug)
+	if err != nil {
+		return false, err
+	}
+	return s.repo.IsModerator(board.ID, userID)
+}
+
+func (s *service) GetModerators(slug string) ([]*Moderator, error) {
+	board, err := s.GetBoardBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+	moderators, err := s.repo.GetModerators(board.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get moderators: %w", err)
+	}
+	if moderators == nil {
+		moderators = []*Moderator{}
+	}
+	return moderators, nil
+}
+
+func (s *service) AddModerator(slug string, userID uint64) error {
+	board, err := s.GetBoardBySlug(slug)
+	if err != nil {
+		return err
+	}
+	added, err := s.repo.AddModerator(board.ID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to add moderator: %w", err)
+	}
+	if !added {
+		return utils.NotFound("user")
+	}
+	return nil
+}
+
+func (s *service) RemoveModerator(slug string, userID uint64) error {
+	board, err := s.GetBoardBySlug(slug)
+	if err != nil {
+		return err
+	}
+	removed, err := s.repo.RemoveModerator(board.ID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove moderator: %w", err)
+	}
+	if !removed {
+		return utils.NotFound("moderator")
+	}
+	return nil
+}
+
+// applyTo validates req and lays it over b.
+func (req UpdateBoardRequest) applyTo(b *Board) error {
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if n := utf8.RuneCountInString(title); n < 1 || n > maxTitleLength {
+			return utils.Invalid("title", "title must be between 1 and %d characters, got %d", maxTitleLength, n)
+		}
+		b.Title = title
+	}
+	if req.Description != nil {
+		b.Description = nil
+		if d := strings.TrimSpace(*req.Description); d != "" {
+			if n := utf8.RuneCountInString(d); n > maxDescriptionLength {
+				return utils.Invalid("description", "description must be at most %d characters, got %d", maxDescriptionLength, n)
+			}
+			b.Description = &d
+		}
+	}
+	if req.AllowedContentTypes != nil {
+		b.AllowedContentTypes = nil
+		if t := strings.TrimSpace(*req.AllowedContentTypes); t != "" {
+			b.AllowedContentTypes = &t
+		}
+	}
+	if req.IsNSFW != nil {
+		b.IsNSFW = *req.IsNSFW
+	}
+	if req.IsReadOnly != nil {
+		b.IsReadOnly = *req.IsReadOnly
+	}
+	if req.MathEnabled != nil {
+		b.MathEnabled = *req.MathEnabled
+	}
+	if req.ProxyPolicy != nil {
+		if !ProxyPolicies[*req.ProxyPolicy] {
+			return utils.Invalid("proxy_policy", "proxy_policy must be allow, captcha or block, got %q", *req.ProxyPolicy)
+		}
+		policy := *req.ProxyPolicy
+		b.ProxyPolicy = &policy
+	}
+	if req.DefaultSort != nil {
+		if !Sorts[*req.DefaultSort] {
+			return utils.Invalid("default_sort", "default_sort must be new, popular or active, got %q", *req.DefaultSort)
+		}
+		sort := *req.DefaultSort
+		b.DefaultSort = &sort
+	}
+
+	checks := []struct {
+		field string
+		value *int
+		min   int
+		max   int
+		dst   **int
+	}{
+		{"max_files_per_post", req.MaxFilesPerPost, 1, 0, &b.MaxFilesPerPost},
+		{"thread_cooldown_seconds", req.ThreadCooldownSeconds, 0, maxCooldownSeconds, &b.ThreadCooldownSeconds},
+		{"message_cooldown_seconds", req.MessageCooldownSeconds, 0, maxCooldownSeconds, &b.MessageCooldownSeconds},
+		{"bump_limit", req.BumpLimit, 0, 0, &b.BumpLimit},
+		{"max_threads", req.MaxThreads, 1, 0, &b.MaxThreads},
+		{"max_message_length", req.MaxMessageLength, 1, maxMessageLength, &b.MaxMessageLength},
+		{"archive_retention_days", req.ArchiveRetentionDays, 0, 0, &b.ArchiveRetentionDays},
+	}
+	for _, c := range checks {
+		if c.value == nil {
+			continue
+		}
+		v := *c.value
+		if v < c.min || (c.max > 0 && v > c.max) {
+			if c.max > 0 {
+				return utils.Invalid(c.field, "%s must be between %d and %d, got %d", c.field, c.min, c.max, v)
+			}
+			return utils.Invalid(c.field, "%s must be at least %d, got %d", c.field, c.min, v)
+		}
+		*c.dst = &v
+	}
+	if req.MaxFileSize != nil {
+		if *req.MaxFileSize <= 0 {
+			return utils.Invalid("max_file_size", "max_file_size must be greater than zero, got %d", *req.MaxFileSize)
+		}
+		size := *req.MaxFileSize
+		b.MaxFileSize = &size
+	}
+
+	for _, name := range req.Reset {
+		switch name {
+		case "allowed_content_types":
+			b.AllowedContentTypes = nil
+		case "max_file_size":
+			b.MaxFileSize = nil
+		case "max_files_per_post":
+			b.MaxFilesPerPost = nil
+		case "thread_cooldown_seconds":
+			b.ThreadCooldownSeconds = nil
+		case "message_cooldown_seconds":
+			b.MessageCooldownSeconds = nil
+		case "bump_limit":
+			b.BumpLimit = nil
+		case "max_threads":
+			b.MaxThreads = nil
+		case "max_message_length":
+			b.MaxMessageLength = nil
+		case "default_sort":
+			b.DefaultSort = nil
+		case "archive_retention_days":
+			b.ArchiveRetentionDays = nil
+		case "proxy_policy":
+			b.ProxyPolicy = nil
+		default:
+			return utils.Invalid("reset", "%q is not a board limit that can be reset", name)
+		}
+	}
+	return nil
+}
+
+// diffBoards returns the JSON fields that differ between old and new, with
+// both values, leaving out the bookkeeping ones.
+func diffBoards(old, new *Board) (map[string]FieldChange, error) {
+	before, err := boardFields(old)
+	if err != nil {
+		return nil, err
+	}
+	after, err := boardFields(new)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]FieldChange)
+	for _, fields := range []map[string]any{before, after} {
+		for name := range fields {
+			if _, seen := changes[name]; seen || name == "updated_at" || name == "version" {
+				continue
+			}
+			a, _ := json.Marshal(before[name])
+			b, _ := json.Marshal(after[name])
+			if string(a) != string(b) {
+				changes[name] = FieldChange{Old: before[name], New: after[name]}
+			}
+		}
+	}
+	return changes, nil
+}
+
+func boardFields(b *Board) (map[string]any, error) {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	return fields, json.Unmarshal(data, &fields)
+}
+
+// cached decodes key into dst, or calls load, caches its result and decodes
+// that. A missing board is cached briefly as well; other errors are not.
+func (s *service) cached(key string, dst any, load func() (any, error)) error {
+	ctx := context.Background()
+	data, err := s.redisP.CachedGet(ctx, key)
+	if data == redis.NotFound {
+		return utils.NotFound("board")
+	}
+	if err == nil && json.Unmarshal([]byte(data), dst) == nil {
+		return nil
+	}
+
+	value, err := load()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		s.redisP.CachedSet(ctx, key, []byte(redis.NotFound), redis.NotFoundTTL)
+		return utils.NotFound("board")
+	}
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.redisP.CachedSet(ctx, key, buf, boardCacheTTL)
+	return json.Unmarshal(buf, dst)
 }
@@ -0,0 +1,224 @@
+package bookmark
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"backend/internal/app/session"
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	List(c *gin.Context)
+	Feed(c *gin.Context)
+	AddThread(c *gin.Context)
+	RemoveThread(c *gin.Context)
+	AddBoard(c *gin.Context)
+	RemoveBoard(c *gin.Context)
+}
+
+type handler struct {
+	service    Service
+	sessionSvc session.Service
+}
+
+func NewHandler(service Service, sessionSvc session.Service) Handler {
+	return &handler{
+		service:    service,
+		sessionSvc: sessionSvc,
+	}
+}
+
+// @Summary List bookmarks
+// @Description Get the threads and boards the current user bookmarked
+// @Tags Bookmark
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} BookmarksResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/bookmarks [get]
+func (h *handler) List(c *gin.Context) {
+	userID, ok := h.currentUserID(c)
+	if !ok {
+		return
+	}
+
+	bookmarks, err := h.service.List(userID)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get bookmarks")
+		return
+	}
+	c.JSON(http.StatusOK, bookmarks)
+}
+
+// @Summary Get favorites feed
+// @Description Get the latest replies in the current user's bookmarked threads, newest first
+// @Tags Bookmark
+// @Produce json
+// @Security BearerAuth
+// @Param before_id query int false "Return replies older than this message ID (next_before_id of the previous page)"
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} FeedResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /api/bookmarks/feed [get]
+func (h *handler) Feed(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	var beforeID *uint64
+	if raw := c.Query("before_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			utils.RespondError(c, http.StatusBadRequest, "invalid before_id")
+			return
+		}
+		beforeID = &id
+	}
+
+	userID, ok := h.currentUserID(c)
+	if !ok {
+		return
+	}
+
+	feed, err := h.service.Feed(userID, beforeID, limit)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get favorites feed")
+		return
+	}
+	c.JSON(http.StatusOK, feed)
+}
+
+// @Summary Bookmark a thread
+// @Description Add a thread to the current user's bookmarks and favorites feed
+// @Tags Bookmark
+// @Produce json
+// @Param thread_id path int true "Thread ID"
+// @Security BearerAuth
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/bookmarks/threads/{thread_id} [post]
+func (h *handler) AddThread(c *gin.Context) {
+	threadID, ok := parseID(c, "thread_id", "invalid thread ID")
+	if !ok {
+		return
+	}
+	userID, ok := h.currentUserID(c)
+	if !ok {
+		return
+	}
+
+	h.respond(c, h.service.AddThread(userID, threadID))
+}
+
+// @Summary Remove a thread bookmark
+// @Description Remove a thread from the current user's bookmarks
+// @Tags Bookmark
+// @Produce json
+// @Param thread_id path int true "Thread ID"
+// @Security BearerAuth
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Router /api/bookmarks/threads/{thread_id} [delete]
+func (h *handler) RemoveThread(c *gin.Context) {
+	threadID, ok := parseID(c, "thread_id", "invalid thread ID")
+	if !ok {
+		return
+	}
+	userID, ok := h.currentUserID(c)
+	if !ok {
+		return
+	}
+
+	h.respond(c, h.service.RemoveThread(userID, threadID))
+}
+
+// @Summary Bookmark a board
+// @Description Add a board to the current user's bookmarks
+// @Tags Bookmark
+// @Produce json
+// @Param board_id path int true "Board ID"
+// @Security BearerAuth
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/bookmarks/boards/{board_id} [post]
+func (h *handler) AddBoard(c *gin.Context) {
+	boardID, ok := parseID(c, "board_id", "invalid board ID")
+	if !ok {
+		return
+	}
+	userID, ok := h.currentUserID(c)
+	if !ok {
+		return
+	}
+
+	h.respond(c, h.service.AddBoard(userID, boardID))
+}
+
+// @Summary Remove a board bookmark
+// @Description Remove a board from the current user's bookmarks
+// @Tags Bookmark
+// @Produce json
+// @Param board_id path int true "Board ID"
+// @Security BearerAuth
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Router /api/bookmarks/boards/{board_id} [delete]
+func (h *handler) RemoveBoard(c *gin.Context) {
+	boardID, ok := parseID(c, "board_id", "invalid board ID")
+	if !ok {
+		return
+	}
+	userID, ok := h.currentUserID(c)
+	if !ok {
+		return
+	}
+
+	h.respond(c, h.service.RemoveBoard(userID, boardID))
+}
+
+func (h *handler) respond(c *gin.Context, err error) {
+	if err != nil {
+		if errors.Is(err, ErrBookmarkLimit) {
+			utils.RespondError(c, http.StatusConflict, err.Error())
+			return
+		}
+		utils.WriteError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *handler) currentUserID(c *gin.Context) (uint64, bool) {
+	sessionKey := session.Key(c)
+	if sessionKey == "" {
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
+		return 0, false
+	}
+
+	user, err := h.sessionSvc.GetUserBySessionKey(sessionKey)
+	if err != nil {
+		utils.RespondError(c, http.StatusNotFound, "user not found")
+		return 0, false
+	}
+	return user.ID, true
+}
+
+func parseID(c *gin.Context, param, message string) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param(param), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, message)
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,71 @@
+package bookmark
+
+import (
+	"time"
+
+	"backend/internal/utils"
+)
+
+type ThreadBookmark struct {
+	ID        uint64    `gorm:"primaryKey"`
+	UserID    uint64    `gorm:"not null;uniqueIndex:idx_thread_bookmarks_user_thread"`
+	ThreadID  uint64    `gorm:"not null;uniqueIndex:idx_thread_bookmarks_user_thread;index"`
+	CreatedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP"`
+}
+
+func (ThreadBookmark) TableName() string {
+	return "thread_bookmarks"
+}
+
+type BoardBookmark struct {
+	ID        uint64    `gorm:"primaryKey"`
+	UserID    uint64    `gorm:"not null;uniqueIndex:idx_board_bookmarks_user_board"`
+	BoardID   uint64    `gorm:"not null;uniqueIndex:idx_board_bookmarks_user_board;index"`
+	CreatedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP"`
+}
+
+func (BoardBookmark) TableName() string {
+	return "board_bookmarks"
+}
+
+type BookmarkedThread struct {
+	ThreadID     uint64     `json:"thread_id"`
+	BoardSlug    string     `json:"board_slug"`
+	Title        string     `json:"title"`
+	MessageCount int        `json:"message_count"`
+	BumpAt       *time.Time `json:"bump_at,omitempty"`
+	ArchivedAt   *time.Time `json:"archived_at,omitempty"`
+	BookmarkedAt time.Time  `json:"bookmarked_at"`
+}
+
+type BookmarkedBoard struct {
+	BoardID      uint64    `json:"board_id"`
+	Slug         string    `json:"slug"`
+	Title        string    `json:"title"`
+	BookmarkedAt time.Time `json:"bookmarked_at"`
+}
+
+type BookmarksResponse struct {
+	Threads []*BookmarkedThread `json:"threads"`
+	Boards  []*BookmarkedBoard  `json:"boards"`
+}
+
+// FeedItem is a reply in a bookmarked thread.
+type FeedItem struct {
+	MessageID      uint64    `json:"message_id"`
+	ThreadID       uint64    `json:"thread_id"`
+	ThreadTitle    string    `json:"thread_title"`
+	BoardSlug      string    `json:"board_slug"`
+	AuthorNickname string    `json:"author_nickname"`
+	Excerpt        string    `json:"excerpt"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// FeedResponse lists feed items newest first; pass NextBeforeID as
+// before_id for the next page. It is nil on the last page.
+type FeedResponse struct {
+	Items        []*FeedItem `json:"items"`
+	NextBeforeID *uint64     `json:"next_before_id"`
+}
+
+type ErrorResponse = utils.ErrorResponse
@@ -0,0 +1,133 @@
+package bookmark
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository interface {
+	ThreadExists(threadID uint64) (bool, error)
+	BoardExists(boardID uint64) (bool, error)
+	AddThread(userID, threadID uint64) error
+	RemoveThread(userID, threadID uint64) error
+	CountThreads(userID uint64) (int64, error)
+	ListThreads(userID uint64) ([]*BookmarkedThread, error)
+	AddBoard(userID, boardID uint64) error
+	RemoveBoard(userID, boardID uint64) error
+	CountBoards(userID uint64) (int64, error)
+	ListBoards(userID uint64) ([]*BookmarkedBoard, error)
+	Feed(userID uint64, beforeID *uint64, limit int) ([]*FeedItem, error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) ThreadExists(threadID uint64) (bool, error) {
+	var exists bool
+	err := r.db.Raw("SELECT EXISTS (SELECT 1 FROM threads WHERE id = ?)", threadID).Scan(&exists).Error
+	return exists, err
+}
+
+func (r *repository) BoardExists(boardID uint64) (bool, error) {
+	var exists bool
+	err := r.db.Raw("SELECT EXISTS (SELECT 1 FROM boards WHERE id = ?)", boardID).Scan(&exists).Error
+	return exists, err
+}
+
+func (r *repository) AddThread(userID, threadID uint64) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&ThreadBookmark{UserID: userID, ThreadID: threadID}).Error
+}
+
+func (r *repository) RemoveThread(userID, threadID uint64) error {
+	return r.db.Where("user_id = ? AND thread_id = ?", userID, threadID).Delete(&ThreadBookmark{}).Error
+}
+
+func (r *repository) CountThreads(userID uint64) (int64, error) {
+	var count int64
+	err := r.db.Model(&ThreadBookmark{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *repository) ListThreads(userID uint64) ([]*BookmarkedThread, error) {
+	var threads []*BookmarkedThread
+	err := r.db.Table("thread_bookmarks").
+		Select(`
+			thread_bookmarks.thread_id,
+			boards.slug AS board_slug,
+			threads.title,
+			COALESCE(threads_activity.message_count, 0) AS message_count,
+			threads_activity.bump_at,
+			threads.archived_at,
+			thread_bookmarks.created_at AS bookmarked_at
+		`).
+		Joins("JOIN threads ON threads.id = thread_bookmarks.thread_id").
+		Joins("JOIN boards ON boards.id = threads.board_id").
+		Joins("LEFT JOIN threads_activity ON threads_activity.thread_id = threads.id").
+		Where("thread_bookmarks.user_id = ? AND threads.deleted_at IS NULL", userID).
+		Order("thread_bookmarks.created_at DESC").
+		Scan(&threads).Error
+	return threads, err
+}
+
+func (r *repository) AddBoard(userID, boardID uint64) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&BoardBookmark{UserID: userID, BoardID: boardID}).Error
+}
+
+func (r *repository) RemoveBoard(userID, boardID uint64) error {
+	return r.db.Where("user_id = ? AND board_id = ?", userID, boardID).Delete(&BoardBookmark{}).Error
+}
+
+func (r *repository) CountBoards(userID uint64) (int64, error) {
+	var count int64
+	err := r.db.Model(&BoardBookmark{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *repository) ListBoards(userID uint64) ([]*BookmarkedBoard, error) {
+	var boards []*BookmarkedBoard
+	err := r.db.Table("board_bookmarks").
+		Select(`
+			board_bookmarks.board_id,
+			boards.slug,
+			boards.title,
+			board_bookmarks.created_at AS bookmarked_at
+		`).
+		Joins("JOIN boards ON boards.id = board_bookmarks.board_id").
+		Where("board_bookmarks.user_id = ?", userID).
+		Order("boards.slug ASC").
+		Scan(&boards).Error
+	return boards, err
+}
+
+// Feed returns the newest replies in the user's bookmarked threads, walking
+// back from beforeID.
+func (r *repository) Feed(userID uint64, beforeID *uint64, limit int) ([]*FeedItem, error) {
+	query := r.db.Table("messages").
+		Select(`
+			messages.id AS message_id,
+			messages.thread_id,
+			threads.title AS thread_title,
+			boards.slug AS board_slug,
+			messages.author_nickname,
+			messages.content AS excerpt,
+			messages.created_at
+		`).
+		Joins("JOIN thread_bookmarks ON thread_bookmarks.thread_id = messages.thread_id AND thread_bookmarks.user_id = ?", userID).
+		Joins("JOIN threads ON threads.id = messages.thread_id").
+		Joins("JOIN boards ON boards.id = threads.board_id").
+		Where("messages.deleted_at IS NULL AND threads.deleted_at IS NULL")
+	if beforeID != nil {
+		query = query.Where("messages.id < ?", *beforeID)
+	}
+
+	var items []*FeedItem
+	err := query.Order("messages.id DESC").Limit(limit).Scan(&items).Error
+	return items, err
+}
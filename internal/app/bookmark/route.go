@@ -0,0 +1,15 @@
+package bookmark
+
+import "github.com/gin-gonic/gin"
+
+func RegisterRoutes(rg *gin.RouterGroup, handler Handler) {
+	bookmarks := rg.Group("/bookmarks")
+	{
+		bookmarks.GET("", handler.List)
+		bookmarks.GET("/feed", handler.Feed)
+		bookmarks.POST("/threads/:thread_id", handler.AddThread)
+		bookmarks.DELETE("/threads/:thread_id", handler.RemoveThread)
+		bookmarks.POST("/boards/:board_id", handler.AddBoard)
+		bookmarks.DELETE("/boards/:board_id", handler.RemoveBoard)
+	}
+}
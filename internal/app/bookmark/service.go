@@ -0,0 +1,128 @@
+package bookmark
+
+import (
+	"errors"
+	"fmt"
+
+	"backend/internal/utils"
+)
+
+const (
+	maxBookmarks      = 500
+	feedExcerptLength = 200
+)
+
+var ErrBookmarkLimit = errors.New("bookmark list is full")
+
+type Service interface {
+	List(userID uint64) (*BookmarksResponse, error)
+	AddThread(userID, threadID uint64) error
+	RemoveThread(userID, threadID uint64) error
+	AddBoard(userID, boardID uint64) error
+	RemoveBoard(userID, boardID uint64) error
+	Feed(userID uint64, beforeID *uint64, limit int) (*FeedResponse, error)
+}
+
+type service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	return &service{repo: repo}
+}
+
+func (s *service) List(userID uint64) (*BookmarksResponse, error) {
+	threads, err := s.repo.ListThreads(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bookmarked threads: %w", err)
+	}
+	boards, err := s.repo.ListBoards(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bookmarked boards: %w", err)
+	}
+	if threads == nil {
+		threads = []*BookmarkedThread{}
+	}
+	if boards == nil {
+		boards = []*BookmarkedBoard{}
+	}
+	return &BookmarksResponse{Threads: threads, Boards: boards}, nil
+}
+
+func (s *service) AddThread(userID, threadID uint64) error {
+	exists, err := s.repo.ThreadExists(threadID)
+	if err != nil {
+		return fmt.Errorf("failed to check thread: %w", err)
+	}
+	if !exists {
+		return utils.NotFound("thread")
+	}
+
+	count, err := s.repo.CountThreads(userID)
+	if err != nil {
+		return fmt.Errorf("failed to count bookmarks: %w", err)
+	}
+	if count >= maxBookmarks {
+		return fmt.Errorf("%w: at most %d threads", ErrBookmarkLimit, maxBookmarks)
+	}
+	return s.repo.AddThread(userID, threadID)
+}
+
+func (s *service) RemoveThread(userID, threadID uint64) error {
+	return s.repo.RemoveThread(userID, threadID)
+}
+
+func (s *service) AddBoard(userID, boardID uint64) error {
+	exists, err := s.repo.BoardExists(boardID)
+	if err != nil {
+		return fmt.Errorf("failed to check board: %w", err)
+	}
+	if !exists {
+		return utils.NotFound("board")
+	}
+
+	count, err := s.repo.CountBoards(userID)
+	if err != nil {
+		return fmt.Errorf("failed to count bookmarks: %w", err)
+	}
+	if count >= maxBookmarks {
+		return fmt.Errorf("%w: at most %d boards", ErrBookmarkLimit, maxBookmarks)
+	}
+	return s.repo.AddBoard(userID, boardID)
+}
+
+func (s *service) RemoveBoard(userID, boardID uint64) error {
+	return s.repo.RemoveBoard(userID, boardID)
+}
+
+// Feed returns a page of replies in the user's bookmarked threads, newest
+// first, with their content cut down to an excerpt.
+func (s *service) Feed(userID uint64, beforeID *uint64, limit int) (*FeedResponse, error) {
+	// One extra row tells whether there is another page.
+	items, err := s.repo.Feed(userID, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get favorites feed: %w", err)
+	}
+
+	resp := &FeedResponse{Items: items}
+	if len(items) > limit {
+		resp.Items = items[:limit]
+		next := resp.Items[limit-1].MessageID
+		resp.NextBeforeID = &next
+	}
+	if resp.Items == nil {
+		resp.Items = []*FeedItem{}
+	}
+	for _, item := range resp.Items {
+		item.Excerpt = excerpt(item.Excerpt, feedExcerptLength)
+	}
+	return resp, nil
+}
+
+func excerpt(content string, length int) string {
+	runes := []rune(content)
+	if len(runes) <= length {
+		return content
+	}
+	return string(runes[:length]) + "…"
+}
@@ -1,36 +1,75 @@
 package app
 
 import (
+	"context"
+	"os"
+	"time"
+
+	"backend/internal/app/announcement"
+	"backend/internal/app/antispam"
+	"backend/internal/app/apikey"
 	"backend/internal/app/attachment"
+	"backend/internal/app/backup"
 	"backend/internal/app/board"
+	"backend/internal/app/bookmark"
 	"backend/internal/app/cleanup"
+	"backend/internal/app/files"
+	"backend/internal/app/filter"
 	"backend/internal/app/health"
+	"backend/internal/app/ipreputation"
+	"backend/internal/app/linkpreview"
 	"backend/internal/app/message"
+	"backend/internal/app/notification"
 	"backend/internal/app/session"
+	"backend/internal/app/settings"
+	"backend/internal/app/stats"
 	"backend/internal/app/thread"
 	"backend/internal/app/upload"
 	"backend/internal/app/user"
+	"backend/internal/app/watch"
 	"backend/internal/config"
 	"backend/internal/db"
 	"backend/internal/db/seeder"
 	"backend/internal/gateways/websocket"
+	"backend/internal/providers/broker"
 	"backend/internal/providers/minio"
 	"backend/internal/providers/redis"
+	"backend/internal/providers/secrets"
+	"backend/internal/providers/webpush"
 	"backend/internal/router"
+	"backend/internal/scheduler"
 	"backend/internal/utils"
-	"time"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
 type Application struct {
-	Router *router.Router
-	DB     *gorm.DB
+	Router    *router.Router
+	DB        *gorm.DB
+	Scheduler *scheduler.Scheduler
+	Hub       *websocket.Hub
+	Settings  settings.Service
+
+	redis *redis.RedisProvider
+	// stop cancels the background loops started by Bootstrap (event broker,
+	// settings sync, pool stats).
+	stop context.CancelFunc
 }
 
 func Bootstrap(cfg *config.Config, logger *zap.Logger) (*Application, error) {
-	dbConn, err := db.Connect(cfg, logger)
+	secretsManager, err := secrets.NewManager(secrets.Options{
+		CacheTTL:       cfg.SecretsCacheTTL,
+		VaultAddr:      cfg.VaultAddr,
+		VaultToken:     cfg.VaultToken,
+		VaultNamespace: cfg.VaultNamespace,
+		AWSRegion:      cfg.AWSRegion,
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	dbConn, err := db.Connect(cfg, secretsManager, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -39,18 +78,70 @@ func Bootstrap(cfg *config.Config, logger *zap.Logger) (*Application, error) {
 		return nil, err
 	}
 
-	seed := seeder.NewSeeder(dbConn, logger)
+	ipHasher := utils.NewIPHasher(cfg.IPHashSalt, cfg.IDRotation)
+	seed := seeder.NewSeeder(dbConn, ipHasher, logger)
 	if err := seed.Seed(); err != nil {
 		logger.Warn("Failed to run seeders", zap.Error(err))
 	}
 
-	redisProvider := redis.NewRedisProvider(cfg.RedisURL, logger, cfg.RedisTTL)
-	minioProvider, err := minio.NewMinioProvider(cfg, logger)
+	redisProvider, err := redis.NewRedisProvider(redis.Options{
+		URL:        cfg.RedisURL,
+		Username:   cfg.RedisUser,
+		Password:   cfg.RedisPassword,
+		CACertFile: cfg.RedisCACert,
+		TTL:        cfg.RedisTTL,
+	}, secretsManager, logger)
 	if err != nil {
-		logger.Warn("Failed to initialize MinIO provider", zap.Error(err))
+		return nil, err
+	}
+	minioProvider, minioErr := minio.NewMinioProvider(cfg, secretsManager, logger)
+	if minioErr != nil {
+		logger.Warn("Failed to initialize MinIO provider", zap.Error(minioErr))
 		minioProvider = nil
 	}
+	if cfg.Demo {
+		if err := seed.SeedDemo(seeder.DemoOptions{
+			Users:              cfg.DemoUsers,
+			ThreadsPerBoard:    cfg.DemoThreadsPerBoard,
+			MaxReplies:         cfg.DemoMaxReplies,
+			AttachmentsPercent: cfg.DemoAttachmentsPercent,
+			Seed:               uint64(cfg.DemoSeed),
+		}, minioProvider); err != nil {
+			logger.Warn("Failed to seed demo data", zap.Error(err))
+		}
+	}
 	eventBus := utils.NewEventBus()
+	ctx, stop := context.WithCancel(context.Background())
+	go db.LogPoolStats(ctx, dbConn, cfg.DBPoolStatsInterval, logger)
+	redisProvider.EnableL1(cfg.L1CacheSize, cfg.L1CacheTTL)
+	go redisProvider.RunL1(ctx)
+	eventLog := redis.NewEventLog(redisProvider, "ws:events", cfg.EventLogMaxLen, utils.EventThreadCreated, utils.EventThreadUpdated, utils.EventMessageCreated, utils.EventLinkPreviews)
+	eventBus.SetRecorder(eventLog)
+	presence := redis.NewPresence(redisProvider, time.Minute)
+	eventBroker, err := broker.New(broker.Options{
+		Kind:         cfg.EventBroker,
+		Topic:        cfg.EventFanoutChannel,
+		NATSURL:      cfg.NATSURL,
+		KafkaRESTURL: cfg.KafkaRESTURL,
+	}, redisProvider, eventBus, logger)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	if eventBroker != nil {
+		eventBus.SetForwarder(eventBroker)
+		go eventBroker.Run(ctx)
+	}
+
+	settingsService := settings.NewService(cfg, func() (config.Config, error) {
+		return config.LoadConfig(os.Args[1:])
+	}, redisProvider, eventBus, logger)
+	if minioProvider != nil {
+		settingsService.OnChange(func(s settings.Settings) {
+			minioProvider.SetLimits(s.MaxFileSize, s.MaxFilesPerPost)
+		})
+	}
+	go settingsService.Run(ctx)
 
 	sessionRepo := session.NewRepository(dbConn)
 	userRepo := user.NewRepository(dbConn)
@@ -58,60 +149,159 @@ func Bootstrap(cfg *config.Config, logger *zap.Logger) (*Application, error) {
 	threadRepo := thread.NewRepository(dbConn)
 	messageRepo := message.NewRepository(dbConn)
 	attachmentRepo := attachment.NewRepository(dbConn)
+	notificationRepo := notification.NewRepository(dbConn)
+	apiKeyRepo := apikey.NewRepository(dbConn)
+	watchRepo := watch.NewRepository(dbConn)
+	filterRepo := filter.NewRepository(dbConn)
+	bookmarkRepo := bookmark.NewRepository(dbConn)
+	announcementRepo := announcement.NewRepository(dbConn)
 
 	attachmentService := attachment.NewService(attachmentRepo, dbConn, minioProvider, logger)
-	uploadHandler := upload.NewHandler(minioProvider, attachmentService, logger)
 
-	sessionService := session.NewService(sessionRepo, redisProvider)
-	userService := user.NewService(userRepo, sessionService, redisProvider, logger)
-	boardService := board.NewService(boardRepo)
-	threadService := thread.NewService(threadRepo, sessionService, userService, dbConn, redisProvider, eventBus, logger, minioProvider, attachmentService)
-	messageService := message.NewService(messageRepo, sessionService, threadService, dbConn, redisProvider, eventBus, logger, minioProvider, attachmentService)
+	sessionService := session.NewService(sessionRepo, redisProvider, eventBus, []byte(cfg.SessionSecret), cfg.SessionMaxAge, ipHasher, settingsService)
+	userService := user.NewService(userRepo, sessionService, settingsService, redisProvider, logger)
+	boardService := board.NewService(boardRepo, redisProvider, eventBus)
+	uploadHandler := upload.NewHandler(minioProvider, attachmentService, boardService, sessionService, eventBus, logger)
+	threadService := thread.NewService(threadRepo, sessionService, userService, redisProvider, eventBus, logger, minioProvider, attachmentService, settingsService, boardService)
+	notificationChannels := []notification.Channel{
+		notification.NewWebSocketChannel(eventBus),
+		notification.NewWebhookChannel(cfg.NotificationWebhookTimeout),
+	}
+	if cfg.VAPIDPublicKey != "" {
+		pushSender, err := webpush.NewSender(cfg.VAPIDPublicKey, cfg.VAPIDPrivateKey, cfg.VAPIDSubject, cfg.NotificationWebhookTimeout)
+		if err != nil {
+			logger.Warn("Web push disabled", zap.Error(err))
+		} else {
+			notificationChannels = append(notificationChannels, notification.NewWebPushChannel(pushSender, notificationRepo))
+		}
+	}
+	notificationService := notification.NewService(notificationRepo, logger, notificationChannels...)
+	filterService := filter.NewService(filterRepo, redisProvider)
+	bookmarkService := bookmark.NewService(bookmarkRepo)
+	announcementService := announcement.NewService(announcementRepo, redisProvider, eventBus, logger)
+	watchService := watch.NewService(watchRepo, threadService, redisProvider, eventBus, notificationService, logger)
+	var previewService linkpreview.Service
+	if cfg.LinkPreviews {
+		previewService = linkpreview.NewService(redisProvider, cfg.LinkPreviewTimeout, cfg.LinkPreviewCacheTTL, logger)
+	}
+	messageService := message.NewService(messageRepo, sessionService, threadService, dbConn, redisProvider, eventBus, logger, minioProvider, attachmentService, settingsService, boardService, previewService, watchService, notificationService)
 
-	hub := websocket.NewHub(logger, sessionService, eventBus, userRepo, redisProvider)
+	hub := websocket.NewHub(logger, sessionService, eventBus, userRepo, redisProvider, eventLog, presence, websocket.Limits{
+		PerIP:      cfg.WSMaxConnsPerIP,
+		PerSession: cfg.WSMaxConnsPerSession,
+	})
 	go hub.Run()
 
+	statsService := stats.NewService(dbConn, redisProvider, minioProvider, eventBus, presence, logger)
+
+	jobScheduler := scheduler.New(logger, redisProvider)
+	cleanupService := cleanup.NewService(dbConn, redisProvider, minioProvider, logger)
+	if err := registerJobs(jobScheduler, cfg, logger, minioProvider, sessionService, threadService, statsService, announcementService, cleanupService); err != nil {
+		stop()
+		return nil, err
+	}
+	jobScheduler.Start()
+
+	healthChecker := &utils.HealthChecker{
+		DB:             dbConn,
+		Redis:          redisProvider.Client,
+		MinioInitError: minioErr,
+		Migrations: func(ctx context.Context) error {
+			return db.CheckMigrations(ctx, dbConn)
+		},
+		EventBus:  eventBus,
+		Jobs:      jobScheduler,
+		StartedAt: time.Now(),
+	}
 	if minioProvider != nil {
-		go func() {
-			ticker := time.NewTicker(15 * time.Minute)
-			defer ticker.Stop()
-			for range ticker.C {
-				if err := minioProvider.DeleteTmpFilesOlderThan(1 * time.Hour); err != nil {
-					logger.Warn("Failed to cleanup old tmp files", zap.Error(err))
-				}
-			}
-		}()
-	}
-
-	healthHandler := health.NewHandler(&utils.HealthChecker{
-		DB:    dbConn,
-		Redis: redisProvider.Client,
-	})
-	sessionHandler := session.NewHandler(sessionService)
+		healthChecker.MinIO = minioProvider.GetClient()
+		healthChecker.MinioBucket = minioProvider.GetBucket()
+	}
+	healthHandler := health.NewHandler(healthChecker)
+	sessionHandler := session.NewHandler(sessionService, session.Cookie{Secure: cfg.SessionCookieSecure})
 	userHandler := user.NewHandler(userService, sessionService, eventBus, logger, redisProvider)
 	boardHandler := board.NewHandler(boardService)
-	threadHandler := thread.NewHandler(threadService, sessionService, userService)
-	messageHandler := message.NewHandler(messageService, sessionService)
+	threadHandler := thread.NewHandler(threadService, sessionService, userService, filterService)
+	messageHandler := message.NewHandler(messageService, sessionService, filterService)
 	attachmentHandler := attachment.NewHandler(attachmentService)
-	cleanupService := cleanup.NewService(dbConn, redisProvider, minioProvider, logger)
+	filesHandler := files.NewHandler(minioProvider, logger)
+	notificationHandler := notification.NewHandler(notificationService, sessionService)
+	watchHandler := watch.NewHandler(watchService, sessionService)
+	filterHandler := filter.NewHandler(filterService, sessionService)
+	bookmarkHandler := bookmark.NewHandler(bookmarkService, sessionService)
+	announcementHandler := announcement.NewHandler(announcementService)
+	apiKeyService := apikey.NewService(apiKeyRepo, redisProvider, logger)
+	apiKeyHandler := apikey.NewHandler(apiKeyService)
+	statsHandler := stats.NewHandler(statsService)
 	cleanupHandler := cleanup.NewHandler(cleanupService)
+	backupHandler := backup.NewHandler(backup.NewService(dbConn, minioProvider, logger))
+	settingsHandler := settings.NewHandler(settingsService)
+	antispamService := antispam.NewService([]byte(cfg.SessionSecret), cfg.PostMinDelay, cfg.FormTokenTTL, cfg.SpamThreshold)
+	antispamHandler := antispam.NewHandler(antispamService)
+	reputationService := ipreputation.NewService(cfg.TorExitList, cfg.ASNDatabase, cfg.DatacenterASNs, logger)
+	go reputationService.Run(ctx, cfg.IPReputationRefresh)
+	geoAudit := ipreputation.NewAudit(redisProvider, logger)
+	geoHandler := ipreputation.NewHandler(geoAudit)
+	var captchaVerifier antispam.CaptchaVerifier
+	if cfg.CaptchaSecret != "" {
+		captchaVerifier = antispam.NewCaptchaVerifier(cfg.CaptchaVerifyURL, cfg.CaptchaSecret)
+	}
 
 	r := router.NewRouter(logger)
+	if err := r.TrustProxies(cfg.TrustedProxies); err != nil {
+		stop()
+		return nil, err
+	}
+	r.UseBodyLimit(cfg.MaxBodySize, uploadHandler.MaxUploadSize)
+	r.UseAPIKeyAuth(apiKeyService)
+	r.UseMaintenance(settingsService)
+	r.UseSession()
+	if ipHasher.Rotates() {
+		// Rotated users start with no cooldowns, so they are also kept per
+		// client IP.
+		r.UseClientKey(ipHasher)
+	}
+	r.UseOrigin(reputationService, captchaVerifier, settingsService, geoAudit, logger)
+	r.UseAntispam(antispamService, logger)
+	r.UseIdempotency(redisProvider, cfg.IdempotencyTTL, logger)
 
 	r.RegisterHealthRoutes(healthHandler)
 	r.RegisterWebSocketRoutes(hub)
 	r.RegisterSessionRoutes(sessionHandler)
 	r.RegisterUserRoutes(userHandler)
 	r.RegisterBoardRoutes(boardHandler)
+	r.RegisterBoardModRoutes(boardHandler, boardService, sessionService, cfg.AdminAPIKey)
+	r.RegisterModerationRoutes(threadHandler, messageHandler, boardService, sessionService, cfg.AdminAPIKey)
 	r.RegisterThreadRoutes(threadHandler)
 	r.RegisterMessageRoutes(messageHandler)
 	r.RegisterAttachmentRoutes(attachmentHandler)
 	r.RegisterUploadRoutes(uploadHandler)
+	r.RegisterFileRoutes(filesHandler)
+	r.RegisterNotificationRoutes(notificationHandler)
+	r.RegisterWatchRoutes(watchHandler)
+	r.RegisterFilterRoutes(filterHandler)
+	r.RegisterAntispamRoutes(antispamHandler)
+	r.RegisterBookmarkRoutes(bookmarkHandler)
+	r.RegisterAnnouncementRoutes(announcementHandler, cfg.AdminAPIKey)
+	r.RegisterStatsRoutes(statsHandler)
 	r.RegisterCleanupRoutes(cleanupHandler, cfg.AdminAPIKey)
-	r.RegisterSwaggerRoutes()
+	r.RegisterAPIKeyRoutes(apiKeyHandler, cfg.AdminAPIKey)
+	r.RegisterStatsAdminRoutes(statsHandler, cfg.AdminAPIKey)
+	r.RegisterGeoAdminRoutes(geoHandler, cfg.AdminAPIKey)
+	r.RegisterBoardAdminRoutes(boardHandler, cfg.AdminAPIKey)
+	r.RegisterBackupRoutes(backupHandler, cfg.AdminAPIKey)
+	r.RegisterSettingsRoutes(settingsHandler, cfg.AdminAPIKey)
+	if cfg.APIDocs {
+		r.RegisterDocsRoutes()
+	}
 
 	return &Application{
-		Router: r,
-		DB:     dbConn,
+		Router:    r,
+		DB:        dbConn,
+		Scheduler: jobScheduler,
+		Hub:       hub,
+		Settings:  settingsService,
+		redis:     redisProvider,
+		stop:      stop,
 	}, nil
 }
@@ -4,11 +4,15 @@ import (
 	"net/http"
 	"strconv"
 
+	"backend/internal/utils"
+
 	"github.com/gin-gonic/gin"
 )
 
 type Handler interface {
 	Cleanup(c *gin.Context)
+	Reconcile(c *gin.Context)
+	RebuildCounters(c *gin.Context)
 }
 
 type handler struct {
@@ -28,7 +32,7 @@ type CleanupRequest struct {
 }
 
 // @Summary Cleanup old data
-// @Description Delete messages, threads, attachments and Redis cache older than specified minutes
+// @Description Soft-delete messages and threads, and delete attachments and Redis cache older than specified minutes
 // @Tags Cleanup
 // @Accept json
 // @Produce json
@@ -39,12 +43,12 @@ type CleanupRequest struct {
 // @Param attachments query bool false "Clean old attachments"
 // @Param redis query bool false "Clean Redis cache"
 // @Success 200 {object} CleanupResult
-// @Router /cleanup [post]
+// @Router /api/cleanup [post]
 func (h *handler) Cleanup(c *gin.Context) {
 	minutesStr := c.DefaultQuery("minutes", "1440")
 	minutes, err := strconv.Atoi(minutesStr)
 	if err != nil || minutes < 1 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid minutes parameter"})
+		utils.RespondError(c, http.StatusBadRequest, "invalid minutes parameter")
 		return
 	}
 
@@ -57,7 +61,44 @@ func (h *handler) Cleanup(c *gin.Context) {
 
 	result, err := h.service.Cleanup(c.Request.Context(), minutes, cleanAll || cleanMessages, cleanAll || cleanThreads, cleanAll || cleanAttachments, cleanAll || cleanRedis)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		utils.RespondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// @Summary Reconcile storage with attachments
+// @Description Find MinIO objects without attachment rows and attachment rows whose object is missing. Orphaned objects are deleted and missing rows flagged unless dry_run is set.
+// @Tags Cleanup
+// @Produce json
+// @Security ApiKeyAuth
+// @Param dry_run query bool false "Only report, do not delete or flag" default(true)
+// @Success 200 {object} ReconcileResult
+// @Router /api/cleanup/reconcile [post]
+func (h *handler) Reconcile(c *gin.Context) {
+	dryRun := c.DefaultQuery("dry_run", "true") != "false"
+
+	result, err := h.service.Reconcile(c.Request.Context(), dryRun)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// @Summary Rebuild activity counters
+// @Description Recompute per-thread, per-user and per-user-per-board message and thread counters from the threads and messages tables
+// @Tags Cleanup
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} CountersResult
+// @Router /api/cleanup/counters [post]
+func (h *handler) RebuildCounters(c *gin.Context) {
+	result, err := h.service.RebuildCounters(c.Request.Context())
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -6,5 +6,7 @@ func RegisterRoutes(rg *gin.RouterGroup, handler Handler) {
 	cleanup := rg.Group("/cleanup")
 	{
 		cleanup.POST("", handler.Cleanup)
+		cleanup.POST("/reconcile", handler.Reconcile)
+		cleanup.POST("/counters", handler.RebuildCounters)
 	}
 }
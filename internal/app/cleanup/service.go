@@ -2,11 +2,17 @@ package cleanup
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"backend/internal/app/attachment"
+	"backend/internal/app/bookmark"
+	"backend/internal/app/filter"
 	"backend/internal/app/message"
 	"backend/internal/app/thread"
+	"backend/internal/app/user"
+	"backend/internal/app/watch"
 	"backend/internal/providers/minio"
 	"backend/internal/providers/redis"
 
@@ -16,6 +22,14 @@ import (
 
 type Service interface {
 	Cleanup(ctx context.Context, minutes int, cleanMessages, cleanThreads, cleanAttachments, cleanRedis bool) (CleanupResult, error)
+	Reconcile(ctx context.Context, dryRun bool) (ReconcileResult, error)
+	RebuildCounters(ctx context.Context) (CountersResult, error)
+	// PurgeDeleted removes threads and messages soft-deleted more than
+	// retention ago for good, with their attachments.
+	PurgeDeleted(ctx context.Context, retention time.Duration) (PurgeResult, error)
+	// PurgeArchived removes threads archived longer than their board's
+	// archive_retention_days, or retention on boards without one, for good.
+	PurgeArchived(ctx context.Context, retention time.Duration) (PurgeResult, error)
 }
 
 type CleanupResult struct {
@@ -25,6 +39,46 @@ type CleanupResult struct {
 	RedisFlushed       bool  `json:"redisFlushed"`
 }
 
+type ReconcileResult struct {
+	DryRun             bool            `json:"dryRun"`
+	ObjectsScanned     int64           `json:"objectsScanned"`
+	AttachmentsScanned int64           `json:"attachmentsScanned"`
+	OrphanedObjects    []string        `json:"orphanedObjects"`
+	OrphanedBytes      int64           `json:"orphanedBytes"`
+	ObjectsDeleted     int64           `json:"objectsDeleted"`
+	MissingObjects     []MissingObject `json:"missingObjects"`
+	AttachmentsFlagged int64           `json:"attachmentsFlagged"`
+	Errors             []string        `json:"errors,omitempty"`
+	StartedAt          time.Time       `json:"startedAt"`
+	Duration           string          `json:"duration"`
+}
+
+type CountersResult struct {
+	ThreadsFixed  int64  `json:"threadsFixed"`
+	MessagesFixed int64  `json:"messagesFixed"`
+	UsersFixed    int64  `json:"usersFixed"`
+	BoardsFixed   int64  `json:"boardsFixed"`
+	Duration      string `json:"duration"`
+}
+
+type PurgeResult struct {
+	ThreadsPurged     int64 `json:"threadsPurged"`
+	MessagesPurged    int64 `json:"messagesPurged"`
+	AttachmentsPurged int64 `json:"attachmentsPurged"`
+}
+
+type MissingObject struct {
+	AttachmentID uint64 `json:"attachmentId"`
+	ObjectName   string `json:"objectName"`
+}
+
+// cleanupActor is recorded as deleted_by for posts removed by Cleanup.
+const cleanupActor = "cleanup"
+
+// reconcileGracePeriod keeps freshly written objects out of the orphan set
+// while their attachment row may still be in flight.
+const reconcileGracePeriod = time.Hour
+
 type service struct {
 	db     *gorm.DB
 	redisP *redis.RedisProvider
@@ -47,18 +101,18 @@ func (s *service) Cleanup(ctx context.Context, minutes int, cleanMessages, clean
 	cutoffDate := time.Now().Add(-time.Duration(minutes) * time.Minute)
 	s.logger.Infow("Starting cleanup", "minutes", minutes, "cutoff", cutoffDate)
 
+	// Threads and messages are only soft-deleted here, so they can still be
+	// restored until PurgeDeleted removes them.
+	softDelete := map[string]interface{}{"deleted_at": time.Now().UTC(), "deleted_by": cleanupActor}
+
 	if cleanMessages {
-		var count int64
-		s.db.Model(&message.Message{}).Where("created_at < ?", cutoffDate).Count(&count)
-		res := s.db.Where("created_at < ?", cutoffDate).Delete(&message.Message{})
+		res := s.db.Model(&message.Message{}).Where("created_at < ? AND deleted_at IS NULL", cutoffDate).Updates(softDelete)
 		result.MessagesDeleted = res.RowsAffected
 		s.logger.Infow("Deleted messages", "count", result.MessagesDeleted)
 	}
 
 	if cleanThreads {
-		var count int64
-		s.db.Model(&thread.Thread{}).Where("created_at < ?", cutoffDate).Count(&count)
-		res := s.db.Where("created_at < ?", cutoffDate).Delete(&thread.Thread{})
+		res := s.db.Model(&thread.Thread{}).Where("created_at < ? AND deleted_at IS NULL", cutoffDate).Updates(softDelete)
 		result.ThreadsDeleted = res.RowsAffected
 		s.logger.Infow("Deleted threads", "count", result.ThreadsDeleted)
 	}
@@ -96,3 +150,310 @@ func (s *service) Cleanup(ctx context.Context, minutes int, cleanMessages, clean
 	s.logger.Infow("Cleanup completed", "result", result)
 	return result, nil
 }
+
+func (s *service) Reconcile(ctx context.Context, dryRun bool) (ReconcileResult, error) {
+	result := ReconcileResult{
+		DryRun:          dryRun,
+		OrphanedObjects: []string{},
+		MissingObjects:  []MissingObject{},
+		StartedAt:       time.Now().UTC(),
+	}
+
+	if s.minioP == nil {
+		return result, fmt.Errorf("minio is not configured")
+	}
+
+	var rows []struct {
+		ID         uint64
+		ObjectName string
+	}
+	if err := s.db.WithContext(ctx).Model(&attachment.Attachment{}).Select("id, object_name").Find(&rows).Error; err != nil {
+		return result, fmt.Errorf("failed to load attachments: %w", err)
+	}
+	result.AttachmentsScanned = int64(len(rows))
+
+	known := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		known[row.ObjectName] = false
+	}
+
+	cutoff := time.Now().Add(-reconcileGracePeriod)
+	err := s.minioP.WalkObjects(ctx, "", func(obj minio.ObjectInfo) error {
+		result.ObjectsScanned++
+		if _, ok := known[obj.Key]; ok {
+			known[obj.Key] = true
+			return nil
+		}
+		if strings.HasPrefix(obj.Key, "tmp/") || obj.LastModified.After(cutoff) {
+			return nil
+		}
+
+		result.OrphanedObjects = append(result.OrphanedObjects, obj.Key)
+		result.OrphanedBytes += obj.Size
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	if !dryRun {
+		for _, key := range result.OrphanedObjects {
+			if err := s.minioP.DeleteFile(key); err != nil {
+				result.Errors = append(result.Errors, err.Error())
+				continue
+			}
+			result.ObjectsDeleted++
+		}
+	}
+
+	var missingIDs, presentIDs []uint64
+	for _, row := range rows {
+		if known[row.ObjectName] {
+			presentIDs = append(presentIDs, row.ID)
+			continue
+		}
+		missingIDs = append(missingIDs, row.ID)
+		result.MissingObjects = append(result.MissingObjects, MissingObject{AttachmentID: row.ID, ObjectName: row.ObjectName})
+	}
+
+	if !dryRun {
+		if len(missingIDs) > 0 {
+			res := s.db.WithContext(ctx).Model(&attachment.Attachment{}).
+				Where("id IN ? AND missing_at IS NULL", missingIDs).
+				Update("missing_at", time.Now().UTC())
+			if res.Error != nil {
+				result.Errors = append(result.Errors, res.Error.Error())
+			}
+			result.AttachmentsFlagged = res.RowsAffected
+		}
+		if len(presentIDs) > 0 {
+			if err := s.db.WithContext(ctx).Model(&attachment.Attachment{}).
+				Where("id IN ? AND missing_at IS NOT NULL", presentIDs).
+				Update("missing_at", nil).Error; err != nil {
+				result.Errors = append(result.Errors, err.Error())
+			}
+		}
+	}
+
+	result.Duration = time.Since(result.StartedAt).String()
+	s.logger.Infow("Storage reconciliation completed",
+		"dry_run", dryRun,
+		"objects_scanned", result.ObjectsScanned,
+		"attachments_scanned", result.AttachmentsScanned,
+		"orphaned_objects", len(result.OrphanedObjects),
+		"orphaned_bytes", result.OrphanedBytes,
+		"objects_deleted", result.ObjectsDeleted,
+		"missing_objects", len(result.MissingObjects),
+		"errors", len(result.Errors),
+	)
+	return result, nil
+}
+
+// RebuildCounters recomputes threads_activity, messages.replies_count,
+// user_activity and user_board_activity from the threads and messages
+// tables, creating missing rows. Only rows whose values
+// actually differ are written, so the result counts the rows that had
+// drifted.
+func (s *service) RebuildCounters(ctx context.Context) (CountersResult, error) {
+	var result CountersResult
+	started := time.Now()
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		threads := tx.Exec(`
+			INSERT INTO threads_activity (thread_id, message_count, bump_at, created_at, updated_at)
+			SELECT threads.id, COUNT(messages.id), COALESCE(MAX(messages.created_at), threads.created_at), NOW(), NOW()
+			FROM threads
+			LEFT JOIN messages ON messages.thread_id = threads.id AND messages.deleted_at IS NULL
+			GROUP BY threads.id
+			ON CONFLICT (thread_id) DO UPDATE SET
+				message_count = EXCLUDED.message_count,
+				updated_at = NOW()
+			WHERE threads_activity.message_count <> EXCLUDED.message_count
+		`)
+		if threads.Error != nil {
+			return fmt.Errorf("failed to rebuild thread counters: %w", threads.Error)
+		}
+		result.ThreadsFixed = threads.RowsAffected
+
+		replies := tx.Exec(message.RecountReplies)
+		if replies.Error != nil {
+			return fmt.Errorf("failed to rebuild reply counters: %w", replies.Error)
+		}
+		result.MessagesFixed = replies.RowsAffected
+
+		users := tx.Exec(`
+			WITH thread_stats AS (
+				SELECT sessions.user_id, COUNT(*) AS total, MAX(threads.created_at) AS last_at
+				FROM threads JOIN sessions ON sessions.id = threads.created_by_session_id
+				GROUP BY sessions.user_id
+			), message_stats AS (
+				SELECT sessions.user_id, COUNT(*) AS total, MAX(messages.created_at) AS last_at
+				FROM messages JOIN sessions ON sessions.id = messages.created_by_session_id
+				GROUP BY sessions.user_id
+			)
+			INSERT INTO user_activity (user_id, thread_count, message_count, last_thread_at, last_message_at, created_at, updated_at)
+			SELECT users.id, COALESCE(thread_stats.total, 0), COALESCE(message_stats.total, 0),
+				thread_stats.last_at, message_stats.last_at, NOW(), NOW()
+			FROM users
+			LEFT JOIN thread_stats ON thread_stats.user_id = users.id
+			LEFT JOIN message_stats ON message_stats.user_id = users.id
+			ON CONFLICT (user_id) DO UPDATE SET
+				thread_count = EXCLUDED.thread_count,
+				message_count = EXCLUDED.message_count,
+				last_thread_at = EXCLUDED.last_thread_at,
+				last_message_at = EXCLUDED.last_message_at,
+				updated_at = NOW()
+			WHERE (user_activity.thread_count, user_activity.message_count, user_activity.last_thread_at, user_activity.last_message_at)
+				IS DISTINCT FROM (EXCLUDED.thread_count, EXCLUDED.message_count, EXCLUDED.last_thread_at, EXCLUDED.last_message_at)
+		`)
+		if users.Error != nil {
+			return fmt.Errorf("failed to rebuild user counters: %w", users.Error)
+		}
+		result.UsersFixed = users.RowsAffected
+
+		boards := tx.Exec(`
+			INSERT INTO user_board_activity (user_id, board_id, thread_count, message_count, last_thread_at, last_message_at, created_at, updated_at)
+			SELECT user_id, board_id, thread_count, message_count, last_thread_at, last_message_at, NOW(), NOW()
+			FROM (` + user.BoardActivitySelect + `) stats
+			ON CONFLICT (user_id, board_id) DO UPDATE SET
+				thread_count = EXCLUDED.thread_count,
+				message_count = EXCLUDED.message_count,
+				last_thread_at = EXCLUDED.last_thread_at,
+				last_message_at = EXCLUDED.last_message_at,
+				updated_at = NOW()
+			WHERE (user_board_activity.thread_count, user_board_activity.message_count, user_board_activity.last_thread_at, user_board_activity.last_message_at)
+				IS DISTINCT FROM (EXCLUDED.thread_count, EXCLUDED.message_count, EXCLUDED.last_thread_at, EXCLUDED.last_message_at)
+		`)
+		if boards.Error != nil {
+			return fmt.Errorf("failed to rebuild board counters: %w", boards.Error)
+		}
+		result.BoardsFixed = boards.RowsAffected
+
+		// Rows left for boards the user no longer has posts on.
+		stale := tx.Exec(`
+			DELETE FROM user_board_activity
+			WHERE (user_id, board_id) NOT IN (SELECT user_id, board_id FROM (` + user.BoardActivitySelect + `) stats)
+		`)
+		if stale.Error != nil {
+			return fmt.Errorf("failed to prune board counters: %w", stale.Error)
+		}
+		result.BoardsFixed += stale.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	result.Duration = time.Since(started).String()
+	s.logger.Infow("Counters rebuilt", "threads_fixed", result.ThreadsFixed, "messages_fixed", result.MessagesFixed, "users_fixed", result.UsersFixed, "boards_fixed", result.BoardsFixed, "duration", result.Duration)
+	return result, nil
+}
+
+func (s *service) PurgeDeleted(ctx context.Context, retention time.Duration) (PurgeResult, error) {
+	cutoff := time.Now().Add(-retention)
+	result, err := s.purge(ctx, func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("threads.deleted_at < ?", cutoff)
+	}, &cutoff)
+	if err == nil && (result.ThreadsPurged > 0 || result.MessagesPurged > 0) {
+		s.logger.Infow("Purged deleted posts", "result", result)
+	}
+	return result, err
+}
+
+func (s *service) PurgeArchived(ctx context.Context, retention time.Duration) (PurgeResult, error) {
+	// A board's own retention wins over the site-wide one; either being 0
+	// keeps that board's archive.
+	const retentionSeconds = "COALESCE(boards.archive_retention_days * 86400, ?)"
+	seconds := int64(retention / time.Second)
+	result, err := s.purge(ctx, func(tx *gorm.DB) *gorm.DB {
+		return tx.Joins("JOIN boards ON boards.id = threads.board_id").
+			Where("threads.archived_at IS NOT NULL").
+			Where(retentionSeconds+" > 0", seconds).
+			Where("threads.archived_at < NOW() - "+retentionSeconds+" * INTERVAL '1 second'", seconds)
+	}, nil)
+	if err == nil && result.ThreadsPurged > 0 {
+		s.logger.Infow("Purged archived threads", "result", result)
+	}
+	return result, err
+}
+
+// purge deletes for good the threads picked by threads with every reply in
+// them, the messages soft-deleted before messagesBefore when it is set, and
+// the attachments, files and per-user thread rows that go with them.
+func (s *service) purge(ctx context.Context, threads func(tx *gorm.DB) *gorm.DB, messagesBefore *time.Time) (PurgeResult, error) {
+	var result PurgeResult
+	var objects []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var threadIDs, messageIDs []uint64
+		if err := threads(tx.Model(&thread.Thread{})).Pluck("threads.id", &threadIDs).Error; err != nil {
+			return fmt.Errorf("failed to find purgeable threads: %w", err)
+		}
+		// The replies of a purged thread go with it, deleted or not. An empty
+		// IN list matches nothing.
+		messages := tx.Model(&message.Message{})
+		if messagesBefore != nil {
+			messages = messages.Where("deleted_at < ? OR thread_id IN ?", *messagesBefore, threadIDs)
+		} else {
+			messages = messages.Where("thread_id IN ?", threadIDs)
+		}
+		if err := messages.Pluck("id", &messageIDs).Error; err != nil {
+			return fmt.Errorf("failed to find purgeable messages: %w", err)
+		}
+		if len(threadIDs) == 0 && len(messageIDs) == 0 {
+			return nil
+		}
+
+		var attachmentIDs []uint64
+		var rows []attachment.Attachment
+		if err := tx.Select("id", "object_name").
+			Where("thread_id IN ? OR message_id IN ?", threadIDs, messageIDs).
+			Find(&rows).Error; err != nil {
+			return fmt.Errorf("failed to find purgeable attachments: %w", err)
+		}
+		for _, row := range rows {
+			attachmentIDs = append(attachmentIDs, row.ID)
+			objects = append(objects, row.ObjectName)
+		}
+
+		if len(attachmentIDs) > 0 {
+			res := tx.Where("id IN ?", attachmentIDs).Delete(&attachment.Attachment{})
+			if res.Error != nil {
+				return fmt.Errorf("failed to purge attachments: %w", res.Error)
+			}
+			result.AttachmentsPurged = res.RowsAffected
+		}
+		if len(messageIDs) > 0 {
+			res := tx.Where("id IN ?", messageIDs).Delete(&message.Message{})
+			if res.Error != nil {
+				return fmt.Errorf("failed to purge messages: %w", res.Error)
+			}
+			result.MessagesPurged = res.RowsAffected
+		}
+		if len(threadIDs) > 0 {
+			for _, model := range []interface{}{&thread.ThreadActivity{}, &watch.Watch{}, &bookmark.ThreadBookmark{}, &filter.HiddenThread{}} {
+				if err := tx.Where("thread_id IN ?", threadIDs).Delete(model).Error; err != nil {
+					return fmt.Errorf("failed to purge thread rows: %w", err)
+				}
+			}
+			res := tx.Where("id IN ?", threadIDs).Delete(&thread.Thread{})
+			if res.Error != nil {
+				return fmt.Errorf("failed to purge threads: %w", res.Error)
+			}
+			result.ThreadsPurged = res.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	// Objects that fail to go now are picked up by Reconcile as orphans.
+	if s.minioP != nil {
+		for _, object := range objects {
+			if err := s.minioP.DeleteFile(object); err != nil {
+				s.logger.Warnw("Failed to delete purged file from MinIO", "object", object, "error", err)
+			}
+		}
+	}
+	return result, nil
+}
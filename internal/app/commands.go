@@ -0,0 +1,190 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"backend/internal/app/backup"
+	"backend/internal/app/cleanup"
+	"backend/internal/config"
+	"backend/internal/db"
+	"backend/internal/providers/minio"
+	"backend/internal/providers/secrets"
+	"backend/internal/utils"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// commands are one-off maintenance tasks run as "404chan <command> [flags]"
+// instead of starting the server. They only connect to what they need.
+var commands = map[string]func(ctx context.Context, cfg *config.Config, logger *zap.Logger) error{
+	"rebuild-counters": rebuildCounters,
+	"hash-ips":         hashIPs,
+	"export-board":     exportBoard,
+	"import":           importDump,
+}
+
+func RunCommand(ctx context.Context, name string, cfg *config.Config, logger *zap.Logger) error {
+	run, ok := commands[name]
+	if !ok {
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown command %q, available: %s", name, strings.Join(names, ", "))
+	}
+	return run(ctx, cfg, logger)
+}
+
+func rebuildCounters(ctx context.Context, cfg *config.Config, logger *zap.Logger) error {
+	dbConn, closeDB, err := connectDB(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	_, err = cleanup.NewService(dbConn, nil, nil, logger).RebuildCounters(ctx)
+	return err
+}
+
+// hashIPs converts the users stored by raw IP before IP_HASH_SALT was set.
+// It runs the migrations first so the column can hold the hashes.
+func hashIPs(ctx context.Context, cfg *config.Config, logger *zap.Logger) error {
+	if cfg.IPHashSalt == "" {
+		return errors.New("IP_HASH_SALT is not set")
+	}
+	dbConn, closeDB, err := connectDB(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	if err := db.Migrate(dbConn, logger); err != nil {
+		return err
+	}
+	hashed, skipped, err := db.HashUserIPs(ctx, dbConn, utils.NewIPHasher(cfg.IPHashSalt, 0), logger)
+	if err != nil {
+		return err
+	}
+	logger.Info("User IPs hashed", zap.Int("hashed", hashed), zap.Int("skipped", skipped))
+	return nil
+}
+
+// exportBoard writes the board named by EXPORT_BOARD to EXPORT_FILE, or to
+// stdout, in the format of GET /api/admin/boards/:slug/export. A failed
+// export removes the partial file.
+func exportBoard(ctx context.Context, cfg *config.Config, logger *zap.Logger) (err error) {
+	if cfg.ExportBoard == "" {
+		return errors.New("EXPORT_BOARD is not set")
+	}
+	dbConn, closeDB, err := connectDB(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	var out io.Writer = os.Stdout
+	if cfg.ExportFile != "" {
+		f, err := os.Create(cfg.ExportFile)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(cfg.ExportFile)
+			}
+		}()
+		out = f
+	}
+
+	w := bufio.NewWriter(out)
+	if _, err := backup.NewService(dbConn, nil, logger).Export(ctx, cfg.ExportBoard, w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// importDump loads the dump in IMPORT_FILE, or stdin, into IMPORT_BOARD and
+// then rebuilds the counters the new posts change. It runs the migrations
+// first, so a fresh instance can be filled from a backup.
+func importDump(ctx context.Context, cfg *config.Config, logger *zap.Logger) error {
+	dbConn, closeDB, err := connectDB(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	if err := db.Migrate(dbConn, logger); err != nil {
+		return err
+	}
+
+	var storage *minio.MinioProvider
+	if cfg.ImportReupload {
+		secretsManager, err := newSecretsManager(cfg, logger)
+		if err != nil {
+			return err
+		}
+		if storage, err = minio.NewMinioProvider(cfg, secretsManager, logger); err != nil {
+			return err
+		}
+	}
+
+	var in io.Reader = os.Stdin
+	if cfg.ImportFile != "" {
+		f, err := os.Open(cfg.ImportFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	_, err = backup.NewService(dbConn, storage, logger).Import(ctx, bufio.NewReader(in), backup.ImportOptions{
+		Board:       cfg.ImportBoard,
+		Reupload:    cfg.ImportReupload,
+		FilesURL:    cfg.ImportFilesURL,
+		MaxFileSize: cfg.MaxFileSize,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = cleanup.NewService(dbConn, nil, nil, logger).RebuildCounters(ctx)
+	return err
+}
+
+func newSecretsManager(cfg *config.Config, logger *zap.Logger) (*secrets.Manager, error) {
+	return secrets.NewManager(secrets.Options{
+		CacheTTL:       cfg.SecretsCacheTTL,
+		VaultAddr:      cfg.VaultAddr,
+		VaultToken:     cfg.VaultToken,
+		VaultNamespace: cfg.VaultNamespace,
+		AWSRegion:      cfg.AWSRegion,
+	}, logger)
+}
+
+func connectDB(cfg *config.Config, logger *zap.Logger) (*gorm.DB, func(), error) {
+	secretsManager, err := newSecretsManager(cfg, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	dbConn, err := db.Connect(cfg, secretsManager, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dbConn, func() {
+		if sqlDB, err := dbConn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}, nil
+}
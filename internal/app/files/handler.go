@@ -0,0 +1,102 @@
+package files
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"backend/internal/providers/minio"
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	miniogo "github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// inlineContentTypes are the types shown in the browser. Anything else,
+// HTML and SVG above all, is sent as a download: uploads are served from the
+// API origin, where script in them would run with the site's cookies.
+var inlineContentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/avif": true,
+	"image/bmp":  true,
+	"video/mp4":  true,
+	"video/webm": true,
+	"video/ogg":  true,
+}
+
+type Handler interface {
+	GetFile(c *gin.Context)
+}
+
+type handler struct {
+	minioP *minio.MinioProvider
+	logger *zap.SugaredLogger
+}
+
+func NewHandler(minioP *minio.MinioProvider, logger *zap.Logger) Handler {
+	return &handler{
+		minioP: minioP,
+		logger: logger.Sugar(),
+	}
+}
+
+// @Summary Get file
+// @Description Stream a stored object through the backend with caching headers and Range support
+// @Tags Files
+// @Produce octet-stream
+// @Param object path string true "Object name"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Success 304
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/files/{object} [get]
+func (h *handler) GetFile(c *gin.Context) {
+	if h.minioP == nil {
+		utils.RespondError(c, http.StatusServiceUnavailable, "MinIO not configured")
+		return
+	}
+
+	objectName := strings.TrimPrefix(c.Param("object"), "/")
+	if objectName == "" || strings.Contains(objectName, "..") {
+		utils.RespondError(c, http.StatusBadRequest, "invalid object name")
+		return
+	}
+
+	obj, info, err := h.minioP.GetObject(c.Request.Context(), objectName)
+	if err != nil {
+		if miniogo.ToErrorResponse(err).Code == "NoSuchKey" {
+			utils.RespondError(c, http.StatusNotFound, "file not found")
+			return
+		}
+		h.logger.Errorw("GetFile: failed to open object", "object", objectName, "error", err)
+		utils.RespondError(c, http.StatusBadGateway, "failed to fetch file")
+		return
+	}
+	defer obj.Close()
+
+	header := c.Writer.Header()
+	if info.ContentType != "" {
+		header.Set("Content-Type", info.ContentType)
+	}
+	if info.ETag != "" {
+		header.Set("ETag", `"`+strings.Trim(info.ETag, `"`)+`"`)
+	}
+	if strings.HasPrefix(objectName, "tmp/") {
+		header.Set("Cache-Control", "private, max-age=0, must-revalidate")
+	} else {
+		// Permanent object names embed random UUIDs and are never rewritten.
+		header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Content-Security-Policy", "sandbox")
+	if mediaType, _, _ := mime.ParseMediaType(info.ContentType); !inlineContentTypes[mediaType] {
+		header.Set("Content-Disposition", "attachment")
+	}
+
+	http.ServeContent(c.Writer, c.Request, "", info.LastModified, obj)
+}
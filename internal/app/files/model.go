@@ -0,0 +1,5 @@
+package files
+
+import "backend/internal/utils"
+
+type ErrorResponse = utils.ErrorResponse
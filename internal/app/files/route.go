@@ -0,0 +1,8 @@
+package files
+
+import "github.com/gin-gonic/gin"
+
+func RegisterRoutes(rg *gin.RouterGroup, handler Handler) {
+	rg.GET("/files/*object", handler.GetFile)
+	rg.HEAD("/files/*object", handler.GetFile)
+}
@@ -0,0 +1,198 @@
+package filter
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"backend/internal/app/session"
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	List(c *gin.Context)
+	HideThread(c *gin.Context)
+	UnhideThread(c *gin.Context)
+	AddRule(c *gin.Context)
+	DeleteRule(c *gin.Context)
+}
+
+type handler struct {
+	service    Service
+	sessionSvc session.Service
+}
+
+func NewHandler(service Service, sessionSvc session.Service) Handler {
+	return &handler{
+		service:    service,
+		sessionSvc: sessionSvc,
+	}
+}
+
+// @Summary List filters
+// @Description Get the threads the current user hid and their filter rules
+// @Tags Filter
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} FiltersResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/filters [get]
+func (h *handler) List(c *gin.Context) {
+	userID, ok := h.currentUserID(c)
+	if !ok {
+		return
+	}
+
+	filters, err := h.service.Get(c.Request.Context(), userID)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get filters")
+		return
+	}
+	c.JSON(http.StatusOK, filters)
+}
+
+// @Summary Hide a thread
+// @Description Hide a thread from the current user's thread lists
+// @Tags Filter
+// @Produce json
+// @Param thread_id path int true "Thread ID"
+// @Security BearerAuth
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/filters/threads/{thread_id} [post]
+func (h *handler) HideThread(c *gin.Context) {
+	threadID, ok := parseID(c, "thread_id", "invalid thread ID")
+	if !ok {
+		return
+	}
+	userID, ok := h.currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.HideThread(c.Request.Context(), userID, threadID); err != nil {
+		if errors.Is(err, ErrHiddenLimit) {
+			utils.RespondError(c, http.StatusConflict, err.Error())
+			return
+		}
+		utils.WriteError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Unhide a thread
+// @Description Show a hidden thread in the current user's thread lists again
+// @Tags Filter
+// @Produce json
+// @Param thread_id path int true "Thread ID"
+// @Security BearerAuth
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Router /api/filters/threads/{thread_id} [delete]
+func (h *handler) UnhideThread(c *gin.Context) {
+	threadID, ok := parseID(c, "thread_id", "invalid thread ID")
+	if !ok {
+		return
+	}
+	userID, ok := h.currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.UnhideThread(c.Request.Context(), userID, threadID); err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to unhide thread")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Add a filter rule
+// @Description Filter threads and messages whose content (and thread title) or author nickname matches a regular expression (Go RE2 syntax; prefix with (?i) to ignore case)
+// @Tags Filter
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateRuleRequest true "Filter rule"
+// @Success 201 {object} Rule
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/filters/rules [post]
+func (h *handler) AddRule(c *gin.Context) {
+	var req CreateRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	userID, ok := h.currentUserID(c)
+	if !ok {
+		return
+	}
+
+	rule, err := h.service.AddRule(c.Request.Context(), userID, req.Field, req.Pattern)
+	if err != nil {
+		if errors.Is(err, ErrRuleLimit) {
+			utils.RespondError(c, http.StatusConflict, err.Error())
+			return
+		}
+		utils.WriteError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+// @Summary Delete a filter rule
+// @Description Delete one of the current user's filter rules
+// @Tags Filter
+// @Produce json
+// @Param id path int true "Rule ID"
+// @Security BearerAuth
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/filters/rules/{id} [delete]
+func (h *handler) DeleteRule(c *gin.Context) {
+	ruleID, ok := parseID(c, "id", "invalid rule ID")
+	if !ok {
+		return
+	}
+	userID, ok := h.currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteRule(c.Request.Context(), userID, ruleID); err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *handler) currentUserID(c *gin.Context) (uint64, bool) {
+	sessionKey := session.Key(c)
+	if sessionKey == "" {
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
+		return 0, false
+	}
+
+	user, err := h.sessionSvc.GetUserBySessionKey(sessionKey)
+	if err != nil {
+		utils.RespondError(c, http.StatusNotFound, "user not found")
+		return 0, false
+	}
+	return user.ID, true
+}
+
+func parseID(c *gin.Context, param, message string) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param(param), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, message)
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,50 @@
+package filter
+
+import (
+	"time"
+
+	"backend/internal/utils"
+)
+
+// Fields a rule can match against.
+const (
+	FieldContent  = "content"
+	FieldNickname = "nickname"
+)
+
+type HiddenThread struct {
+	ID        uint64    `gorm:"primaryKey"`
+	UserID    uint64    `gorm:"not null;uniqueIndex:idx_hidden_threads_user_thread"`
+	ThreadID  uint64    `gorm:"not null;uniqueIndex:idx_hidden_threads_user_thread"`
+	CreatedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP"`
+}
+
+func (HiddenThread) TableName() string {
+	return "hidden_threads"
+}
+
+// Rule filters posts whose Field matches Pattern, a Go regular expression.
+// Content rules also match thread titles.
+type Rule struct {
+	ID        uint64    `json:"id" gorm:"primaryKey"`
+	UserID    uint64    `json:"-" gorm:"not null;index"`
+	Field     string    `json:"field" gorm:"type:varchar(16);not null"`
+	Pattern   string    `json:"pattern" gorm:"type:text;not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
+}
+
+func (Rule) TableName() string {
+	return "filter_rules"
+}
+
+type CreateRuleRequest struct {
+	Field   string `json:"field" binding:"required,oneof=content nickname"`
+	Pattern string `json:"pattern" binding:"required,max=256"`
+}
+
+type FiltersResponse struct {
+	HiddenThreads []uint64 `json:"hidden_threads"`
+	Rules         []*Rule  `json:"rules"`
+}
+
+type ErrorResponse = utils.ErrorResponse
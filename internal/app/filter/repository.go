@@ -0,0 +1,77 @@
+package filter
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository interface {
+	ThreadExists(threadID uint64) (bool, error)
+	HideThread(userID, threadID uint64) error
+	UnhideThread(userID, threadID uint64) error
+	CountHiddenThreads(userID uint64) (int64, error)
+	HiddenThreadIDs(userID uint64) ([]uint64, error)
+	CreateRule(rule *Rule) error
+	DeleteRule(userID, ruleID uint64) (int64, error)
+	CountRules(userID uint64) (int64, error)
+	ListRules(userID uint64) ([]*Rule, error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) ThreadExists(threadID uint64) (bool, error) {
+	var exists bool
+	err := r.db.Raw("SELECT EXISTS (SELECT 1 FROM threads WHERE id = ?)", threadID).Scan(&exists).Error
+	return exists, err
+}
+
+func (r *repository) HideThread(userID, threadID uint64) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&HiddenThread{UserID: userID, ThreadID: threadID}).Error
+}
+
+func (r *repository) UnhideThread(userID, threadID uint64) error {
+	return r.db.Where("user_id = ? AND thread_id = ?", userID, threadID).Delete(&HiddenThread{}).Error
+}
+
+func (r *repository) CountHiddenThreads(userID uint64) (int64, error) {
+	var count int64
+	err := r.db.Model(&HiddenThread{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *repository) HiddenThreadIDs(userID uint64) ([]uint64, error) {
+	var ids []uint64
+	err := r.db.Model(&HiddenThread{}).
+		Where("user_id = ?", userID).
+		Order("thread_id ASC").
+		Pluck("thread_id", &ids).Error
+	return ids, err
+}
+
+func (r *repository) CreateRule(rule *Rule) error {
+	return r.db.Create(rule).Error
+}
+
+func (r *repository) DeleteRule(userID, ruleID uint64) (int64, error) {
+	res := r.db.Where("id = ? AND user_id = ?", ruleID, userID).Delete(&Rule{})
+	return res.RowsAffected, res.Error
+}
+
+func (r *repository) CountRules(userID uint64) (int64, error) {
+	var count int64
+	err := r.db.Model(&Rule{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *repository) ListRules(userID uint64) ([]*Rule, error) {
+	var rules []*Rule
+	err := r.db.Where("user_id = ?", userID).Order("id ASC").Find(&rules).Error
+	return rules, err
+}
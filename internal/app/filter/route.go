@@ -0,0 +1,14 @@
+package filter
+
+import "github.com/gin-gonic/gin"
+
+func RegisterRoutes(rg *gin.RouterGroup, handler Handler) {
+	filters := rg.Group("/filters")
+	{
+		filters.GET("", handler.List)
+		filters.POST("/threads/:thread_id", handler.HideThread)
+		filters.DELETE("/threads/:thread_id", handler.UnhideThread)
+		filters.POST("/rules", handler.AddRule)
+		filters.DELETE("/rules/:id", handler.DeleteRule)
+	}
+}
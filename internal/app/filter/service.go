@@ -0,0 +1,163 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"backend/internal/providers/redis"
+	"backend/internal/utils"
+)
+
+const (
+	maxHiddenThreads = 1000
+	maxRules         = 50
+	filtersCacheTTL  = 10 * time.Minute
+)
+
+var (
+	ErrHiddenLimit = errors.New("too many hidden threads")
+	ErrRuleLimit   = errors.New("too many filter rules")
+)
+
+type Service interface {
+	Get(ctx context.Context, userID uint64) (*FiltersResponse, error)
+	HideThread(ctx context.Context, userID, threadID uint64) error
+	UnhideThread(ctx context.Context, userID, threadID uint64) error
+	AddRule(ctx context.Context, userID uint64, field, pattern string) (*Rule, error)
+	DeleteRule(ctx context.Context, userID, ruleID uint64) error
+	// ForUser returns the user's filters ready to apply to a listing, or
+	// nil when they have none.
+	ForUser(ctx context.Context, userID uint64) (*Set, error)
+}
+
+type service struct {
+	repo   Repository
+	redisP *redis.RedisProvider
+}
+
+func NewService(repo Repository, redisP *redis.RedisProvider) Service {
+	return &service{
+		repo:   repo,
+		redisP: redisP,
+	}
+}
+
+func filtersCacheKey(userID uint64) string {
+	return fmt.Sprintf("filters:%d", userID)
+}
+
+func (s *service) Get(ctx context.Context, userID uint64) (*FiltersResponse, error) {
+	cacheKey := filtersCacheKey(userID)
+	if cached, err := s.redisP.CachedGet(ctx, cacheKey); err == nil && cached != "" {
+		var filters FiltersResponse
+		if json.Unmarshal([]byte(cached), &filters) == nil {
+			return &filters, nil
+		}
+	}
+
+	hidden, err := s.repo.HiddenThreadIDs(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hidden threads: %w", err)
+	}
+	rules, err := s.repo.ListRules(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get filter rules: %w", err)
+	}
+	if hidden == nil {
+		hidden = []uint64{}
+	}
+	if rules == nil {
+		rules = []*Rule{}
+	}
+
+	filters := &FiltersResponse{HiddenThreads: hidden, Rules: rules}
+	if data, err := json.Marshal(filters); err == nil {
+		s.redisP.CachedSet(ctx, cacheKey, data, filtersCacheTTL)
+	}
+	return filters, nil
+}
+
+func (s *service) HideThread(ctx context.Context, userID, threadID uint64) error {
+	exists, err := s.repo.ThreadExists(threadID)
+	if err != nil {
+		return fmt.Errorf("failed to check thread: %w", err)
+	}
+	if !exists {
+		return utils.NotFound("thread")
+	}
+
+	count, err := s.repo.CountHiddenThreads(userID)
+	if err != nil {
+		return fmt.Errorf("failed to count hidden threads: %w", err)
+	}
+	if count >= maxHiddenThreads {
+		return fmt.Errorf("%w: at most %d", ErrHiddenLimit, maxHiddenThreads)
+	}
+
+	if err := s.repo.HideThread(userID, threadID); err != nil {
+		return fmt.Errorf("failed to hide thread: %w", err)
+	}
+	s.redisP.CachedDel(ctx, filtersCacheKey(userID))
+	return nil
+}
+
+func (s *service) UnhideThread(ctx context.Context, userID, threadID uint64) error {
+	if err := s.repo.UnhideThread(userID, threadID); err != nil {
+		return fmt.Errorf("failed to unhide thread: %w", err)
+	}
+	s.redisP.CachedDel(ctx, filtersCacheKey(userID))
+	return nil
+}
+
+func (s *service) AddRule(ctx context.Context, userID uint64, field, pattern string) (*Rule, error) {
+	if field != FieldContent && field != FieldNickname {
+		return nil, utils.Invalid("field", "field must be %q or %q", FieldContent, FieldNickname)
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		return nil, utils.Invalid("pattern", "invalid regular expression: %v", err)
+	}
+
+	count, err := s.repo.CountRules(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count filter rules: %w", err)
+	}
+	if count >= maxRules {
+		return nil, fmt.Errorf("%w: at most %d", ErrRuleLimit, maxRules)
+	}
+
+	rule := &Rule{
+		UserID:    userID,
+		Field:     field,
+		Pattern:   pattern,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.repo.CreateRule(rule); err != nil {
+		return nil, fmt.Errorf("failed to save filter rule: %w", err)
+	}
+	s.redisP.CachedDel(ctx, filtersCacheKey(userID))
+	return rule, nil
+}
+
+func (s *service) DeleteRule(ctx context.Context, userID, ruleID uint64) error {
+	deleted, err := s.repo.DeleteRule(userID, ruleID)
+	if err != nil {
+		return fmt.Errorf("failed to delete filter rule: %w", err)
+	}
+	if deleted == 0 {
+		return utils.NotFound("filter rule")
+	}
+	s.redisP.CachedDel(ctx, filtersCacheKey(userID))
+	return nil
+}
+
+func (s *service) ForUser(ctx context.Context, userID uint64) (*Set, error) {
+	filters, err := s.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return newSet(filters), nil
+}
@@ -0,0 +1,93 @@
+package filter
+
+import (
+	"regexp"
+
+	"backend/internal/app/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Set is one user's filters, compiled for matching against a listing.
+type Set struct {
+	hidden   map[uint64]bool
+	content  []*regexp.Regexp
+	nickname []*regexp.Regexp
+}
+
+func newSet(filters *FiltersResponse) *Set {
+	if len(filters.HiddenThreads) == 0 && len(filters.Rules) == 0 {
+		return nil
+	}
+
+	set := &Set{hidden: make(map[uint64]bool, len(filters.HiddenThreads))}
+	for _, id := range filters.HiddenThreads {
+		set.hidden[id] = true
+	}
+	for _, rule := range filters.Rules {
+		// Patterns are checked when saved, so this only skips rules saved
+		// under a different regexp implementation.
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			continue
+		}
+		switch rule.Field {
+		case FieldContent:
+			set.content = append(set.content, re)
+		case FieldNickname:
+			set.nickname = append(set.nickname, re)
+		}
+	}
+	return set
+}
+
+// HidesThread reports whether the user hid the thread.
+func (s *Set) HidesThread(threadID uint64) bool {
+	return s != nil && s.hidden[threadID]
+}
+
+// Matches reports whether a post by nickname with the given texts (title,
+// content) hits one of the user's rules.
+func (s *Set) Matches(nickname string, texts ...string) bool {
+	if s == nil {
+		return false
+	}
+	for _, re := range s.nickname {
+		if re.MatchString(nickname) {
+			return true
+		}
+	}
+	for _, re := range s.content {
+		for _, text := range texts {
+			if re.MatchString(text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FromRequest loads the filters of the user making the request. It returns
+// nil for anonymous requests and users without filters; a listing is not
+// worth failing over filters that cannot be loaded, so errors give nil too.
+func FromRequest(c *gin.Context, svc Service, sessionSvc session.Service) *Set {
+	sessionKey := session.Key(c)
+	if sessionKey == "" {
+		return nil
+	}
+	sess, err := sessionSvc.GetSessionByKey(sessionKey)
+	if err != nil {
+		return nil
+	}
+	set, err := svc.ForUser(c.Request.Context(), sess.UserID)
+	if err != nil {
+		return nil
+	}
+	return set
+}
+
+// HideRequested reports whether a listing asked for filtered items to be
+// left out (filter=hide) rather than marked.
+func HideRequested(c *gin.Context) bool {
+	return c.Query("filter") == "hide"
+}
@@ -10,6 +10,8 @@ import (
 
 type Handler interface {
 	Check(c *gin.Context)
+	Live(c *gin.Context)
+	Ready(c *gin.Context)
 }
 
 type handler struct {
@@ -30,9 +32,30 @@ func NewHandler(checker *utils.HealthChecker) Handler {
 // @Router /api/health [get]
 func (h *handler) Check(c *gin.Context) {
 	status := h.checker.Check(c.Request.Context())
-	if status.Status == "healthy" {
+	if status.Status != "degraded" {
 		c.JSON(http.StatusOK, status)
 	} else {
 		c.JSON(http.StatusServiceUnavailable, status)
 	}
 }
+
+// @Summary Liveness probe
+// @Description Report that the process is running; never checks dependencies
+// @Tags Health
+// @Produce json
+// @Success 200 {object} utils.LivenessStatus
+// @Router /healthz [get]
+func (h *handler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, h.checker.Live())
+}
+
+// @Summary Readiness probe
+// @Description Report whether PostgreSQL, Redis, MinIO and the schema are usable; 503 tells the orchestrator to stop routing traffic here
+// @Tags Health
+// @Produce json
+// @Success 200 {object} utils.HealthStatus
+// @Failure 503 {object} utils.HealthStatus
+// @Router /readyz [get]
+func (h *handler) Ready(c *gin.Context) {
+	h.Check(c)
+}
@@ -5,3 +5,9 @@ import "github.com/gin-gonic/gin"
 func RegisterRoutes(rg gin.IRoutes, handler Handler) {
 	rg.GET("/health", handler.Check)
 }
+
+// RegisterProbeRoutes mounts the orchestrator probes at the root, outside /api.
+func RegisterProbeRoutes(rg gin.IRoutes, handler Handler) {
+	rg.GET("/healthz", handler.Live)
+	rg.GET("/readyz", handler.Ready)
+}
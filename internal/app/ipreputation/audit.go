@@ -0,0 +1,64 @@
+package ipreputation
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"backend/internal/providers/redis"
+
+	"go.uber.org/zap"
+)
+
+const geoDecisionsKey = "geo:decisions"
+
+// Decisions the geo policies take on a request, as counted by Audit.
+const (
+	DecisionBlocked         = "blocked"
+	DecisionReadOnly        = "readonly"
+	DecisionCaptchaRequired = "captcha_required"
+	DecisionCaptchaPassed   = "captcha_passed"
+)
+
+// Audit counts geo policy decisions per country, across all instances.
+type Audit interface {
+	Record(ctx context.Context, country, decision string)
+	Decisions(ctx context.Context) (*GeoDecisions, error)
+}
+
+type audit struct {
+	redisP *redis.RedisProvider
+	logger *zap.SugaredLogger
+}
+
+func NewAudit(redisP *redis.RedisProvider, logger *zap.Logger) Audit {
+	return &audit{redisP: redisP, logger: logger.Sugar()}
+}
+
+// Record adds one to the country's count for decision. A failure is only
+// logged: the request it is counting goes on either way.
+func (a *audit) Record(ctx context.Context, country, decision string) {
+	if err := a.redisP.Client.HIncrBy(ctx, geoDecisionsKey, country+":"+decision, 1).Err(); err != nil {
+		a.logger.Warnw("Failed to count geo policy decision", "country", country, "decision", decision, "error", err)
+	}
+}
+
+func (a *audit) Decisions(ctx context.Context) (*GeoDecisions, error) {
+	fields, err := a.redisP.Client.HGetAll(ctx, geoDecisionsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	result := &GeoDecisions{Countries: make(map[string]map[string]int64)}
+	for field, value := range fields {
+		country, decision, ok := strings.Cut(field, ":")
+		n, err := strconv.ParseInt(value, 10, 64)
+		if !ok || err != nil {
+			continue
+		}
+		if result.Countries[country] == nil {
+			result.Countries[country] = make(map[string]int64)
+		}
+		result.Countries[country][decision] = n
+	}
+	return result, nil
+}
@@ -0,0 +1,38 @@
+package ipreputation
+
+import (
+	"net/http"
+
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	GetGeoDecisions(c *gin.Context)
+}
+
+type handler struct {
+	audit Audit
+}
+
+func NewHandler(audit Audit) Handler {
+	return &handler{audit: audit}
+}
+
+// @Summary Get geo policy decisions
+// @Description Get how many requests the geo policies refused (blocked, readonly), asked for a captcha (captcha_required) or let through with one (captcha_passed), per country, across all instances
+// @Tags Stats
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} GeoDecisions
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/stats/geo [get]
+func (h *handler) GetGeoDecisions(c *gin.Context) {
+	decisions, err := h.audit.Decisions(c.Request.Context())
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get geo policy decisions")
+		return
+	}
+	c.JSON(http.StatusOK, decisions)
+}
@@ -0,0 +1,91 @@
+package ipreputation
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// asnRange is one row of the ASN table: the addresses from start to end,
+// both included, announced by asn.
+type asnRange struct {
+	start, end netip.Addr
+	asn        uint32
+	country    string
+}
+
+// loadTorList reads a Tor exit list such as
+// https://check.torproject.org/torbulkexitlist: one address per line, with
+// blank lines and # comments skipped.
+func loadTorList(path string) (map[netip.Addr]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tor := make(map[netip.Addr]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if addr, err := netip.ParseAddr(line); err == nil {
+			tor[addr.Unmap()] = struct{}{}
+		}
+	}
+	return tor, scanner.Err()
+}
+
+// loadASNTable reads an ip2asn table (https://iptoasn.com): tab-separated
+// range_start, range_end, AS number, country code and description, IPv4 and
+// IPv6 alike. Unrouted ranges, with AS number 0, are skipped.
+func loadASNTable(path string) ([]asnRange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ranges []asnRange
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 4 {
+			continue
+		}
+		start, err1 := netip.ParseAddr(fields[0])
+		end, err2 := netip.ParseAddr(fields[1])
+		asn, err3 := strconv.ParseUint(trimAS(fields[2]), 10, 32)
+		if err1 != nil || err2 != nil || err3 != nil || start.Is4() != end.Is4() || end.Less(start) {
+			return nil, fmt.Errorf("line %d: malformed row", line)
+		}
+		if asn == 0 {
+			continue
+		}
+		country := strings.ToUpper(strings.TrimSpace(fields[3]))
+		if country == "NONE" {
+			country = ""
+		}
+		ranges = append(ranges, asnRange{start: start.Unmap(), end: end.Unmap(), asn: uint32(asn), country: country})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start.Less(ranges[j].start) })
+	return ranges, nil
+}
+
+// trimAS accepts AS numbers written as AS13335 as well as 13335.
+func trimAS(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > 2 && strings.EqualFold(s[:2], "as") {
+		s = s[2:]
+	}
+	return s
+}
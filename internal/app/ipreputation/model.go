@@ -0,0 +1,11 @@
+package ipreputation
+
+import "backend/internal/utils"
+
+// GeoDecisions are the geo policy decisions taken since the counters were
+// created, by country and then by decision.
+type GeoDecisions struct {
+	Countries map[string]map[string]int64 `json:"countries"`
+}
+
+type ErrorResponse = utils.ErrorResponse
@@ -0,0 +1,7 @@
+package ipreputation
+
+import "github.com/gin-gonic/gin"
+
+func RegisterAdminRoutes(rg *gin.RouterGroup, handler Handler) {
+	rg.GET("/stats/geo", handler.GetGeoDecisions)
+}
@@ -0,0 +1,180 @@
+package ipreputation
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"backend/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+// defaultDatacenterASNs are large hosting, cloud and VPN networks, used when
+// no list is configured.
+var defaultDatacenterASNs = []uint32{
+	16509,  // Amazon
+	14618,  // Amazon
+	15169,  // Google
+	396982, // Google Cloud
+	8075,   // Microsoft
+	14061,  // DigitalOcean
+	16276,  // OVH
+	24940,  // Hetzner
+	63949,  // Akamai (Linode)
+	20473,  // Vultr
+	45102,  // Alibaba Cloud
+	12876,  // Scaleway
+	51167,  // Contabo
+	9009,   // M247
+	60068,  // Datacamp (CDN77)
+	212238, // Datacamp
+	136787, // TEFINCOM (NordVPN)
+	13335,  // Cloudflare (WARP)
+}
+
+type Service interface {
+	// Lookup returns what the lists say about ip. An address that is not
+	// on them, or cannot be parsed, gets the zero Origin.
+	Lookup(ip string) utils.Origin
+	// Run reloads the lists whenever their files change, checking every
+	// refresh, until ctx is cancelled.
+	Run(ctx context.Context, refresh time.Duration)
+}
+
+type lists struct {
+	tor    map[netip.Addr]struct{}
+	ranges []asnRange
+}
+
+type service struct {
+	torPath        string
+	asnPath        string
+	datacenterASNs map[uint32]bool
+	logger         *zap.SugaredLogger
+
+	mu     sync.RWMutex
+	lists  lists
+	torMod time.Time
+	asnMod time.Time
+}
+
+// NewService loads the Tor exit list at torPath, one address per line,
+// and the ip2asn table at asnPath; either may be empty to do without it.
+// Networks in datacenterASNs, or a built-in list of large hosting and VPN
+// networks when it is empty, count as datacenters. A list that fails to
+// load is logged and left empty until it loads.
+func NewService(torPath, asnPath string, datacenterASNs []string, logger *zap.Logger) Service {
+	s := &service{
+		torPath:        torPath,
+		asnPath:        asnPath,
+		datacenterASNs: make(map[uint32]bool),
+		logger:         logger.Sugar(),
+	}
+	for _, asn := range datacenterASNs {
+		n, err := strconv.ParseUint(trimAS(asn), 10, 32)
+		if err != nil {
+			s.logger.Warnw("Ignoring invalid datacenter ASN", "asn", asn)
+			continue
+		}
+		s.datacenterASNs[uint32(n)] = true
+	}
+	if len(s.datacenterASNs) == 0 {
+		for _, asn := range defaultDatacenterASNs {
+			s.datacenterASNs[asn] = true
+		}
+	}
+	s.reload()
+	return s
+}
+
+func (s *service) Lookup(ip string) utils.Origin {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return utils.Origin{}
+	}
+	addr = addr.Unmap()
+
+	s.mu.RLock()
+	l := s.lists
+	s.mu.RUnlock()
+
+	var origin utils.Origin
+	_, origin.Tor = l.tor[addr]
+	// Ranges are sorted by start and do not overlap, so the candidate is
+	// the last range starting at or before addr.
+	i := sort.Search(len(l.ranges), func(i int) bool { return addr.Less(l.ranges[i].start) })
+	if i > 0 && !l.ranges[i-1].end.Less(addr) {
+		r := l.ranges[i-1]
+		origin.ASN = r.asn
+		origin.Country = r.country
+		origin.Datacenter = s.datacenterASNs[r.asn]
+	}
+	return origin
+}
+
+func (s *service) Run(ctx context.Context, refresh time.Duration) {
+	if s.torPath == "" && s.asnPath == "" {
+		return
+	}
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.reload()
+		}
+	}
+}
+
+// reload reads the files that changed since they were last loaded. A file
+// that fails to load keeps the list that was loaded before.
+func (s *service) reload() {
+	s.mu.RLock()
+	next, torMod, asnMod := s.lists, s.torMod, s.asnMod
+	s.mu.RUnlock()
+
+	changed := false
+	if mod, ok := s.modified(s.torPath, torMod); ok {
+		if tor, err := loadTorList(s.torPath); err != nil {
+			s.logger.Warnw("Failed to load Tor exit list", "path", s.torPath, "error", err)
+		} else {
+			next.tor, torMod, changed = tor, mod, true
+			s.logger.Infow("Loaded Tor exit list", "addresses", len(tor))
+		}
+	}
+	if mod, ok := s.modified(s.asnPath, asnMod); ok {
+		if ranges, err := loadASNTable(s.asnPath); err != nil {
+			s.logger.Warnw("Failed to load ASN table", "path", s.asnPath, "error", err)
+		} else {
+			next.ranges, asnMod, changed = ranges, mod, true
+			s.logger.Infow("Loaded ASN table", "ranges", len(ranges))
+		}
+	}
+	if !changed {
+		return
+	}
+	s.mu.Lock()
+	s.lists, s.torMod, s.asnMod = next, torMod, asnMod
+	s.mu.Unlock()
+}
+
+// modified reports the modification time of the file at path when it
+// differs from loaded.
+func (s *service) modified(path string, loaded time.Time) (time.Time, bool) {
+	if path == "" {
+		return time.Time{}, false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		s.logger.Warnw("Failed to stat IP reputation list", "path", path, "error", err)
+		return time.Time{}, false
+	}
+	return info.ModTime(), !info.ModTime().Equal(loaded)
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"backend/internal/app/announcement"
+	"backend/internal/app/cleanup"
+	"backend/internal/app/session"
+	"backend/internal/app/stats"
+	"backend/internal/app/thread"
+	"backend/internal/config"
+	"backend/internal/providers/minio"
+	"backend/internal/scheduler"
+
+	"go.uber.org/zap"
+)
+
+func registerJobs(
+	s *scheduler.Scheduler,
+	cfg *config.Config,
+	logger *zap.Logger,
+	minioProvider *minio.MinioProvider,
+	sessionService session.Service,
+	threadService thread.Service,
+	statsService stats.Service,
+	announcementService announcement.Service,
+	cleanupService cleanup.Service,
+) error {
+	if minioProvider != nil {
+		if err := s.Add("tmp_cleanup", cfg.JobTmpCleanupSchedule, 10*time.Minute, func(ctx context.Context) error {
+			return minioProvider.DeleteTmpFilesOlderThan(cfg.TmpFileMaxAge)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := s.Add("session_expiry", cfg.JobSessionExpirySchedule, 5*time.Minute, func(ctx context.Context) error {
+		n, err := sessionService.ExpireSessions(ctx)
+		if err == nil && n > 0 {
+			logger.Info("Expired sessions", zap.Int64("count", n))
+		}
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := s.Add("thread_archive", cfg.JobArchiveSchedule, 5*time.Minute, func(ctx context.Context) error {
+		_, err := threadService.ArchiveInactiveThreads(ctx, cfg.ThreadArchiveAfter)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := s.Add("purge_deleted", cfg.JobPurgeDeletedSchedule, 30*time.Minute, func(ctx context.Context) error {
+		_, err := cleanupService.PurgeDeleted(ctx, cfg.DeletedRetention)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := s.Add("purge_archived", cfg.JobPurgeArchivedSchedule, 30*time.Minute, func(ctx context.Context) error {
+		_, err := cleanupService.PurgeArchived(ctx, cfg.ArchiveRetention)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := s.Add("top_threads_ranking", cfg.JobTopThreadsSchedule, time.Minute, func(ctx context.Context) error {
+		_, err := threadService.RebuildTopRanking(ctx, cfg.TopThreadsHalfLife)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := s.Add("trending_threads", cfg.JobTrendingSchedule, 5*time.Minute, func(ctx context.Context) error {
+		_, err := threadService.RecomputeTrending(ctx, cfg.TrendingHalfLife)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := s.Add("stats_aggregation", cfg.JobStatsSchedule, time.Minute, func(ctx context.Context) error {
+		_, err := statsService.Aggregate(ctx)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := s.Add("hourly_posts", cfg.JobHourlyPostsSchedule, 5*time.Minute, func(ctx context.Context) error {
+		return statsService.AggregateHourly(ctx)
+	}); err != nil {
+		return err
+	}
+
+	if err := s.Add("announcements_publish", cfg.JobAnnouncementsSchedule, time.Minute, func(ctx context.Context) error {
+		_, err := announcementService.PublishDue(ctx)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := s.Add("storage_stats", cfg.JobStorageStatsSchedule, 30*time.Minute, func(ctx context.Context) error {
+		_, err := statsService.AggregateStorage(ctx)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package linkpreview
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	ProviderYouTube    = "youtube"
+	ProviderVimeo      = "vimeo"
+	ProviderSoundCloud = "soundcloud"
+)
+
+// maxEmbeds is how many players a single post can carry.
+const maxEmbeds = 4
+
+var (
+	youTubeID      = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	vimeoID        = regexp.MustCompile(`^[0-9]{1,12}$`)
+	vimeoHash      = regexp.MustCompile(`^[0-9a-f]{6,20}$`)
+	soundCloudName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,100}$`)
+	youTubeTime    = regexp.MustCompile(`^(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s?)?$`)
+)
+
+// soundCloudReserved are first path segments that are SoundCloud pages
+// rather than users.
+var soundCloudReserved = map[string]bool{
+	"discover": true, "search": true, "stream": true, "upload": true,
+	"you": true, "charts": true, "pages": true, "settings": true, "messages": true,
+}
+
+// Embeds returns the YouTube, Vimeo and SoundCloud links in content as
+// embeds, at most maxEmbeds of them, each video or track once. Any other
+// link, or one whose ID does not look valid, is left out.
+func Embeds(content string) []*Embed {
+	var embeds []*Embed
+	seen := make(map[string]bool)
+	for _, match := range linkPattern.FindAllString(content, -1) {
+		embed := parseEmbed(trimLink(match))
+		if embed == nil || seen[embed.Provider+":"+embed.ID] {
+			continue
+		}
+		seen[embed.Provider+":"+embed.ID] = true
+		embeds = append(embeds, embed)
+		if len(embeds) == maxEmbeds {
+			break
+		}
+	}
+	return embeds
+}
+
+func parseEmbed(link string) *Embed {
+	u, err := url.Parse(link)
+	if err != nil || u.User != nil || (u.Port() != "" && u.Port() != "443" && u.Port() != "80") {
+		return nil
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	segments := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+
+	switch host {
+	case "youtube.com", "m.youtube.com", "music.youtube.com", "youtube-nocookie.com":
+		var id string
+		switch {
+		case len(segments) == 1 && segments[0] == "watch":
+			id = u.Query().Get("v")
+		case len(segments) == 2 && (segments[0] == "shorts" || segments[0] == "embed" || segments[0] == "live" || segments[0] == "v"):
+			id = segments[1]
+		}
+		return youTube(id, u.Query())
+	case "youtu.be":
+		if len(segments) == 1 {
+			return youTube(segments[0], u.Query())
+		}
+	case "vimeo.com", "player.vimeo.com":
+		// vimeo.com/ID, vimeo.com/ID/HASH for unlisted videos,
+		// vimeo.com/channels/NAME/ID and player.vimeo.com/video/ID?h=HASH.
+		var id, hash string
+		switch {
+		case host == "player.vimeo.com" && len(segments) == 2 && segments[0] == "video":
+			id, hash = segments[1], u.Query().Get("h")
+		case host == "vimeo.com" && len(segments) == 1:
+			id = segments[0]
+		case host == "vimeo.com" && len(segments) == 2 && vimeoID.MatchString(segments[0]):
+			id, hash = segments[0], segments[1]
+		case host == "vimeo.com" && len(segments) == 3 && segments[0] == "channels":
+			id = segments[2]
+		}
+		return vimeo(id, hash)
+	case "soundcloud.com", "m.soundcloud.com":
+		// soundcloud.com/USER/TRACK or soundcloud.com/USER/sets/PLAYLIST.
+		if len(segments) == 2 || (len(segments) == 3 && segments[1] == "sets") {
+			return soundCloud(segments)
+		}
+	}
+	return nil
+}
+
+func youTube(id string, query url.Values) *Embed {
+	if !youTubeID.MatchString(id) {
+		return nil
+	}
+	embed := &Embed{
+		Provider: ProviderYouTube,
+		ID:       id,
+		URL:      "https://www.youtube.com/watch?v=" + id,
+		EmbedURL: "https://www.youtube-nocookie.com/embed/" + id,
+	}
+	if start := youTubeStart(firstOf(query.Get("t"), query.Get("start"))); start > 0 {
+		embed.Start = start
+		embed.EmbedURL += "?start=" + strconv.Itoa(start)
+	}
+	return embed
+}
+
+// youTubeStart reads t=90, t=90s or t=1h2m3s as seconds; anything else is 0.
+func youTubeStart(t string) int {
+	m := youTubeTime.FindStringSubmatch(t)
+	if t == "" || m == nil {
+		return 0
+	}
+	seconds := 0
+	for i, unit := range []int{3600, 60, 1} {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil || n > 86400 {
+			return 0
+		}
+		seconds += n * unit
+	}
+	return seconds
+}
+
+func vimeo(id, hash string) *Embed {
+	if !vimeoID.MatchString(id) || (hash != "" && !vimeoHash.MatchString(hash)) {
+		return nil
+	}
+	embed := &Embed{
+		Provider: ProviderVimeo,
+		ID:       id,
+		URL:      "https://vimeo.com/" + id,
+		EmbedURL: "https://player.vimeo.com/video/" + id,
+	}
+	if hash != "" {
+		embed.URL += "/" + hash
+		embed.EmbedURL += "?h=" + hash
+	}
+	return embed
+}
+
+func soundCloud(segments []string) *Embed {
+	if soundCloudReserved[strings.ToLower(segments[0])] {
+		return nil
+	}
+	for _, segment := range segments {
+		if !soundCloudName.MatchString(segment) {
+			return nil
+		}
+	}
+	id := strings.ToLower(strings.Join(segments, "/"))
+	page := "https://soundcloud.com/" + id
+	return &Embed{
+		Provider: ProviderSoundCloud,
+		ID:       id,
+		URL:      page,
+		EmbedURL: "https://w.soundcloud.com/player/?url=" + url.QueryEscape(page),
+	}
+}
@@ -0,0 +1,161 @@
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// maxPageBytes is how much of a page is read; the tags a preview needs
+	// are in the head, near the start.
+	maxPageBytes = 512 << 10
+
+	maxTitleLength       = 200
+	maxDescriptionLength = 500
+)
+
+func (s *service) fetch(ctx context.Context, link string) (*Preview, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "404chan-linkpreview/1.0")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("content type %q", mediaType)
+	}
+
+	preview := parse(io.LimitReader(resp.Body, maxPageBytes), resp.Request.URL)
+	if preview.Title == "" && preview.Description == "" {
+		return nil, errors.New("page has no title or description")
+	}
+	preview.URL = link
+	return preview, nil
+}
+
+// parse reads the page's head: Open Graph and Twitter card tags win over
+// <title> and the description meta tag.
+func parse(r io.Reader, base *url.URL) *Preview {
+	var title, description, image, siteName, docTitle, metaDescription string
+	z := html.NewTokenizer(r)
+	inTitle := false
+tokens:
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			break tokens
+		case html.TextToken:
+			if inTitle {
+				docTitle += string(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				break tokens
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = tt == html.StartTagToken
+			case "body":
+				break tokens
+			case "meta":
+				if !hasAttr {
+					continue
+				}
+				var key, content string
+				for {
+					attr, value, more := z.TagAttr()
+					switch string(attr) {
+					case "property", "name":
+						key = strings.ToLower(string(value))
+					case "content":
+						content = string(value)
+					}
+					if !more {
+						break
+					}
+				}
+				switch key {
+				case "og:title":
+					title = content
+				case "twitter:title":
+					title = firstOf(title, content)
+				case "og:description":
+					description = content
+				case "twitter:description":
+					description = firstOf(description, content)
+				case "description":
+					metaDescription = content
+				case "og:image", "og:image:url":
+					image = firstOf(image, content)
+				case "twitter:image":
+					image = firstOf(image, content)
+				case "og:site_name":
+					siteName = content
+				}
+			}
+		}
+	}
+	return &Preview{
+		Title:       clip(firstOf(title, docTitle), maxTitleLength),
+		Description: clip(firstOf(description, metaDescription), maxDescriptionLength),
+		ImageURL:    imageURL(base, image),
+		SiteName:    clip(siteName, maxTitleLength),
+	}
+}
+
+// imageURL resolves the image against the page and keeps only http and
+// https images; the client loads it, not us.
+func imageURL(base *url.URL, image string) string {
+	if image == "" {
+		return ""
+	}
+	u, err := base.Parse(strings.TrimSpace(image))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// clip collapses whitespace and cuts s to at most n characters.
+func clip(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) > n {
+		s = string([]rune(s)[:n-1]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,24 @@
+package linkpreview
+
+// Preview is what a link card shows. URL is the link as it was posted;
+// everything else comes from the page's title, description and Open Graph
+// tags and may be empty.
+type Preview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+// Embed is a media link from a whitelisted provider, reduced to its
+// canonical ID. The client builds the player from EmbedURL only, never
+// from the posted link.
+type Embed struct {
+	Provider string `json:"provider"`
+	ID       string `json:"id"`
+	URL      string `json:"url"`
+	EmbedURL string `json:"embed_url"`
+	// Start is the YouTube start time in seconds.
+	Start int `json:"start,omitempty"`
+}
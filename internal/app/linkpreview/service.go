@@ -0,0 +1,115 @@
+package linkpreview
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"backend/internal/providers/redis"
+	"backend/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+// maxLinks is how many links of a post get a preview; the rest are left as
+// plain links.
+const maxLinks = 3
+
+// failureTTL remembers for a while that a link has no preview, so a link
+// pasted again and again is not fetched every time.
+const failureTTL = 10 * time.Minute
+
+var linkPattern = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `]+`)
+
+type Service interface {
+	// Previews returns the previews of the first links in content, in order.
+	// Links that cannot be fetched, are not HTML pages or resolve to a
+	// private address are left out.
+	Previews(ctx context.Context, content string) []*Preview
+}
+
+type service struct {
+	redisP   *redis.RedisProvider
+	client   *http.Client
+	cacheTTL time.Duration
+	logger   *zap.SugaredLogger
+}
+
+// NewService returns the preview service. timeout bounds each page fetch,
+// redirects included, and cacheTTL is how long a fetched preview is reused.
+func NewService(redisP *redis.RedisProvider, timeout, cacheTTL time.Duration, logger *zap.Logger) Service {
+	return &service{
+		redisP:   redisP,
+		client:   utils.NewPublicClient(timeout, "80", "443"),
+		cacheTTL: cacheTTL,
+		logger:   logger.Sugar(),
+	}
+}
+
+func (s *service) Previews(ctx context.Context, content string) []*Preview {
+	var previews []*Preview
+	for _, link := range Links(content) {
+		if preview := s.preview(ctx, link); preview != nil {
+			previews = append(previews, preview)
+		}
+	}
+	return previews
+}
+
+func (s *service) preview(ctx context.Context, link string) *Preview {
+	sum := sha256.Sum256([]byte(link))
+	cacheKey := "linkpreview:" + hex.EncodeToString(sum[:])
+	if cached, err := s.redisP.Get(ctx, cacheKey).Result(); err == nil {
+		if cached == redis.NotFound {
+			return nil
+		}
+		var preview Preview
+		if json.Unmarshal([]byte(cached), &preview) == nil {
+			return &preview
+		}
+	}
+
+	preview, err := s.fetch(ctx, link)
+	if err != nil {
+		s.logger.Debugw("No link preview", "url", link, "error", err)
+		s.redisP.SetEX(ctx, cacheKey, redis.NotFound, failureTTL)
+		return nil
+	}
+	if data, err := json.Marshal(preview); err == nil {
+		s.redisP.SetEX(ctx, cacheKey, data, s.cacheTTL)
+	}
+	return preview
+}
+
+// Links returns the distinct http and https links in content, at most
+// maxLinks of them, without the punctuation that usually ends a sentence.
+// Media links are left out; they get an Embed instead of a preview.
+func Links(content string) []string {
+	var links []string
+	seen := make(map[string]bool)
+	for _, match := range linkPattern.FindAllString(content, -1) {
+		link := trimLink(match)
+		u, err := url.Parse(link)
+		if err != nil || u.Host == "" || u.User != nil || seen[link] || parseEmbed(link) != nil {
+			continue
+		}
+		seen[link] = true
+		links = append(links, link)
+		if len(links) == maxLinks {
+			break
+		}
+	}
+	return links
+}
+
+// trimLink drops the punctuation that usually ends a sentence rather than
+// a link.
+func trimLink(match string) string {
+	return strings.TrimRight(match, ".,;:!?)]}")
+}
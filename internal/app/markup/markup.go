@@ -0,0 +1,233 @@
+// Package markup splits post content into typed segments, so a client can
+// render the parts that need it, such as math and code, without ever
+// treating user text as HTML.
+package markup
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Segment types.
+const (
+	TypeText = "text"
+	TypeMath = "math"
+	TypeCode = "code"
+)
+
+// maxMathLength bounds one math segment in bytes; longer ones stay text.
+const maxMathLength = 1000
+
+// languagePattern is what a fence's language hint may look like: c++, c#,
+// objective-c, f# and the like. Anything else leaves the block unlabelled.
+var languagePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_+#.-]{0,31}$`)
+
+// Segment is a piece of a post. Text is the raw source of the piece, with
+// the delimiters stripped from math and the fence lines from code.
+type Segment struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+	// Display is set on $$...$$ math, which is rendered as a block of its
+	// own rather than inline.
+	Display bool `json:"display,omitempty"`
+	// Language is the lowercased hint after a code fence, as in ```go.
+	Language string `json:"language,omitempty"`
+}
+
+// Options are the markup a board turns on. Fenced code blocks are always
+// recognised.
+type Options struct {
+	// Math isolates $...$ and $$...$$ as math segments.
+	Math bool
+}
+
+// Parse splits content into segments. It returns nil when content has no
+// segment but text, so plain posts carry nothing extra and the client shows
+// content as it is.
+func Parse(content string, opts Options) []*Segment {
+	hasMath := opts.Math && strings.Contains(content, "$")
+	if !hasMath && !strings.Contains(content, "```") {
+		return nil
+	}
+	var segments []*Segment
+	for _, block := range splitFences(content) {
+		if block.Type == TypeText && hasMath {
+			segments = append(segments, parseMath(block.Text)...)
+		} else {
+			segments = append(segments, block)
+		}
+	}
+	for _, s := range segments {
+		if s.Type != TypeText {
+			return segments
+		}
+	}
+	return nil
+}
+
+// splitFences cuts the fenced code blocks out of content. A fence is a line
+// of three or more backticks, indented by at most three spaces, optionally
+// followed by a language; it is closed by a line of at least as many
+// backticks, or by the end of the post. Code is never parsed for math.
+func splitFences(content string) []*Segment {
+	var segments []*Segment
+	textStart := 0
+	for pos := 0; pos < len(content); {
+		line, next := lineAt(content, pos)
+		fence, language, ok := openFence(line)
+		if !ok {
+			pos = next
+			continue
+		}
+		end, after := len(content), len(content)
+		for p := next; p < len(content); {
+			l, n := lineAt(content, p)
+			if closesFence(l, fence) {
+				end, after = p, n
+				break
+			}
+			p = n
+		}
+		if pos > textStart {
+			segments = append(segments, &Segment{Type: TypeText, Text: content[textStart:pos]})
+		}
+		code := content[min(next, end):end]
+		code = strings.TrimSuffix(strings.TrimSuffix(code, "\n"), "\r")
+		segments = append(segments, &Segment{Type: TypeCode, Text: code, Language: language})
+		textStart, pos = after, after
+	}
+	if textStart < len(content) {
+		segments = append(segments, &Segment{Type: TypeText, Text: content[textStart:]})
+	}
+	return segments
+}
+
+// lineAt returns the line starting at pos, without its line break, and the
+// offset of the next line.
+func lineAt(content string, pos int) (string, int) {
+	end := strings.IndexByte(content[pos:], '\n')
+	if end < 0 {
+		return strings.TrimSuffix(content[pos:], "\r"), len(content)
+	}
+	return strings.TrimSuffix(content[pos:pos+end], "\r"), pos + end + 1
+}
+
+// openFence reports whether line opens a code block, with the number of
+// backticks that must close it and the language hint, if any.
+func openFence(line string) (fence int, language string, ok bool) {
+	rest, ok := unindent(line)
+	if !ok {
+		return 0, "", false
+	}
+	fence = len(rest) - len(strings.TrimLeft(rest, "`"))
+	if fence < 3 {
+		return 0, "", false
+	}
+	info := strings.TrimSpace(rest[fence:])
+	// A backtick in the info string means the line is inline code.
+	if strings.Contains(info, "`") {
+		return 0, "", false
+	}
+	if fields := strings.Fields(info); len(fields) > 0 {
+		if hint := strings.ToLower(fields[0]); languagePattern.MatchString(hint) {
+			language = hint
+		}
+	}
+	return fence, language, true
+}
+
+func closesFence(line string, fence int) bool {
+	rest, ok := unindent(line)
+	if !ok {
+		return false
+	}
+	rest = strings.TrimRight(rest, " \t")
+	return len(rest) >= fence && strings.Trim(rest, "`") == ""
+}
+
+// unindent strips up to three leading spaces; a line indented further is
+// not a fence.
+func unindent(line string) (string, bool) {
+	rest := strings.TrimLeft(line, " ")
+	return rest, len(line)-len(rest) <= 3
+}
+
+// parseMath isolates the math in content. Inline math follows the usual
+// TeX-in-Markdown rules so prices are left alone: the opening $ is not
+// followed by a space, the closing $ is not preceded by one nor followed by
+// a digit, and both are on the same line. \$ is a literal dollar sign.
+func parseMath(content string) []*Segment {
+	var segments []*Segment
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			segments = append(segments, &Segment{Type: TypeText, Text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(content); {
+		c := content[i]
+		if c == '\\' && i+1 < len(content) && content[i+1] == '$' {
+			text.WriteByte('$')
+			i += 2
+			continue
+		}
+		if c != '$' {
+			text.WriteByte(c)
+			i++
+			continue
+		}
+		if math, end, display := scanMath(content, i); end > 0 {
+			flush()
+			segments = append(segments, &Segment{Type: TypeMath, Text: math, Display: display})
+			i = end
+			continue
+		}
+		text.WriteByte(c)
+		i++
+	}
+	flush()
+	return segments
+}
+
+// scanMath reads the math opened by the $ at start, returning its source
+// and the offset just past the closing delimiter, or end 0 when the $ opens
+// nothing.
+func scanMath(content string, start int) (math string, end int, display bool) {
+	if strings.HasPrefix(content[start:], "$$") {
+		body := content[start+2:]
+		stop := strings.Index(body, "$$")
+		if stop < 0 || stop > maxMathLength || strings.TrimSpace(body[:stop]) == "" {
+			return "", 0, false
+		}
+		return strings.TrimSpace(body[:stop]), start + 2 + stop + 2, true
+	}
+
+	open := start + 1
+	if open >= len(content) || isSpace(content[open]) {
+		return "", 0, false
+	}
+	for j := open; j < len(content) && j-open <= maxMathLength; j++ {
+		switch content[j] {
+		case '\n':
+			return "", 0, false
+		case '\\':
+			j++
+		case '$':
+			if j == open || isSpace(content[j-1]) || (j+1 < len(content) && isDigit(content[j+1])) {
+				continue
+			}
+			return content[open:j], j + 1, false
+		}
+	}
+	return "", 0, false
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
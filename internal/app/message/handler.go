@@ -1,10 +1,15 @@
 package message
 
 import (
-	"backend/internal/app/session"
+	"errors"
 	"net/http"
 	"strconv"
 
+	"backend/internal/app/board"
+	"backend/internal/app/filter"
+	"backend/internal/app/session"
+	"backend/internal/utils"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -13,17 +18,25 @@ type Handler interface {
 	GetMessagesByThreadID(c *gin.Context)
 	GetMessageCooldown(c *gin.Context)
 	GetMessageByID(c *gin.Context)
+	ResolvePost(c *gin.Context)
+	GetReplies(c *gin.Context)
+	SyncMessages(c *gin.Context)
+	SearchMessages(c *gin.Context)
+	DeleteMessage(c *gin.Context)
+	RestoreMessage(c *gin.Context)
 }
 
 type handler struct {
 	service    Service
 	sessionSvc session.Service
+	filterSvc  filter.Service
 }
 
-func NewHandler(service Service, sessionSvc session.Service) Handler {
+func NewHandler(service Service, sessionSvc session.Service, filterSvc filter.Service) Handler {
 	return &handler{
 		service:    service,
 		sessionSvc: sessionSvc,
+		filterSvc:  filterSvc,
 	}
 }
 
@@ -34,25 +47,29 @@ func NewHandler(service Service, sessionSvc session.Service) Handler {
 // @Produce json
 // @Param thread_id path int true "Thread ID"
 // @Param request body CreateMessageRequest true "Message creation request"
+// @Param Idempotency-Key header string false "Replays the original response to retries with the same key"
 // @Success 201 {object} MessageResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
 // @Router /api/messages/{thread_id} [post]
 func (h *handler) CreateMessage(c *gin.Context) {
 	threadIDStr := c.Param("thread_id")
 	threadID, err := strconv.ParseUint(threadIDStr, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid thread ID"})
+		utils.RespondError(c, http.StatusBadRequest, "invalid thread ID")
 		return
 	}
 	var req CreateMessageRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		utils.RespondError(c, http.StatusBadRequest, "invalid request body")
 		return
 	}
-	sessionKey := c.Query("session_key")
+	sessionKey := session.Key(c)
 	if sessionKey == "" {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "session_key is required"})
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
 		return
 	}
 	message, err := h.service.CreateMessage(
@@ -62,16 +79,18 @@ func (h *handler) CreateMessage(c *gin.Context) {
 		req.Content,
 		req.ParentID,
 		req.ShowAsAuthor,
+		req.Sage,
 		req.AttachmentIDs,
 	)
 	if err != nil {
-		if err.Error() == "message creation cooldown: ..." {
-			c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: err.Error()})
+		if errors.Is(err, board.ErrReadOnly) {
+			utils.RespondError(c, http.StatusForbidden, err.Error())
 			return
 		}
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		utils.WriteError(c, err)
 		return
 	}
+	utils.SetCooldownHeaders(c.Writer.Header(), h.service.Cooldown(c.Request.Context(), threadID))
 	c.JSON(http.StatusCreated, message)
 }
 
@@ -81,36 +100,79 @@ func (h *handler) CreateMessage(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param thread_id path int true "Thread ID"
-// @Param page query int false "Page number" default(1)
+// @Param page query string false "Page number, or last for the last page" default(1)
 // @Param limit query int false "Items per page" default(10)
+// @Param order query string false "Page order: desc (newest first) or asc (oldest first)" Enums(desc, asc) default(desc)
+// @Param before_id query int false "Return messages older than this ID, newest first (keyset mode, replaces page)"
+// @Param after_id query int false "Return messages newer than this ID, oldest first (keyset mode, replaces page)"
+// @Param filter query string false "What to do with messages matching the user's filter rules: mark them with filtered=true (mark) or leave them out (hide)" default("mark")
 // @Success 200 {object} MessageListResponse
+// @Failure 400 {object} ErrorResponse
 // @Router /api/messages/{thread_id} [get]
 func (h *handler) GetMessagesByThreadID(c *gin.Context) {
 	threadIDStr := c.Param("thread_id")
 	threadID, err := strconv.ParseUint(threadIDStr, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid thread ID"})
+		utils.RespondError(c, http.StatusBadRequest, "invalid thread ID")
 		return
 	}
 	pageStr := c.DefaultQuery("page", "1")
 	limitStr := c.DefaultQuery("limit", "10")
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		page = 1
+	// Page 0 asks the service for the last page.
+	page := 0
+	if pageStr != "last" {
+		page, err = strconv.Atoi(pageStr)
+		if err != nil || page < 1 {
+			page = 1
+		}
 	}
 	limit, err := strconv.Atoi(limitStr)
 	if err != nil || limit < 1 || limit > 50 {
 		limit = 10
 	}
-	messages, total, err := h.service.GetMessagesByThreadID(c.Request.Context(), threadID, page, limit)
+	var ascending bool
+	switch c.DefaultQuery("order", "desc") {
+	case "desc":
+	case "asc":
+		ascending = true
+	default:
+		utils.RespondError(c, http.StatusBadRequest, "order must be asc or desc")
+		return
+	}
+
+	beforeID, ok := optionalID(c, "before_id")
+	if !ok {
+		return
+	}
+	afterID, ok := optionalID(c, "after_id")
+	if !ok {
+		return
+	}
+	if beforeID != nil && afterID != nil {
+		utils.RespondError(c, http.StatusBadRequest, "before_id and after_id cannot be combined")
+		return
+	}
+	if beforeID != nil || afterID != nil {
+		messages, cursor, err := h.service.GetMessagesByCursor(c.Request.Context(), threadID, beforeID, afterID, limit)
+		if err != nil {
+			utils.RespondError(c, http.StatusInternalServerError, "failed to get messages")
+			return
+		}
+		messages = h.applyFilters(c, messages)
+		c.JSON(http.StatusOK, MessageListResponse{Messages: messages, Cursor: cursor})
+		return
+	}
+
+	messages, total, page, err := h.service.GetMessagesByThreadID(c.Request.Context(), threadID, page, limit, ascending)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to get messages"})
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get messages")
 		return
 	}
+	messages = h.applyFilters(c, messages)
 	totalPages := (total + int64(limit) - 1) / int64(limit)
 	c.JSON(http.StatusOK, MessageListResponse{
 		Messages: messages,
-		Pagination: Pagination{
+		Pagination: &Pagination{
 			Page:       page,
 			Limit:      limit,
 			Total:      total,
@@ -120,28 +182,36 @@ func (h *handler) GetMessagesByThreadID(c *gin.Context) {
 }
 
 // @Summary Get message creation cooldown
-// @Description Get the timestamp of the last message creation
+// @Description Get the timestamp of the last message creation and the current cooldown length, in the given thread's board if thread_id is set
 // @Tags Message
 // @Accept json
 // @Produce json
-// @Param session_key query string true "Session key"
+// @Security BearerAuth
+// @Param thread_id query int false "Thread ID"
 // @Success 200 {object} MessageCooldownResponse
 // @Failure 401 {object} ErrorResponse
 // @Router /api/messages/cooldown [get]
 func (h *handler) GetMessageCooldown(c *gin.Context) {
-	sessionKey := c.Query("session_key")
+	sessionKey := session.Key(c)
 	if sessionKey == "" {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "session_key is required"})
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
 		return
 	}
 	user, err := h.sessionSvc.GetUserBySessionKey(sessionKey)
 	if err != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "user not found"})
+		utils.RespondError(c, http.StatusNotFound, "user not found")
 		return
 	}
+	var threadID uint64
+	if raw := c.Query("thread_id"); raw != "" {
+		if threadID, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			utils.RespondError(c, http.StatusBadRequest, "invalid thread ID")
+			return
+		}
+	}
 	lastMessageTime, err := h.service.GetMessageCooldown(user.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to get last message time"})
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get last message time")
 		return
 	}
 	var lastMessageUnix *int64
@@ -151,6 +221,7 @@ func (h *handler) GetMessageCooldown(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, MessageCooldownResponse{
 		LastMessageCreationUnix: lastMessageUnix,
+		CooldownSeconds:         int64(h.service.Cooldown(c.Request.Context(), threadID).Seconds()),
 	})
 }
 
@@ -168,13 +239,262 @@ func (h *handler) GetMessageByID(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid message ID"})
+		utils.RespondError(c, http.StatusBadRequest, "invalid message ID")
 		return
 	}
 	message, err := h.service.GetMessageByID(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "message not found"})
+		utils.WriteError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, MessageResponse{Message: message})
 }
+
+// @Summary Get messages newer than a known one
+// @Description Catch up on a thread after a dropped websocket: the messages after after_id, oldest first, at most limit of them. Repeat with cursor.after_id while cursor.has_more is true.
+// @Tags Message
+// @Produce json
+// @Param id path int true "Thread ID"
+// @Param after_id query int true "ID of the newest message the client has"
+// @Param limit query int false "Maximum number of messages (max 50)" default(50)
+// @Param filter query string false "What to do with messages matching the user's filter rules: mark them with filtered=true (mark) or leave them out (hide)" default("mark")
+// @Success 200 {object} MessageListResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/threads/{id}/messages [get]
+func (h *handler) SyncMessages(c *gin.Context) {
+	// The route shares its wildcard with the board's thread listing, as gin
+	// requires, but here it holds the thread ID.
+	threadID, err := strconv.ParseUint(c.Param("board_id"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid thread ID")
+		return
+	}
+	afterID, ok := optionalID(c, "after_id")
+	if !ok {
+		return
+	}
+	if afterID == nil {
+		utils.RespondError(c, http.StatusBadRequest, "after_id is required")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 50 {
+		limit = 50
+	}
+
+	messages, cursor, err := h.service.SyncMessages(c.Request.Context(), threadID, *afterID, limit)
+	if err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+	messages = h.applyFilters(c, messages)
+	c.JSON(http.StatusOK, MessageListResponse{Messages: messages, Cursor: cursor})
+}
+
+// @Summary Search a thread
+// @Description Full-text search of one thread's messages, newest first. Every word of q must match. Each match carries its position in GET /api/messages/{thread_id} (newest first) and the page there that shows it at page_size per page.
+// @Tags Message
+// @Produce json
+// @Param id path int true "Thread ID"
+// @Param q query string true "Words to find (at most 100 characters)"
+// @Param page query int false "Page of matches" default(1)
+// @Param limit query int false "Matches per page (max 50)" default(20)
+// @Param page_size query int false "Page size of the thread listing the page is computed for (max 50)" default(10)
+// @Success 200 {object} MessageSearchResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/threads/{id}/messages/search [get]
+func (h *handler) SearchMessages(c *gin.Context) {
+	// See SyncMessages for the wildcard name.
+	threadID, err := strconv.ParseUint(c.Param("board_id"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid thread ID")
+		return
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 50 {
+		limit = 20
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	if err != nil || pageSize < 1 || pageSize > 50 {
+		pageSize = 10
+	}
+
+	matches, total, err := h.service.SearchMessages(c.Request.Context(), threadID, c.Query("q"), page, limit, pageSize)
+	if err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, MessageSearchResponse{
+		Matches: matches,
+		Pagination: &Pagination{
+			Page:       page,
+			Limit:      limit,
+			Total:      total,
+			TotalPages: (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// @Summary Get replies to a message
+// @Description Get the direct replies to a message (messages with it as parent_id), oldest first, for collapsed reply trees
+// @Tags Message
+// @Produce json
+// @Param id path int true "Message ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(10)
+// @Param filter query string false "What to do with replies matching the user's filter rules: mark them with filtered=true (mark) or leave them out (hide)" default("mark")
+// @Success 200 {object} MessageListResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/messages/{id}/replies [get]
+func (h *handler) GetReplies(c *gin.Context) {
+	// The route shares its wildcard with the thread listing, as gin
+	// requires, but here it holds the message ID.
+	id, err := strconv.ParseUint(c.Param("thread_id"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid message ID")
+		return
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > 50 {
+		limit = 10
+	}
+
+	replies, total, err := h.service.GetReplies(c.Request.Context(), id, page, limit)
+	if err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+	replies = h.applyFilters(c, replies)
+	c.JSON(http.StatusOK, MessageListResponse{
+		Messages: replies,
+		Pagination: &Pagination{
+			Page:       page,
+			Limit:      limit,
+			Total:      total,
+			TotalPages: (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// @Summary Resolve a post number
+// @Description Find the thread and message behind a board's post number, e.g. for a >>12345 link, and the page of GET /api/messages/{thread_id} that shows it. message_id is null for a thread's opening post.
+// @Tags Message
+// @Produce json
+// @Param board path string true "Board slug"
+// @Param post_no path int true "Post number"
+// @Param limit query int false "Page size the page is computed for (default 10, max 50)"
+// @Success 200 {object} PostLocation
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/posts/{board}/{post_no} [get]
+func (h *handler) ResolvePost(c *gin.Context) {
+	postNo, err := strconv.ParseUint(c.Param("post_no"), 10, 64)
+	if err != nil || postNo == 0 {
+		utils.RespondError(c, http.StatusBadRequest, "invalid post number")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		limit = 10
+	}
+	location, err := h.service.ResolvePost(c.Request.Context(), c.Param("board"), postNo, limit)
+	if err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, location)
+}
+
+// @Summary Delete a message
+// @Description Soft-delete a message on the board. It disappears from the thread and can be restored until the purge job removes it. Board moderators and admins only.
+// @Tags Message
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param slug path string true "Board slug"
+// @Param message_id path int true "Message ID"
+// @Success 204
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/boards/{slug}/messages/{message_id} [delete]
+func (h *handler) DeleteMessage(c *gin.Context) {
+	h.setDeleted(c, true)
+}
+
+// @Summary Restore a message
+// @Description Bring back a soft-deleted message on the board. Board moderators and admins only.
+// @Tags Message
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param slug path string true "Board slug"
+// @Param message_id path int true "Message ID"
+// @Success 204
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/boards/{slug}/messages/{message_id}/restore [post]
+func (h *handler) RestoreMessage(c *gin.Context) {
+	h.setDeleted(c, false)
+}
+
+func (h *handler) setDeleted(c *gin.Context, deleted bool) {
+	messageID, err := strconv.ParseUint(c.Param("message_id"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid message ID")
+		return
+	}
+
+	var deletedBy *string
+	if deleted {
+		who := board.ModeratorFrom(c)
+		deletedBy = &who
+	}
+	if err := h.service.SetDeleted(c.Request.Context(), c.Param("slug"), messageID, deletedBy); err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// optionalID reads an optional numeric query parameter, answering 400 and
+// returning false when it is malformed.
+func optionalID(c *gin.Context, name string) (*uint64, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, true
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid "+name)
+		return nil, false
+	}
+	return &id, true
+}
+
+// applyFilters marks the messages matching the requesting user's filter
+// rules, or drops them for filter=hide. Pagination and cursors still count
+// them.
+func (h *handler) applyFilters(c *gin.Context, messages []*Message) []*Message {
+	set := filter.FromRequest(c, h.filterSvc, h.sessionSvc)
+	if set == nil {
+		return messages
+	}
+	hide := filter.HideRequested(c)
+	kept := messages[:0]
+	for _, m := range messages {
+		m.Filtered = set.Matches(m.AuthorNickname, m.Content)
+		if !hide || !m.Filtered {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
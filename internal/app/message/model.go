@@ -1,18 +1,34 @@
 package message
 
-import "time"
+import (
+	"time"
+
+	"backend/internal/app/linkpreview"
+	"backend/internal/app/markup"
+	"backend/internal/utils"
+)
 
 type Message struct {
-	ID                 uint64               `json:"id" gorm:"primaryKey"`
-	ThreadID           uint64               `json:"thread_id"`
-	CreatedBySessionID uint64               `json:"created_by_session_id"`
-	ParentID           *uint64              `json:"parent_id,omitempty"`
-	Content            string               `json:"content"`
-	CreatedAt          time.Time            `json:"created_at"`
-	UpdatedAt          time.Time            `json:"updated_at"`
-	AuthorNickname     string               `json:"author_nickname"`
-	IsAuthor           bool                 `json:"is_author"`
-	Attachments        []*MessageAttachment `json:"attachments,omitempty" gorm:"-"`
+	ID                 uint64                 `json:"id" gorm:"primaryKey;index:idx_messages_thread_id_id,priority:2"`
+	ThreadID           uint64                 `json:"thread_id" gorm:"index:idx_messages_thread_id_id,priority:1"`
+	PostNo             uint64                 `json:"post_no" gorm:"not null;default:0;index"`
+	CreatedBySessionID uint64                 `json:"created_by_session_id"`
+	ParentID           *uint64                `json:"parent_id,omitempty" gorm:"index"`
+	RepliesCount       int64                  `json:"replies_count" gorm:"not null;default:0"`
+	Content            string                 `json:"content"`
+	Segments           []*markup.Segment      `json:"segments,omitempty" gorm:"type:jsonb;serializer:json"`
+	CreatedAt          time.Time              `json:"created_at"`
+	UpdatedAt          time.Time              `json:"updated_at"`
+	DeletedAt          *time.Time             `json:"deleted_at,omitempty" gorm:"index"`
+	DeletedBy          *string                `json:"deleted_by,omitempty"`
+	AuthorNickname     string                 `json:"author_nickname"`
+	IsAuthor           bool                   `json:"is_author"`
+	Attachments        []*MessageAttachment   `json:"attachments,omitempty" gorm:"-"`
+	Embeds             []*linkpreview.Embed   `json:"embeds,omitempty" gorm:"type:jsonb;serializer:json"`
+	LinkPreviews       []*linkpreview.Preview `json:"link_previews,omitempty" gorm:"type:jsonb;serializer:json"`
+	// Filtered is set per request when the message matches a filter rule of
+	// the user asking.
+	Filtered bool `json:"filtered,omitempty" gorm:"-"`
 }
 
 type MessageAttachment struct {
@@ -27,15 +43,30 @@ type MessageAttachment struct {
 }
 
 type CreateMessageRequest struct {
-	Content       string   `json:"content" binding:"required"`
-	ParentID      *uint64  `json:"parent_id,omitempty"`
+	Content  string  `json:"content" binding:"required"`
+	ParentID *uint64 `json:"parent_id,omitempty"`
+	// ShowAsAuthor asks for the OP badge; it is only granted, as is_author,
+	// when the poster created the thread.
 	ShowAsAuthor  bool     `json:"show_as_author"`
+	Sage          bool     `json:"sage"`
 	AttachmentIDs []string `json:"attachment_ids"`
 }
 
+// MessageListResponse carries Pagination for page requests and Cursor for
+// before_id/after_id requests.
 type MessageListResponse struct {
-	Messages   []*Message `json:"messages"`
-	Pagination Pagination `json:"pagination"`
+	Messages   []*Message  `json:"messages"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+	Cursor     *Cursor     `json:"cursor,omitempty"`
+}
+
+// Cursor continues a keyset listing: pass BeforeID as before_id for older
+// messages or AfterID as after_id for newer ones. HasMore reports whether
+// more messages exist in the requested direction.
+type Cursor struct {
+	BeforeID *uint64 `json:"before_id"`
+	AfterID  *uint64 `json:"after_id"`
+	HasMore  bool    `json:"has_more"`
 }
 
 type Pagination struct {
@@ -49,10 +80,48 @@ type MessageResponse struct {
 	Message *Message `json:"message"`
 }
 
+// MessageMatch is a search hit. Position counts the messages before it in
+// the thread's newest-first listing, and Page is the listing page that shows
+// it at the requested page size.
+type MessageMatch struct {
+	Message  `gorm:"embedded"`
+	Position int `json:"position"`
+	Page     int `json:"page" gorm:"-"`
+}
+
+type MessageSearchResponse struct {
+	Matches    []*MessageMatch `json:"matches"`
+	Pagination *Pagination     `json:"pagination"`
+}
+
+// RecountReplies sets every message's replies_count from its live direct
+// replies, writing only the rows that differ.
+const RecountReplies = `
+	UPDATE messages SET replies_count = counts.replies
+	FROM (
+		SELECT parent.id, COUNT(reply.id) AS replies
+		FROM messages parent
+		LEFT JOIN messages reply ON reply.parent_id = parent.id AND reply.deleted_at IS NULL
+		GROUP BY parent.id
+	) counts
+	WHERE messages.id = counts.id AND messages.replies_count <> counts.replies
+`
+
+// PostLocation is where a board's post number points: the thread, and the
+// message with the page of the thread's replies (at Limit per page) that
+// shows it. MessageID is null for the thread's opening post.
+type PostLocation struct {
+	Board     string  `json:"board"`
+	PostNo    uint64  `json:"post_no"`
+	ThreadID  uint64  `json:"thread_id"`
+	MessageID *uint64 `json:"message_id"`
+	Page      int     `json:"page"`
+	Limit     int     `json:"limit"`
+}
+
 type MessageCooldownResponse struct {
 	LastMessageCreationUnix *int64 `json:"lastMessageCreationUnix"`
+	CooldownSeconds         int64  `json:"cooldownSeconds"`
 }
 
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
+type ErrorResponse = utils.ErrorResponse
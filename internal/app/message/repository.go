@@ -4,14 +4,43 @@ import (
 	"database/sql"
 	"time"
 
+	"backend/internal/app/board"
+	"backend/internal/app/linkpreview"
+	"backend/internal/app/markup"
+	"backend/internal/db/resolver"
+
 	"gorm.io/gorm"
 )
 
 type Repository interface {
-	CreateMessage(threadID uint64, sessionID uint64, parentID *uint64, content string, authorNickname string, isAuthor bool) (*Message, error)
-	GetMessagesByThreadID(threadID uint64, page int, limit int) ([]*Message, int64, error)
+	CreateMessage(boardID, threadID uint64, userID uint64, sessionID uint64, parentID *uint64, content string, segments []*markup.Segment, authorNickname string, isAuthor bool, bump BumpPolicy) (*Message, bool, error)
+	// GetMessagesByThreadID returns a page of the thread's messages, newest
+	// first unless ascending, and the total. Page 0 is the last page, and
+	// the page actually returned is reported back.
+	GetMessagesByThreadID(threadID uint64, page int, limit int, ascending bool) ([]*Message, int64, int, error)
+	GetMessagesBefore(threadID uint64, beforeID uint64, limit int) ([]*Message, bool, error)
+	GetMessagesAfter(threadID uint64, afterID uint64, limit int) ([]*Message, bool, error)
 	GetUserLastMessageTime(userID uint64) (*time.Time, error)
 	GetMessageByID(id uint64) (*Message, error)
+	// SearchMessages full-text searches the thread's live messages, newest
+	// first, with each match's position in the thread listing.
+	SearchMessages(threadID uint64, query string, page, limit int) ([]*MessageMatch, int64, error)
+	// GetThreadIDOf returns the thread of a live message; a missing or
+	// deleted one is gorm.ErrRecordNotFound.
+	GetThreadIDOf(messageID uint64) (uint64, error)
+	// ResolvePost finds the live post numbered postNo on the board. messageID
+	// is nil for an opening post; position counts the replies listed before
+	// the message, newest first. A missing post is gorm.ErrRecordNotFound.
+	ResolvePost(slug string, postNo uint64) (threadID uint64, messageID *uint64, position int, err error)
+	// GetReplies lists the live direct replies to a message, oldest first.
+	GetReplies(parentID uint64, page, limit int) ([]*Message, int64, error)
+	// SetDeleted soft-deletes a message on the board with deletedBy recorded,
+	// or restores it when deletedBy is nil, keeping the thread's and the
+	// parent's reply counts in step. changed is false when the message was
+	// already in that state; a message not on the board is
+	// gorm.ErrRecordNotFound.
+	SetDeleted(boardID, messageID uint64, deletedBy *string) (threadID uint64, parentID *uint64, changed bool, err error)
+	SetLinkPreviews(messageID uint64, previews []*linkpreview.Preview) error
 }
 
 type repository struct {
@@ -22,60 +51,181 @@ func NewRepository(db *gorm.DB) Repository {
 	return &repository{db: db}
 }
 
+// BumpPolicy decides whether a reply moves its thread up: a sage reply never
+// does, and neither does any reply once the thread has Limit replies
+// (0 means no limit).
+type BumpPolicy struct {
+	Sage  bool
+	Limit int
+}
+
+// CreateMessage inserts the message under the board's next post number,
+// bumps the thread's and the author's message counters (overall and for the thread's board) and moves the
+// thread's bump_at in one transaction, so none of them can drift from the
+// messages table when a request fails halfway. It reports whether the thread was bumped.
 func (r *repository) CreateMessage(
+	boardID uint64,
 	threadID uint64,
+	userID uint64,
 	sessionID uint64,
 	parentID *uint64,
 	content string,
+	segments []*markup.Segment,
 	authorNickname string,
 	isAuthor bool,
-) (*Message, error) {
+	bump BumpPolicy,
+) (*Message, bool, error) {
 	message := &Message{
 		ThreadID:           threadID,
 		CreatedBySessionID: sessionID,
 		ParentID:           parentID,
 		Content:            content,
+		Segments:           segments,
+		Embeds:             linkpreview.Embeds(content),
 		AuthorNickname:     authorNickname,
 		IsAuthor:           isAuthor,
 		CreatedAt:          time.Now(),
 		UpdatedAt:          time.Now(),
 	}
-	result := r.db.Create(message)
-	if result.Error != nil {
-		return nil, result.Error
+	var bumped bool
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		postNo, err := board.NextPostNo(tx, boardID)
+		if err != nil {
+			return err
+		}
+		message.PostNo = postNo
+		if err := tx.Create(message).Error; err != nil {
+			return err
+		}
+		if parentID != nil {
+			if err := tx.Exec(`UPDATE messages SET replies_count = replies_count + 1 WHERE id = ?`, *parentID).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Exec(`
+			INSERT INTO user_activity (user_id, message_count, last_message_at, created_at, updated_at)
+			VALUES (?, 1, ?, NOW(), NOW())
+			ON CONFLICT (user_id) DO UPDATE SET
+				message_count = user_activity.message_count + 1,
+				last_message_at = EXCLUDED.last_message_at,
+				updated_at = NOW()
+		`, userID, message.CreatedAt).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec(`
+			INSERT INTO user_board_activity (user_id, board_id, message_count, last_message_at, created_at, updated_at)
+			SELECT ?, threads.board_id, 1, ?, NOW(), NOW() FROM threads WHERE threads.id = ?
+			ON CONFLICT (user_id, board_id) DO UPDATE SET
+				message_count = user_board_activity.message_count + 1,
+				last_message_at = EXCLUDED.last_message_at,
+				updated_at = NOW()
+		`, userID, message.CreatedAt, threadID).Error; err != nil {
+			return err
+		}
+
+		// The row lock taken by the upsert serialises concurrent replies, so
+		// the bump limit compares against an exact count. NOW() is the
+		// transaction start, which tells a fresh bump from a kept one.
+		return tx.Raw(`
+			INSERT INTO threads_activity (thread_id, message_count, bump_at, created_at, updated_at)
+			VALUES (@thread, 1, NOW(), NOW(), NOW())
+			ON CONFLICT (thread_id) DO UPDATE SET
+				message_count = threads_activity.message_count + 1,
+				bump_at = CASE
+					WHEN @sage OR (@limit > 0 AND threads_activity.message_count >= @limit) THEN threads_activity.bump_at
+					ELSE NOW()
+				END,
+				updated_at = NOW()
+			RETURNING bump_at = NOW()
+		`, sql.Named("thread", threadID), sql.Named("sage", bump.Sage), sql.Named("limit", bump.Limit)).Scan(&bumped).Error
+	})
+	if err != nil {
+		return nil, false, err
 	}
-	return message, nil
+	return message, bumped, nil
 }
 
-func (r *repository) GetMessagesByThreadID(threadID uint64, page int, limit int) ([]*Message, int64, error) {
+func (r *repository) GetMessagesByThreadID(threadID uint64, page int, limit int, ascending bool) ([]*Message, int64, int, error) {
 	var messages []*Message
 	var total int64
-	offset := (page - 1) * limit
 
-	err := r.db.Table("messages").
-		Where("messages.thread_id = ?", threadID).
-		Order("messages.created_at DESC").
-		Offset(offset).
+	err := resolver.Read(r.db).Model(&Message{}).Where("thread_id = ? AND deleted_at IS NULL", threadID).Count(&total).Error
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if page <= 0 {
+		page = int((total + int64(limit) - 1) / int64(limit))
+		if page < 1 {
+			page = 1
+		}
+	}
+
+	order := "messages.created_at DESC, messages.id DESC"
+	if ascending {
+		order = "messages.created_at, messages.id"
+	}
+	err = resolver.Read(r.db).Table("messages").
+		Where("messages.thread_id = ? AND messages.deleted_at IS NULL", threadID).
+		Order(order).
+		Offset((page - 1) * limit).
 		Limit(limit).
 		Find(&messages).Error
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, 0, err
 	}
 
-	err = r.db.Model(&Message{}).Where("thread_id = ?", threadID).Count(&total).Error
+	return messages, total, page, nil
+}
+
+// GetMessagesBefore returns up to limit messages older than beforeID, newest
+// first, and whether there are more. Both keyset queries are range scans on
+// idx_messages_thread_id_id, so their cost does not grow with the depth of
+// the page the way OFFSET does.
+func (r *repository) GetMessagesBefore(threadID uint64, beforeID uint64, limit int) ([]*Message, bool, error) {
+	var messages []*Message
+	err := resolver.Read(r.db).Table("messages").
+		Where("thread_id = ? AND id < ? AND deleted_at IS NULL", threadID, beforeID).
+		Order("id DESC").
+		Limit(limit + 1).
+		Find(&messages).Error
 	if err != nil {
-		return nil, 0, err
+		return nil, false, err
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
 	}
+	return messages, hasMore, nil
+}
 
-	return messages, total, nil
+// GetMessagesAfter returns up to limit messages newer than afterID, oldest
+// first, and whether there are more.
+func (r *repository) GetMessagesAfter(threadID uint64, afterID uint64, limit int) ([]*Message, bool, error) {
+	var messages []*Message
+	err := resolver.Read(r.db).Table("messages").
+		Where("thread_id = ? AND id > ? AND deleted_at IS NULL", threadID, afterID).
+		Order("id ASC").
+		Limit(limit + 1).
+		Find(&messages).Error
+	if err != nil {
+		return nil, false, err
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	return messages, hasMore, nil
 }
 
+// GetUserLastMessageTime reads the time CreateMessage records in
+// user_activity rather than scanning the user's messages.
 func (r *repository) GetUserLastMessageTime(userID uint64) (*time.Time, error) {
 	var lastMessageTime sql.NullTime
-	err := r.db.Model(&Message{}).
-		Select("MAX(messages.created_at)").
-		Joins("JOIN sessions ON sessions.id = messages.created_by_session_id").
-		Where("sessions.user_id = ?", userID).
+	err := r.db.Table("user_activity").
+		Select("last_message_at").
+		Where("user_id = ?", userID).
 		Scan(&lastMessageTime).Error
 	if err != nil {
 		return nil, err
@@ -89,10 +239,159 @@ func (r *repository) GetUserLastMessageTime(userID uint64) (*time.Time, error) {
 func (r *repository) GetMessageByID(id uint64) (*Message, error) {
 	var message Message
 	err := r.db.Table("messages").
-		Where("messages.id = ?", id).
+		Where("messages.id = ? AND messages.deleted_at IS NULL", id).
 		First(&message).Error
 	if err != nil {
 		return nil, err
 	}
 	return &message, nil
 }
+
+func (r *repository) GetReplies(parentID uint64, page, limit int) ([]*Message, int64, error) {
+	var messages []*Message
+	var total int64
+	replies := func() *gorm.DB {
+		return resolver.Read(r.db).Model(&Message{}).Where("parent_id = ? AND deleted_at IS NULL", parentID)
+	}
+	if err := replies().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := replies().Order("created_at, id").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&messages).Error
+	return messages, total, err
+}
+
+func (r *repository) GetThreadIDOf(messageID uint64) (uint64, error) {
+	var threadIDs []uint64
+	err := r.db.Model(&Message{}).
+		Where("id = ? AND deleted_at IS NULL", messageID).
+		Pluck("thread_id", &threadIDs).Error
+	if err == nil && len(threadIDs) == 0 {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return threadIDs[0], nil
+}
+
+// positionColumn counts the live messages listed before a message in its
+// thread's newest-first listing.
+const positionColumn = `(
+	SELECT COUNT(*) FROM messages newer
+	WHERE newer.thread_id = messages.thread_id AND newer.deleted_at IS NULL
+		AND (newer.created_at, newer.id) > (messages.created_at, messages.id)
+)`
+
+// contentMatch uses the idx_messages_content_search expression index; both
+// sides must use the same text search configuration for it to apply.
+const contentMatch = `to_tsvector('simple', messages.content) @@ plainto_tsquery('simple', ?)`
+
+func (r *repository) SearchMessages(threadID uint64, query string, page, limit int) ([]*MessageMatch, int64, error) {
+	var matches []*MessageMatch
+	var total int64
+
+	matching := func() *gorm.DB {
+		return resolver.Read(r.db).Table("messages").
+			Where("messages.thread_id = ? AND messages.deleted_at IS NULL", threadID).
+			Where(contentMatch, query)
+	}
+	if err := matching().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := matching().
+		Select("messages.*, " + positionColumn + " AS position").
+		Order("messages.created_at DESC, messages.id DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Scan(&matches).Error
+	return matches, total, err
+}
+
+func (r *repository) ResolvePost(slug string, postNo uint64) (uint64, *uint64, int, error) {
+	var row struct {
+		ThreadID  uint64
+		MessageID *uint64
+		Position  int
+	}
+	res := resolver.Read(r.db).Raw(`
+		SELECT threads.id AS thread_id, NULL::bigint AS message_id, 0 AS position
+		FROM threads
+		JOIN boards ON boards.id = threads.board_id
+		WHERE boards.slug = @slug AND threads.post_no = @post_no AND threads.deleted_at IS NULL
+		UNION ALL
+		SELECT messages.thread_id, messages.id, `+positionColumn+`
+		FROM messages
+		JOIN threads ON threads.id = messages.thread_id
+		JOIN boards ON boards.id = threads.board_id
+		WHERE boards.slug = @slug AND messages.post_no = @post_no
+			AND messages.deleted_at IS NULL AND threads.deleted_at IS NULL
+		LIMIT 1
+	`, sql.Named("slug", slug), sql.Named("post_no", postNo)).Scan(&row)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return 0, nil, 0, gorm.ErrRecordNotFound
+	}
+	return row.ThreadID, row.MessageID, row.Position, res.Error
+}
+
+func (r *repository) SetLinkPreviews(messageID uint64, previews []*linkpreview.Preview) error {
+	return r.db.Model(&Message{ID: messageID}).Select("LinkPreviews").Updates(&Message{LinkPreviews: previews}).Error
+}
+
+func (r *repository) SetDeleted(boardID, messageID uint64, deletedBy *string) (uint64, *uint64, bool, error) {
+	var (
+		threadID uint64
+		parentID *uint64
+		changed  bool
+	)
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		set, state, delta := "deleted_at = NULL, deleted_by = NULL", "messages.deleted_at IS NOT NULL", 1
+		args := []interface{}{}
+		if deletedBy != nil {
+			set, state, delta = "deleted_at = NOW(), deleted_by = ?", "messages.deleted_at IS NULL", -1
+			args = append(args, *deletedBy)
+		}
+		args = append(args, messageID, boardID)
+
+		var rows []struct {
+			ThreadID uint64
+			ParentID *uint64
+		}
+		if err := tx.Raw(`
+			UPDATE messages SET `+set+`
+			FROM threads
+			WHERE messages.id = ? AND threads.id = messages.thread_id AND threads.board_id = ? AND `+state+`
+			RETURNING messages.thread_id, messages.parent_id
+		`, args...).Scan(&rows).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			var ids []uint64
+			if err := tx.Table("messages").
+				Joins("JOIN threads ON threads.id = messages.thread_id").
+				Where("messages.id = ? AND threads.board_id = ?", messageID, boardID).
+				Pluck("messages.thread_id", &ids).Error; err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				return gorm.ErrRecordNotFound
+			}
+			threadID = ids[0]
+			return nil
+		}
+
+		threadID, parentID, changed = rows[0].ThreadID, rows[0].ParentID, true
+		if parentID != nil {
+			if err := tx.Exec(`UPDATE messages SET replies_count = GREATEST(replies_count + ?, 0) WHERE id = ?`, delta, *parentID).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Exec(`
+			UPDATE threads_activity SET message_count = GREATEST(message_count + ?, 0), updated_at = NOW()
+			WHERE thread_id = ?
+		`, delta, threadID).Error
+	})
+	return threadID, parentID, changed, err
+}
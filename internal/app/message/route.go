@@ -7,7 +7,21 @@ func RegisterRoutes(rg *gin.RouterGroup, handler Handler) {
 	{
 		messages.POST("/:thread_id", handler.CreateMessage)
 		messages.GET("/:thread_id", handler.GetMessagesByThreadID)
+		messages.GET("/:thread_id/replies", handler.GetReplies)
 		messages.GET("/cooldown", handler.GetMessageCooldown)
 		messages.GET("/message/:id", handler.GetMessageByID)
 	}
+	rg.GET("/threads/:board_id/messages", handler.SyncMessages)
+	rg.GET("/threads/:board_id/messages/search", handler.SearchMessages)
+	rg.GET("/posts/:board/:post_no", handler.ResolvePost)
+}
+
+// RegisterModRoutes registers the moderation routes; rg must only let board
+// moderators and admins through.
+func RegisterModRoutes(rg *gin.RouterGroup, handler Handler) {
+	messages := rg.Group("/boards/:slug/messages")
+	{
+		messages.DELETE("/:message_id", handler.DeleteMessage)
+		messages.POST("/:message_id/restore", handler.RestoreMessage)
+	}
 }
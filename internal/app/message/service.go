@@ -2,14 +2,20 @@ package message
 
 import (
 	"backend/internal/app/attachment"
+	"backend/internal/app/board"
+	"backend/internal/app/linkpreview"
+	"backend/internal/app/markup"
 	"backend/internal/app/session"
+	"backend/internal/app/settings"
 	"backend/internal/app/thread"
 	"backend/internal/providers/minio"
 	"backend/internal/providers/redis"
 	"backend/internal/utils"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 	"unicode/utf8"
 
@@ -17,25 +23,63 @@ import (
 	"gorm.io/gorm"
 )
 
+// defaultMaxMessageLength applies on boards without a max_message_length.
+const defaultMaxMessageLength = 9999
+
 type Service interface {
-	CreateMessage(ctx context.Context, threadID uint64, sessionKey string, content string, parentID *uint64, showAsAuthor bool, attachmentIDs []string) (*Message, error)
-	GetMessagesByThreadID(ctx context.Context, threadID uint64, page int, limit int) ([]*Message, int64, error)
+	CreateMessage(ctx context.Context, threadID uint64, sessionKey string, content string, parentID *uint64, showAsAuthor bool, sage bool, attachmentIDs []string) (*Message, error)
+	// GetMessagesByThreadID lists a page of the thread's messages, newest
+	// first unless ascending. Page 0 asks for the last page; the page
+	// returned is reported back with the total.
+	GetMessagesByThreadID(ctx context.Context, threadID uint64, page int, limit int, ascending bool) ([]*Message, int64, int, error)
+	// GetMessagesByCursor lists messages older than beforeID (newest first)
+	// or newer than afterID (oldest first); exactly one must be set.
+	GetMessagesByCursor(ctx context.Context, threadID uint64, beforeID, afterID *uint64, limit int) ([]*Message, *Cursor, error)
+	// SyncMessages returns up to limit messages of the thread newer than
+	// afterID, oldest first, for clients catching up after a dropped
+	// connection. A missing thread is a NotFoundError.
+	SyncMessages(ctx context.Context, threadID, afterID uint64, limit int) ([]*Message, *Cursor, error)
 	GetUserLastMessageTime(userID uint64) (*time.Time, error)
 	GetMessageCooldown(userID uint64) (*time.Time, error)
 	GetMessageByID(ctx context.Context, id uint64) (*Message, error)
+	// SearchMessages finds the thread's messages matching every word of
+	// query, newest first, each with the page of the thread's listing at
+	// pageSize per page that shows it.
+	SearchMessages(ctx context.Context, threadID uint64, query string, page, limit, pageSize int) ([]*MessageMatch, int64, error)
+	// GetReplies lists the direct replies to a message, oldest first.
+	GetReplies(ctx context.Context, messageID uint64, page, limit int) ([]*Message, int64, error)
+	// ResolvePost locates the board's post number for a permalink, with the
+	// page of the thread's replies it is on at limit per page.
+	ResolvePost(ctx context.Context, slug string, postNo uint64, limit int) (*PostLocation, error)
+	// Cooldown is the message cooldown in the thread's board, or the
+	// site-wide one for threadID 0.
+	Cooldown(ctx context.Context, threadID uint64) time.Duration
+	// SetDeleted soft-deletes a message on the board for a moderator, who is
+	// recorded as deletedBy, or restores it when deletedBy is nil.
+	SetDeleted(ctx context.Context, slug string, messageID uint64, deletedBy *string) error
+}
+
+// ReplyNotifier is told about every new reply, e.g. to alert thread watchers
+// or the authors of quoted posts.
+type ReplyNotifier interface {
+	NotifyReply(ctx context.Context, threadID, messageID, authorUserID uint64, content string)
 }
 
 type service struct {
-	repo          Repository
-	sessionSvc    session.Service
-	threadSvc     thread.Service
-	dbConn        *gorm.DB
-	redisP        *redis.RedisProvider
-	minioP        *minio.MinioProvider
-	eventBus      *utils.EventBus
-	logger        *zap.SugaredLogger
-	cachePrefix   string
-	attachmentSvc attachment.Service
+	repo           Repository
+	sessionSvc     session.Service
+	threadSvc      thread.Service
+	dbConn         *gorm.DB
+	redisP         *redis.RedisProvider
+	minioP         *minio.MinioProvider
+	eventBus       *utils.EventBus
+	logger         *zap.SugaredLogger
+	cachePrefix    string
+	attachmentSvc  attachment.Service
+	settingsSvc    settings.Service
+	boardSvc       board.Service
+	previewSvc     linkpreview.Service
+	replyNotifiers []ReplyNotifier
 }
 
 func NewService(
@@ -48,19 +92,55 @@ func NewService(
 	logger *zap.Logger,
 	minioP *minio.MinioProvider,
 	attachmentSvc attachment.Service,
+	settingsSvc settings.Service,
+	boardSvc board.Service,
+	previewSvc linkpreview.Service,
+	replyNotifiers ...ReplyNotifier,
 ) Service {
 	return &service{
-		repo:          repo,
-		sessionSvc:    sessionSvc,
-		threadSvc:     threadSvc,
-		dbConn:        dbConn,
-		redisP:        redisP,
-		minioP:        minioP,
-		eventBus:      eventBus,
-		logger:        logger.Sugar(),
-		cachePrefix:   "messages:thread",
-		attachmentSvc: attachmentSvc,
+		repo:           repo,
+		sessionSvc:     sessionSvc,
+		threadSvc:      threadSvc,
+		dbConn:         dbConn,
+		redisP:         redisP,
+		minioP:         minioP,
+		eventBus:       eventBus,
+		logger:         logger.Sugar(),
+		cachePrefix:    "messages:thread",
+		attachmentSvc:  attachmentSvc,
+		settingsSvc:    settingsSvc,
+		boardSvc:       boardSvc,
+		previewSvc:     previewSvc,
+		replyNotifiers: replyNotifiers,
+	}
+}
+
+func (s *service) Cooldown(ctx context.Context, threadID uint64) time.Duration {
+	if threadID != 0 {
+		if thread, err := s.threadSvc.GetThreadByID(ctx, threadID); err == nil {
+			return s.boardCooldown(thread.BoardID)
+		}
+	}
+	return time.Duration(s.settingsSvc.Current().MessageCooldown)
+}
+
+// boardCooldown and bumpLimit read the board's own limit, falling back to
+// the runtime setting. Boards are cached and dropped from the cache on every
+// admin edit, so a change applies to the next post.
+func (s *service) boardCooldown(boardID uint64) time.Duration {
+	cooldown := time.Duration(s.settingsSvc.Current().MessageCooldown)
+	if b, err := s.boardSvc.GetBoardByID(boardID); err == nil {
+		return b.MessageCooldown(cooldown)
 	}
+	return cooldown
+}
+
+func (s *service) bumpLimit(boardID uint64) int {
+	limit := s.settingsSvc.Current().BumpLimit
+	if b, err := s.boardSvc.GetBoardByID(boardID); err == nil {
+		return b.BumpLimitOr(limit)
+	}
+	return limit
 }
 
 func (s *service) GetUserLastMessageTime(userID uint64) (*time.Time, error) {
@@ -78,40 +158,83 @@ func (s *service) CreateMessage(
 	content string,
 	parentID *uint64,
 	showAsAuthor bool,
+	sage bool,
 	attachmentIDs []string,
 ) (*Message, error) {
-	contentLength := utf8.RuneCountInString(content)
-	if contentLength < 1 || contentLength > 9999 {
-		return nil, fmt.Errorf("message content must be between 1 and 9999 characters, got %d", contentLength)
-	}
-
 	user, err := s.sessionSvc.GetUserBySessionKey(sessionKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
+	thread, err := s.threadSvc.GetThreadByID(ctx, threadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thread: %w", err)
+	}
+	if thread.ArchivedAt != nil {
+		return nil, utils.Invalid("thread_id", "thread is archived")
+	}
+
+	b, err := s.boardSvc.GetBoardByID(thread.BoardID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get board: %w", err)
+	}
+	if err := b.PostingError(); err != nil {
+		return nil, err
+	}
+	if err := b.OriginError(utils.OriginFromContext(ctx), s.settingsSvc.Current().ProxyPolicy); err != nil {
+		return nil, err
+	}
+	if len(attachmentIDs) > 0 && s.attachmentSvc != nil {
+		if err := s.attachmentSvc.CheckPolicy(ctx, attachmentIDs, b); err != nil {
+			return nil, err
+		}
+	}
+	maxLength := b.MessageLengthOr(defaultMaxMessageLength)
+	markupOpts := b.Markup()
+	contentLength := utf8.RuneCountInString(content)
+	if contentLength < 1 || contentLength > maxLength {
+		return nil, utils.Invalid("content", "message content must be between 1 and %d characters, got %d", maxLength, contentLength)
+	}
+
+	cooldown := s.boardCooldown(thread.BoardID)
 	lastMessageTime, err := s.GetUserLastMessageTime(user.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get last message time: %w", err)
 	}
 	if lastMessageTime != nil {
 		elapsed := time.Since(*lastMessageTime)
-		if elapsed < 10*time.Second {
-			secondsLeft := int64(10 - elapsed.Seconds())
-			return nil, fmt.Errorf("message creation cooldown: %d seconds left", secondsLeft)
+		if elapsed < cooldown {
+			return nil, &utils.CooldownError{Action: "message creation", Cooldown: cooldown, Remaining: cooldown - elapsed}
 		}
 	}
+	// With ID rotation the cooldown is also kept per client, since a
+	// rotated user starts without one.
+	clientCooldownKey := ""
+	if clientKey := utils.ClientKeyFromContext(ctx); clientKey != "" {
+		clientCooldownKey = "cooldown:message:" + clientKey
+		if left, err := s.redisP.CooldownLeft(ctx, clientCooldownKey); err == nil && left > 0 {
+			return nil, &utils.CooldownError{Action: "message creation", Cooldown: cooldown, Remaining: left}
+		}
+	}
+	if parentID != nil {
+		parentThreadID, err := s.repo.GetThreadIDOf(*parentID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, utils.BadReference("parent_id", "parent message %d does not exist", *parentID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent message: %w", err)
+		}
+		if parentThreadID != threadID {
+			return nil, utils.BadReference("parent_id", "parent message %d is in another thread", *parentID)
+		}
+	}
+	content = s.settingsSvc.FilterContent(content)
 
 	session, err := s.sessionSvc.GetSessionByKey(sessionKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
 
-	thread, err := s.threadSvc.GetThreadByID(ctx, threadID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get thread: %w", err)
-	}
-
 	isThreadAuthor, err := s.threadSvc.IsUserAuthor(ctx, user.ID, threadID)
 	if err != nil {
 		s.logger.Warnw("Failed to check thread authorship", "error", err, "user_id", user.ID, "thread_id", threadID)
@@ -125,10 +248,27 @@ func (s *service) CreateMessage(
 		nickname = "Аноним"
 	}
 
-	message, err := s.repo.CreateMessage(threadID, session.ID, parentID, content, nickname, isAuthor)
+	// The post is claimed before the insert, so a form submitted twice is
+	// caught even when both requests arrive at once. Without Redis the
+	// check is skipped rather than refusing every post.
+	duplicateKey := fmt.Sprintf("duplicate:%d:%s", user.ID, utils.ContentFingerprint(content, attachmentIDs))
+	if left, err := s.redisP.ClaimCooldown(ctx, duplicateKey, time.Duration(s.settingsSvc.Current().DuplicateWindow)); err != nil {
+		s.logger.Warnw("Failed to check for a duplicate post", "error", err, "user_id", user.ID)
+	} else if left > 0 {
+		return nil, &utils.DuplicateError{Remaining: left}
+	}
+
+	message, bumped, err := s.repo.CreateMessage(thread.BoardID, threadID, user.ID, session.ID, parentID, content, markup.Parse(content, markupOpts), nickname, isAuthor, BumpPolicy{
+		Sage:  sage,
+		Limit: s.bumpLimit(thread.BoardID),
+	})
 	if err != nil {
+		s.redisP.Del(ctx, duplicateKey)
 		return nil, fmt.Errorf("failed to create message: %w", err)
 	}
+	if clientCooldownKey != "" {
+		s.redisP.StartCooldown(ctx, clientCooldownKey, cooldown)
+	}
 
 	if len(attachmentIDs) > 0 && s.attachmentSvc != nil {
 		if err := s.attachmentSvc.LinkToMessageByFileID(ctx, attachmentIDs, message.ID); err != nil {
@@ -136,115 +276,278 @@ func (s *service) CreateMessage(
 		}
 	}
 
-	s.dbConn.Exec(`
-		INSERT INTO user_activity (user_id, message_count, created_at, updated_at)
-		VALUES (?, 1, NOW(), NOW())
-		ON CONFLICT (user_id) DO UPDATE SET
-			message_count = user_activity.message_count + 1,
-			updated_at = NOW()
-	`, user.ID)
-
-	s.dbConn.Exec(`
-		INSERT INTO threads_activity (thread_id, message_count, bump_at, created_at, updated_at)
-		VALUES (?, 1, NOW(), NOW(), NOW())
-		ON CONFLICT (thread_id) DO UPDATE SET
-			message_count = threads_activity.message_count + 1,
-			bump_at = NOW(),
-			updated_at = NOW()
-	`, threadID)
-
 	s.invalidateCache(threadID)
+	// The ID may have been probed before it existed.
+	s.redisP.Del(ctx, fmt.Sprintf("%s:message:%d", s.cachePrefix, message.ID))
+	if parentID != nil {
+		s.redisP.Del(ctx, fmt.Sprintf("%s:message:%d", s.cachePrefix, *parentID))
+	}
 	if s.threadSvc != nil {
-		s.threadSvc.InvalidateThreadsCache(thread.BoardID)
-		s.threadSvc.InvalidateTopThreadsCache()
+		s.threadSvc.InvalidateAfterReply(thread.BoardID, threadID, bumped)
 	}
 
-	userCacheKey := fmt.Sprintf("user:session:%s", sessionKey)
-	s.redisP.Del(context.Background(), userCacheKey)
+	userCacheKey := fmt.Sprintf("user:%d", user.ID)
+	s.redisP.CachedDel(context.Background(), userCacheKey)
 
-	eventData := map[string]interface{}{
-		"message_id":      message.ID,
-		"thread_id":       message.ThreadID,
-		"content":         message.Content,
-		"created_at":      message.CreatedAt,
-		"updated_at":      message.UpdatedAt,
-		"author_nickname": message.AuthorNickname,
-		"is_author":       message.IsAuthor,
-		"user_id":         user.ID,
-		"timestamp":       time.Now().UTC().Unix(),
+	var segments, embeds json.RawMessage
+	if len(message.Segments) > 0 {
+		segments, _ = json.Marshal(message.Segments)
+	}
+	if len(message.Embeds) > 0 {
+		embeds, _ = json.Marshal(message.Embeds)
+	}
+	s.eventBus.PublishWithContext(ctx, utils.MessageCreated{
+		MessageID:      message.ID,
+		ThreadID:       message.ThreadID,
+		BoardID:        thread.BoardID,
+		PostNo:         message.PostNo,
+		Content:        message.Content,
+		CreatedAt:      message.CreatedAt,
+		UpdatedAt:      message.UpdatedAt,
+		AuthorNickname: message.AuthorNickname,
+		IsAuthor:       message.IsAuthor,
+		Segments:       segments,
+		Embeds:         embeds,
+		Bumped:         bumped,
+		UserID:         user.ID,
+		Timestamp:      time.Now().UTC().Unix(),
+	})
+	for _, notifier := range s.replyNotifiers {
+		notifier.NotifyReply(ctx, threadID, message.ID, user.ID, message.Content)
+	}
+	if s.previewSvc != nil && len(linkpreview.Links(message.Content)) > 0 {
+		go s.attachLinkPreviews(context.WithoutCancel(ctx), thread.BoardID, message.ID, message.ThreadID, message.Content)
 	}
-	s.eventBus.Publish("message_created", eventData)
 
 	return message, nil
 }
 
+// attachLinkPreviews fetches the previews of the links in a new reply and
+// stores them on it. It runs after the reply is posted, so posting never
+// waits on a remote site; readers get the previews with the link_previews
+// event or on their next load.
+func (s *service) attachLinkPreviews(ctx context.Context, boardID, messageID, threadID uint64, content string) {
+	previews := s.previewSvc.Previews(ctx, content)
+	if len(previews) == 0 {
+		return
+	}
+	if err := s.repo.SetLinkPreviews(messageID, previews); err != nil {
+		s.logger.Warn("Failed to save link previews", zap.Uint64("message_id", messageID), zap.Error(err))
+		return
+	}
+	s.invalidateCache(threadID)
+	s.redisP.Del(ctx, fmt.Sprintf("%s:message:%d", s.cachePrefix, messageID))
+
+	data, err := json.Marshal(previews)
+	if err != nil {
+		return
+	}
+	s.eventBus.PublishWithContext(ctx, utils.LinkPreviews{
+		MessageID: messageID,
+		ThreadID:  threadID,
+		BoardID:   boardID,
+		Previews:  data,
+		Timestamp: time.Now().UTC().Unix(),
+	})
+}
+
 func (s *service) GetMessagesByThreadID(
 	ctx context.Context,
 	threadID uint64,
 	page int,
 	limit int,
-) ([]*Message, int64, error) {
+	ascending bool,
+) ([]*Message, int64, int, error) {
 	if limit < 1 {
 		limit = 10
 	}
 	if limit > 50 {
 		limit = 50
 	}
+	if page < 0 {
+		page = 0
+	}
 
-	cacheKey := fmt.Sprintf("%s:%d:page:%d:limit:%d", s.cachePrefix, threadID, page, limit)
+	order := "desc"
+	if ascending {
+		order = "asc"
+	}
+	cacheKey := fmt.Sprintf("%s:%d:page:%d:limit:%d:order:%s", s.cachePrefix, threadID, page, limit, order)
 	cmd := s.redisP.Get(ctx, cacheKey)
 	cachedData, err := cmd.Result()
 	var result struct {
 		Messages []*Message `json:"messages"`
 		Total    int64      `json:"total"`
+		Page     int        `json:"page"`
 	}
 
 	if err == nil && cachedData != "" {
 		if json.Unmarshal([]byte(cachedData), &result) == nil {
-			return result.Messages, result.Total, nil
+			return result.Messages, result.Total, result.Page, nil
 		}
 	}
 
-	messages, total, err := s.repo.GetMessagesByThreadID(threadID, page, limit)
+	messages, total, page, err := s.repo.GetMessagesByThreadID(threadID, page, limit, ascending)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get messages: %w", err)
-	}
-
-	if len(messages) > 0 && s.attachmentSvc != nil {
-		for _, msg := range messages {
-			attachments, err := s.attachmentSvc.GetByMessageID(ctx, msg.ID)
-			if err == nil {
-				msg.Attachments = make([]*MessageAttachment, 0, len(attachments))
-				for _, att := range attachments {
-					msg.Attachments = append(msg.Attachments, &MessageAttachment{
-						ID:          att.FileID,
-						FileID:      att.FileID,
-						FileName:    att.FileName,
-						FileURL:     att.FileURL,
-						FileSize:    att.FileSize,
-						ContentType: att.ContentType,
-						ObjectName:  att.ObjectName,
-						CreatedAt:   att.CreatedAt.Format("2006-01-02T15:04:05Z"),
-					})
-				}
-			}
-		}
+		return nil, 0, 0, fmt.Errorf("failed to get messages: %w", err)
 	}
 
+	s.loadAttachments(ctx, messages)
+
 	if len(messages) > 0 {
 		result.Messages = messages
 		result.Total = total
+		result.Page = page
 		data, _ := json.Marshal(result)
-		s.redisP.SetEX(ctx, cacheKey, data, 5*time.Minute)
+		s.redisP.SetTagged(ctx, s.pagesTag(threadID), cacheKey, data, 5*time.Minute)
 	}
 
-	return messages, total, nil
+	return messages, total, page, nil
+}
+
+func (s *service) GetMessagesByCursor(
+	ctx context.Context,
+	threadID uint64,
+	beforeID, afterID *uint64,
+	limit int,
+) ([]*Message, *Cursor, error) {
+	if limit < 1 {
+		limit = 10
+	}
+	if limit > 50 {
+		limit = 50
+	}
+	if (beforeID == nil) == (afterID == nil) {
+		return nil, nil, fmt.Errorf("exactly one of before_id and after_id must be set")
+	}
+
+	var (
+		messages []*Message
+		hasMore  bool
+		err      error
+	)
+	if beforeID != nil {
+		messages, hasMore, err = s.repo.GetMessagesBefore(threadID, *beforeID, limit)
+	} else {
+		messages, hasMore, err = s.repo.GetMessagesAfter(threadID, *afterID, limit)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+	s.loadAttachments(ctx, messages)
+
+	// An empty page keeps the cursor where it was so the client can poll
+	// the same position again.
+	cursor := &Cursor{BeforeID: beforeID, AfterID: afterID, HasMore: hasMore}
+	if len(messages) > 0 {
+		oldest, newest := messages[len(messages)-1].ID, messages[0].ID
+		if afterID != nil {
+			oldest, newest = newest, oldest
+		}
+		cursor.BeforeID, cursor.AfterID = &oldest, &newest
+	}
+	return messages, cursor, nil
+}
+
+// maxSearchQueryLength caps in-thread search strings, in characters.
+const maxSearchQueryLength = 100
+
+func (s *service) SearchMessages(ctx context.Context, threadID uint64, query string, page, limit, pageSize int) ([]*MessageMatch, int64, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, 0, utils.Invalid("q", "q is required")
+	}
+	if n := utf8.RuneCountInString(query); n > maxSearchQueryLength {
+		return nil, 0, utils.Invalid("q", "q must be at most %d characters, got %d", maxSearchQueryLength, n)
+	}
+	if _, err := s.threadSvc.GetThreadByID(ctx, threadID); err != nil {
+		return nil, 0, err
+	}
+
+	matches, total, err := s.repo.SearchMessages(threadID, query, page, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search messages: %w", err)
+	}
+	messages := make([]*Message, len(matches))
+	for i, m := range matches {
+		m.Page = m.Position/pageSize + 1
+		messages[i] = &m.Message
+	}
+	s.loadAttachments(ctx, messages)
+	return matches, total, nil
+}
+
+func (s *service) SyncMessages(ctx context.Context, threadID, afterID uint64, limit int) ([]*Message, *Cursor, error) {
+	if _, err := s.threadSvc.GetThreadByID(ctx, threadID); err != nil {
+		return nil, nil, err
+	}
+	return s.GetMessagesByCursor(ctx, threadID, nil, &afterID, limit)
+}
+
+func (s *service) loadAttachments(ctx context.Context, messages []*Message) {
+	if s.attachmentSvc == nil {
+		return
+	}
+	for _, msg := range messages {
+		attachments, err := s.attachmentSvc.GetByMessageID(ctx, msg.ID)
+		if err == nil {
+			msg.Attachments = make([]*MessageAttachment, 0, len(attachments))
+			for _, att := range attachments {
+				msg.Attachments = append(msg.Attachments, &MessageAttachment{
+					ID:          att.FileID,
+					FileID:      att.FileID,
+					FileName:    att.FileName,
+					FileURL:     att.FileURL,
+					FileSize:    att.FileSize,
+					ContentType: att.ContentType,
+					ObjectName:  att.ObjectName,
+					CreatedAt:   att.CreatedAt.Format("2006-01-02T15:04:05Z"),
+				})
+			}
+		}
+	}
+}
+
+func (s *service) GetReplies(ctx context.Context, messageID uint64, page, limit int) ([]*Message, int64, error) {
+	if _, err := s.GetMessageByID(ctx, messageID); err != nil {
+		return nil, 0, err
+	}
+	replies, total, err := s.repo.GetReplies(messageID, page, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get replies: %w", err)
+	}
+	s.loadAttachments(ctx, replies)
+	return replies, total, nil
+}
+
+func (s *service) ResolvePost(ctx context.Context, slug string, postNo uint64, limit int) (*PostLocation, error) {
+	if limit < 1 || limit > 50 {
+		limit = 10
+	}
+	threadID, messageID, position, err := s.repo.ResolvePost(slug, postNo)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.NotFound("post")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve post: %w", err)
+	}
+	return &PostLocation{
+		Board:     slug,
+		PostNo:    postNo,
+		ThreadID:  threadID,
+		MessageID: messageID,
+		Page:      position/limit + 1,
+		Limit:     limit,
+	}, nil
 }
 
 func (s *service) GetMessageByID(ctx context.Context, id uint64) (*Message, error) {
 	cacheKey := fmt.Sprintf("%s:message:%d", s.cachePrefix, id)
 	cmd := s.redisP.Get(ctx, cacheKey)
 	cachedData, err := cmd.Result()
+	if cachedData == redis.NotFound {
+		return nil, utils.NotFound("message")
+	}
 
 	if err == nil && cachedData != "" {
 		var message Message
@@ -254,6 +557,10 @@ func (s *service) GetMessageByID(ctx context.Context, id uint64) (*Message, erro
 	}
 
 	message, err := s.repo.GetMessageByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		s.redisP.SetEX(ctx, cacheKey, redis.NotFound, redis.NotFoundTTL)
+		return nil, utils.NotFound("message")
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -283,35 +590,51 @@ func (s *service) GetMessageByID(ctx context.Context, id uint64) (*Message, erro
 	return message, nil
 }
 
-func (s *service) invalidateCache(threadID uint64) {
-	ctx := context.Background()
-	pattern := fmt.Sprintf("%s:%d:page:*", s.cachePrefix, threadID)
-	var cursor uint64
-	deletedCount := 0
-
-	for {
-		keys, cur, err := s.redisP.Scan(ctx, cursor, pattern, 100).Result()
-		if err != nil {
-			s.logger.Warnw("Redis scan failed during cache invalidation", "error", err, "pattern", pattern)
-			return
-		}
+func (s *service) SetDeleted(ctx context.Context, slug string, messageID uint64, deletedBy *string) error {
+	b, err := s.boardSvc.GetBoardBySlug(slug)
+	if err != nil {
+		return err
+	}
+	threadID, parentID, changed, err := s.repo.SetDeleted(b.ID, messageID, deletedBy)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.NotFound("message")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update message: %w", err)
+	}
+	if !changed {
+		return nil
+	}
 
-		if len(keys) > 0 {
-			n, err := s.redisP.Del(ctx, keys...).Result()
-			if err != nil {
-				s.logger.Warnw("Failed to delete cache keys", "error", err, "keys", keys)
-			} else {
-				deletedCount += int(n)
-			}
-		}
+	s.redisP.Del(ctx, fmt.Sprintf("%s:message:%d", s.cachePrefix, messageID))
+	if parentID != nil {
+		s.redisP.Del(ctx, fmt.Sprintf("%s:message:%d", s.cachePrefix, *parentID))
+	}
+	s.invalidateCache(threadID)
+	// The reply count shows in every listing of the board.
+	s.threadSvc.InvalidateAfterReply(b.ID, threadID, false)
+	s.threadSvc.InvalidateThreadsCache(b.ID)
+	s.threadSvc.InvalidateTopThreadsCache()
+	if deletedBy != nil {
+		s.logger.Infow("Message deleted", "message_id", messageID, "thread_id", threadID, "deleted_by", *deletedBy)
+	} else {
+		s.logger.Infow("Message restored", "message_id", messageID, "thread_id", threadID)
+	}
+	return nil
+}
 
-		if cur == 0 {
-			break
-		}
+// pagesTag is the set of cached page keys for a thread (see
+// redis.SetTagged), so a new reply drops them without a keyspace scan.
+func (s *service) pagesTag(threadID uint64) string {
+	return fmt.Sprintf("%s:%d:keys", s.cachePrefix, threadID)
+}
 
-		cursor = cur
+func (s *service) invalidateCache(threadID uint64) {
+	deletedCount, err := s.redisP.DeleteTagged(context.Background(), s.pagesTag(threadID))
+	if err != nil {
+		s.logger.Warnw("Failed to invalidate message list cache", "thread_id", threadID, "error", err)
+		return
 	}
-
 	if deletedCount > 0 {
 		s.logger.Debugw("Message list cache invalidated", "thread_id", threadID, "deleted_keys", deletedCount)
 	}
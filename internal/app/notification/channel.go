@@ -0,0 +1,142 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"backend/internal/providers/webpush"
+	"backend/internal/utils"
+)
+
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, pref *Preference, n *Notification) error
+}
+
+type webSocketChannel struct {
+	eventBus *utils.EventBus
+}
+
+func NewWebSocketChannel(eventBus *utils.EventBus) Channel {
+	return &webSocketChannel{eventBus: eventBus}
+}
+
+func (c *webSocketChannel) Name() string {
+	return ChannelWebSocket
+}
+
+func (c *webSocketChannel) Send(ctx context.Context, pref *Preference, n *Notification) error {
+	c.eventBus.PublishWithContext(ctx, utils.Notification{
+		ID:        n.ID,
+		UserID:    n.UserID,
+		Type:      n.Type,
+		Data:      n.Data,
+		Timestamp: n.CreatedAt.Unix(),
+	})
+	return nil
+}
+
+type webhookChannel struct {
+	client *http.Client
+}
+
+// NewWebhookChannel posts to user-chosen URLs, so its client refuses to
+// connect anywhere but public addresses.
+func NewWebhookChannel(timeout time.Duration) Channel {
+	return &webhookChannel{client: utils.NewPublicClient(timeout)}
+}
+
+func (c *webhookChannel) Name() string {
+	return ChannelWebhook
+}
+
+func (c *webhookChannel) Send(ctx context.Context, pref *Preference, n *Notification) error {
+	if pref == nil || pref.Target == nil || *pref.Target == "" {
+		return fmt.Errorf("webhook target is not configured")
+	}
+
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, *pref.Target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type webPushChannel struct {
+	sender *webpush.Sender
+	repo   Repository
+}
+
+func NewWebPushChannel(sender *webpush.Sender, repo Repository) Channel {
+	return &webPushChannel{sender: sender, repo: repo}
+}
+
+func (c *webPushChannel) Name() string {
+	return ChannelWebPush
+}
+
+func (c *webPushChannel) PublicKey() string {
+	return c.sender.PublicKey()
+}
+
+// Send pushes n to every browser the user subscribed from. Subscriptions the
+// push service reports as gone are deleted.
+func (c *webPushChannel) Send(ctx context.Context, pref *Preference, n *Notification) error {
+	subs, err := c.repo.GetPushSubscriptions(n.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to load push subscriptions: %w", err)
+	}
+	if len(subs) == 0 {
+		return fmt.Errorf("no push subscriptions")
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":         n.ID,
+		"type":       n.Type,
+		"data":       n.Data,
+		"created_at": n.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	var errs []error
+	for _, sub := range subs {
+		err := c.sender.Send(ctx, webpush.Subscription{
+			Endpoint: sub.Endpoint,
+			P256dh:   sub.P256dh,
+			Auth:     sub.Auth,
+		}, payload)
+		if errors.Is(err, webpush.ErrSubscriptionGone) {
+			if err := c.repo.DeletePushSubscriptionByEndpoint(sub.Endpoint); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,278 @@
+package notification
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"backend/internal/app/session"
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	List(c *gin.Context)
+	MarkRead(c *gin.Context)
+	GetPreferences(c *gin.Context)
+	UpdatePreferences(c *gin.Context)
+	GetPushKey(c *gin.Context)
+	SubscribePush(c *gin.Context)
+	UnsubscribePush(c *gin.Context)
+}
+
+type handler struct {
+	service    Service
+	sessionSvc session.Service
+}
+
+func NewHandler(service Service, sessionSvc session.Service) Handler {
+	return &handler{
+		service:    service,
+		sessionSvc: sessionSvc,
+	}
+}
+
+// @Summary List notifications
+// @Description Get the current user's stored notifications, newest first
+// @Tags Notification
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param unread query bool false "Only return unread notifications"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} NotificationListResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/notifications [get]
+func (h *handler) List(c *gin.Context) {
+	sessionKey := session.Key(c)
+	if sessionKey == "" {
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
+		return
+	}
+
+	user, err := h.sessionSvc.GetUserBySessionKey(sessionKey)
+	if err != nil {
+		utils.RespondError(c, http.StatusNotFound, "user not found")
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+	unreadOnly := c.Query("unread") == "true"
+
+	notifications, total, unread, err := h.service.List(user.ID, unreadOnly, page, limit)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get notifications")
+		return
+	}
+
+	c.JSON(http.StatusOK, NotificationListResponse{
+		Notifications: notifications,
+		Unread:        unread,
+		Pagination: Pagination{
+			Page:       page,
+			Limit:      limit,
+			Total:      total,
+			TotalPages: (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// @Summary Mark notifications as read
+// @Description Mark the given notifications as read, or all of them when ids is omitted
+// @Tags Notification
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MarkReadRequest true "Mark read request"
+// @Success 200 {object} MarkReadResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/notifications/read [post]
+func (h *handler) MarkRead(c *gin.Context) {
+	var req MarkReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, err := h.sessionSvc.GetUserBySessionKey(session.KeyOr(c, req.SessionKey))
+	if err != nil {
+		utils.RespondError(c, http.StatusNotFound, "user not found")
+		return
+	}
+
+	updated, err := h.service.MarkRead(user.ID, req.IDs)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to mark notifications as read")
+		return
+	}
+
+	c.JSON(http.StatusOK, MarkReadResponse{Updated: updated})
+}
+
+// @Summary Get notification preferences
+// @Description Get the notification delivery channels enabled for the current user
+// @Tags Notification
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} PreferencesResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/notifications/preferences [get]
+func (h *handler) GetPreferences(c *gin.Context) {
+	sessionKey := session.Key(c)
+	if sessionKey == "" {
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
+		return
+	}
+
+	user, err := h.sessionSvc.GetUserBySessionKey(sessionKey)
+	if err != nil {
+		utils.RespondError(c, http.StatusNotFound, "user not found")
+		return
+	}
+
+	prefs, err := h.service.GetPreferences(user.ID)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get preferences")
+		return
+	}
+
+	c.JSON(http.StatusOK, PreferencesResponse{
+		Channels:    h.service.Channels(),
+		Preferences: prefs,
+	})
+}
+
+// @Summary Update notification preferences
+// @Description Enable or disable notification delivery channels for the current user
+// @Tags Notification
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body UpdatePreferencesRequest true "Preferences update request"
+// @Success 200 {object} PreferencesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/notifications/preferences [put]
+func (h *handler) UpdatePreferences(c *gin.Context) {
+	var req UpdatePreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, err := h.sessionSvc.GetUserBySessionKey(session.KeyOr(c, req.SessionKey))
+	if err != nil {
+		utils.RespondError(c, http.StatusNotFound, "user not found")
+		return
+	}
+
+	prefs, err := h.service.UpdatePreferences(user.ID, req.Preferences)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, PreferencesResponse{
+		Channels:    h.service.Channels(),
+		Preferences: prefs,
+	})
+}
+
+// @Summary Get web push key
+// @Description Get the VAPID public key to pass as applicationServerKey when subscribing
+// @Tags Notification
+// @Produce json
+// @Success 200 {object} PushKeyResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /api/notifications/push/key [get]
+func (h *handler) GetPushKey(c *gin.Context) {
+	key, err := h.service.PushPublicKey()
+	if err != nil {
+		utils.RespondError(c, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, PushKeyResponse{PublicKey: key})
+}
+
+// @Summary Subscribe to web push
+// @Description Store a browser push subscription and enable the webpush channel for the current user
+// @Tags Notification
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body SubscribePushRequest true "Push subscription"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /api/notifications/push [post]
+func (h *handler) SubscribePush(c *gin.Context) {
+	var req SubscribePushRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, err := h.sessionSvc.GetUserBySessionKey(session.KeyOr(c, req.SessionKey))
+	if err != nil {
+		utils.RespondError(c, http.StatusNotFound, "user not found")
+		return
+	}
+
+	if err := h.service.SubscribePush(user.ID, req); err != nil {
+		if errors.Is(err, ErrPushDisabled) {
+			utils.RespondError(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		utils.RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Unsubscribe from web push
+// @Description Remove a browser push subscription of the current user
+// @Tags Notification
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body UnsubscribePushRequest true "Push subscription endpoint"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/notifications/push [delete]
+func (h *handler) UnsubscribePush(c *gin.Context) {
+	var req UnsubscribePushRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, err := h.sessionSvc.GetUserBySessionKey(session.KeyOr(c, req.SessionKey))
+	if err != nil {
+		utils.RespondError(c, http.StatusNotFound, "user not found")
+		return
+	}
+
+	if err := h.service.UnsubscribePush(user.ID, req.Endpoint); err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to remove subscription")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,121 @@
+package notification
+
+import (
+	"time"
+
+	"backend/internal/utils"
+)
+
+const (
+	ChannelWebSocket = "websocket"
+	ChannelWebhook   = "webhook"
+	ChannelWebPush   = "webpush"
+)
+
+const TypeYouWereQuoted = "you_were_quoted"
+
+type Notification struct {
+	ID        uint64                 `json:"id" gorm:"primaryKey"`
+	UserID    uint64                 `json:"user_id" gorm:"not null;index:idx_notifications_user_created,priority:1"`
+	Type      string                 `json:"type" gorm:"type:varchar(64);not null"`
+	Data      map[string]interface{} `json:"data,omitempty" gorm:"type:jsonb;serializer:json"`
+	ReadAt    *time.Time             `json:"read_at,omitempty"`
+	CreatedAt time.Time              `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP;index:idx_notifications_user_created,priority:2,sort:desc"`
+}
+
+func (Notification) TableName() string {
+	return "notifications"
+}
+
+type Preference struct {
+	ID        uint64    `json:"-" gorm:"primaryKey"`
+	UserID    uint64    `json:"-" gorm:"not null;uniqueIndex:idx_notification_pref_user_channel"`
+	Channel   string    `json:"channel" gorm:"type:varchar(32);not null;uniqueIndex:idx_notification_pref_user_channel"`
+	Enabled   bool      `json:"enabled" gorm:"not null;default:true"`
+	Target    *string   `json:"target,omitempty" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
+}
+
+func (Preference) TableName() string {
+	return "notification_preferences"
+}
+
+type PushSubscription struct {
+	ID        uint64    `json:"id" gorm:"primaryKey"`
+	UserID    uint64    `json:"-" gorm:"not null;index"`
+	Endpoint  string    `json:"endpoint" gorm:"type:text;not null;uniqueIndex"`
+	P256dh    string    `json:"-" gorm:"type:varchar(128);not null"`
+	Auth      string    `json:"-" gorm:"type:varchar(64);not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
+}
+
+func (PushSubscription) TableName() string {
+	return "push_subscriptions"
+}
+
+type PushSubscriptionKeys struct {
+	P256dh string `json:"p256dh" binding:"required"`
+	Auth   string `json:"auth" binding:"required"`
+}
+
+// SubscribePushRequest mirrors PushSubscription.toJSON() in the browser.
+type SubscribePushRequest struct {
+	// Deprecated: send the key in the Authorization header or session cookie.
+	SessionKey string               `json:"session_key,omitempty"`
+	Endpoint   string               `json:"endpoint" binding:"required"`
+	Keys       PushSubscriptionKeys `json:"keys" binding:"required"`
+}
+
+type UnsubscribePushRequest struct {
+	// Deprecated: send the key in the Authorization header or session cookie.
+	SessionKey string `json:"session_key,omitempty"`
+	Endpoint   string `json:"endpoint" binding:"required"`
+}
+
+type PushKeyResponse struct {
+	PublicKey string `json:"public_key"`
+}
+
+type UpdatePreferencesRequest struct {
+	// Deprecated: send the key in the Authorization header or session cookie.
+	SessionKey  string              `json:"session_key,omitempty"`
+	Preferences []PreferenceRequest `json:"preferences" binding:"required"`
+}
+
+type PreferenceRequest struct {
+	Channel string  `json:"channel" binding:"required"`
+	Enabled bool    `json:"enabled"`
+	Target  *string `json:"target,omitempty"`
+}
+
+type PreferencesResponse struct {
+	Channels    []string      `json:"channels"`
+	Preferences []*Preference `json:"preferences"`
+}
+
+type MarkReadRequest struct {
+	// Deprecated: send the key in the Authorization header or session cookie.
+	SessionKey string   `json:"session_key,omitempty"`
+	IDs        []uint64 `json:"ids,omitempty"`
+}
+
+type MarkReadResponse struct {
+	Updated int64 `json:"updated"`
+}
+
+type NotificationListResponse struct {
+	Notifications []*Notification `json:"notifications"`
+	Unread        int64           `json:"unread"`
+	Pagination    Pagination      `json:"pagination"`
+}
+
+type Pagination struct {
+	Page       int   `json:"page"`
+	Limit      int   `json:"limit"`
+	Total      int64 `json:"total"`
+	TotalPages int64 `json:"total_pages"`
+}
+
+type ErrorResponse = utils.ErrorResponse
@@ -0,0 +1,154 @@
+package notification
+
+import (
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository interface {
+	GetPreferencesByUserID(userID uint64) ([]*Preference, error)
+	UpsertPreference(pref *Preference) error
+	CreateNotification(n *Notification) error
+	ListByUser(userID uint64, unreadOnly bool, page, limit int) ([]*Notification, int64, error)
+	CountUnread(userID uint64) (int64, error)
+	MarkRead(userID uint64, ids []uint64) (int64, error)
+	QuotedAuthors(threadID uint64, postNos []uint64) (map[uint64]uint64, error)
+	UsersWithChannelEnabled(channel string, userIDs []uint64) ([]uint64, error)
+	UpsertPushSubscription(sub *PushSubscription) error
+	DeletePushSubscription(userID uint64, endpoint string) error
+	DeletePushSubscriptionByEndpoint(endpoint string) error
+	GetPushSubscriptions(userID uint64) ([]*PushSubscription, error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) GetPreferencesByUserID(userID uint64) ([]*Preference, error) {
+	var prefs []*Preference
+	err := r.db.
+		Where("user_id = ?", userID).
+		Order("channel ASC").
+		Find(&prefs).Error
+	return prefs, err
+}
+
+func (r *repository) UpsertPreference(pref *Preference) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "channel"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled", "target", "updated_at"}),
+	}).Create(pref).Error
+}
+
+func (r *repository) CreateNotification(n *Notification) error {
+	return r.db.Create(n).Error
+}
+
+func (r *repository) ListByUser(userID uint64, unreadOnly bool, page, limit int) ([]*Notification, int64, error) {
+	query := r.db.Model(&Notification{}).Where("user_id = ?", userID)
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var notifications []*Notification
+	err := query.
+		Order("created_at DESC, id DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&notifications).Error
+	return notifications, total, err
+}
+
+func (r *repository) CountUnread(userID uint64) (int64, error) {
+	var count int64
+	err := r.db.Model(&Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// MarkRead marks the given notifications as read, or all of the user's
+// unread notifications when ids is empty.
+func (r *repository) MarkRead(userID uint64, ids []uint64) (int64, error) {
+	query := r.db.Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", userID)
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+	result := query.Update("read_at", time.Now().UTC())
+	return result.RowsAffected, result.Error
+}
+
+// QuotedAuthors maps each existing post number on the thread's board, OP or
+// reply, to the user who posted it.
+func (r *repository) QuotedAuthors(threadID uint64, postNos []uint64) (map[uint64]uint64, error) {
+	var rows []struct {
+		PostNo uint64
+		UserID uint64
+	}
+	err := r.db.Raw(`
+		SELECT threads.post_no, sessions.user_id
+		FROM threads
+		JOIN sessions ON sessions.id = threads.created_by_session_id
+		WHERE threads.board_id = (SELECT board_id FROM threads WHERE id = @thread)
+			AND threads.post_no IN @post_nos
+		UNION ALL
+		SELECT messages.post_no, sessions.user_id
+		FROM messages
+		JOIN threads ON threads.id = messages.thread_id
+		JOIN sessions ON sessions.id = messages.created_by_session_id
+		WHERE threads.board_id = (SELECT board_id FROM threads WHERE id = @thread)
+			AND messages.post_no IN @post_nos
+	`, sql.Named("thread", threadID), sql.Named("post_nos", postNos)).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	authors := make(map[uint64]uint64, len(rows))
+	for _, row := range rows {
+		authors[row.PostNo] = row.UserID
+	}
+	return authors, nil
+}
+
+func (r *repository) UsersWithChannelEnabled(channel string, userIDs []uint64) ([]uint64, error) {
+	var ids []uint64
+	err := r.db.Model(&Preference{}).
+		Where("channel = ? AND enabled = ? AND user_id IN ?", channel, true, userIDs).
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// UpsertPushSubscription re-binds an endpoint to the given user, since a
+// browser keeps its endpoint when a different session subscribes with it.
+func (r *repository) UpsertPushSubscription(sub *PushSubscription) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "endpoint"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "p256dh", "auth", "updated_at"}),
+	}).Create(sub).Error
+}
+
+func (r *repository) DeletePushSubscription(userID uint64, endpoint string) error {
+	return r.db.Where("user_id = ? AND endpoint = ?", userID, endpoint).Delete(&PushSubscription{}).Error
+}
+
+func (r *repository) DeletePushSubscriptionByEndpoint(endpoint string) error {
+	return r.db.Where("endpoint = ?", endpoint).Delete(&PushSubscription{}).Error
+}
+
+func (r *repository) GetPushSubscriptions(userID uint64) ([]*PushSubscription, error) {
+	var subs []*PushSubscription
+	err := r.db.Where("user_id = ?", userID).Order("id ASC").Find(&subs).Error
+	return subs, err
+}
@@ -0,0 +1,16 @@
+package notification
+
+import "github.com/gin-gonic/gin"
+
+func RegisterRoutes(rg *gin.RouterGroup, handler Handler) {
+	notifications := rg.Group("/notifications")
+	{
+		notifications.GET("", handler.List)
+		notifications.POST("/read", handler.MarkRead)
+		notifications.GET("/preferences", handler.GetPreferences)
+		notifications.PUT("/preferences", handler.UpdatePreferences)
+		notifications.GET("/push/key", handler.GetPushKey)
+		notifications.POST("/push", handler.SubscribePush)
+		notifications.DELETE("/push", handler.UnsubscribePush)
+	}
+}
@@ -0,0 +1,303 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"backend/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+type Service interface {
+	Notify(ctx context.Context, n *Notification)
+	GetPreferences(userID uint64) ([]*Preference, error)
+	UpdatePreferences(userID uint64, prefs []PreferenceRequest) ([]*Preference, error)
+	Channels() []string
+	List(userID uint64, unreadOnly bool, page, limit int) ([]*Notification, int64, int64, error)
+	MarkRead(userID uint64, ids []uint64) (int64, error)
+	NotifyReply(ctx context.Context, threadID, messageID, authorUserID uint64, content string)
+	PushToUsers(ctx context.Context, userIDs []uint64, notifType string, data map[string]interface{})
+	PushPublicKey() (string, error)
+	SubscribePush(userID uint64, req SubscribePushRequest) error
+	UnsubscribePush(userID uint64, endpoint string) error
+}
+
+var ErrPushDisabled = errors.New("web push is not configured")
+
+// maxQuotesPerMessage bounds the lookups a single message can trigger.
+const maxQuotesPerMessage = 20
+
+var quotePattern = regexp.MustCompile(`>>(\d+)`)
+
+type service struct {
+	repo     Repository
+	channels map[string]Channel
+	order    []string
+	logger   *zap.SugaredLogger
+}
+
+func NewService(repo Repository, logger *zap.Logger, channels ...Channel) Service {
+	s := &service{
+		repo:     repo,
+		channels: make(map[string]Channel, len(channels)),
+		logger:   logger.Sugar(),
+	}
+	for _, ch := range channels {
+		s.channels[ch.Name()] = ch
+		s.order = append(s.order, ch.Name())
+	}
+	return s
+}
+
+func (s *service) Channels() []string {
+	return s.order
+}
+
+// Notify stores n and delivers it through every channel the user has enabled.
+// Users without stored preferences get WebSocket delivery only.
+func (s *service) Notify(ctx context.Context, n *Notification) {
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now().UTC()
+	}
+	if err := s.repo.CreateNotification(n); err != nil {
+		s.logger.Warnw("Failed to store notification", "user_id", n.UserID, "type", n.Type, "error", err)
+	}
+
+	prefs, err := s.repo.GetPreferencesByUserID(n.UserID)
+	if err != nil {
+		s.logger.Warnw("Failed to load notification preferences", "user_id", n.UserID, "error", err)
+	}
+
+	byChannel := make(map[string]*Preference, len(prefs))
+	for _, p := range prefs {
+		byChannel[p.Channel] = p
+	}
+
+	for _, name := range s.order {
+		pref, ok := byChannel[name]
+		if !ok {
+			if name != ChannelWebSocket {
+				continue
+			}
+		} else if !pref.Enabled {
+			continue
+		}
+
+		if err := s.channels[name].Send(ctx, pref, n); err != nil {
+			s.logger.Warnw("Failed to deliver notification",
+				"channel", name,
+				"user_id", n.UserID,
+				"type", n.Type,
+				"error", err,
+			)
+			continue
+		}
+		s.logger.Debugw("Notification delivered", "channel", name, "user_id", n.UserID, "type", n.Type)
+	}
+}
+
+func (s *service) GetPreferences(userID uint64) ([]*Preference, error) {
+	return s.repo.GetPreferencesByUserID(userID)
+}
+
+func (s *service) UpdatePreferences(userID uint64, prefs []PreferenceRequest) ([]*Preference, error) {
+	now := time.Now().UTC()
+	for _, p := range prefs {
+		if _, ok := s.channels[p.Channel]; !ok {
+			return nil, fmt.Errorf("unknown notification channel: %s", p.Channel)
+		}
+		if p.Channel == ChannelWebhook && p.Enabled {
+			if p.Target == nil {
+				return nil, fmt.Errorf("webhook target is required")
+			}
+			u, err := url.Parse(*p.Target)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("invalid webhook target")
+			}
+			if err := utils.CheckPublicURL(context.Background(), u); err != nil {
+				return nil, fmt.Errorf("invalid webhook target: %w", err)
+			}
+		}
+
+		pref := &Preference{
+			UserID:    userID,
+			Channel:   p.Channel,
+			Enabled:   p.Enabled,
+			Target:    p.Target,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := s.repo.UpsertPreference(pref); err != nil {
+			return nil, fmt.Errorf("failed to save preference: %w", err)
+		}
+	}
+	return s.repo.GetPreferencesByUserID(userID)
+}
+
+// List returns a page of the user's notifications, newest first, along with
+// the total for the filter and the overall unread count.
+func (s *service) List(userID uint64, unreadOnly bool, page, limit int) ([]*Notification, int64, int64, error) {
+	notifications, total, err := s.repo.ListByUser(userID, unreadOnly, page, limit)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	unread, err := s.repo.CountUnread(userID)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return notifications, total, unread, nil
+}
+
+func (s *service) MarkRead(userID uint64, ids []uint64) (int64, error) {
+	return s.repo.MarkRead(userID, ids)
+}
+
+// NotifyReply sends you_were_quoted to the authors of every post the reply
+// quotes with >>post_no, skipping the reply's own author. Delivery happens in
+// the background so slow webhooks never hold up posting.
+func (s *service) NotifyReply(ctx context.Context, threadID, messageID, authorUserID uint64, content string) {
+	quoted := parseQuotes(content)
+	if len(quoted) == 0 {
+		return
+	}
+	go s.notifyQuoted(context.WithoutCancel(ctx), threadID, messageID, authorUserID, quoted)
+}
+
+func (s *service) notifyQuoted(ctx context.Context, threadID, messageID, authorUserID uint64, quoted []uint64) {
+
+	authors, err := s.repo.QuotedAuthors(threadID, quoted)
+	if err != nil {
+		s.logger.Errorw("Failed to resolve quoted posts", "message_id", messageID, "error", err)
+		return
+	}
+
+	byUser := make(map[uint64][]uint64)
+	var order []uint64
+	for _, postNo := range quoted {
+		userID, ok := authors[postNo]
+		if !ok || userID == authorUserID {
+			continue
+		}
+		if _, seen := byUser[userID]; !seen {
+			order = append(order, userID)
+		}
+		byUser[userID] = append(byUser[userID], postNo)
+	}
+
+	for _, userID := range order {
+		s.Notify(ctx, &Notification{
+			UserID: userID,
+			Type:   TypeYouWereQuoted,
+			Data: map[string]interface{}{
+				"thread_id":       threadID,
+				"message_id":      messageID,
+				"quoted_post_nos": byUser[userID],
+			},
+		})
+	}
+}
+
+// parseQuotes returns the distinct post numbers referenced as >>post_no, in
+// order of first appearance.
+func parseQuotes(content string) []uint64 {
+	matches := quotePattern.FindAllStringSubmatch(content, -1)
+	ids := make([]uint64, 0, len(matches))
+	seen := make(map[uint64]bool, len(matches))
+	for _, m := range matches {
+		id, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+		if len(ids) == maxQuotesPerMessage {
+			break
+		}
+	}
+	return ids
+}
+
+// PushPublicKey returns the VAPID key browsers need to subscribe.
+func (s *service) PushPublicKey() (string, error) {
+	ch, ok := s.channels[ChannelWebPush].(interface{ PublicKey() string })
+	if !ok {
+		return "", ErrPushDisabled
+	}
+	return ch.PublicKey(), nil
+}
+
+// SubscribePush stores the browser subscription and opts the user into the
+// web push channel.
+func (s *service) SubscribePush(userID uint64, req SubscribePushRequest) error {
+	if _, ok := s.channels[ChannelWebPush]; !ok {
+		return ErrPushDisabled
+	}
+	u, err := url.Parse(req.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" || (u.Port() != "" && u.Port() != "443") {
+		return fmt.Errorf("invalid push endpoint")
+	}
+	if err := utils.CheckPublicURL(context.Background(), u); err != nil {
+		return fmt.Errorf("invalid push endpoint: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if err := s.repo.UpsertPushSubscription(&PushSubscription{
+		UserID:    userID,
+		Endpoint:  req.Endpoint,
+		P256dh:    req.Keys.P256dh,
+		Auth:      req.Keys.Auth,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}); err != nil {
+		return fmt.Errorf("failed to save push subscription: %w", err)
+	}
+
+	return s.repo.UpsertPreference(&Preference{
+		UserID:    userID,
+		Channel:   ChannelWebPush,
+		Enabled:   true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+}
+
+func (s *service) UnsubscribePush(userID uint64, endpoint string) error {
+	return s.repo.DeletePushSubscription(userID, endpoint)
+}
+
+// PushToUsers delivers a transient notification over web push only, to the
+// users among userIDs who enabled it. Nothing is stored, since the event is
+// already delivered live over the websocket.
+func (s *service) PushToUsers(ctx context.Context, userIDs []uint64, notifType string, data map[string]interface{}) {
+	ch, ok := s.channels[ChannelWebPush]
+	if !ok || len(userIDs) == 0 {
+		return
+	}
+
+	go func(ctx context.Context) {
+		enabled, err := s.repo.UsersWithChannelEnabled(ChannelWebPush, userIDs)
+		if err != nil {
+			s.logger.Warnw("Failed to load web push preferences", "error", err)
+			return
+		}
+
+		now := time.Now().UTC()
+		for _, userID := range enabled {
+			n := &Notification{UserID: userID, Type: notifType, Data: data, CreatedAt: now}
+			if err := ch.Send(ctx, nil, n); err != nil {
+				s.logger.Warnw("Failed to deliver notification",
+					"channel", ChannelWebPush,
+					"user_id", userID,
+					"type", notifType,
+					"error", err,
+				)
+			}
+		}
+	}(context.WithoutCancel(ctx))
+}
@@ -0,0 +1,82 @@
+package session
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CookieName is the HttpOnly cookie CreateSession sets for browsers.
+const CookieName = "session_key"
+
+// QueryParam is the deprecated query parameter that used to carry the key.
+const QueryParam = "session_key"
+
+const contextKey = "session_key"
+
+// Cookie configures the session cookie, which lives as long as the token in
+// it.
+type Cookie struct {
+	Secure bool
+}
+
+// KeyFromRequest finds the session key a request presents: an
+// Authorization: Bearer header first, then the session cookie, then the
+// session_key query parameter. fromQuery reports the last case so callers
+// can flag the deprecated form.
+func KeyFromRequest(r *http.Request) (key string, fromQuery bool) {
+	if auth := r.Header.Get("Authorization"); len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		return strings.TrimSpace(auth[len("Bearer "):]), false
+	}
+	if cookie, err := r.Cookie(CookieName); err == nil && cookie.Value != "" {
+		return cookie.Value, false
+	}
+	if key := r.URL.Query().Get(QueryParam); key != "" {
+		return key, true
+	}
+	return "", false
+}
+
+// SetKey stores the request's session key in the gin context.
+func SetKey(c *gin.Context, key string) {
+	c.Set(contextKey, key)
+}
+
+// Key is the session key the auth middleware found on the request, or ""
+// for anonymous requests.
+func Key(c *gin.Context) string {
+	return c.GetString(contextKey)
+}
+
+// KeyOr is Key, falling back to a key sent in the request body by clients
+// that predate the Authorization header.
+func KeyOr(c *gin.Context, bodyKey string) string {
+	if key := Key(c); key != "" {
+		return key
+	}
+	return bodyKey
+}
+
+func setCookie(c *gin.Context, token *Token, cookie Cookie) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(CookieName, token.Value, int(time.Until(token.ExpiresAt).Seconds()), "/", "", cookie.Secure, true)
+}
+
+func clearCookie(c *gin.Context, cookie Cookie) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(CookieName, "", -1, "/", "", cookie.Secure, true)
+}
+
+// ClientIP is the address users are identified by. X-Forwarded-For and
+// X-Real-IP count only when the peer is one of the trusted proxies (see
+// router.TrustProxies); otherwise it is the peer address, so a client
+// cannot pick the address it posts from.
+func ClientIP(c *gin.Context) string {
+	if ip := net.ParseIP(c.ClientIP()); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
@@ -1,27 +1,34 @@
 package session
 
 import (
-	"net"
+	"errors"
 	"net/http"
-	"strings"
+	"strconv"
+
+	"backend/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Handler interface {
 	CreateSession(c *gin.Context)
+	RefreshSession(c *gin.Context)
+	DeleteSession(c *gin.Context)
+	ListSessions(c *gin.Context)
+	RevokeSession(c *gin.Context)
 }
 
 type handler struct {
 	service Service
+	cookie  Cookie
 }
 
-func NewHandler(service Service) Handler {
-	return &handler{service: service}
+func NewHandler(service Service, cookie Cookie) Handler {
+	return &handler{service: service, cookie: cookie}
 }
 
 // @Summary Create a new session
-// @Description Creates a new anonymous session and user for posting
+// @Description Creates a new anonymous session and user for posting. The key is returned in the body for the Authorization: Bearer header and set as an HttpOnly session_key cookie for browsers.
 // @Tags Session
 // @Accept json
 // @Produce json
@@ -30,42 +37,150 @@ func NewHandler(service Service) Handler {
 // @Router /api/session [post]
 func (h *handler) CreateSession(c *gin.Context) {
 	userAgent := c.GetHeader("User-Agent")
-	ip := extractIP(c)
+	ip := ClientIP(c)
 
-	session, user, err := h.service.CreateSessionAndUser(userAgent, ip)
+	session, user, token, err := h.service.CreateSessionAndUser(userAgent, ip)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		utils.RespondError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	setCookie(c, token, h.cookie)
 	c.JSON(http.StatusCreated, SessionResponse{
 		ID:         user.ID,
 		Nickname:   user.Nickname,
 		CreatedAt:  session.CreatedAt,
-		SessionKey: session.SessionKey,
+		SessionKey: token.Value,
+		ExpiresAt:  token.ExpiresAt,
 	})
 }
 
-func extractIP(c *gin.Context) string {
-	clientIP := c.GetHeader("X-Forwarded-For")
-	if clientIP != "" {
-		ips := strings.Split(clientIP, ",")
-		if len(ips) > 0 {
-			netIP := net.ParseIP(strings.TrimSpace(ips[0]))
-			if netIP != nil {
-				return netIP.String()
-			}
+// @Summary Refresh the session token
+// @Description Swaps the current token for a new one that expires SESSION_MAX_AGE from now; the old token stops working
+// @Tags Session
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} TokenResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /api/session/refresh [post]
+func (h *handler) RefreshSession(c *gin.Context) {
+	sessionKey := Key(c)
+	if sessionKey == "" {
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
+		return
+	}
+
+	token, err := h.service.Refresh(c.Request.Context(), sessionKey)
+	if err != nil {
+		if isAuthError(err) {
+			clearCookie(c, h.cookie)
+			utils.RespondError(c, http.StatusUnauthorized, err.Error())
+			return
 		}
+		utils.WriteError(c, err)
+		return
 	}
 
-	clientIP = c.GetHeader("X-Real-IP")
-	if clientIP != "" {
-		netIP := net.ParseIP(clientIP)
-		if netIP != nil {
-			return netIP.String()
+	setCookie(c, token, h.cookie)
+	c.JSON(http.StatusOK, TokenResponse{
+		SessionKey: token.Value,
+		ExpiresAt:  token.ExpiresAt,
+	})
+}
+
+// @Summary End the current session
+// @Description Revokes the session token right away and clears the session cookie
+// @Tags Session
+// @Security BearerAuth
+// @Success 204
+// @Failure 401 {object} ErrorResponse
+// @Router /api/session [delete]
+func (h *handler) DeleteSession(c *gin.Context) {
+	sessionKey := Key(c)
+	if sessionKey == "" {
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
+		return
+	}
+
+	if err := h.service.Revoke(c.Request.Context(), sessionKey); err != nil {
+		if isAuthError(err) {
+			clearCookie(c, h.cookie)
+			utils.RespondError(c, http.StatusUnauthorized, err.Error())
+			return
 		}
+		utils.WriteError(c, err)
+		return
+	}
+
+	clearCookie(c, h.cookie)
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary List active sessions
+// @Description Lists the current user's active sessions on all devices; the one making the request has current set
+// @Tags Session
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} SessionListResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /api/sessions [get]
+func (h *handler) ListSessions(c *gin.Context) {
+	sessionKey := Key(c)
+	if sessionKey == "" {
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
+		return
 	}
 
-	ip, _, _ := net.SplitHostPort(c.Request.RemoteAddr)
-	return ip
+	sessions, err := h.service.ListSessions(c.Request.Context(), sessionKey)
+	if err != nil {
+		if isAuthError(err) {
+			utils.RespondError(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		utils.WriteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SessionListResponse{Sessions: sessions})
+}
+
+// @Summary Revoke a session
+// @Description Signs out one of the current user's sessions and closes its websocket connections
+// @Tags Session
+// @Security BearerAuth
+// @Param id path int true "Session ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/sessions/{id} [delete]
+func (h *handler) RevokeSession(c *gin.Context) {
+	sessionKey := Key(c)
+	if sessionKey == "" {
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
+		return
+	}
+
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid session ID")
+		return
+	}
+
+	if err := h.service.RevokeByID(c.Request.Context(), sessionKey, sessionID); err != nil {
+		if isAuthError(err) {
+			utils.RespondError(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		utils.WriteError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// isAuthError reports errors that mean the presented token is no good, as
+// opposed to the server failing to check it.
+func isAuthError(err error) bool {
+	return errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrTokenExpired) || errors.Is(err, ErrRevoked)
 }
@@ -1,6 +1,10 @@
 package session
 
-import "time"
+import (
+	"time"
+
+	"backend/internal/utils"
+)
 
 type Session struct {
 	ID         uint64    `gorm:"primaryKey"`
@@ -11,11 +15,24 @@ type Session struct {
 	UserID     uint64    `gorm:"not null;index"`
 	CreatedAt  time.Time `gorm:"not null;default:CURRENT_TIMESTAMP"`
 	UpdatedAt  time.Time `gorm:"not null;default:CURRENT_TIMESTAMP"`
+
+	// TokenVersion and ExpiresAt describe the one token that is valid for
+	// the session; Refresh moves both. ExpiresAt is nil for sessions created
+	// before it was recorded, which expire a TTL after StartedAt.
+	TokenVersion int        `gorm:"not null;default:0"`
+	ExpiresAt    *time.Time `gorm:"index"`
+
+	// LastSeenAt is updated at most once per lastSeenInterval.
+	LastSeenAt *time.Time
+
+	// RotatesAt is when the user behind the session is retired under
+	// ID_ROTATION; tokens never outlive it. Nil without rotation.
+	RotatesAt *time.Time
 }
 
 type User struct {
 	ID        uint64    `gorm:"primaryKey"`
-	IP        string    `gorm:"type:inet;not null;unique"`
+	IP        string    `gorm:"type:text;not null;unique"`
 	Nickname  string    `gorm:"not null;default:'Аноним'"`
 	CreatedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP"`
 	UpdatedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP"`
@@ -26,8 +43,26 @@ type SessionResponse struct {
 	Nickname   string    `json:"nickname"`
 	CreatedAt  time.Time `json:"created_at"`
 	SessionKey string    `json:"session_key"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type TokenResponse struct {
+	SessionKey string    `json:"session_key"`
+	ExpiresAt  time.Time `json:"expires_at"`
 }
 
-type ErrorResponse struct {
-	Error string `json:"error"`
+// SessionInfo describes one of the user's sessions for the device list.
+type SessionInfo struct {
+	ID         uint64     `json:"id"`
+	UserAgent  *string    `json:"user_agent,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	Current    bool       `json:"current"`
 }
+
+type SessionListResponse struct {
+	Sessions []*SessionInfo `json:"sessions"`
+}
+
+type ErrorResponse = utils.ErrorResponse
@@ -9,12 +9,16 @@ import (
 type Repository interface {
 	GetUserByIP(ip string) (*User, error)
 	CreateUser(user *User) error
+	SetNickname(userID uint64, nickname string) error
 	CreateSession(session *Session) error
-	CloseUserSessions(userID uint64) error
 	GetSessionByKey(sessionKey string) (*Session, error)
 	GetSessionByID(sessionID uint64) (*Session, error)
 	GetUserByID(id uint64) (*User, error)
 	UpdateSessionEndedAt(sessionID uint64) error
+	RotateToken(sessionID uint64, version int, expiresAt time.Time) (bool, error)
+	CloseExpiredSessions(now, legacyCutoff time.Time) ([]*Session, error)
+	GetActiveSessions(userID uint64, now, legacyCutoff time.Time) ([]*Session, error)
+	TouchLastSeen(sessionID uint64, at time.Time) error
 }
 
 type repository struct {
@@ -35,14 +39,12 @@ func (r *repository) CreateUser(user *User) error {
 	return r.db.Create(user).Error
 }
 
-func (r *repository) CreateSession(session *Session) error {
-	return r.db.Create(session).Error
+func (r *repository) SetNickname(userID uint64, nickname string) error {
+	return r.db.Model(&User{}).Where("id = ?", userID).Update("nickname", nickname).Error
 }
 
-func (r *repository) CloseUserSessions(userID uint64) error {
-	return r.db.Model(&Session{}).
-		Where("user_id = ? AND ended_at IS NULL", userID).
-		Update("ended_at", time.Now().UTC()).Error
+func (r *repository) CreateSession(session *Session) error {
+	return r.db.Create(session).Error
 }
 
 func (r *repository) GetSessionByKey(sessionKey string) (*Session, error) {
@@ -68,3 +70,56 @@ func (r *repository) UpdateSessionEndedAt(sessionID uint64) error {
 		Where("id = ?", sessionID).
 		Update("ended_at", time.Now().UTC()).Error
 }
+
+// RotateToken bumps the session's token version only if it is still
+// version, so two refreshes racing with the same token cannot both win.
+func (r *repository) RotateToken(sessionID uint64, version int, expiresAt time.Time) (bool, error) {
+	res := r.db.Model(&Session{}).
+		Where("id = ? AND token_version = ?", sessionID, version).
+		Updates(map[string]interface{}{
+			"token_version": gorm.Expr("token_version + 1"),
+			"expires_at":    expiresAt,
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+// CloseExpiredSessions ends open sessions whose token expired before now;
+// sessions without expires_at count as expired once they started before
+// legacyCutoff.
+func (r *repository) CloseExpiredSessions(now, legacyCutoff time.Time) ([]*Session, error) {
+	var expired []*Session
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id", "user_id").
+			Where("ended_at IS NULL AND (expires_at < ? OR (expires_at IS NULL AND started_at < ?))", now, legacyCutoff).
+			Find(&expired).Error; err != nil {
+			return err
+		}
+		if len(expired) == 0 {
+			return nil
+		}
+
+		ids := make([]uint64, len(expired))
+		for i, session := range expired {
+			ids[i] = session.ID
+		}
+		return tx.Model(&Session{}).Where("id IN ?", ids).Update("ended_at", now).Error
+	})
+	return expired, err
+}
+
+// GetActiveSessions lists the user's open, unexpired sessions, most recently
+// started first.
+func (r *repository) GetActiveSessions(userID uint64, now, legacyCutoff time.Time) ([]*Session, error) {
+	var sessions []*Session
+	err := r.db.
+		Where("user_id = ? AND ended_at IS NULL AND (expires_at > ? OR (expires_at IS NULL AND started_at >= ?))", userID, now, legacyCutoff).
+		Order("started_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *repository) TouchLastSeen(sessionID uint64, at time.Time) error {
+	return r.db.Model(&Session{}).
+		Where("id = ?", sessionID).
+		UpdateColumn("last_seen_at", at).Error
+}
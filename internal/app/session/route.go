@@ -4,4 +4,8 @@ import "github.com/gin-gonic/gin"
 
 func RegisterRoutes(rg gin.IRoutes, handler Handler) {
 	rg.POST("/session", handler.CreateSession)
+	rg.POST("/session/refresh", handler.RefreshSession)
+	rg.DELETE("/session", handler.DeleteSession)
+	rg.GET("/sessions", handler.ListSessions)
+	rg.DELETE("/sessions/:id", handler.RevokeSession)
 }
@@ -4,67 +4,147 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"time"
 
+	"backend/internal/app/settings"
 	"backend/internal/providers/redis"
+	"backend/internal/utils"
 )
 
+const (
+	sessionCacheTTL  = 10 * time.Minute
+	lastSeenInterval = time.Minute
+)
+
+// Token is a signed session token and the moment it stops being accepted.
+type Token struct {
+	Value     string
+	ExpiresAt time.Time
+}
+
 type Service interface {
-	CreateSessionAndUser(userAgent string, ipStr string) (*Session, *User, error)
+	CreateSessionAndUser(userAgent string, ipStr string) (*Session, *User, *Token, error)
 	GetUserBySessionKey(sessionKey string) (*User, error)
 	GetSessionByKey(sessionKey string) (*Session, error)
 	UpdateSessionEndedAt(sessionID uint64) error
 	GetSessionStartedAtBySessionKey(sessionKey string) (time.Time, error)
+	ExpireSessions(ctx context.Context) (int64, error)
+	Refresh(ctx context.Context, sessionKey string) (*Token, error)
+	Revoke(ctx context.Context, sessionKey string) error
+	ListSessions(ctx context.Context, sessionKey string) ([]*SessionInfo, error)
+	RevokeByID(ctx context.Context, sessionKey string, sessionID uint64) error
 }
 
 type service struct {
-	repo   Repository
-	redisP *redis.RedisProvider
+	repo     Repository
+	redisP   *redis.RedisProvider
+	eventBus *utils.EventBus
+	tokens   tokenSigner
+	ttl      time.Duration
+	ips      utils.IPHasher
+	settings settings.Service
+}
+
+// NewService signs session tokens with secret; each token is accepted for
+// ttl after it is issued. Users are stored and found by ips.Identity of
+// their IP.
+func NewService(repo Repository, redisP *redis.RedisProvider, eventBus *utils.EventBus, secret []byte, ttl time.Duration, ips utils.IPHasher, settingsSvc settings.Service) Service {
+	return &service{
+		repo:     repo,
+		redisP:   redisP,
+		eventBus: eventBus,
+		tokens:   tokenSigner{secret: secret},
+		ttl:      ttl,
+		ips:      ips,
+		settings: settingsSvc,
+	}
+}
+
+func sessionCacheKey(sessionID uint64) string {
+	return fmt.Sprintf("session:%d", sessionID)
 }
 
-func NewService(repo Repository, redisP *redis.RedisProvider) Service {
-	return &service{repo: repo, redisP: redisP}
+func revokedKey(sessionID uint64) string {
+	return fmt.Sprintf("session:revoked:%d", sessionID)
 }
 
-func (s *service) CreateSessionAndUser(userAgent, ipStr string) (*Session, *User, error) {
-	user, err := s.repo.GetUserByIP(ipStr)
+func lastSeenKey(sessionID uint64) string {
+	return fmt.Sprintf("session:seen:%d", sessionID)
+}
+
+func (s *service) CreateSessionAndUser(userAgent, ipStr string) (*Session, *User, *Token, error) {
+	now := time.Now().UTC()
+	ip, rotatesAt := s.ips.Identity(ipStr, now)
+	user, err := s.repo.GetUserByIP(ip)
 	if err != nil {
 		user = &User{
-			IP:       ipStr,
+			IP:       ip,
 			Nickname: "Аноним",
 		}
 		if err := s.repo.CreateUser(user); err != nil {
-			return nil, nil, fmt.Errorf("failed to create user: %w", err)
+			return nil, nil, nil, fmt.Errorf("failed to create user: %w", err)
+		}
+		// The pseudonym is seeded by the user ID, which only exists now. If
+		// it cannot be saved the user simply stays "Аноним".
+		if s.settings.Current().AnonNames {
+			name := utils.AnonName(user.ID)
+			if err := s.repo.SetNickname(user.ID, name); err == nil {
+				user.Nickname = name
+			}
 		}
 	}
 
-	if err := s.repo.CloseUserSessions(user.ID); err != nil {
-		return nil, nil, err
-	}
-
+	// The random key only keeps the unique column filled; clients
+	// authenticate with the signed token, which names the session by ID.
 	sessionKey, err := generateSessionKey()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate session key: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to generate session key: %w", err)
 	}
 
+	expiresAt := now.Add(s.ttl)
+	var rotates *time.Time
+	if !rotatesAt.IsZero() {
+		rotates = &rotatesAt
+		if rotatesAt.Before(expiresAt) {
+			expiresAt = rotatesAt
+		}
+	}
 	session := &Session{
 		SessionKey: sessionKey,
 		UserAgent:  &userAgent,
 		UserID:     user.ID,
-		StartedAt:  time.Now().UTC(),
-		CreatedAt:  time.Now().UTC(),
+		StartedAt:  now,
+		CreatedAt:  now,
+		ExpiresAt:  &expiresAt,
+		RotatesAt:  rotates,
 	}
 
 	if err := s.repo.CreateSession(session); err != nil {
-		return nil, nil, fmt.Errorf("failed to create session: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return session, user, s.issue(session.ID, session.TokenVersion, expiresAt), nil
+}
+
+func (s *service) issue(sessionID uint64, version int, expiresAt time.Time) *Token {
+	return &Token{
+		Value:     s.tokens.sign(tokenClaims{SessionID: sessionID, Version: version, ExpiresAt: expiresAt}),
+		ExpiresAt: expiresAt,
 	}
+}
 
-	return session, user, nil
+// expiresAt is when the session's current token stops being accepted.
+func (s *service) expiresAt(session *Session) time.Time {
+	if session.ExpiresAt != nil {
+		return *session.ExpiresAt
+	}
+	return session.StartedAt.Add(s.ttl)
 }
 
 func (s *service) GetUserBySessionKey(sessionKey string) (*User, error) {
-	session, err := s.repo.GetSessionByKey(sessionKey)
+	session, err := s.GetSessionByKey(sessionKey)
 	if err != nil {
 		return nil, fmt.Errorf("session not found: %w", err)
 	}
@@ -77,8 +157,199 @@ func (s *service) GetUserBySessionKey(sessionKey string) (*User, error) {
 	return user, nil
 }
 
+// GetSessionByKey accepts a signed token, checked against its signature,
+// expiry and the revocation list before the session is read from cache and
+// its version compared, or a key issued before tokens were signed, which is
+// looked up as before and expires ttl after its session started. A session
+// that was ended is not found, whatever its token says.
 func (s *service) GetSessionByKey(sessionKey string) (*Session, error) {
-	return s.repo.GetSessionByKey(sessionKey)
+	ctx := context.Background()
+
+	if !isSignedToken(sessionKey) {
+		session, err := s.repo.GetSessionByKey(sessionKey)
+		if err != nil {
+			return nil, err
+		}
+		if session.EndedAt != nil {
+			return nil, utils.NotFound("session")
+		}
+		if !time.Now().Before(s.expiresAt(session)) {
+			return nil, ErrTokenExpired
+		}
+		if s.isRevoked(ctx, session.ID) {
+			return nil, ErrRevoked
+		}
+		s.touch(ctx, session.ID)
+		return session, nil
+	}
+
+	claims, err := s.tokens.parse(sessionKey, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if s.isRevoked(ctx, claims.SessionID) {
+		return nil, ErrRevoked
+	}
+	session, err := s.getSessionByID(ctx, claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.EndedAt != nil {
+		return nil, utils.NotFound("session")
+	}
+	if session.TokenVersion != claims.Version {
+		return nil, ErrRevoked
+	}
+	s.touch(ctx, session.ID)
+	return session, nil
+}
+
+// touch records that the session was used, writing to the database at most
+// once per lastSeenInterval.
+func (s *service) touch(ctx context.Context, sessionID uint64) {
+	ok, err := s.redisP.Client.SetNX(ctx, lastSeenKey(sessionID), 1, lastSeenInterval).Result()
+	if err != nil || !ok {
+		return
+	}
+	s.repo.TouchLastSeen(sessionID, time.Now().UTC())
+}
+
+func (s *service) getSessionByID(ctx context.Context, sessionID uint64) (*Session, error) {
+	key := sessionCacheKey(sessionID)
+	if cached, err := s.redisP.CachedGet(ctx, key); err == nil {
+		var session Session
+		if json.Unmarshal([]byte(cached), &session) == nil {
+			return &session, nil
+		}
+	}
+
+	session, err := s.repo.GetSessionByID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := json.Marshal(session); err == nil {
+		s.redisP.CachedSet(ctx, key, data, sessionCacheTTL)
+	}
+	return session, nil
+}
+
+// isRevoked fails open: while Redis is unreachable revoked sessions keep
+// working rather than every session being refused.
+func (s *service) isRevoked(ctx context.Context, sessionID uint64) bool {
+	n, err := s.redisP.Exists(ctx, revokedKey(sessionID)).Result()
+	return err == nil && n > 0
+}
+
+// Revoke ends the session sessionKey belongs to before its token expires.
+func (s *service) Revoke(ctx context.Context, sessionKey string) error {
+	session, err := s.GetSessionByKey(sessionKey)
+	if err != nil {
+		return err
+	}
+	return s.revoke(ctx, session)
+}
+
+// ListSessions returns the active sessions of the user sessionKey belongs
+// to, flagging the one making the request.
+func (s *service) ListSessions(ctx context.Context, sessionKey string) ([]*SessionInfo, error) {
+	current, err := s.GetSessionByKey(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	sessions, err := s.repo.GetActiveSessions(current.UserID, now, now.Add(-s.ttl))
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]*SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		if s.isRevoked(ctx, session.ID) {
+			continue
+		}
+		infos = append(infos, &SessionInfo{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			StartedAt:  session.StartedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  s.expiresAt(session),
+			Current:    session.ID == current.ID,
+		})
+	}
+	return infos, nil
+}
+
+// RevokeByID ends another session of the same user, e.g. a lost device.
+func (s *service) RevokeByID(ctx context.Context, sessionKey string, sessionID uint64) error {
+	current, err := s.GetSessionByKey(sessionKey)
+	if err != nil {
+		return err
+	}
+
+	session, err := s.repo.GetSessionByID(sessionID)
+	if err != nil || session.UserID != current.UserID || session.EndedAt != nil {
+		return utils.NotFound("session")
+	}
+	return s.revoke(ctx, session)
+}
+
+// revoke puts the session on the Redis revocation list until its token
+// would have expired anyway, closes it, and tells every instance to drop
+// its websocket connections.
+func (s *service) revoke(ctx context.Context, session *Session) error {
+	ttl := time.Until(s.expiresAt(session))
+	if ttl > 0 {
+		if err := s.redisP.SetEX(ctx, revokedKey(session.ID), 1, ttl).Err(); err != nil {
+			return fmt.Errorf("failed to revoke session: %w", err)
+		}
+	}
+
+	if err := s.UpdateSessionEndedAt(session.ID); err != nil {
+		return err
+	}
+
+	s.eventBus.PublishWithContext(ctx, utils.SessionRevoked{
+		SessionID: session.ID,
+		UserID:    session.UserID,
+		Timestamp: time.Now().UTC().Unix(),
+	})
+	return nil
+}
+
+// Refresh swaps a valid token for a new one that expires a full ttl from
+// now, or when the session's identity rotates, keeping the session and its
+// ID. The old token stops working at once, and keys issued before tokens
+// were signed are upgraded to a token.
+func (s *service) Refresh(ctx context.Context, sessionKey string) (*Token, error) {
+	session, err := s.GetSessionByKey(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(s.ttl)
+	if session.RotatesAt != nil {
+		// Past this point the client has to start a session, and with it
+		// get the next identity.
+		if !now.Before(*session.RotatesAt) {
+			return nil, ErrTokenExpired
+		}
+		if session.RotatesAt.Before(expiresAt) {
+			expiresAt = *session.RotatesAt
+		}
+	}
+	rotated, err := s.repo.RotateToken(session.ID, session.TokenVersion, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh session: %w", err)
+	}
+	if !rotated {
+		// Another refresh with the same token got there first.
+		return nil, ErrRevoked
+	}
+
+	s.redisP.CachedDel(ctx, sessionCacheKey(session.ID))
+	return s.issue(session.ID, session.TokenVersion+1, expiresAt), nil
 }
 
 func (s *service) UpdateSessionEndedAt(sessionID uint64) error {
@@ -87,18 +358,41 @@ func (s *service) UpdateSessionEndedAt(sessionID uint64) error {
 		cacheKey := fmt.Sprintf("user:%d:session:%d", sessionData.UserID, sessionData.ID)
 		s.redisP.Client.Del(context.Background(), cacheKey)
 	}
+	s.redisP.CachedDel(context.Background(), sessionCacheKey(sessionID))
 
 	return s.repo.UpdateSessionEndedAt(sessionID)
 }
 
 func (s *service) GetSessionStartedAtBySessionKey(sessionKey string) (time.Time, error) {
-	session, err := s.repo.GetSessionByKey(sessionKey)
+	session, err := s.GetSessionByKey(sessionKey)
 	if err != nil {
 		return time.Time{}, err
 	}
 	return session.StartedAt, nil
 }
 
+// ExpireSessions closes sessions whose token has expired and drops them
+// from the cache, so their last cached copy does not outlive them.
+func (s *service) ExpireSessions(ctx context.Context) (int64, error) {
+	now := time.Now().UTC()
+	expired, err := s.repo.CloseExpiredSessions(now, now.Add(-s.ttl))
+	if err != nil {
+		return 0, err
+	}
+
+	keys := make([]string, 0, 2*len(expired))
+	for _, session := range expired {
+		keys = append(keys,
+			sessionCacheKey(session.ID),
+			fmt.Sprintf("user:%d:session:%d", session.UserID, session.ID),
+		)
+	}
+	if len(keys) > 0 {
+		s.redisP.CachedDel(ctx, keys...)
+	}
+	return int64(len(expired)), nil
+}
+
 func generateSessionKey() (string, error) {
 	bytes := make([]byte, 32)
 	if _, err := rand.Read(bytes); err != nil {
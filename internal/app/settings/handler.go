@@ -0,0 +1,142 @@
+package settings
+
+import (
+	"errors"
+	"net/http"
+
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	GetSettings(c *gin.Context)
+	UpdateSettings(c *gin.Context)
+	ResetSettings(c *gin.Context)
+	ReloadSettings(c *gin.Context)
+	GetMaintenance(c *gin.Context)
+	SetMaintenance(c *gin.Context)
+}
+
+type handler struct {
+	service Service
+}
+
+func NewHandler(service Service) Handler {
+	return &handler{service: service}
+}
+
+// @Summary Get runtime settings
+// @Description Get the effective runtime settings (cooldowns, file limits, wordfilter, maintenance mode) and the admin overrides applied on top of the config
+// @Tags Settings
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} SettingsResponse
+// @Router /api/admin/settings [get]
+func (h *handler) GetSettings(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.Get())
+}
+
+// @Summary Update runtime settings
+// @Description Override selected runtime settings on every instance without a restart. Omitted fields are left unchanged; overrides survive restarts until reset.
+// @Tags Settings
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body UpdateSettingsRequest true "Settings to override"
+// @Success 200 {object} SettingsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/settings [patch]
+func (h *handler) UpdateSettings(c *gin.Context) {
+	var req UpdateSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := h.service.Update(c.Request.Context(), req)
+	if errors.Is(err, ErrInvalidSettings) {
+		utils.RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to update settings")
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Reset runtime settings
+// @Description Drop all admin overrides and go back to the configured values
+// @Tags Settings
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} SettingsResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/settings [delete]
+func (h *handler) ResetSettings(c *gin.Context) {
+	resp, err := h.service.ResetOverrides(c.Request.Context())
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to reset settings")
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Reload runtime settings
+// @Description Re-read the config file on this instance, like SIGHUP. Environment variables are fixed for the life of the process.
+// @Tags Settings
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} SettingsResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/admin/settings/reload [post]
+func (h *handler) ReloadSettings(c *gin.Context) {
+	resp, err := h.service.Reload(c.Request.Context())
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Get maintenance mode
+// @Description Tell whether the site is read-only; while it is, writes get 503 with the returned message
+// @Tags Settings
+// @Produce json
+// @Success 200 {object} MaintenanceResponse
+// @Router /api/maintenance [get]
+func (h *handler) GetMaintenance(c *gin.Context) {
+	c.JSON(http.StatusOK, maintenanceOf(h.service.Current()))
+}
+
+// @Summary Switch maintenance mode
+// @Description Put every instance into read-only mode or take it out. Connected clients get a maintenance_mode event.
+// @Tags Settings
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body MaintenanceRequest true "Maintenance mode"
+// @Success 200 {object} MaintenanceResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/maintenance [put]
+func (h *handler) SetMaintenance(c *gin.Context) {
+	var req MaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	resp, err := h.service.SetMaintenance(c.Request.Context(), *req.Enabled, req.Message)
+	if errors.Is(err, ErrInvalidSettings) {
+		utils.RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to switch maintenance mode")
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,250 @@
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"backend/internal/config"
+	"backend/internal/utils"
+)
+
+// Duration is a time.Duration that reads and writes JSON as "5m", "10s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\" or \"5m\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Settings are the values that can change while the server is running.
+type Settings struct {
+	ThreadCooldown     Duration                `json:"thread_cooldown"`
+	MessageCooldown    Duration                `json:"message_cooldown"`
+	NicknameCooldown   Duration                `json:"nickname_cooldown"`
+	ThreadEditWindow   Duration                `json:"thread_edit_window"`
+	DuplicateWindow    Duration                `json:"duplicate_window"`
+	ProxyPolicy        string                  `json:"proxy_policy"`
+	MaxFileSize        int64                   `json:"max_file_size"`
+	MaxFilesPerPost    int                     `json:"max_files_per_post"`
+	BumpLimit          int                     `json:"bump_limit"`
+	PreviewReplies     int                     `json:"preview_replies"`
+	WordFilter         []config.WordFilterRule `json:"wordfilter"`
+	GeoPolicies        map[string]string       `json:"geo_policies"`
+	MaintenanceMode    bool                    `json:"maintenance_mode"`
+	MaintenanceMessage string                  `json:"maintenance_message"`
+	AnonNames          bool                    `json:"anon_names"`
+}
+
+// UpdateSettingsRequest holds admin overrides; omitted fields keep their
+// current value.
+type UpdateSettingsRequest struct {
+	ThreadCooldown     *Duration                `json:"thread_cooldown,omitempty"`
+	MessageCooldown    *Duration                `json:"message_cooldown,omitempty"`
+	NicknameCooldown   *Duration                `json:"nickname_cooldown,omitempty"`
+	ThreadEditWindow   *Duration                `json:"thread_edit_window,omitempty"`
+	DuplicateWindow    *Duration                `json:"duplicate_window,omitempty"`
+	ProxyPolicy        *string                  `json:"proxy_policy,omitempty"`
+	MaxFileSize        *int64                   `json:"max_file_size,omitempty"`
+	MaxFilesPerPost    *int                     `json:"max_files_per_post,omitempty"`
+	BumpLimit          *int                     `json:"bump_limit,omitempty"`
+	PreviewReplies     *int                     `json:"preview_replies,omitempty"`
+	WordFilter         *[]config.WordFilterRule `json:"wordfilter,omitempty"`
+	GeoPolicies        *map[string]string       `json:"geo_policies,omitempty"`
+	MaintenanceMode    *bool                    `json:"maintenance_mode,omitempty"`
+	MaintenanceMessage *string                  `json:"maintenance_message,omitempty"`
+	AnonNames          *bool                    `json:"anon_names,omitempty"`
+}
+
+type SettingsResponse struct {
+	Settings   Settings              `json:"settings"`
+	Overrides  UpdateSettingsRequest `json:"overrides"`
+	ReloadedAt time.Time             `json:"reloaded_at"`
+}
+
+// MaintenanceRequest switches read-only mode; message is optional and
+// keeps the current text when omitted.
+type MaintenanceRequest struct {
+	Enabled *bool   `json:"enabled" binding:"required"`
+	Message *string `json:"message,omitempty"`
+}
+
+type MaintenanceResponse struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+}
+
+type ErrorResponse = utils.ErrorResponse
+
+// maintenanceOf reports the message only while maintenance mode is on.
+func maintenanceOf(s Settings) *MaintenanceResponse {
+	resp := &MaintenanceResponse{Enabled: s.MaintenanceMode}
+	if s.MaintenanceMode {
+		resp.Message = s.MaintenanceMessage
+	}
+	return resp
+}
+
+func fromConfig(cfg *config.Config) Settings {
+	return Settings{
+		ThreadCooldown:     Duration(cfg.ThreadCooldown),
+		MessageCooldown:    Duration(cfg.MessageCooldown),
+		NicknameCooldown:   Duration(cfg.NicknameCooldown),
+		ThreadEditWindow:   Duration(cfg.ThreadEditWindow),
+		DuplicateWindow:    Duration(cfg.DuplicateWindow),
+		ProxyPolicy:        cfg.ProxyPolicy,
+		MaxFileSize:        cfg.MaxFileSize,
+		MaxFilesPerPost:    cfg.MaxFilesPerPost,
+		BumpLimit:          cfg.BumpLimit,
+		PreviewReplies:     cfg.PreviewReplies,
+		WordFilter:         cfg.WordFilter,
+		GeoPolicies:        cfg.GeoPolicies,
+		MaintenanceMode:    cfg.MaintenanceMode,
+		MaintenanceMessage: cfg.MaintenanceMessage,
+		AnonNames:          cfg.AnonNames,
+	}
+}
+
+// apply returns base with the overrides in req laid on top.
+func (req UpdateSettingsRequest) apply(base Settings) Settings {
+	if req.ThreadCooldown != nil {
+		base.ThreadCooldown = *req.ThreadCooldown
+	}
+	if req.MessageCooldown != nil {
+		base.MessageCooldown = *req.MessageCooldown
+	}
+	if req.NicknameCooldown != nil {
+		base.NicknameCooldown = *req.NicknameCooldown
+	}
+	if req.ThreadEditWindow != nil {
+		base.ThreadEditWindow = *req.ThreadEditWindow
+	}
+	if req.DuplicateWindow != nil {
+		base.DuplicateWindow = *req.DuplicateWindow
+	}
+	if req.ProxyPolicy != nil {
+		base.ProxyPolicy = *req.ProxyPolicy
+	}
+	if req.MaxFileSize != nil {
+		base.MaxFileSize = *req.MaxFileSize
+	}
+	if req.MaxFilesPerPost != nil {
+		base.MaxFilesPerPost = *req.MaxFilesPerPost
+	}
+	if req.BumpLimit != nil {
+		base.BumpLimit = *req.BumpLimit
+	}
+	if req.PreviewReplies != nil {
+		base.PreviewReplies = *req.PreviewReplies
+	}
+	if req.WordFilter != nil {
+		base.WordFilter = *req.WordFilter
+	}
+	if req.GeoPolicies != nil {
+		base.GeoPolicies = *req.GeoPolicies
+	}
+	if req.MaintenanceMode != nil {
+		base.MaintenanceMode = *req.MaintenanceMode
+	}
+	if req.MaintenanceMessage != nil {
+		base.MaintenanceMessage = *req.MaintenanceMessage
+	}
+	if req.AnonNames != nil {
+		base.AnonNames = *req.AnonNames
+	}
+	return base
+}
+
+// merge lays next on top of req, so successive PATCHes accumulate.
+func (req UpdateSettingsRequest) merge(next UpdateSettingsRequest) UpdateSettingsRequest {
+	if next.ThreadCooldown != nil {
+		req.ThreadCooldown = next.ThreadCooldown
+	}
+	if next.MessageCooldown != nil {
+		req.MessageCooldown = next.MessageCooldown
+	}
+	if next.NicknameCooldown != nil {
+		req.NicknameCooldown = next.NicknameCooldown
+	}
+	if next.ThreadEditWindow != nil {
+		req.ThreadEditWindow = next.ThreadEditWindow
+	}
+	if next.DuplicateWindow != nil {
+		req.DuplicateWindow = next.DuplicateWindow
+	}
+	if next.ProxyPolicy != nil {
+		req.ProxyPolicy = next.ProxyPolicy
+	}
+	if next.MaxFileSize != nil {
+		req.MaxFileSize = next.MaxFileSize
+	}
+	if next.MaxFilesPerPost != nil {
+		req.MaxFilesPerPost = next.MaxFilesPerPost
+	}
+	if next.BumpLimit != nil {
+		req.BumpLimit = next.BumpLimit
+	}
+	if next.PreviewReplies != nil {
+		req.PreviewReplies = next.PreviewReplies
+	}
+	if next.WordFilter != nil {
+		req.WordFilter = next.WordFilter
+	}
+	if next.GeoPolicies != nil {
+		req.GeoPolicies = next.GeoPolicies
+	}
+	if next.MaintenanceMode != nil {
+		req.MaintenanceMode = next.MaintenanceMode
+	}
+	if next.MaintenanceMessage != nil {
+		req.MaintenanceMessage = next.MaintenanceMessage
+	}
+	if next.AnonNames != nil {
+		req.AnonNames = next.AnonNames
+	}
+	return req
+}
+
+func (s Settings) validate() error {
+	switch {
+	case s.ThreadCooldown < 0, s.MessageCooldown < 0, s.NicknameCooldown < 0:
+		return fmt.Errorf("cooldowns must not be negative")
+	case s.ThreadEditWindow < 0:
+		return fmt.Errorf("thread_edit_window must not be negative")
+	case s.DuplicateWindow < 0:
+		return fmt.Errorf("duplicate_window must not be negative")
+	case s.ProxyPolicy != "allow" && s.ProxyPolicy != "captcha" && s.ProxyPolicy != "block":
+		return fmt.Errorf("proxy_policy must be allow, captcha or block")
+	case s.MaxFileSize <= 0:
+		return fmt.Errorf("max_file_size must be greater than zero")
+	case s.MaxFilesPerPost <= 0:
+		return fmt.Errorf("max_files_per_post must be greater than zero")
+	case s.BumpLimit < 0:
+		return fmt.Errorf("bump_limit must not be negative")
+	case s.PreviewReplies < 0 || s.PreviewReplies > 10:
+		return fmt.Errorf("preview_replies must be between 0 and 10")
+	}
+	for _, rule := range s.WordFilter {
+		if rule.Pattern == "" {
+			return fmt.Errorf("wordfilter patterns must not be empty")
+		}
+	}
+	for country, policy := range s.GeoPolicies {
+		if err := config.CheckGeoPolicy(country, policy); err != nil {
+			return fmt.Errorf("geo_policies: %w", err)
+		}
+	}
+	return nil
+}
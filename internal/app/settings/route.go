@@ -0,0 +1,18 @@
+package settings
+
+import "github.com/gin-gonic/gin"
+
+func RegisterRoutes(rg *gin.RouterGroup, handler Handler) {
+	rg.GET("/maintenance", handler.GetMaintenance)
+}
+
+func RegisterAdminRoutes(rg *gin.RouterGroup, handler Handler) {
+	settings := rg.Group("/settings")
+	{
+		settings.GET("", handler.GetSettings)
+		settings.PATCH("", handler.UpdateSettings)
+		settings.DELETE("", handler.ResetSettings)
+		settings.POST("/reload", handler.ReloadSettings)
+	}
+	rg.PUT("/maintenance", handler.SetMaintenance)
+}
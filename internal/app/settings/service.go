@@ -0,0 +1,296 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/internal/config"
+	"backend/internal/providers/redis"
+	"backend/internal/utils"
+
+	goredis "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// overridesKey holds the admin overrides shared by every instance.
+const overridesKey = "settings:overrides"
+
+var ErrInvalidSettings = errors.New("invalid settings")
+
+type Service interface {
+	// Current returns the effective settings; it is cheap enough to call on
+	// every request.
+	Current() Settings
+	Get() *SettingsResponse
+	Update(ctx context.Context, req UpdateSettingsRequest) (*SettingsResponse, error)
+	// SetMaintenance switches read-only mode on every instance; message
+	// replaces the 503 text when set.
+	SetMaintenance(ctx context.Context, enabled bool, message *string) (*MaintenanceResponse, error)
+	ResetOverrides(ctx context.Context) (*SettingsResponse, error)
+	// Reload re-reads the config file and the shared overrides.
+	Reload(ctx context.Context) (*SettingsResponse, error)
+	FilterContent(text string) string
+	// OnChange registers fn to be called with the new settings after every
+	// change, e.g. to push limits into providers that keep their own copy.
+	OnChange(fn func(Settings))
+	Run(ctx context.Context)
+}
+
+type compiledRule struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+type service struct {
+	load     func() (config.Config, error)
+	redisP   *redis.RedisProvider
+	eventBus *utils.EventBus
+	logger   *zap.SugaredLogger
+
+	mu         sync.RWMutex
+	base       Settings
+	overrides  UpdateSettingsRequest
+	current    Settings
+	filter     []compiledRule
+	reloadedAt time.Time
+	listeners  []func(Settings)
+}
+
+// NewService starts from cfg; load is called again on Reload to pick up a
+// changed config file.
+func NewService(cfg *config.Config, load func() (config.Config, error), redisP *redis.RedisProvider, eventBus *utils.EventBus, logger *zap.Logger) Service {
+	s := &service{
+		load:     load,
+		redisP:   redisP,
+		eventBus: eventBus,
+		logger:   logger.Sugar(),
+		base:     fromConfig(cfg),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	overrides, err := s.readOverrides(ctx)
+	if err != nil {
+		s.logger.Warnw("Failed to read settings overrides, using config values", "error", err)
+	}
+	if err := s.apply(s.base, overrides); err != nil {
+		s.logger.Warnw("Ignoring invalid settings overrides", "error", err)
+		s.apply(s.base, UpdateSettingsRequest{})
+	}
+	return s
+}
+
+func (s *service) Current() Settings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+func (s *service) Get() *SettingsResponse {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &SettingsResponse{Settings: s.current, Overrides: s.overrides, ReloadedAt: s.reloadedAt}
+}
+
+func (s *service) Update(ctx context.Context, req UpdateSettingsRequest) (*SettingsResponse, error) {
+	s.mu.RLock()
+	base, overrides := s.base, s.overrides.merge(req)
+	s.mu.RUnlock()
+
+	if err := overrides.apply(base).validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSettings, err)
+	}
+	if err := s.writeOverrides(ctx, overrides); err != nil {
+		return nil, err
+	}
+	before := s.Current()
+	if err := s.apply(base, overrides); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSettings, err)
+	}
+	s.broadcast(ctx)
+	s.announceMaintenance(ctx, before)
+	return s.Get(), nil
+}
+
+func (s *service) SetMaintenance(ctx context.Context, enabled bool, message *string) (*MaintenanceResponse, error) {
+	resp, err := s.Update(ctx, UpdateSettingsRequest{MaintenanceMode: &enabled, MaintenanceMessage: message})
+	if err != nil {
+		return nil, err
+	}
+	return maintenanceOf(resp.Settings), nil
+}
+
+func (s *service) ResetOverrides(ctx context.Context) (*SettingsResponse, error) {
+	if err := s.redisP.Del(ctx, overridesKey).Err(); err != nil {
+		return nil, fmt.Errorf("failed to clear overrides: %w", err)
+	}
+
+	s.mu.RLock()
+	base, before := s.base, s.current
+	s.mu.RUnlock()
+	if err := s.apply(base, UpdateSettingsRequest{}); err != nil {
+		return nil, err
+	}
+	s.broadcast(ctx)
+	s.announceMaintenance(ctx, before)
+	return s.Get(), nil
+}
+
+func (s *service) Reload(ctx context.Context) (*SettingsResponse, error) {
+	cfg, err := s.load()
+	if err != nil {
+		return nil, fmt.Errorf("config reload failed, keeping current settings: %w", err)
+	}
+	overrides, err := s.readOverrides(ctx)
+	if err != nil {
+		return nil, err
+	}
+	before := s.Current()
+	if err := s.apply(fromConfig(&cfg), overrides); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSettings, err)
+	}
+	s.announceMaintenance(ctx, before)
+	s.logger.Infow("Runtime settings reloaded")
+	return s.Get(), nil
+}
+
+func (s *service) FilterContent(text string) string {
+	s.mu.RLock()
+	rules := s.filter
+	s.mu.RUnlock()
+
+	for _, rule := range rules {
+		text = rule.re.ReplaceAllString(text, rule.replacement)
+	}
+	return text
+}
+
+func (s *service) OnChange(fn func(Settings)) {
+	s.mu.Lock()
+	s.listeners = append(s.listeners, fn)
+	current := s.current
+	s.mu.Unlock()
+	fn(current)
+}
+
+// Run applies changes made on other instances, which announce them with a
+// settings_updated event. An EventResync after missed events is handled the
+// same way, since the overrides are reread in full either way.
+func (s *service) Run(ctx context.Context) {
+	sub := s.eventBus.Subscribe("settings", utils.EventSettingsUpdated)
+	defer s.eventBus.Unsubscribe(sub)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			overrides, err := s.readOverrides(ctx)
+			if err != nil {
+				s.logger.Warnw("Failed to refresh settings overrides", "error", err)
+				continue
+			}
+			s.mu.RLock()
+			base := s.base
+			s.mu.RUnlock()
+			if err := s.apply(base, overrides); err != nil {
+				s.logger.Warnw("Ignoring invalid settings overrides", "error", err)
+			}
+		}
+	}
+}
+
+// apply makes base+overrides the effective settings and notifies listeners.
+func (s *service) apply(base Settings, overrides UpdateSettingsRequest) error {
+	current := overrides.apply(base)
+	if err := current.validate(); err != nil {
+		return err
+	}
+	filter := compileWordFilter(current.WordFilter)
+
+	s.mu.Lock()
+	s.base, s.overrides, s.current, s.filter = base, overrides, current, filter
+	s.reloadedAt = time.Now().UTC()
+	listeners := append([]func(Settings){}, s.listeners...)
+	s.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(current)
+	}
+	return nil
+}
+
+func (s *service) broadcast(ctx context.Context) {
+	s.eventBus.PublishWithContext(ctx, utils.SettingsUpdated{Timestamp: time.Now().Unix()})
+}
+
+// announceMaintenance tells connected clients when a local change switched
+// maintenance mode or its message. Changes picked up from other instances in
+// Run are announced by the instance that made them.
+func (s *service) announceMaintenance(ctx context.Context, before Settings) {
+	after := s.Current()
+	if after.MaintenanceMode == before.MaintenanceMode &&
+		(!after.MaintenanceMode || after.MaintenanceMessage == before.MaintenanceMessage) {
+		return
+	}
+	if after.MaintenanceMode {
+		s.logger.Infow("Maintenance mode enabled")
+	} else {
+		s.logger.Infow("Maintenance mode disabled")
+	}
+	m := maintenanceOf(after)
+	s.eventBus.PublishWithContext(ctx, utils.MaintenanceMode{
+		Enabled:   m.Enabled,
+		Message:   m.Message,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+func (s *service) readOverrides(ctx context.Context) (UpdateSettingsRequest, error) {
+	var overrides UpdateSettingsRequest
+	data, err := s.redisP.Get(ctx, overridesKey).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return overrides, nil
+	}
+	if err != nil {
+		return overrides, fmt.Errorf("failed to read overrides: %w", err)
+	}
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return overrides, fmt.Errorf("failed to decode overrides: %w", err)
+	}
+	return overrides, nil
+}
+
+func (s *service) writeOverrides(ctx context.Context, overrides UpdateSettingsRequest) error {
+	data, err := json.Marshal(overrides)
+	if err != nil {
+		return err
+	}
+	if err := s.redisP.Client.Set(ctx, overridesKey, data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to save overrides: %w", err)
+	}
+	return nil
+}
+
+// compileWordFilter matches whole words case-insensitively. \b only knows
+// ASCII, so word boundaries are spelled out to work for Cyrillic too.
+func compileWordFilter(rules []config.WordFilterRule) []compiledRule {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		re := regexp.MustCompile(`(?i)(^|[^\p{L}\p{N}_])` + regexp.QuoteMeta(rule.Pattern) + `($|[^\p{L}\p{N}_])`)
+		compiled = append(compiled, compiledRule{
+			re:          re,
+			replacement: "${1}" + strings.ReplaceAll(rule.Replacement, "$", "$$") + "${2}",
+		})
+	}
+	return compiled
+}
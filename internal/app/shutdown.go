@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"backend/internal/db/resolver"
+)
+
+// Shutdown stops the application in dependency order: scheduled jobs first
+// so none starts against a closing pool, then the websocket hub, which still
+// needs Redis and Postgres to record session ends, then the background loops,
+// and finally the Redis and Postgres pools themselves. It keeps going after a
+// failed step and returns every error; the HTTP server should be shut down
+// before calling it.
+func (a *Application) Shutdown(ctx context.Context) error {
+	var errs []error
+
+	if err := a.Scheduler.Stop(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := a.Hub.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("websocket hub shutdown: %w", err))
+	}
+
+	a.stop()
+
+	if err := a.redis.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("redis close: %w", err))
+	}
+
+	sqlDB, err := a.DB.DB()
+	if err == nil {
+		err = sqlDB.Close()
+	}
+	if err != nil {
+		errs = append(errs, fmt.Errorf("database close: %w", err))
+	}
+	if replicas := resolver.Of(a.DB); replicas != nil {
+		if err := replicas.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("database replicas close: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
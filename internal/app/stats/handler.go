@@ -0,0 +1,145 @@
+package stats
+
+import (
+	"net/http"
+	"strconv"
+
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	GetSiteStats(c *gin.Context)
+	GetStorageStats(c *gin.Context)
+	GetOnline(c *gin.Context)
+	GetActivity(c *gin.Context)
+	GetEventMetrics(c *gin.Context)
+}
+
+type handler struct {
+	service Service
+}
+
+func NewHandler(service Service) Handler {
+	return &handler{service: service}
+}
+
+// @Summary Get site statistics
+// @Description Get site-wide totals, storage use, unique posters today and posts in the last hour. The numbers are refreshed by a background job and also pushed as stats_updated events.
+// @Tags Stats
+// @Produce json
+// @Success 200 {object} SiteStats
+// @Failure 500 {object} ErrorResponse
+// @Router /api/stats [get]
+func (h *handler) GetSiteStats(c *gin.Context) {
+	stats, err := h.service.GetSiteStats(c.Request.Context())
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get stats")
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// @Summary Get storage usage
+// @Description Get attachment count and bytes per board and content type, plus tmp space usage. Pass refresh=true to recompute instead of using the cached report.
+// @Tags Stats
+// @Produce json
+// @Security ApiKeyAuth
+// @Param refresh query bool false "Recompute instead of using the cache"
+// @Success 200 {object} StorageStats
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/stats/storage [get]
+func (h *handler) GetStorageStats(c *gin.Context) {
+	var (
+		stats *StorageStats
+		err   error
+	)
+	if c.Query("refresh") == "true" {
+		stats, err = h.service.AggregateStorage(c.Request.Context())
+	} else {
+		stats, err = h.service.GetStorageStats(c.Request.Context())
+	}
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get storage stats")
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// @Summary Get online counts
+// @Description Get the number of connected sessions site-wide and optionally on a board and in a thread
+// @Tags Stats
+// @Produce json
+// @Param board_id query int false "Board ID"
+// @Param thread_id query int false "Thread ID"
+// @Success 200 {object} OnlineStats
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/stats/online [get]
+func (h *handler) GetOnline(c *gin.Context) {
+	var boardID, threadID uint64
+	if v := c.Query("board_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			utils.RespondError(c, http.StatusBadRequest, "invalid board ID")
+			return
+		}
+		boardID = id
+	}
+	if v := c.Query("thread_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			utils.RespondError(c, http.StatusBadRequest, "invalid thread ID")
+			return
+		}
+		threadID = id
+	}
+
+	online, err := h.service.GetOnline(c.Request.Context(), boardID, threadID)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get online counts")
+		return
+	}
+	c.JSON(http.StatusOK, online)
+}
+
+// @Summary Get posting activity
+// @Description Get threads and messages posted per hour over the last 24 hours or 7 days, site-wide or on one board. The series is refreshed by a background job, so the current hour may lag behind.
+// @Tags Stats
+// @Produce json
+// @Param range query string false "Time range: 24h or 7d" default(24h)
+// @Param board_id query int false "Board ID"
+// @Success 200 {object} ActivityStats
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/stats/activity [get]
+func (h *handler) GetActivity(c *gin.Context) {
+	var boardID *uint64
+	if v := c.Query("board_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			utils.RespondError(c, http.StatusBadRequest, "invalid board ID")
+			return
+		}
+		boardID = &id
+	}
+
+	activity, err := h.service.GetActivity(c.Request.Context(), c.DefaultQuery("range", "24h"), boardID)
+	if err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, activity)
+}
+
+// @Summary Get event bus metrics
+// @Description Get published event counts and per-subscriber delivered, pending, dropped and resync counts for this instance
+// @Tags Stats
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} utils.BusMetrics
+// @Router /api/admin/stats/events [get]
+func (h *handler) GetEventMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.EventMetrics())
+}
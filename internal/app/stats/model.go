@@ -0,0 +1,91 @@
+package stats
+
+import (
+	"time"
+
+	"backend/internal/utils"
+)
+
+// SiteStats are the public site counters. UniquePostersToday counts users
+// who posted since midnight UTC; PostsPerHour counts threads and messages
+// created in the last hour.
+type SiteStats struct {
+	Boards             int64     `json:"boards"`
+	Threads            int64     `json:"threads"`
+	Messages           int64     `json:"messages"`
+	Attachments        int64     `json:"attachments"`
+	StorageBytes       int64     `json:"storage_bytes"`
+	UniquePostersToday int64     `json:"unique_posters_today"`
+	PostsPerHour       int64     `json:"posts_per_hour"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+type StorageStats struct {
+	TotalAttachments int64              `json:"total_attachments"`
+	TotalBytes       int64              `json:"total_bytes"`
+	Boards           []BoardUsage       `json:"boards"`
+	ContentTypes     []ContentTypeUsage `json:"content_types"`
+	Unlinked         Usage              `json:"unlinked"`
+	TmpSpace         Usage              `json:"tmp_space"`
+	UpdatedAt        time.Time          `json:"updated_at"`
+}
+
+type Usage struct {
+	Count int64 `json:"count"`
+	Bytes int64 `json:"bytes"`
+}
+
+type BoardUsage struct {
+	BoardID     uint64 `json:"board_id"`
+	BoardSlug   string `json:"board_slug"`
+	Attachments int64  `json:"attachments"`
+	Bytes       int64  `json:"bytes"`
+}
+
+type ContentTypeUsage struct {
+	ContentType string `json:"content_type"`
+	Attachments int64  `json:"attachments"`
+	Bytes       int64  `json:"bytes"`
+}
+
+type OnlineStats struct {
+	Total  int64  `json:"total"`
+	Board  *int64 `json:"board,omitempty"`
+	Thread *int64 `json:"thread,omitempty"`
+}
+
+// HourlyPosts is the number of threads and messages started on a board in
+// the hour beginning at Hour (UTC).
+type HourlyPosts struct {
+	BoardID  uint64    `gorm:"primaryKey"`
+	Hour     time.Time `gorm:"primaryKey;index"`
+	Threads  int64     `gorm:"not null;default:0"`
+	Messages int64     `gorm:"not null;default:0"`
+}
+
+func (HourlyPosts) TableName() string {
+	return "board_hourly_posts"
+}
+
+// ActivityRanges maps the accepted range values to their length.
+var ActivityRanges = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+}
+
+type ActivityPoint struct {
+	Hour     time.Time `json:"hour"`
+	Threads  int64     `json:"threads"`
+	Messages int64     `json:"messages"`
+	Posts    int64     `json:"posts"`
+}
+
+// ActivityStats is an hourly posting series, oldest hour first, with every
+// hour of the range present.
+type ActivityStats struct {
+	Range   string          `json:"range"`
+	BoardID *uint64         `json:"board_id,omitempty"`
+	Points  []ActivityPoint `json:"points"`
+}
+
+type ErrorResponse = utils.ErrorResponse
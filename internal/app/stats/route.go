@@ -0,0 +1,20 @@
+package stats
+
+import "github.com/gin-gonic/gin"
+
+func RegisterRoutes(rg *gin.RouterGroup, handler Handler) {
+	stats := rg.Group("/stats")
+	{
+		stats.GET("", handler.GetSiteStats)
+		stats.GET("/online", handler.GetOnline)
+		stats.GET("/activity", handler.GetActivity)
+	}
+}
+
+func RegisterAdminRoutes(rg *gin.RouterGroup, handler Handler) {
+	stats := rg.Group("/stats")
+	{
+		stats.GET("/storage", handler.GetStorageStats)
+		stats.GET("/events", handler.GetEventMetrics)
+	}
+}
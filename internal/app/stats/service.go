@@ -0,0 +1,282 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"backend/internal/providers/minio"
+	"backend/internal/providers/redis"
+	"backend/internal/utils"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	siteStatsCacheKey    = "stats:site"
+	siteStatsCacheTTL    = time.Hour
+	storageStatsCacheKey = "stats:storage"
+	storageStatsCacheTTL = 6 * time.Hour
+	// hourlyPostsKeep is how long hourly rows are kept; the longest range
+	// reads 7 days back.
+	hourlyPostsKeep = 8 * 24 * time.Hour
+)
+
+type Service interface {
+	Aggregate(ctx context.Context) (*SiteStats, error)
+	GetSiteStats(ctx context.Context) (*SiteStats, error)
+	AggregateStorage(ctx context.Context) (*StorageStats, error)
+	GetStorageStats(ctx context.Context) (*StorageStats, error)
+	GetOnline(ctx context.Context, boardID, threadID uint64) (*OnlineStats, error)
+	// AggregateHourly recounts the current and previous hour per board and
+	// prunes rows past the longest range. It is meant to run from the
+	// scheduler.
+	AggregateHourly(ctx context.Context) error
+	GetActivity(ctx context.Context, rangeName string, boardID *uint64) (*ActivityStats, error)
+	EventMetrics() utils.BusMetrics
+}
+
+type service struct {
+	db       *gorm.DB
+	redisP   *redis.RedisProvider
+	minioP   *minio.MinioProvider
+	eventBus *utils.EventBus
+	presence *redis.Presence
+	logger   *zap.SugaredLogger
+}
+
+func NewService(db *gorm.DB, redisP *redis.RedisProvider, minioP *minio.MinioProvider, eventBus *utils.EventBus, presence *redis.Presence, logger *zap.Logger) Service {
+	return &service{
+		db:       db,
+		redisP:   redisP,
+		minioP:   minioP,
+		eventBus: eventBus,
+		presence: presence,
+		logger:   logger.Sugar(),
+	}
+}
+
+// Aggregate recomputes site-wide counters, caches them and broadcasts a
+// stats_updated event. It is meant to run from the scheduler.
+func (s *service) Aggregate(ctx context.Context) (*SiteStats, error) {
+	now := time.Now().UTC()
+	stats := &SiteStats{UpdatedAt: now}
+	today := now.Truncate(24 * time.Hour)
+	hourAgo := now.Add(-time.Hour)
+
+	err := s.db.WithContext(ctx).Raw(`
+		SELECT
+			(SELECT COUNT(*) FROM boards) AS boards,
+			(SELECT COUNT(*) FROM threads WHERE deleted_at IS NULL) AS threads,
+			(SELECT COUNT(*) FROM messages WHERE deleted_at IS NULL) AS messages,
+			(SELECT COUNT(*) FROM attachments) AS attachments,
+			(SELECT COALESCE(SUM(file_size), 0) FROM attachments) AS storage_bytes,
+			(SELECT COUNT(*) FROM user_activity
+				WHERE last_thread_at >= @today OR last_message_at >= @today) AS unique_posters_today,
+			(SELECT COUNT(*) FROM threads WHERE created_at >= @hour_ago)
+				+ (SELECT COUNT(*) FROM messages WHERE created_at >= @hour_ago) AS posts_per_hour
+	`, map[string]interface{}{"today": today, "hour_ago": hourAgo}).Scan(stats).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate stats: %w", err)
+	}
+
+	if data, err := json.Marshal(stats); err == nil {
+		s.redisP.SetEX(ctx, siteStatsCacheKey, data, siteStatsCacheTTL)
+	}
+
+	s.eventBus.Publish(utils.StatsUpdated(*stats))
+	return stats, nil
+}
+
+func (s *service) GetSiteStats(ctx context.Context) (*SiteStats, error) {
+	cached, err := s.redisP.Get(ctx, siteStatsCacheKey).Result()
+	if err == nil && cached != "" {
+		var stats SiteStats
+		if json.Unmarshal([]byte(cached), &stats) == nil {
+			return &stats, nil
+		}
+	}
+	return s.Aggregate(ctx)
+}
+
+// AggregateStorage recomputes attachment usage from the database and walks the
+// tmp/ prefix in MinIO. The result is cached because the bucket walk is slow.
+func (s *service) AggregateStorage(ctx context.Context) (*StorageStats, error) {
+	stats := &StorageStats{
+		Boards:       []BoardUsage{},
+		ContentTypes: []ContentTypeUsage{},
+		UpdatedAt:    time.Now().UTC(),
+	}
+	db := s.db.WithContext(ctx)
+
+	var total Usage
+	if err := db.Raw(`SELECT COUNT(*) AS count, COALESCE(SUM(file_size), 0) AS bytes FROM attachments`).Scan(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to aggregate attachment totals: %w", err)
+	}
+	stats.TotalAttachments = total.Count
+	stats.TotalBytes = total.Bytes
+
+	if err := db.Raw(`
+		SELECT boards.id AS board_id, boards.slug AS board_slug,
+			COUNT(attachments.id) AS attachments,
+			COALESCE(SUM(attachments.file_size), 0) AS bytes
+		FROM attachments
+		LEFT JOIN messages ON messages.id = attachments.message_id
+		JOIN threads ON threads.id = COALESCE(attachments.thread_id, messages.thread_id)
+		JOIN boards ON boards.id = threads.board_id
+		GROUP BY boards.id, boards.slug
+		ORDER BY bytes DESC
+	`).Scan(&stats.Boards).Error; err != nil {
+		return nil, fmt.Errorf("failed to aggregate board usage: %w", err)
+	}
+
+	if err := db.Raw(`
+		SELECT content_type, COUNT(*) AS attachments, COALESCE(SUM(file_size), 0) AS bytes
+		FROM attachments
+		GROUP BY content_type
+		ORDER BY bytes DESC
+	`).Scan(&stats.ContentTypes).Error; err != nil {
+		return nil, fmt.Errorf("failed to aggregate content type usage: %w", err)
+	}
+
+	if err := db.Raw(`
+		SELECT COUNT(*) AS count, COALESCE(SUM(file_size), 0) AS bytes
+		FROM attachments
+		WHERE thread_id IS NULL AND message_id IS NULL
+	`).Scan(&stats.Unlinked).Error; err != nil {
+		return nil, fmt.Errorf("failed to aggregate unlinked attachments: %w", err)
+	}
+
+	if s.minioP != nil {
+		err := s.minioP.WalkObjects(ctx, "tmp/", func(obj minio.ObjectInfo) error {
+			stats.TmpSpace.Count++
+			stats.TmpSpace.Bytes += obj.Size
+			return nil
+		})
+		if err != nil {
+			s.logger.Warnw("Failed to measure tmp space", "error", err)
+		}
+	}
+
+	if data, err := json.Marshal(stats); err == nil {
+		s.redisP.SetEX(ctx, storageStatsCacheKey, data, storageStatsCacheTTL)
+	}
+	return stats, nil
+}
+
+func (s *service) GetStorageStats(ctx context.Context) (*StorageStats, error) {
+	cached, err := s.redisP.Get(ctx, storageStatsCacheKey).Result()
+	if err == nil && cached != "" {
+		var stats StorageStats
+		if json.Unmarshal([]byte(cached), &stats) == nil {
+			return &stats, nil
+		}
+	}
+	return s.AggregateStorage(ctx)
+}
+
+// GetOnline returns online session counts site-wide and, when the IDs are
+// non-zero, for one board and one thread.
+func (s *service) GetOnline(ctx context.Context, boardID, threadID uint64) (*OnlineStats, error) {
+	rooms := []string{redis.PresenceAll}
+	if boardID != 0 {
+		rooms = append(rooms, fmt.Sprintf("board:%d", boardID))
+	}
+	if threadID != 0 {
+		rooms = append(rooms, fmt.Sprintf("thread:%d", threadID))
+	}
+
+	counts, err := s.presence.Counts(ctx, rooms...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read presence: %w", err)
+	}
+
+	online := &OnlineStats{Total: counts[redis.PresenceAll]}
+	if boardID != 0 {
+		n := counts[rooms[1]]
+		online.Board = &n
+	}
+	if threadID != 0 {
+		n := counts[rooms[len(rooms)-1]]
+		online.Thread = &n
+	}
+	return online, nil
+}
+
+func (s *service) AggregateHourly(ctx context.Context) error {
+	now := time.Now().UTC()
+	since := now.Truncate(time.Hour).Add(-time.Hour)
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Counting both hours again on every run picks up posts that landed
+		// after the previous run closed the hour.
+		if err := tx.Exec(`
+			INSERT INTO board_hourly_posts (board_id, hour, threads, messages)
+			SELECT board_id, hour, SUM(threads), SUM(messages)
+			FROM (
+				SELECT board_id, date_trunc('hour', created_at) AS hour, COUNT(*) AS threads, 0 AS messages
+				FROM threads
+				WHERE created_at >= @since
+				GROUP BY board_id, hour
+				UNION ALL
+				SELECT threads.board_id, date_trunc('hour', messages.created_at) AS hour, 0 AS threads, COUNT(*) AS messages
+				FROM messages
+				JOIN threads ON threads.id = messages.thread_id
+				WHERE messages.created_at >= @since
+				GROUP BY threads.board_id, hour
+			) counts
+			GROUP BY board_id, hour
+			ON CONFLICT (board_id, hour) DO UPDATE
+			SET threads = EXCLUDED.threads, messages = EXCLUDED.messages
+		`, map[string]interface{}{"since": since}).Error; err != nil {
+			return fmt.Errorf("failed to aggregate hourly posts: %w", err)
+		}
+
+		if err := tx.Where("hour < ?", now.Add(-hourlyPostsKeep)).Delete(&HourlyPosts{}).Error; err != nil {
+			return fmt.Errorf("failed to prune hourly posts: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetActivity returns the hourly series for rangeName, site-wide or for one
+// board. Hours without posts are filled in with zeros.
+func (s *service) GetActivity(ctx context.Context, rangeName string, boardID *uint64) (*ActivityStats, error) {
+	length, ok := ActivityRanges[rangeName]
+	if !ok {
+		return nil, utils.Invalid("range", "range must be 24h or 7d")
+	}
+	last := time.Now().UTC().Truncate(time.Hour)
+	first := last.Add(-length + time.Hour)
+
+	query := s.db.WithContext(ctx).Model(&HourlyPosts{}).
+		Select("hour, SUM(threads) AS threads, SUM(messages) AS messages").
+		Where("hour >= ?", first).
+		Group("hour")
+	if boardID != nil {
+		query = query.Where("board_id = ?", *boardID)
+	}
+	var rows []ActivityPoint
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read hourly posts: %w", err)
+	}
+
+	byHour := make(map[time.Time]ActivityPoint, len(rows))
+	for _, row := range rows {
+		byHour[row.Hour.UTC()] = row
+	}
+	activity := &ActivityStats{Range: rangeName, BoardID: boardID}
+	for hour := first; !hour.After(last); hour = hour.Add(time.Hour) {
+		point := byHour[hour]
+		point.Hour = hour
+		point.Posts = point.Threads + point.Messages
+		activity.Points = append(activity.Points, point)
+	}
+	return activity, nil
+}
+
+func (s *service) EventMetrics() utils.BusMetrics {
+	return s.eventBus.Metrics()
+}
@@ -1,35 +1,45 @@
 package thread
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
+	"backend/internal/app/board"
+	"backend/internal/app/filter"
 	"backend/internal/app/session"
 	"backend/internal/app/user"
+	"backend/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Handler interface {
 	CreateThread(c *gin.Context)
+	EditThread(c *gin.Context)
 	GetThreadsByBoardID(c *gin.Context)
 	GetThreadCooldown(c *gin.Context)
 	GetThreadByID(c *gin.Context)
+	GetArchive(c *gin.Context)
 	GetTopThreads(c *gin.Context)
 	CheckThreadAuthor(c *gin.Context)
+	DeleteThread(c *gin.Context)
+	RestoreThread(c *gin.Context)
 }
 
 type handler struct {
 	service    Service
 	sessionSvc session.Service
 	userSvc    user.Service
+	filterSvc  filter.Service
 }
 
-func NewHandler(service Service, sessionSvc session.Service, userSvc user.Service) Handler {
+func NewHandler(service Service, sessionSvc session.Service, userSvc user.Service, filterSvc filter.Service) Handler {
 	return &handler{
 		service:    service,
 		sessionSvc: sessionSvc,
 		userSvc:    userSvc,
+		filterSvc:  filterSvc,
 	}
 }
 
@@ -40,63 +50,113 @@ func NewHandler(service Service, sessionSvc session.Service, userSvc user.Servic
 // @Produce json
 // @Param board_id path int true "Board ID"
 // @Param request body CreateThreadRequest true "Thread creation request"
+// @Param Idempotency-Key header string false "Replays the original response to retries with the same key"
 // @Success 201 {object} ThreadResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Router /api/threads/{board_id} [post]
 func (h *handler) CreateThread(c *gin.Context) {
 	boardIDStr := c.Param("board_id")
 	boardID, err := strconv.ParseUint(boardIDStr, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid board ID"})
+		utils.RespondError(c, http.StatusBadRequest, "invalid board ID")
 		return
 	}
 
 	var req CreateThreadRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		utils.RespondError(c, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	sessionKey := c.Query("session_key")
+	sessionKey := session.Key(c)
 	if sessionKey == "" {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "session_key is required"})
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
 		return
 	}
 
 	thread, err := h.service.CreateThread(c.Request.Context(), boardID, sessionKey, req.Title, req.Content, req.AttachmentIDs)
 	if err != nil {
-		if err.Error() == "thread creation cooldown: ..." {
-			c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: err.Error()})
+		if errors.Is(err, board.ErrReadOnly) {
+			utils.RespondError(c, http.StatusForbidden, err.Error())
 			return
 		}
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		utils.WriteError(c, err)
 		return
 	}
 
+	utils.SetCooldownHeaders(c.Writer.Header(), h.service.Cooldown(boardID))
 	c.JSON(http.StatusCreated, thread)
 }
 
+// @Summary Edit a thread
+// @Description Change the title, text or both of your own thread while the thread_edit_window since posting is open. Open clients get a thread_updated event.
+// @Tags Thread
+// @Accept json
+// @Produce json
+// @Param id path int true "Thread ID"
+// @Param request body UpdateThreadRequest true "Fields to change"
+// @Success 200 {object} Thread
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/threads/thread/{id} [patch]
+func (h *handler) EditThread(c *gin.Context) {
+	threadID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid thread ID")
+		return
+	}
+
+	var req UpdateThreadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	sessionKey := session.Key(c)
+	if sessionKey == "" {
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
+		return
+	}
+
+	thread, err := h.service.EditThread(c.Request.Context(), threadID, sessionKey, req)
+	if err != nil {
+		if errors.Is(err, ErrNotAuthor) || errors.Is(err, ErrEditWindowClosed) || errors.Is(err, board.ErrReadOnly) {
+			utils.RespondError(c, http.StatusForbidden, err.Error())
+			return
+		}
+		utils.WriteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, thread)
+}
+
 // @Summary Get threads by board ID
 // @Description Get paginated list of threads for a board
 // @Tags Thread
 // @Accept json
 // @Produce json
 // @Param board_id path int true "Board ID"
-// @Param sort query string false "Sort order (new, top)" default("new")
+// @Param sort query string false "Sort order (new, popular, active, trending); the board's default_sort, or new, when omitted"
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Items per page" default(10)
+// @Param filter query string false "What to do with threads the user hid or filtered: mark them with filtered=true (mark) or leave them out (hide)" default("mark")
 // @Success 200 {object} ThreadListResponse
 // @Router /api/threads/{board_id} [get]
 func (h *handler) GetThreadsByBoardID(c *gin.Context) {
 	boardIDStr := c.Param("board_id")
 	boardID, err := strconv.ParseUint(boardIDStr, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid board ID"})
+		utils.RespondError(c, http.StatusBadRequest, "invalid board ID")
 		return
 	}
 
-	sort := c.DefaultQuery("sort", "new")
+	sort := c.Query("sort")
 	pageStr := c.DefaultQuery("page", "1")
 	limitStr := c.DefaultQuery("limit", "10")
 
@@ -112,9 +172,10 @@ func (h *handler) GetThreadsByBoardID(c *gin.Context) {
 
 	threads, total, err := h.service.GetThreadsByBoardID(c.Request.Context(), boardID, sort, page, limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to get threads"})
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get threads")
 		return
 	}
+	threads = h.applyFilters(c, threads)
 
 	totalPages := (total + int64(limit) - 1) / int64(limit)
 
@@ -129,31 +190,79 @@ func (h *handler) GetThreadsByBoardID(c *gin.Context) {
 	})
 }
 
+// @Summary Browse a board's archive
+// @Description Get archived threads of a board, last archived first. The archive is read-only and cached for an hour; threads come without reply counts, previews or attachments.
+// @Tags Thread
+// @Produce json
+// @Param slug path string true "Board slug"
+// @Param q query string false "Only threads whose title or text contains this, case-insensitively (up to 100 characters)"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} ThreadListResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/boards/{slug}/archive [get]
+func (h *handler) GetArchive(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	threads, total, err := h.service.GetArchivedThreads(c.Request.Context(), c.Param("slug"), c.Query("q"), page, limit)
+	if err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ThreadListResponse{
+		Threads: threads,
+		Pagination: Pagination{
+			Page:       page,
+			Limit:      limit,
+			Total:      total,
+			TotalPages: (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
 // @Summary Get thread creation cooldown
-// @Description Get the timestamp of the last thread creation
+// @Description Get the timestamp of the last thread creation and the current cooldown length, on the given board if board_id is set
 // @Tags Thread
 // @Accept json
 // @Produce json
-// @Param session_key query string true "Session key"
+// @Security BearerAuth
+// @Param board_id query int false "Board ID"
 // @Success 200 {object} ThreadCooldownResponse
 // @Failure 401 {object} ErrorResponse
 // @Router /api/threads/cooldown [get]
 func (h *handler) GetThreadCooldown(c *gin.Context) {
-	sessionKey := c.Query("session_key")
+	sessionKey := session.Key(c)
 	if sessionKey == "" {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "session_key is required"})
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
 		return
 	}
 
 	user, err := h.sessionSvc.GetUserBySessionKey(sessionKey)
 	if err != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "user not found"})
+		utils.RespondError(c, http.StatusNotFound, "user not found")
 		return
 	}
 
+	var boardID uint64
+	if raw := c.Query("board_id"); raw != "" {
+		if boardID, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			utils.RespondError(c, http.StatusBadRequest, "invalid board ID")
+			return
+		}
+	}
+
 	lastThreadTime, err := h.userSvc.GetUserLastThreadTime(user.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to get last thread time"})
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get last thread time")
 		return
 	}
 
@@ -165,6 +274,7 @@ func (h *handler) GetThreadCooldown(c *gin.Context) {
 
 	c.JSON(http.StatusOK, ThreadCooldownResponse{
 		LastThreadCreationUnix: lastThreadUnix,
+		CooldownSeconds:        int64(h.service.Cooldown(boardID).Seconds()),
 	})
 }
 
@@ -182,13 +292,13 @@ func (h *handler) GetThreadByID(c *gin.Context) {
 	threadIDStr := c.Param("id")
 	threadID, err := strconv.ParseUint(threadIDStr, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid thread ID"})
+		utils.RespondError(c, http.StatusBadRequest, "invalid thread ID")
 		return
 	}
 
 	thread, err := h.service.GetThreadByID(c.Request.Context(), threadID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "thread not found"})
+		utils.WriteError(c, err)
 		return
 	}
 
@@ -200,9 +310,10 @@ func (h *handler) GetThreadByID(c *gin.Context) {
 // @Tags Thread
 // @Accept json
 // @Produce json
-// @Param sort query string false "Sort order (new, top)" default("new")
+// @Param sort query string false "Sort order (new, popular, active, trending)" default("new")
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Items per page" default(10)
+// @Param filter query string false "What to do with threads the user hid or filtered: mark them with filtered=true (mark) or leave them out (hide)" default("mark")
 // @Success 200 {object} TopThreadsResponse
 // @Router /api/threads/top [get]
 func (h *handler) GetTopThreads(c *gin.Context) {
@@ -222,9 +333,10 @@ func (h *handler) GetTopThreads(c *gin.Context) {
 
 	threads, total, err := h.service.GetTopThreads(c.Request.Context(), sort, page, limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to get top threads"})
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get top threads")
 		return
 	}
+	threads = h.applyFilters(c, threads)
 
 	totalPages := (total + int64(limit) - 1) / int64(limit)
 
@@ -245,7 +357,7 @@ func (h *handler) GetTopThreads(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param thread_id path int true "Thread ID"
-// @Param session_key query string true "Session key"
+// @Security BearerAuth
 // @Success 200 {object} CheckAuthorResponse
 // @Failure 400 {object} ErrorResponse
 // @Router /api/threads/check-author/{thread_id} [get]
@@ -253,27 +365,94 @@ func (h *handler) CheckThreadAuthor(c *gin.Context) {
 	threadIDStr := c.Param("thread_id")
 	threadID, err := strconv.ParseUint(threadIDStr, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid thread ID"})
+		utils.RespondError(c, http.StatusBadRequest, "invalid thread ID")
 		return
 	}
 
-	sessionKey := c.Query("session_key")
+	sessionKey := session.Key(c)
 	if sessionKey == "" {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "session_key is required"})
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
 		return
 	}
 
 	user, err := h.sessionSvc.GetUserBySessionKey(sessionKey)
 	if err != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "user not found"})
+		utils.RespondError(c, http.StatusNotFound, "user not found")
 		return
 	}
 
 	isAuthor, err := h.service.IsUserAuthor(c.Request.Context(), user.ID, threadID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to check authorship"})
+		utils.RespondError(c, http.StatusInternalServerError, "failed to check authorship")
 		return
 	}
 
 	c.JSON(http.StatusOK, CheckAuthorResponse{IsAuthor: isAuthor})
 }
+
+// @Summary Delete a thread
+// @Description Soft-delete a thread of the board. It disappears from listings and can be restored until the purge job removes it. Board moderators and admins only.
+// @Tags Thread
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param slug path string true "Board slug"
+// @Param thread_id path int true "Thread ID"
+// @Success 204
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/boards/{slug}/threads/{thread_id} [delete]
+func (h *handler) DeleteThread(c *gin.Context) {
+	h.setDeleted(c, true)
+}
+
+// @Summary Restore a thread
+// @Description Bring back a soft-deleted thread of the board. Board moderators and admins only.
+// @Tags Thread
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param slug path string true "Board slug"
+// @Param thread_id path int true "Thread ID"
+// @Success 204
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/boards/{slug}/threads/{thread_id}/restore [post]
+func (h *handler) RestoreThread(c *gin.Context) {
+	h.setDeleted(c, false)
+}
+
+func (h *handler) setDeleted(c *gin.Context, deleted bool) {
+	threadID, err := strconv.ParseUint(c.Param("thread_id"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid thread ID")
+		return
+	}
+
+	var deletedBy *string
+	if deleted {
+		who := board.ModeratorFrom(c)
+		deletedBy = &who
+	}
+	if err := h.service.SetDeleted(c.Request.Context(), c.Param("slug"), threadID, deletedBy); err != nil {
+		utils.WriteError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// applyFilters marks the threads the requesting user hid or filtered, or
+// drops them for filter=hide. Pagination still counts them.
+func (h *handler) applyFilters(c *gin.Context, threads []*Thread) []*Thread {
+	set := filter.FromRequest(c, h.filterSvc, h.sessionSvc)
+	if set == nil {
+		return threads
+	}
+	hide := filter.HideRequested(c)
+	kept := threads[:0]
+	for _, t := range threads {
+		t.Filtered = set.HidesThread(t.ID) || set.Matches(t.AuthorNickname, t.Title, t.Content)
+		if !hide || !t.Filtered {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
@@ -1,19 +1,50 @@
 package thread
 
-import "time"
+import (
+	"time"
+
+	"backend/internal/app/markup"
+	"backend/internal/utils"
+)
 
 type Thread struct {
 	ID                 uint64              `json:"id" gorm:"primaryKey"`
-	BoardID            uint64              `json:"board_id"`
+	BoardID            uint64              `json:"board_id" gorm:"index"`
 	BoardSlug          string              `json:"board_slug"`
+	PostNo             uint64              `json:"post_no" gorm:"not null;default:0;index"`
 	Title              string              `json:"title"`
 	Content            string              `json:"content"`
+	Segments           []*markup.Segment   `json:"segments,omitempty" gorm:"type:jsonb;serializer:json"`
 	CreatedBySessionID uint64              `json:"created_by_session_id"`
 	AuthorNickname     string              `json:"author_nickname"`
 	MessagesCount      int                 `json:"messages_count"`
 	CreatedAt          time.Time           `json:"created_at"`
 	UpdatedAt          time.Time           `json:"updated_at"`
+	ArchivedAt         *time.Time          `json:"archived_at,omitempty" gorm:"index"`
+	EditedAt           *time.Time          `json:"edited_at,omitempty"`
+	DeletedAt          *time.Time          `json:"deleted_at,omitempty" gorm:"index"`
+	DeletedBy          *string             `json:"deleted_by,omitempty"`
+	AttachmentsCount   int                 `json:"attachments_count" gorm:"->;-:migration"`
+	OPImageURL         *string             `json:"op_image_url,omitempty" gorm:"->;-:migration;column:op_image_url"`
 	Attachments        []*ThreadAttachment `json:"attachments,omitempty" gorm:"-"`
+	// LastReplies are the latest replies, oldest first, shown under the
+	// thread in board listings.
+	LastReplies []*ReplyPreview `json:"last_replies,omitempty" gorm:"-"`
+	// Filtered is set per request when the thread is hidden by, or matches a
+	// filter rule of, the user asking.
+	Filtered bool `json:"filtered,omitempty" gorm:"-"`
+}
+
+type ReplyPreview struct {
+	ID             uint64            `json:"id"`
+	PostNo         uint64            `json:"post_no"`
+	ThreadID       uint64            `json:"thread_id"`
+	ParentID       *uint64           `json:"parent_id,omitempty"`
+	Content        string            `json:"content"`
+	Segments       []*markup.Segment `json:"segments,omitempty" gorm:"serializer:json"`
+	AuthorNickname string            `json:"author_nickname"`
+	IsAuthor       bool              `json:"is_author"`
+	CreatedAt      time.Time         `json:"created_at"`
 }
 
 type ThreadAttachment struct {
@@ -31,8 +62,10 @@ type ThreadActivity struct {
 	ThreadID     uint64    `json:"thread_id" gorm:"primaryKey;column:thread_id"`
 	MessageCount int       `json:"message_count" gorm:"not null;default:0"`
 	BumpAt       time.Time `json:"bump_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
-	CreatedAt    time.Time `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
-	UpdatedAt    time.Time `json:"updated_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
+	// TrendingScore is recomputed by the trending job; see RecomputeTrending.
+	TrendingScore float64   `json:"trending_score" gorm:"not null;default:0;index"`
+	CreatedAt     time.Time `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
 }
 
 func (ThreadActivity) TableName() string {
@@ -45,6 +78,13 @@ type CreateThreadRequest struct {
 	AttachmentIDs []string `json:"attachment_ids"`
 }
 
+// UpdateThreadRequest edits a thread's title, text or both; omitted fields
+// stay as they are.
+type UpdateThreadRequest struct {
+	Title   *string `json:"title,omitempty"`
+	Content *string `json:"content,omitempty"`
+}
+
 type ThreadListResponse struct {
 	Threads    []*Thread  `json:"threads"`
 	Pagination Pagination `json:"pagination"`
@@ -68,12 +108,11 @@ type TopThreadsResponse struct {
 
 type ThreadCooldownResponse struct {
 	LastThreadCreationUnix *int64 `json:"lastThreadCreationUnix"`
+	CooldownSeconds        int64  `json:"cooldownSeconds"`
 }
 
 type CheckAuthorResponse struct {
 	IsAuthor bool `json:"is_author"`
 }
 
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
+type ErrorResponse = utils.ErrorResponse
@@ -0,0 +1,156 @@
+package thread
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// The top threads listings are kept as one Redis sorted set per sort, so a
+// page is a ZREVRANGE plus a primary-key lookup instead of a joined sort over
+// every live thread. The sets are rebuilt by the top_threads_ranking job;
+// in between, new threads and bumps are added as they happen. Until the first
+// rebuild the sets do not exist and GetTopThreads falls back to the database.
+const rankingKeyPrefix = "threads:top:rank:"
+
+var rankingSorts = []string{"new", "active", "popular"}
+
+type RankingRow struct {
+	ID           uint64
+	CreatedAt    time.Time
+	BumpAt       *time.Time
+	MessageCount int
+}
+
+func rankingKey(sort string) string {
+	return rankingKeyPrefix + sort
+}
+
+// popularityScore is the reply count halved for every halfLife since the
+// thread was last bumped, so a busy thread that went quiet sinks below a
+// smaller one that is active now.
+func popularityScore(messageCount int, lastActivity, now time.Time, halfLife time.Duration) float64 {
+	age := now.Sub(lastActivity)
+	if age < 0 {
+		age = 0
+	}
+	return float64(messageCount) * math.Pow(0.5, float64(age)/float64(halfLife))
+}
+
+// RebuildTopRanking recomputes every ranking set from the database and swaps
+// them in atomically.
+func (s *service) RebuildTopRanking(ctx context.Context, halfLife time.Duration) (int, error) {
+	rows, err := s.repo.GetRankingRows()
+	if err != nil {
+		return 0, fmt.Errorf("failed to load ranking rows: %w", err)
+	}
+
+	now := time.Now()
+	members := make(map[string][]goredis.Z, len(rankingSorts))
+	for _, row := range rows {
+		lastActivity := row.CreatedAt
+		if row.BumpAt != nil {
+			lastActivity = *row.BumpAt
+		}
+		id := strconv.FormatUint(row.ID, 10)
+		members["new"] = append(members["new"], goredis.Z{Score: float64(row.CreatedAt.Unix()), Member: id})
+		members["active"] = append(members["active"], goredis.Z{Score: float64(lastActivity.Unix()), Member: id})
+		members["popular"] = append(members["popular"], goredis.Z{
+			Score:  popularityScore(row.MessageCount, lastActivity, now, halfLife),
+			Member: id,
+		})
+	}
+
+	_, err = s.redisP.Client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, sort := range rankingSorts {
+			key := rankingKey(sort)
+			pipe.Del(ctx, key)
+			if len(members[sort]) > 0 {
+				pipe.ZAdd(ctx, key, members[sort]...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to store ranking: %w", err)
+	}
+	s.InvalidateTopThreadsCache()
+	return len(rows), nil
+}
+
+// rankThread records a new thread or a bump in the ranking sets that
+// already exist; the next rebuild recomputes popularity.
+func (s *service) rankThread(threadID uint64, createdAt, bumpAt time.Time, isNew bool) {
+	ctx := context.Background()
+	id := strconv.FormatUint(threadID, 10)
+
+	update := map[string]float64{"active": float64(bumpAt.Unix())}
+	if isNew {
+		update["new"] = float64(createdAt.Unix())
+		update["popular"] = 0
+	}
+	for sort, score := range update {
+		key := rankingKey(sort)
+		if exists, err := s.redisP.Exists(ctx, key).Result(); err != nil || exists == 0 {
+			continue
+		}
+		if err := s.redisP.Client.ZAdd(ctx, key, goredis.Z{Score: score, Member: id}).Err(); err != nil {
+			s.logger.Warnw("Failed to update top threads ranking", "sort", sort, "thread_id", threadID, "error", err)
+		}
+	}
+}
+
+// unrankThread takes a deleted thread out of the ranking sets; a restored
+// one comes back with the next rebuild.
+func (s *service) unrankThread(threadID uint64) {
+	ctx := context.Background()
+	id := strconv.FormatUint(threadID, 10)
+	for _, sort := range rankingSorts {
+		if err := s.redisP.Client.ZRem(ctx, rankingKey(sort), id).Err(); err != nil {
+			s.logger.Warnw("Failed to update top threads ranking", "sort", sort, "thread_id", threadID, "error", err)
+		}
+	}
+}
+
+// topFromRanking serves a top threads page from the ranking set for sort;
+// ok is false when the set has not been built yet.
+func (s *service) topFromRanking(ctx context.Context, sort string, page, limit int) ([]*Thread, int64, bool) {
+	key := rankingKey(sort)
+	total, err := s.redisP.Client.ZCard(ctx, key).Result()
+	if err != nil || total == 0 {
+		return nil, 0, false
+	}
+
+	start := int64((page - 1) * limit)
+	members, err := s.redisP.Client.ZRevRange(ctx, key, start, start+int64(limit)-1).Result()
+	if err != nil {
+		return nil, 0, false
+	}
+	ids := make([]uint64, 0, len(members))
+	for _, member := range members {
+		if id, err := strconv.ParseUint(member, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	loaded, err := s.repo.GetThreadsByIDs(ids)
+	if err != nil {
+		s.logger.Warnw("Failed to load ranked threads", "sort", sort, "error", err)
+		return nil, 0, false
+	}
+	byID := make(map[uint64]*Thread, len(loaded))
+	for _, t := range loaded {
+		byID[t.ID] = t
+	}
+	threads := make([]*Thread, 0, len(ids))
+	for _, id := range ids {
+		if t, ok := byID[id]; ok {
+			threads = append(threads, t)
+		}
+	}
+	return threads, total, true
+}
@@ -2,20 +2,60 @@ package thread
 
 import (
 	"database/sql"
+	"strings"
 	"time"
 
+	"backend/internal/app/board"
+	"backend/internal/app/markup"
+	"backend/internal/db/resolver"
+
 	"gorm.io/gorm"
 )
 
 type Repository interface {
+	// CreateThread inserts the thread under the board's next post number,
+	// filling in its ID and PostNo, and counts it for userID.
+	CreateThread(thread *Thread, userID uint64) error
 	GetThreadsByBoardID(boardID uint64, sort string, last24Hours bool, page int, limit int) ([]*Thread, int64, error)
+	// GetArchivedThreads lists the board's archived threads, last archived
+	// first, whose title or text contains query when it is set.
+	GetArchivedThreads(boardID uint64, query string, page, limit int) ([]*Thread, int64, error)
 	GetThreadByID(id uint64) (*Thread, error)
 	GetUserLastThreadTime(userID uint64) (*time.Time, error)
 	GetTotalThreadsCount(boardID uint64) (int64, error)
 	GetTopThreads(sort string, page, limit int) ([]*Thread, int64, error)
+	GetThreadsByIDs(ids []uint64) ([]*Thread, error)
+	GetRankingRows() ([]RankingRow, error)
+	// GetLastReplies returns up to perThread latest replies of each thread,
+	// oldest first within a thread.
+	GetLastReplies(threadIDs []uint64, perThread int) ([]*ReplyPreview, error)
+	// UpdateTrendingScores rescores threads from the replies since since and
+	// returns the boards whose threads changed score.
+	UpdateTrendingScores(since time.Time, halfLife time.Duration, posterWeight float64) ([]uint64, error)
 	IsUserThreadAuthor(userID uint64, threadID uint64) (bool, error)
+	UpdateThread(threadID uint64, title, content string, segments []*markup.Segment, editedAt time.Time) error
+	// SetDeleted soft-deletes the board's thread with deletedBy recorded, or
+	// restores it when deletedBy is nil. changed is false when the thread was
+	// already in that state; a thread not on the board is
+	// gorm.ErrRecordNotFound.
+	SetDeleted(boardID, threadID uint64, deletedBy *string) (changed bool, err error)
+	ArchiveInactiveThreads(cutoff time.Time) ([]uint64, error)
+	ArchiveThreadsOverCap(boardID uint64, keep int) (int64, error)
 }
 
+// listAttachmentColumns adds the attachment count (OP and replies) and the
+// first OP image to listing queries, so catalogs need no per-thread lookups.
+const listAttachmentColumns = `
+			(SELECT COUNT(*) FROM attachments WHERE attachments.thread_id = threads.id) +
+			(SELECT COUNT(*) FROM attachments JOIN messages ON messages.id = attachments.message_id
+				WHERE messages.thread_id = threads.id) as attachments_count,
+			(SELECT attachments.file_url FROM attachments
+				WHERE attachments.thread_id = threads.id
+				  AND attachments.content_type LIKE 'image/%'
+				  AND attachments.missing_at IS NULL
+				ORDER BY attachments.id LIMIT 1) as op_image_url
+		`
+
 type repository struct {
 	db *gorm.DB
 }
@@ -24,54 +64,160 @@ func NewRepository(db *gorm.DB) Repository {
 	return &repository{db: db}
 }
 
+// CreateThread takes the post number, inserts the thread and bumps the
+// author's thread counters (overall and for the board) in one transaction,
+// so the numbering has no gaps and the counters cannot drift when a request
+// fails halfway.
+func (r *repository) CreateThread(thread *Thread, userID uint64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		postNo, err := board.NextPostNo(tx, thread.BoardID)
+		if err != nil {
+			return err
+		}
+		thread.PostNo = postNo
+		// Create fills in the ID from INSERT .. RETURNING id, so two threads
+		// posted from the same session at the same instant cannot be mixed up.
+		// Select keeps the insert to the columns a new thread owns.
+		if err := tx.Select("BoardID", "PostNo", "Title", "Content", "Segments", "CreatedBySessionID", "AuthorNickname", "CreatedAt", "UpdatedAt").
+			Create(thread).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec(`
+            INSERT INTO user_activity (user_id, thread_count, last_thread_at)
+            VALUES (?, 1, ?)
+            ON CONFLICT (user_id) DO UPDATE SET
+                thread_count = user_activity.thread_count + 1,
+                last_thread_at = EXCLUDED.last_thread_at,
+                updated_at = NOW()
+        `, userID, thread.CreatedAt).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec(`
+            INSERT INTO user_board_activity (user_id, board_id, thread_count, last_thread_at)
+            VALUES (?, ?, 1, ?)
+            ON CONFLICT (user_id, board_id) DO UPDATE SET
+                thread_count = user_board_activity.thread_count + 1,
+                last_thread_at = EXCLUDED.last_thread_at,
+                updated_at = NOW()
+        `, userID, thread.BoardID, thread.CreatedAt).Error; err != nil {
+			return err
+		}
+
+		return tx.Exec(`
+            INSERT INTO threads_activity (thread_id, message_count, bump_at)
+            VALUES (?, 0, NOW())
+            ON CONFLICT (thread_id) DO NOTHING
+        `, thread.ID).Error
+	})
+}
+
 func (r *repository) GetThreadsByBoardID(boardID uint64, sort string, last24Hours bool, page int, limit int) ([]*Thread, int64, error) {
-	var threads []*Thread
+	return r.listThreads(func(db *gorm.DB) *gorm.DB {
+		db = db.Where("threads.board_id = ? AND threads.archived_at IS NULL AND threads.deleted_at IS NULL", boardID)
+		if last24Hours {
+			db = db.Where("threads.created_at > NOW() - INTERVAL '24 hours'")
+		}
+		return db
+	}, sort, page, limit)
+}
 
-	query := r.db.Table("threads").
+// listQuery adds the listing columns and joins to a query over threads.
+func listQuery(db *gorm.DB) *gorm.DB {
+	return db.
 		Select(`
 			threads.id, 
 			threads.board_id, 
+			threads.post_no, 
 			boards.slug as board_slug, 
 			threads.title, 
 			threads.content, 
+			threads.segments, 
 			threads.created_at, 
 			threads.updated_at, 
+			threads.archived_at, 
+			threads.edited_at, 
 			users.id as created_by, 
 			threads.author_nickname as author_nickname, 
 			COALESCE(threads_activity.message_count, 0) as messages_count, 
-			threads_activity.bump_at
-		`).
+			threads_activity.bump_at, 
+		` + listAttachmentColumns).
 		Joins("JOIN sessions ON sessions.id = threads.created_by_session_id").
 		Joins("JOIN users ON users.id = sessions.user_id").
 		Joins("JOIN boards ON boards.id = threads.board_id").
-		Joins("LEFT JOIN threads_activity ON threads_activity.thread_id = threads.id").
-		Where("threads.board_id = ?", boardID)
+		Joins("LEFT JOIN threads_activity ON threads_activity.thread_id = threads.id")
+}
+
+// listThreads counts the threads matching filter on the threads table alone
+// and then loads only the requested page with the joins and per-thread
+// subqueries, instead of running the full joined query twice. filter may
+// only refer to threads columns.
+func (r *repository) listThreads(filter func(*gorm.DB) *gorm.DB, sort string, page, limit int) ([]*Thread, int64, error) {
+	var total int64
+	if err := filter(resolver.Read(r.db).Table("threads")).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
 
-	if last24Hours {
-		query = query.Where("threads.created_at > NOW() - INTERVAL '24 hours'")
+	offset := (page - 1) * limit
+	threads := []*Thread{}
+	if int64(offset) >= total {
+		return threads, total, nil
 	}
 
+	query := listQuery(filter(resolver.Read(r.db).Table("threads")))
+
 	switch sort {
 	case "popular":
 		query = query.Order("threads_activity.message_count DESC")
 	case "active":
 		query = query.Order("threads_activity.bump_at DESC")
+	case "trending":
+		query = query.Order("COALESCE(threads_activity.trending_score, 0) DESC, threads_activity.bump_at DESC")
 	default:
 		query = query.Order("threads.created_at DESC")
 	}
 
-	var total int64
-	if err := query.Count(&total).Error; err != nil {
+	if err := query.Offset(offset).Limit(limit).Find(&threads).Error; err != nil {
 		return nil, 0, err
 	}
 
-	offset := (page - 1) * limit
-	query = query.Offset(offset).Limit(limit).Group("threads.id, boards.slug, users.id, threads_activity.message_count, threads_activity.bump_at")
+	return threads, total, nil
+}
+
+// likeEscaper makes a search string match literally inside a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// GetArchivedThreads reads the threads table alone: the archive is cold, so
+// it goes without the activity, author and attachment joins of live listings.
+func (r *repository) GetArchivedThreads(boardID uint64, query string, page, limit int) ([]*Thread, int64, error) {
+	filter := func(db *gorm.DB) *gorm.DB {
+		db = db.Where("board_id = ? AND archived_at IS NOT NULL AND deleted_at IS NULL", boardID)
+		if query != "" {
+			pattern := "%" + likeEscaper.Replace(query) + "%"
+			db = db.Where("(title ILIKE ? OR content ILIKE ?)", pattern, pattern)
+		}
+		return db
+	}
 
-	if err := query.Find(&threads).Error; err != nil {
+	var total int64
+	if err := filter(resolver.Read(r.db).Table("threads")).Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
+	offset := (page - 1) * limit
+	threads := []*Thread{}
+	if int64(offset) >= total {
+		return threads, total, nil
+	}
+	err := filter(resolver.Read(r.db).Table("threads")).
+		Select("id, board_id, post_no, title, content, segments, author_nickname, created_at, updated_at, archived_at, edited_at").
+		Order("archived_at DESC, id DESC").
+		Offset(offset).Limit(limit).
+		Find(&threads).Error
+	if err != nil {
+		return nil, 0, err
+	}
 	return threads, total, nil
 }
 
@@ -89,7 +235,7 @@ func (r *repository) GetThreadByID(id uint64) (*Thread, error) {
 		Joins("JOIN users ON users.id = sessions.user_id").
 		Joins("JOIN boards ON boards.id = threads.board_id").
 		Joins("LEFT JOIN threads_activity ON threads_activity.thread_id = threads.id").
-		Where("threads.id = ?", id).
+		Where("threads.id = ? AND threads.deleted_at IS NULL", id).
 		First(&thread).Error
 	if err != nil {
 		return nil, err
@@ -123,49 +269,127 @@ func (r *repository) GetTotalThreadsCount(boardID uint64) (int64, error) {
 }
 
 func (r *repository) GetTopThreads(sort string, page, limit int) ([]*Thread, int64, error) {
-	var threads []*Thread
-
-	query := r.db.Table("threads").
-		Select(`
-			threads.id, 
-			threads.board_id, 
-			boards.slug as board_slug, 
-			threads.title, 
-			threads.content, 
-			threads.created_at, 
-			threads.updated_at, 
-			users.id as created_by, 
-			threads.author_nickname as author_nickname, 
-			COALESCE(threads_activity.message_count, 0) as messages_count, 
-			threads_activity.bump_at
-		`).
-		Joins("JOIN sessions ON sessions.id = threads.created_by_session_id").
-		Joins("JOIN users ON users.id = sessions.user_id").
-		Joins("JOIN boards ON boards.id = threads.board_id").
-		Joins("LEFT JOIN threads_activity ON threads_activity.thread_id = threads.id")
+	return r.listThreads(func(db *gorm.DB) *gorm.DB {
+		return db.Where("threads.archived_at IS NULL AND threads.deleted_at IS NULL")
+	}, sort, page, limit)
+}
 
-	switch sort {
-	case "popular":
-		query = query.Order("threads_activity.message_count DESC")
-	case "active":
-		query = query.Order("threads_activity.bump_at DESC")
-	default:
-		query = query.Order("threads.created_at DESC")
+// GetThreadsByIDs loads listing rows for ids, in no particular order;
+// archived and deleted threads are left out.
+func (r *repository) GetThreadsByIDs(ids []uint64) ([]*Thread, error) {
+	threads := []*Thread{}
+	if len(ids) == 0 {
+		return threads, nil
 	}
+	err := listQuery(resolver.Read(r.db).Table("threads")).
+		Where("threads.id IN ? AND threads.archived_at IS NULL AND threads.deleted_at IS NULL", ids).
+		Find(&threads).Error
+	return threads, err
+}
 
-	var total int64
-	if err := query.Count(&total).Error; err != nil {
-		return nil, 0, err
+// GetRankingRows returns what the top threads ranking is computed from, for
+// every live thread.
+func (r *repository) GetRankingRows() ([]RankingRow, error) {
+	var rows []RankingRow
+	err := resolver.Read(r.db).Table("threads").
+		Select("threads.id, threads.created_at, threads_activity.bump_at, COALESCE(threads_activity.message_count, 0) as message_count").
+		Joins("LEFT JOIN threads_activity ON threads_activity.thread_id = threads.id").
+		Where("threads.archived_at IS NULL AND threads.deleted_at IS NULL").
+		Scan(&rows).Error
+	return rows, err
+}
+
+func (r *repository) GetLastReplies(threadIDs []uint64, perThread int) ([]*ReplyPreview, error) {
+	replies := []*ReplyPreview{}
+	if len(threadIDs) == 0 || perThread <= 0 {
+		return replies, nil
 	}
+	err := resolver.Read(r.db).Raw(`
+		SELECT id, thread_id, post_no, parent_id, content, segments, author_nickname, is_author, created_at
+		FROM (
+			SELECT messages.*, ROW_NUMBER() OVER (PARTITION BY thread_id ORDER BY id DESC) AS rn
+			FROM messages
+			WHERE thread_id IN ? AND deleted_at IS NULL
+		) latest
+		WHERE rn <= ?
+		ORDER BY thread_id, id
+	`, threadIDs, perThread).Scan(&replies).Error
+	return replies, err
+}
 
-	offset := (page - 1) * limit
-	query = query.Offset(offset).Limit(limit).Group("threads.id, boards.slug, users.id, threads_activity.message_count, threads_activity.bump_at")
+// UpdateTrendingScores computes each live thread's score as the decayed sum
+// of its replies plus posterWeight times the decayed sum of its distinct
+// posters (each weighted by their latest reply), in one statement so readers
+// never see a half-updated ranking.
+func (r *repository) UpdateTrendingScores(since time.Time, halfLife time.Duration, posterWeight float64) ([]uint64, error) {
+	var boardIDs []uint64
+	err := r.db.Raw(`
+		WITH recent AS (
+			SELECT messages.thread_id, sessions.user_id,
+				POWER(0.5, EXTRACT(EPOCH FROM NOW() - messages.created_at) / @half_life) AS weight
+			FROM messages
+			JOIN sessions ON sessions.id = messages.created_by_session_id
+			WHERE messages.created_at >= @since AND messages.deleted_at IS NULL
+		),
+		posters AS (
+			SELECT thread_id, user_id, MAX(weight) AS weight
+			FROM recent
+			GROUP BY thread_id, user_id
+		),
+		scores AS (
+			SELECT replies.thread_id, replies.weight + @poster_weight * distinct_posters.weight AS score
+			FROM (SELECT thread_id, SUM(weight) AS weight FROM recent GROUP BY thread_id) replies
+			JOIN (SELECT thread_id, SUM(weight) AS weight FROM posters GROUP BY thread_id) distinct_posters
+				ON distinct_posters.thread_id = replies.thread_id
+		),
+		updated AS (
+			UPDATE threads_activity
+			SET trending_score = COALESCE(scores.score, 0)
+			FROM threads
+			LEFT JOIN scores ON scores.thread_id = threads.id
+			WHERE threads.id = threads_activity.thread_id
+				AND threads.archived_at IS NULL
+				AND threads.deleted_at IS NULL
+				AND threads_activity.trending_score <> COALESCE(scores.score, 0)
+			RETURNING threads.board_id
+		)
+		SELECT DISTINCT board_id FROM updated
+	`, map[string]interface{}{
+		"since":         since,
+		"half_life":     halfLife.Seconds(),
+		"poster_weight": posterWeight,
+	}).Scan(&boardIDs).Error
+	return boardIDs, err
+}
 
-	if err := query.Find(&threads).Error; err != nil {
-		return nil, 0, err
+func (r *repository) UpdateThread(threadID uint64, title, content string, segments []*markup.Segment, editedAt time.Time) error {
+	return r.db.Model(&Thread{ID: threadID}).
+		Select("Title", "Content", "Segments", "EditedAt", "UpdatedAt").
+		Updates(&Thread{Title: title, Content: content, Segments: segments, EditedAt: &editedAt, UpdatedAt: editedAt}).Error
+}
+
+func (r *repository) SetDeleted(boardID, threadID uint64, deletedBy *string) (bool, error) {
+	query := r.db.Model(&Thread{}).Where("id = ? AND board_id = ?", threadID, boardID)
+	updates := map[string]interface{}{"deleted_at": nil, "deleted_by": nil}
+	if deletedBy != nil {
+		query = query.Where("deleted_at IS NULL")
+		updates = map[string]interface{}{"deleted_at": time.Now().UTC(), "deleted_by": *deletedBy}
+	} else {
+		query = query.Where("deleted_at IS NOT NULL")
+	}
+	result := query.Updates(updates)
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.RowsAffected > 0, result.Error
 	}
 
-	return threads, total, nil
+	var count int64
+	if err := r.db.Model(&Thread{}).Where("id = ? AND board_id = ?", threadID, boardID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count == 0 {
+		return false, gorm.ErrRecordNotFound
+	}
+	return false, nil
 }
 
 func (r *repository) IsUserThreadAuthor(userID uint64, threadID uint64) (bool, error) {
@@ -182,3 +406,35 @@ func (r *repository) IsUserThreadAuthor(userID uint64, threadID uint64) (bool, e
 
 	return count > 0, nil
 }
+
+// ArchiveInactiveThreads archives every thread not bumped since cutoff and
+// returns the board IDs of the archived threads.
+func (r *repository) ArchiveInactiveThreads(cutoff time.Time) ([]uint64, error) {
+	var boardIDs []uint64
+	err := r.db.Raw(`
+		UPDATE threads SET archived_at = NOW(), updated_at = NOW()
+		WHERE archived_at IS NULL
+		  AND COALESCE(
+		      (SELECT bump_at FROM threads_activity WHERE threads_activity.thread_id = threads.id),
+		      threads.created_at
+		  ) < ?
+		RETURNING board_id
+	`, cutoff).Scan(&boardIDs).Error
+	return boardIDs, err
+}
+
+// ArchiveThreadsOverCap archives the board's live threads beyond the keep
+// most recently bumped and returns how many it archived.
+func (r *repository) ArchiveThreadsOverCap(boardID uint64, keep int) (int64, error) {
+	result := r.db.Exec(`
+		UPDATE threads SET archived_at = NOW(), updated_at = NOW()
+		WHERE id IN (
+			SELECT threads.id FROM threads
+			LEFT JOIN threads_activity ON threads_activity.thread_id = threads.id
+			WHERE threads.board_id = ? AND threads.archived_at IS NULL AND threads.deleted_at IS NULL
+			ORDER BY COALESCE(threads_activity.bump_at, threads.created_at) DESC, threads.id DESC
+			OFFSET ?
+		)
+	`, boardID, keep)
+	return result.RowsAffected, result.Error
+}
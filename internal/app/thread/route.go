@@ -9,7 +9,19 @@ func RegisterRoutes(rg *gin.RouterGroup, handler Handler) {
 		threads.GET("/:board_id", handler.GetThreadsByBoardID)
 		threads.GET("/cooldown", handler.GetThreadCooldown)
 		threads.GET("/thread/:id", handler.GetThreadByID)
+		threads.PATCH("/thread/:id", handler.EditThread)
 		threads.GET("/top", handler.GetTopThreads)
 		threads.GET("/check-author/:thread_id", handler.CheckThreadAuthor)
 	}
+	rg.GET("/boards/:slug/archive", handler.GetArchive)
+}
+
+// RegisterModRoutes registers the moderation routes; rg must only let board
+// moderators and admins through.
+func RegisterModRoutes(rg *gin.RouterGroup, handler Handler) {
+	threads := rg.Group("/boards/:slug/threads")
+	{
+		threads.DELETE("/:thread_id", handler.DeleteThread)
+		threads.POST("/:thread_id/restore", handler.RestoreThread)
+	}
 }
@@ -3,12 +3,17 @@ package thread
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 	"unicode/utf8"
 
 	"backend/internal/app/attachment"
+	"backend/internal/app/board"
+	"backend/internal/app/markup"
 	"backend/internal/app/session"
+	"backend/internal/app/settings"
 	"backend/internal/app/user"
 	"backend/internal/providers/minio"
 	"backend/internal/providers/redis"
@@ -20,51 +25,95 @@ import (
 
 type Service interface {
 	CreateThread(ctx context.Context, boardID uint64, sessionKey, title, content string, attachmentIDs []string) (*Thread, error)
+	// EditThread lets the author change the title and text while the
+	// thread_edit_window since posting is open.
+	EditThread(ctx context.Context, threadID uint64, sessionKey string, req UpdateThreadRequest) (*Thread, error)
 	GetThreadsByBoardID(ctx context.Context, boardID uint64, sort string, page, limit int) ([]*Thread, int64, error)
 	GetThreadByID(ctx context.Context, threadID uint64) (*Thread, error)
+	// GetArchivedThreads pages through the board's archive, optionally
+	// searching titles and text for query.
+	GetArchivedThreads(ctx context.Context, slug, query string, page, limit int) ([]*Thread, int64, error)
 	GetUserLastThreadTime(userID uint64) (*time.Time, error)
 	InvalidateThreadsCache(boardID uint64)
 	GetTopThreads(ctx context.Context, sort string, page, limit int) ([]*Thread, int64, error)
 	InvalidateTopThreadsCache()
+	// RebuildTopRanking recomputes the top threads ranking; popularity decays
+	// by half every halfLife without a bump.
+	RebuildTopRanking(ctx context.Context, halfLife time.Duration) (int, error)
+	// RecomputeTrending rescores threads for sort=trending and returns the
+	// number of boards whose order changed.
+	RecomputeTrending(ctx context.Context, halfLife time.Duration) (int, error)
+	// InvalidateAfterReply drops the caches a new reply makes stale; bumped
+	// tells whether the reply moved the thread up.
+	InvalidateAfterReply(boardID, threadID uint64, bumped bool)
 	IsUserAuthor(ctx context.Context, userID uint64, threadID uint64) (bool, error)
+	ArchiveInactiveThreads(ctx context.Context, maxAge time.Duration) (int, error)
+	// SetDeleted soft-deletes a thread of the board for a moderator, who is
+	// recorded as deletedBy, or restores it when deletedBy is nil.
+	SetDeleted(ctx context.Context, slug string, threadID uint64, deletedBy *string) error
+	// Cooldown is the thread cooldown on the board, or the site-wide one for
+	// boardID 0.
+	Cooldown(boardID uint64) time.Duration
 }
 
+var (
+	// ErrNotAuthor is returned when someone other than the author tries to
+	// edit a thread.
+	ErrNotAuthor = errors.New("only the thread author can edit it")
+	// ErrEditWindowClosed is returned when the thread_edit_window has passed.
+	ErrEditWindowClosed = errors.New("the thread can no longer be edited")
+)
+
 type service struct {
 	repo          Repository
 	sessionSvc    session.Service
 	userSvc       user.Service
-	dbConn        *gorm.DB
 	redisP        *redis.RedisProvider
 	minioP        *minio.MinioProvider
 	eventBus      *utils.EventBus
 	logger        *zap.SugaredLogger
 	cachePrefix   string
 	attachmentSvc attachment.Service
+	settingsSvc   settings.Service
+	boardSvc      board.Service
 }
 
 func NewService(
 	repo Repository,
 	sessionSvc session.Service,
 	userSvc user.Service,
-	dbConn *gorm.DB,
 	redisP *redis.RedisProvider,
 	eventBus *utils.EventBus,
 	logger *zap.Logger,
 	minioP *minio.MinioProvider,
 	attachmentSvc attachment.Service,
+	settingsSvc settings.Service,
+	boardSvc board.Service,
 ) Service {
 	return &service{
 		repo:          repo,
 		sessionSvc:    sessionSvc,
 		userSvc:       userSvc,
-		dbConn:        dbConn,
 		redisP:        redisP,
 		minioP:        minioP,
 		eventBus:      eventBus,
 		logger:        logger.Sugar(),
 		cachePrefix:   "threads:board",
 		attachmentSvc: attachmentSvc,
+		settingsSvc:   settingsSvc,
+		boardSvc:      boardSvc,
+	}
+}
+
+func (s *service) Cooldown(boardID uint64) time.Duration {
+	cooldown := time.Duration(s.settingsSvc.Current().ThreadCooldown)
+	if boardID == 0 {
+		return cooldown
+	}
+	if b, err := s.boardSvc.GetBoardByID(boardID); err == nil {
+		return b.ThreadCooldown(cooldown)
 	}
+	return cooldown
 }
 
 func (s *service) GetUserLastThreadTime(userID uint64) (*time.Time, error) {
@@ -77,80 +126,83 @@ func (s *service) CreateThread(
 	sessionKey, title, content string,
 	attachmentIDs []string,
 ) (*Thread, error) {
-	titleLength := utf8.RuneCountInString(title)
-	if titleLength < 3 || titleLength > 99 {
-		return nil, fmt.Errorf("thread title must be between 3 and 99 characters, got %d", titleLength)
+	if err := validateThread(title, content); err != nil {
+		return nil, err
 	}
-	contentLength := utf8.RuneCountInString(content)
-	if contentLength < 3 || contentLength > 999 {
-		return nil, fmt.Errorf("thread content must be between 3 and 999 characters, got %d", contentLength)
+	b, err := s.boardSvc.GetBoardByID(boardID)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.PostingError(); err != nil {
+		return nil, err
+	}
+	if err := b.OriginError(utils.OriginFromContext(ctx), s.settingsSvc.Current().ProxyPolicy); err != nil {
+		return nil, err
+	}
+	if len(attachmentIDs) > 0 && s.attachmentSvc != nil {
+		if err := s.attachmentSvc.CheckPolicy(ctx, attachmentIDs, b); err != nil {
+			return nil, err
+		}
 	}
 	user, err := s.sessionSvc.GetUserBySessionKey(sessionKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
+	cooldown := s.Cooldown(boardID)
 	lastThreadTime, err := s.GetUserLastThreadTime(user.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get last thread time: %w", err)
 	}
 	if lastThreadTime != nil {
 		elapsed := time.Since(*lastThreadTime)
-		if elapsed < 5*time.Minute {
-			secondsLeft := int64(300 - elapsed.Seconds())
-			return nil, fmt.Errorf("thread creation cooldown: %d seconds left", secondsLeft)
+		if elapsed < cooldown {
+			return nil, &utils.CooldownError{Action: "thread creation", Cooldown: cooldown, Remaining: cooldown - elapsed}
 		}
 	}
+	// With ID rotation the cooldown is also kept per client, since a
+	// rotated user starts without one.
+	clientCooldownKey := ""
+	if clientKey := utils.ClientKeyFromContext(ctx); clientKey != "" {
+		clientCooldownKey = "cooldown:thread:" + clientKey
+		if left, err := s.redisP.CooldownLeft(ctx, clientCooldownKey); err == nil && left > 0 {
+			return nil, &utils.CooldownError{Action: "thread creation", Cooldown: cooldown, Remaining: left}
+		}
+	}
+	title = s.settingsSvc.FilterContent(title)
+	content = s.settingsSvc.FilterContent(content)
 	session, err := s.sessionSvc.GetSessionByKey(sessionKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
-	now := time.Now()
-	var threadID uint64
-	err = s.dbConn.Transaction(func(tx *gorm.DB) error {
-		threadData := map[string]interface{}{
-			"board_id":              boardID,
-			"title":                 title,
-			"content":               content,
-			"created_by_session_id": session.ID,
-			"author_nickname":       user.Nickname,
-			"created_at":            now,
-			"updated_at":            now,
-		}
-
-		if err := tx.Table("threads").Create(threadData).Error; err != nil {
-			return err
-		}
-
-		if err := tx.Raw(`
-            SELECT id FROM threads 
-            WHERE created_by_session_id = ? AND created_at = ?
-        `, session.ID, now).Scan(&threadID).Error; err != nil {
-			return err
-		}
-
-		if err := tx.Exec(`
-            INSERT INTO user_activity (user_id, thread_count, last_thread_at)
-            VALUES (?, 1, ?)
-            ON CONFLICT (user_id) DO UPDATE SET
-                thread_count = user_activity.thread_count + 1,
-                last_thread_at = EXCLUDED.last_thread_at,
-                updated_at = NOW()
-        `, user.ID, now).Error; err != nil {
-			return err
-		}
+	// As with replies, the post is claimed before the insert so a form
+	// submitted twice is caught even when both requests arrive at once.
+	duplicateKey := fmt.Sprintf("duplicate:%d:%s", user.ID, utils.ContentFingerprint(title+"\n"+content, attachmentIDs))
+	if left, err := s.redisP.ClaimCooldown(ctx, duplicateKey, time.Duration(s.settingsSvc.Current().DuplicateWindow)); err != nil {
+		s.logger.Warnw("Failed to check for a duplicate post", "error", err, "user_id", user.ID)
+	} else if left > 0 {
+		return nil, &utils.DuplicateError{Remaining: left}
+	}
 
-		if err := tx.Exec(`
-            INSERT INTO threads_activity (thread_id, message_count, bump_at)
-            VALUES (?, 0, NOW())
-            ON CONFLICT (thread_id) DO NOTHING
-        `, threadID).Error; err != nil {
-			return err
-		}
-		return nil
-	})
+	now := time.Now()
+	newThread := &Thread{
+		BoardID:            boardID,
+		Title:              title,
+		Content:            content,
+		Segments:           markup.Parse(content, b.Markup()),
+		CreatedBySessionID: session.ID,
+		AuthorNickname:     user.Nickname,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	err = s.repo.CreateThread(newThread, user.ID)
 	if err != nil {
+		s.redisP.Del(ctx, duplicateKey)
 		return nil, fmt.Errorf("failed to create thread: %w", err)
 	}
+	threadID := newThread.ID
+	if clientCooldownKey != "" {
+		s.redisP.StartCooldown(ctx, clientCooldownKey, cooldown)
+	}
 
 	if len(attachmentIDs) > 0 && s.attachmentSvc != nil {
 		if err := s.attachmentSvc.LinkToThreadByFileID(ctx, attachmentIDs, threadID); err != nil {
@@ -158,41 +210,147 @@ func (s *service) CreateThread(
 		}
 	}
 
+	// The ID may have been probed before it existed.
+	s.redisP.CachedDel(ctx, fmt.Sprintf("%s:thread:%d", s.cachePrefix, threadID))
+
 	threadData, err := s.repo.GetThreadByID(threadID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get created thread: %w", err)
 	}
 
+	s.enforceThreadCap(boardID)
 	s.invalidateCache(boardID)
 	s.InvalidateTopThreadsCache()
-
-	userCacheKey := fmt.Sprintf("user:session:%s", sessionKey)
-	s.redisP.Del(context.Background(), userCacheKey)
-
-	eventData := map[string]interface{}{
-		"thread_id":       threadData.ID,
-		"board_id":        threadData.BoardID,
-		"title":           threadData.Title,
-		"content":         threadData.Content,
-		"created_at":      threadData.CreatedAt,
-		"updated_at":      threadData.UpdatedAt,
-		"created_by":      user.ID,
-		"author_nickname": threadData.AuthorNickname,
-		"messages_count":  threadData.MessagesCount,
-		"timestamp":       time.Now().UTC().Unix(),
-	}
-	s.eventBus.Publish("thread_created", eventData)
+	s.rankThread(threadID, now, now, true)
+
+	userCacheKey := fmt.Sprintf("user:%d", user.ID)
+	s.redisP.CachedDel(context.Background(), userCacheKey)
+
+	s.eventBus.PublishWithContext(ctx, utils.ThreadCreated{
+		ThreadID:       threadData.ID,
+		BoardID:        threadData.BoardID,
+		PostNo:         threadData.PostNo,
+		Title:          threadData.Title,
+		Content:        threadData.Content,
+		Segments:       rawSegments(threadData.Segments),
+		CreatedAt:      threadData.CreatedAt,
+		UpdatedAt:      threadData.UpdatedAt,
+		CreatedBy:      user.ID,
+		AuthorNickname: threadData.AuthorNickname,
+		MessagesCount:  threadData.MessagesCount,
+		Timestamp:      time.Now().UTC().Unix(),
+	})
 	return threadData, nil
 }
 
+// rawSegments encodes segments for an event, leaving the field out when
+// there are none.
+func rawSegments(segments []*markup.Segment) json.RawMessage {
+	if len(segments) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(segments)
+	return data
+}
+
+func validateThread(title, content string) error {
+	titleLength := utf8.RuneCountInString(title)
+	if titleLength < 3 || titleLength > 99 {
+		return utils.Invalid("title", "thread title must be between 3 and 99 characters, got %d", titleLength)
+	}
+	contentLength := utf8.RuneCountInString(content)
+	if contentLength < 3 || contentLength > 999 {
+		return utils.Invalid("content", "thread content must be between 3 and 999 characters, got %d", contentLength)
+	}
+	return nil
+}
+
+func (s *service) EditThread(ctx context.Context, threadID uint64, sessionKey string, req UpdateThreadRequest) (*Thread, error) {
+	if req.Title == nil && req.Content == nil {
+		return nil, utils.Invalid("title", "nothing to change, send a title, content or both")
+	}
+	thread, err := s.repo.GetThreadByID(threadID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.NotFound("thread")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thread: %w", err)
+	}
+	user, err := s.sessionSvc.GetUserBySessionKey(sessionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	isAuthor, err := s.repo.IsUserThreadAuthor(user.ID, threadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check authorship: %w", err)
+	}
+	if !isAuthor {
+		return nil, ErrNotAuthor
+	}
+	window := time.Duration(s.settingsSvc.Current().ThreadEditWindow)
+	if thread.ArchivedAt != nil || time.Since(thread.CreatedAt) > window {
+		return nil, ErrEditWindowClosed
+	}
+	b, err := s.boardSvc.GetBoardByID(thread.BoardID)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.PostingError(); err != nil {
+		return nil, err
+	}
+
+	title, content := thread.Title, thread.Content
+	if req.Title != nil {
+		title = *req.Title
+	}
+	if req.Content != nil {
+		content = *req.Content
+	}
+	if err := validateThread(title, content); err != nil {
+		return nil, err
+	}
+	title = s.settingsSvc.FilterContent(title)
+	content = s.settingsSvc.FilterContent(content)
+
+	editedAt := time.Now().UTC()
+	segments := markup.Parse(content, b.Markup())
+	if err := s.repo.UpdateThread(threadID, title, content, segments, editedAt); err != nil {
+		return nil, fmt.Errorf("failed to update thread: %w", err)
+	}
+
+	s.redisP.CachedDel(ctx, fmt.Sprintf("%s:thread:%d", s.cachePrefix, threadID))
+	s.invalidateCache(thread.BoardID)
+	s.InvalidateTopThreadsCache()
+
+	updated, err := s.GetThreadByID(ctx, threadID)
+	if err != nil {
+		return nil, err
+	}
+	s.eventBus.PublishWithContext(ctx, utils.ThreadUpdated{
+		ThreadID:  threadID,
+		BoardID:   thread.BoardID,
+		Title:     title,
+		Content:   content,
+		Segments:  rawSegments(segments),
+		EditedAt:  editedAt,
+		Timestamp: editedAt.Unix(),
+	})
+	return updated, nil
+}
+
 func (s *service) GetThreadsByBoardID(
 	ctx context.Context,
 	boardID uint64,
 	sort string,
 	page, limit int,
 ) ([]*Thread, int64, error) {
-	validSorts := map[string]bool{"new": true, "popular": true, "active": true}
-	if !validSorts[sort] {
+	if sort == "" {
+		sort = "new"
+		if b, err := s.boardSvc.GetBoardByID(boardID); err == nil {
+			sort = b.SortOr(sort)
+		}
+	}
+	if !board.Sorts[sort] {
 		sort = "new"
 	}
 
@@ -221,6 +379,7 @@ func (s *service) GetThreadsByBoardID(
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to get threads: %w", err)
 	}
+	s.attachLastReplies(threads)
 
 	if len(threads) > 0 && s.attachmentSvc != nil {
 		for _, thread := range threads {
@@ -255,16 +414,91 @@ func (s *service) GetThreadsByBoardID(
 		result.Total = total
 		data, err := json.Marshal(result)
 		if err == nil {
-			s.redisP.SetEX(ctx, cacheKey, data, 5*time.Minute)
+			s.redisP.SetTagged(ctx, s.listTag(boardID, sort), cacheKey, data, 5*time.Minute)
 		}
 	}
 	return threads, total, nil
 }
 
+// archiveCacheTTL is long because the archive only changes when threads are
+// archived or deleted, and those drop the board's archive pages.
+const archiveCacheTTL = time.Hour
+
+// maxArchiveQueryLength caps archive search strings, in characters.
+const maxArchiveQueryLength = 100
+
+func (s *service) archiveTag(boardID uint64) string {
+	return fmt.Sprintf("%s:%d:archive:keys", s.cachePrefix, boardID)
+}
+
+func (s *service) GetArchivedThreads(ctx context.Context, slug, query string, page, limit int) ([]*Thread, int64, error) {
+	query = strings.TrimSpace(query)
+	if n := utf8.RuneCountInString(query); n > maxArchiveQueryLength {
+		return nil, 0, utils.Invalid("q", "q must be at most %d characters, got %d", maxArchiveQueryLength, n)
+	}
+	b, err := s.boardSvc.GetBoardBySlug(slug)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cacheKey := fmt.Sprintf("%s:%d:archive:q:%s:page:%d:limit:%d", s.cachePrefix, b.ID, query, page, limit)
+	var result struct {
+		Threads []*Thread `json:"threads"`
+		Total   int64     `json:"total"`
+	}
+	if cached, err := s.redisP.Get(ctx, cacheKey).Result(); err == nil && cached != "" {
+		if json.Unmarshal([]byte(cached), &result) == nil {
+			return result.Threads, result.Total, nil
+		}
+	}
+
+	threads, total, err := s.repo.GetArchivedThreads(b.ID, query, page, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get archived threads: %w", err)
+	}
+	for _, t := range threads {
+		t.BoardSlug = b.Slug
+	}
+
+	result.Threads = threads
+	result.Total = total
+	if data, err := json.Marshal(result); err == nil {
+		s.redisP.SetTagged(ctx, s.archiveTag(b.ID), cacheKey, data, archiveCacheTTL)
+	}
+	return threads, total, nil
+}
+
+// attachLastReplies loads the preview replies for a whole listing page in
+// one query. A failure only costs the previews.
+func (s *service) attachLastReplies(threads []*Thread) {
+	perThread := s.settingsSvc.Current().PreviewReplies
+	if perThread == 0 || len(threads) == 0 {
+		return
+	}
+	ids := make([]uint64, len(threads))
+	byID := make(map[uint64]*Thread, len(threads))
+	for i, t := range threads {
+		ids[i] = t.ID
+		byID[t.ID] = t
+	}
+	replies, err := s.repo.GetLastReplies(ids, perThread)
+	if err != nil {
+		s.logger.Warnw("Failed to load last replies", "error", err)
+		return
+	}
+	for _, reply := range replies {
+		if t, ok := byID[reply.ThreadID]; ok {
+			t.LastReplies = append(t.LastReplies, reply)
+		}
+	}
+}
+
 func (s *service) GetThreadByID(ctx context.Context, threadID uint64) (*Thread, error) {
 	cacheKey := fmt.Sprintf("%s:thread:%d", s.cachePrefix, threadID)
-	cmd := s.redisP.Get(ctx, cacheKey)
-	cachedData, err := cmd.Result()
+	cachedData, err := s.redisP.CachedGet(ctx, cacheKey)
+	if cachedData == redis.NotFound {
+		return nil, utils.NotFound("thread")
+	}
 	var thread Thread
 	if err == nil && cachedData != "" {
 		if json.Unmarshal([]byte(cachedData), &thread) == nil {
@@ -273,6 +507,10 @@ func (s *service) GetThreadByID(ctx context.Context, threadID uint64) (*Thread,
 	}
 
 	threadData, err := s.repo.GetThreadByID(threadID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		s.redisP.CachedSet(ctx, cacheKey, []byte(redis.NotFound), redis.NotFoundTTL)
+		return nil, utils.NotFound("thread")
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get thread: %w", err)
 	}
@@ -303,7 +541,7 @@ func (s *service) GetThreadByID(ctx context.Context, threadID uint64) (*Thread,
 		}
 		data, err := json.Marshal(threadData)
 		if err == nil {
-			s.redisP.SetEX(ctx, cacheKey, data, 5*time.Minute)
+			s.redisP.CachedSet(ctx, cacheKey, data, 5*time.Minute)
 		}
 	}
 	return threadData, nil
@@ -313,38 +551,59 @@ func (s *service) InvalidateThreadsCache(boardID uint64) {
 	s.invalidateCache(boardID)
 }
 
+// Listing pages are cached under one key per page and limit; each key is
+// also recorded in a tag set per board and sort (see redis.SetTagged), so
+// invalidation deletes exactly those keys instead of scanning for them.
+func (s *service) listTag(boardID uint64, sort string) string {
+	return fmt.Sprintf("%s:%d:sort:%s:keys", s.cachePrefix, boardID, sort)
+}
+
+func topTag(sort string) string {
+	return fmt.Sprintf("threads:top:sort:%s:keys", sort)
+}
+
 func (s *service) invalidateCache(boardID uint64) {
-	ctx := context.Background()
-	pattern := fmt.Sprintf("%s:%d:sort:*", s.cachePrefix, boardID)
-	var cursor uint64
-	deletedCount := 0
-	for {
-		keys, cur, err := s.redisP.Scan(ctx, cursor, pattern, 100).Result()
-		if err != nil {
-			s.logger.Warnw("Redis scan failed during cache invalidation", "error", err, "pattern", pattern)
-			return
-		}
-		if len(keys) > 0 {
-			n, err := s.redisP.Del(ctx, keys...).Result()
-			if err != nil {
-				s.logger.Warnw("Failed to delete cache keys", "error", err, "keys", keys)
-			} else {
-				deletedCount += int(n)
-			}
-		}
-		if cur == 0 {
-			break
-		}
-		cursor = cur
+	tags := make([]string, 0, len(listSorts))
+	for _, sort := range listSorts {
+		tags = append(tags, s.listTag(boardID, sort))
 	}
-	if deletedCount > 0 {
-		s.logger.Debugw("Thread list cache invalidated", "board_id", boardID, "deleted_keys", deletedCount)
+	if n := s.deleteTagged(tags...); n > 0 {
+		s.logger.Debugw("Thread list cache invalidated", "board_id", boardID, "deleted_keys", n)
 	}
 }
 
+// InvalidateAfterReply: every reply changes the thread's own cached counts
+// and the "popular" order. Only a bump also reorders "active" and moves the
+// thread to the top of the board, so after a sage reply or one past the bump
+// limit the other listings keep their cache until it expires, unless they
+// show reply previews, which every reply changes.
+func (s *service) InvalidateAfterReply(boardID, threadID uint64, bumped bool) {
+	s.redisP.CachedDel(context.Background(), fmt.Sprintf("%s:thread:%d", s.cachePrefix, threadID))
+	if !bumped && s.settingsSvc.Current().PreviewReplies > 0 {
+		s.invalidateCache(boardID)
+		s.deleteTagged(topTag("popular"))
+		return
+	}
+	if bumped {
+		s.invalidateCache(boardID)
+		s.InvalidateTopThreadsCache()
+		s.rankThread(threadID, time.Time{}, time.Now(), false)
+		return
+	}
+	s.deleteTagged(s.listTag(boardID, "popular"), topTag("popular"))
+}
+
+// deleteTagged drops the keys under tags and returns how many went.
+func (s *service) deleteTagged(tags ...string) int {
+	n, err := s.redisP.DeleteTagged(context.Background(), tags...)
+	if err != nil {
+		s.logger.Warnw("Failed to invalidate cache", "tags", tags, "error", err)
+	}
+	return n
+}
+
 func (s *service) GetTopThreads(ctx context.Context, sort string, page, limit int) ([]*Thread, int64, error) {
-	validSorts := map[string]bool{"new": true, "popular": true, "active": true}
-	if !validSorts[sort] {
+	if !board.Sorts[sort] {
 		sort = "new"
 	}
 
@@ -368,9 +627,12 @@ func (s *service) GetTopThreads(ctx context.Context, sort string, page, limit in
 		}
 	}
 
-	threads, total, err := s.repo.GetTopThreads(sort, page, limit)
-	if err != nil {
-		return nil, 0, err
+	threads, total, ranked := s.topFromRanking(ctx, sort, page, limit)
+	if !ranked {
+		threads, total, err = s.repo.GetTopThreads(sort, page, limit)
+		if err != nil {
+			return nil, 0, err
+		}
 	}
 
 	for _, t := range threads {
@@ -398,41 +660,92 @@ func (s *service) GetTopThreads(ctx context.Context, sort string, page, limit in
 		result.Threads = threads
 		result.Total = total
 		data, _ := json.Marshal(result)
-		s.redisP.SetEX(ctx, cacheKey, data, 5*time.Minute)
+		s.redisP.SetTagged(ctx, topTag(sort), cacheKey, data, 5*time.Minute)
 	}
 
 	return threads, total, nil
 }
 
 func (s *service) InvalidateTopThreadsCache() {
-	ctx := context.Background()
-	pattern := "threads:top:sort:*:page:*:limit:*"
-	var cursor uint64
-	deletedCount := 0
-	for {
-		keys, cur, err := s.redisP.Scan(ctx, cursor, pattern, 100).Result()
-		if err != nil {
-			s.logger.Warnw("Redis scan failed during top threads cache invalidation", "error", err, "pattern", pattern)
-			return
-		}
-		if len(keys) > 0 {
-			n, err := s.redisP.Del(ctx, keys...).Result()
-			if err != nil {
-				s.logger.Warnw("Failed to delete top threads cache keys", "error", err, "keys", keys)
-			} else {
-				deletedCount += int(n)
-			}
-		}
-		if cur == 0 {
-			break
-		}
-		cursor = cur
+	tags := make([]string, 0, len(listSorts))
+	for _, sort := range listSorts {
+		tags = append(tags, topTag(sort))
 	}
-	if deletedCount > 0 {
-		s.logger.Debugw("Top threads cache invalidated", "deleted_keys", deletedCount)
+	if n := s.deleteTagged(tags...); n > 0 {
+		s.logger.Debugw("Top threads cache invalidated", "deleted_keys", n)
 	}
 }
 
 func (s *service) IsUserAuthor(ctx context.Context, userID uint64, threadID uint64) (bool, error) {
 	return s.repo.IsUserThreadAuthor(userID, threadID)
 }
+
+// enforceThreadCap archives the least recently bumped threads of a board
+// that has gone over its max_threads. The caller drops the board's caches.
+func (s *service) enforceThreadCap(boardID uint64) {
+	b, err := s.boardSvc.GetBoardByID(boardID)
+	if err != nil || b.MaxThreads == nil {
+		return
+	}
+	archived, err := s.repo.ArchiveThreadsOverCap(boardID, *b.MaxThreads)
+	if err != nil {
+		s.logger.Errorw("Failed to enforce thread cap", "board_id", boardID, "error", err)
+		return
+	}
+	if archived > 0 {
+		s.deleteTagged(s.archiveTag(boardID))
+		s.logger.Infow("Archived threads over the board cap", "board_id", boardID, "count", archived, "max_threads", *b.MaxThreads)
+	}
+}
+
+func (s *service) SetDeleted(ctx context.Context, slug string, threadID uint64, deletedBy *string) error {
+	b, err := s.boardSvc.GetBoardBySlug(slug)
+	if err != nil {
+		return err
+	}
+	changed, err := s.repo.SetDeleted(b.ID, threadID, deletedBy)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.NotFound("thread")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update thread: %w", err)
+	}
+	if !changed {
+		return nil
+	}
+
+	s.redisP.CachedDel(ctx, fmt.Sprintf("%s:thread:%d", s.cachePrefix, threadID))
+	s.invalidateCache(b.ID)
+	s.deleteTagged(s.archiveTag(b.ID))
+	s.InvalidateTopThreadsCache()
+	if deletedBy != nil {
+		s.unrankThread(threadID)
+		s.logger.Infow("Thread deleted", "thread_id", threadID, "board_id", b.ID, "deleted_by", *deletedBy)
+	} else {
+		s.logger.Infow("Thread restored", "thread_id", threadID, "board_id", b.ID)
+	}
+	return nil
+}
+
+func (s *service) ArchiveInactiveThreads(ctx context.Context, maxAge time.Duration) (int, error) {
+	boardIDs, err := s.repo.ArchiveInactiveThreads(time.Now().Add(-maxAge))
+	if err != nil {
+		return 0, fmt.Errorf("failed to archive threads: %w", err)
+	}
+	if len(boardIDs) == 0 {
+		return 0, nil
+	}
+
+	seen := make(map[uint64]bool)
+	for _, boardID := range boardIDs {
+		if !seen[boardID] {
+			seen[boardID] = true
+			s.invalidateCache(boardID)
+			s.deleteTagged(s.archiveTag(boardID))
+		}
+	}
+	s.InvalidateTopThreadsCache()
+
+	s.logger.Infow("Archived inactive threads", "count", len(boardIDs), "boards", len(seen))
+	return len(boardIDs), nil
+}
@@ -0,0 +1,41 @@
+package thread
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// trendingPosterWeight is how much more a distinct poster counts than a
+	// single reply, so one user talking to themselves does not trend.
+	trendingPosterWeight = 2
+	// trendingWindow is how many half-lives of replies are scored; older
+	// replies weigh less than 1/16 and are left out.
+	trendingWindow = 4
+)
+
+// listSorts are the orders thread listings are cached under.
+var listSorts = append(append([]string{}, rankingSorts...), "trending")
+
+// RecomputeTrending scores every thread by its recent replies and distinct
+// posters, each weight halved for every halfLife since the post, and drops
+// the trending listings of the boards whose scores changed.
+func (s *service) RecomputeTrending(ctx context.Context, halfLife time.Duration) (int, error) {
+	since := time.Now().Add(-trendingWindow * halfLife)
+	boardIDs, err := s.repo.UpdateTrendingScores(since, halfLife, trendingPosterWeight)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update trending scores: %w", err)
+	}
+	if len(boardIDs) == 0 {
+		return 0, nil
+	}
+
+	tags := make([]string, 0, len(boardIDs)+1)
+	for _, boardID := range boardIDs {
+		tags = append(tags, s.listTag(boardID, "trending"))
+	}
+	tags = append(tags, topTag("trending"))
+	s.deleteTagged(tags...)
+	return len(boardIDs), nil
+}
@@ -1,33 +1,21 @@
 package upload
 
 import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
 	"backend/internal/app/attachment"
+	"backend/internal/app/board"
+	"backend/internal/app/session"
 	"backend/internal/providers/minio"
+	"backend/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
-// @Summary Upload files
-// @Description Upload files to MinIO storage
-// @Tags Upload
-// @Accept multipart/form-data
-// @Produce json
-// @Param files formData array true "Files to upload"
-// @Success 200 {array} UploadedFileResponse
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/upload [post]
-//
-// @Summary Confirm file uploads
-// @Description Confirm temporary file uploads to make them permanent
-// @Tags Upload
-// @Accept json
-// @Produce json
-// @Param request body ConfirmFilesRequest true "File confirmation request"
-// @Success 200 {object} ConfirmFilesResponse
-// @Failure 400 {object} map[string]string
-// @Router /api/upload/confirm [post]
 type UploadedFileResponse struct {
 	ID          string `json:"id"`
 	Name        string `json:"name"`
@@ -38,16 +26,29 @@ type UploadedFileResponse struct {
 }
 
 type Handler struct {
-	minioP *minio.MinioProvider
-	attSvc attachment.Service
-	logger *zap.Logger
+	minioP     *minio.MinioProvider
+	attSvc     attachment.Service
+	boardSvc   board.Service
+	sessionSvc session.Service
+	eventBus   *utils.EventBus
+	logger     *zap.Logger
 }
 
-func NewHandler(minioP *minio.MinioProvider, attSvc attachment.Service, logger *zap.Logger) *Handler {
+func NewHandler(
+	minioP *minio.MinioProvider,
+	attSvc attachment.Service,
+	boardSvc board.Service,
+	sessionSvc session.Service,
+	eventBus *utils.EventBus,
+	logger *zap.Logger,
+) *Handler {
 	return &Handler{
-		minioP: minioP,
-		attSvc: attSvc,
-		logger: logger,
+		minioP:     minioP,
+		attSvc:     attSvc,
+		boardSvc:   boardSvc,
+		sessionSvc: sessionSvc,
+		eventBus:   eventBus,
+		logger:     logger,
 	}
 }
 
@@ -57,57 +58,109 @@ func NewHandler(minioP *minio.MinioProvider, attSvc attachment.Service, logger *
 // @Accept multipart/form-data
 // @Produce json
 // @Param files formData array true "Files to upload"
+// @Param board_id query int false "Board ID whose file policy applies"
+// @Security BearerAuth
+// @Param upload_id query string false "Client-chosen ID echoed in upload_progress events"
+// @Param Idempotency-Key header string false "Replays the original response to retries with the same key"
 // @Success 200 {array} UploadedFileResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/upload [post]
 func (h *Handler) Upload(c *gin.Context) {
 	if h.minioP == nil {
-		c.JSON(503, ErrorResponse{Error: "MinIO not configured"})
+		utils.RespondError(c, 503, "MinIO not configured")
 		return
 	}
 
 	form, err := c.MultipartForm()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(413, ErrorResponse{
+			Code:    utils.CodeTooLarge,
+			Message: "upload too large",
+			Details: gin.H{"max_bytes": tooLarge.Limit},
+		})
+		return
+	}
 	if err != nil {
 		h.logger.Error("Failed to parse multipart form", zap.Error(err))
-		c.JSON(400, ErrorResponse{Error: "Failed to parse form"})
+		utils.RespondError(c, 400, "Failed to parse form")
 		return
 	}
 
 	files := form.File["files"]
 	if len(files) == 0 {
-		c.JSON(400, ErrorResponse{Error: "No files provided"})
+		utils.RespondError(c, 400, "No files provided")
 		return
 	}
 
+	policy, ok := h.resolvePolicy(c)
+	if !ok {
+		return
+	}
+
+	if err := policy.ValidateCount(len(files)); err != nil {
+		utils.RespondError(c, 400, err.Error())
+		return
+	}
+
+	contentTypes := make([]string, len(files))
+	for i, fileHeader := range files {
+		contentType, err := minio.SniffFile(fileHeader)
+		if err != nil {
+			utils.RespondError(c, 400, err.Error())
+			return
+		}
+		contentTypes[i] = contentType
+		if err := policy.ValidateFile(fileHeader.Filename, fileHeader.Size, contentTypes[i]); err != nil {
+			utils.RespondError(c, 400, err.Error())
+			return
+		}
+	}
+
+	progress := h.progressPublisher(c)
 	uploadedFiles := make([]*UploadedFileResponse, 0, len(files))
 
-	for _, fileHeader := range files {
+	for i, fileHeader := range files {
 		src, err := fileHeader.Open()
 		if err != nil {
 			h.logger.Error("Failed to open file", zap.String("filename", fileHeader.Filename), zap.Error(err))
+			progress.publish(i, fileHeader.Filename, "failed", 0, fileHeader.Size, 0)
 			continue
 		}
 
+		var reader io.Reader = src
+		if progress != nil {
+			index, name, total := i, fileHeader.Filename, fileHeader.Size
+			reader = newProgressReader(src, total, func(read int64, percent int) {
+				progress.publish(index, name, "uploading", read, total, percent)
+			})
+		}
+
 		result, err := h.minioP.UploadFromReader(
-			src,
+			reader,
 			"tmp/"+generateObjectName(fileHeader.Filename),
-			fileHeader.Header.Get("Content-Type"),
+			contentTypes[i],
 			fileHeader.Size,
 		)
 		src.Close()
 
 		if err != nil {
 			h.logger.Error("Failed to upload file", zap.String("filename", fileHeader.Filename), zap.Error(err))
+			progress.publish(i, fileHeader.Filename, "failed", 0, fileHeader.Size, 0)
 			continue
 		}
+		progress.publish(i, fileHeader.Filename, "done", fileHeader.Size, fileHeader.Size, 100)
 
 		att, err := h.attSvc.CreateTemporary(c.Request.Context(), &attachment.CreateAttachmentRequest{
 			FileID:      result.ID,
 			FileName:    fileHeader.Filename,
 			FileURL:     result.URL,
 			FileSize:    fileHeader.Size,
-			ContentType: fileHeader.Header.Get("Content-Type"),
+			ContentType: contentTypes[i],
 			ObjectName:  result.ObjectName,
 		})
 		if err != nil {
@@ -126,7 +179,7 @@ func (h *Handler) Upload(c *gin.Context) {
 	}
 
 	if len(uploadedFiles) == 0 {
-		c.JSON(500, ErrorResponse{Error: "Failed to upload any files"})
+		utils.RespondError(c, 500, "Failed to upload any files")
 		return
 	}
 
@@ -144,25 +197,25 @@ func (h *Handler) Upload(c *gin.Context) {
 // @Router /api/upload/confirm [post]
 func (h *Handler) ConfirmFiles(c *gin.Context) {
 	if h.minioP == nil {
-		c.JSON(503, ErrorResponse{Error: "MinIO not configured"})
+		utils.RespondError(c, 503, "MinIO not configured")
 		return
 	}
 
 	var req ConfirmFilesRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(400, ErrorResponse{Error: "Invalid request"})
+		utils.RespondError(c, 400, "Invalid request")
 		return
 	}
 
 	if len(req.FileIDs) == 0 {
-		c.JSON(400, ErrorResponse{Error: "No file IDs provided"})
+		utils.RespondError(c, 400, "No file IDs provided")
 		return
 	}
 
 	attachments, err := h.attSvc.GetByFileIDs(c.Request.Context(), req.FileIDs)
 	if err != nil {
 		h.logger.Error("Failed to get attachments", zap.Error(err))
-		c.JSON(500, ErrorResponse{Error: "Failed to get attachments"})
+		utils.RespondError(c, 500, "Failed to get attachments")
 		return
 	}
 
@@ -217,6 +270,73 @@ func (h *Handler) ConfirmFiles(c *gin.Context) {
 	c.JSON(200, response)
 }
 
+// progressPublisher returns nil unless the request identifies a session,
+// since progress events are only delivered to the uploader's own sockets.
+func (h *Handler) progressPublisher(c *gin.Context) *progressPublisher {
+	sessionKey := session.Key(c)
+	if sessionKey == "" || h.sessionSvc == nil || h.eventBus == nil {
+		return nil
+	}
+
+	u, err := h.sessionSvc.GetUserBySessionKey(sessionKey)
+	if err != nil {
+		return nil
+	}
+
+	return &progressPublisher{
+		eventBus: h.eventBus,
+		userID:   u.ID,
+		uploadID: c.Query("upload_id"),
+	}
+}
+
+func (h *Handler) resolvePolicy(c *gin.Context) (minio.FilePolicy, bool) {
+	policy := h.minioP.DefaultPolicy()
+
+	boardIDStr := c.Query("board_id")
+	if boardIDStr == "" {
+		boardIDStr = c.PostForm("board_id")
+	}
+	if boardIDStr == "" || h.boardSvc == nil {
+		return policy, true
+	}
+
+	boardID, err := strconv.ParseUint(boardIDStr, 10, 64)
+	if err != nil {
+		utils.RespondError(c, 400, "invalid board ID")
+		return policy, false
+	}
+
+	b, err := h.boardSvc.GetBoardByID(boardID)
+	if err != nil {
+		utils.RespondError(c, 404, "board not found")
+		return policy, false
+	}
+
+	return b.FilePolicy(policy), true
+}
+
+// multipartOverhead covers form field headers and boundaries on top of the
+// file bytes themselves.
+const multipartOverhead = 1 << 20
+
+// MaxUploadSize is the largest multipart body an upload may send: every
+// file the policy allows at its maximum size. It only looks at board_id in
+// the query, since the form itself has not been read yet, and returns 0 when
+// uploads are disabled.
+func (h *Handler) MaxUploadSize(c *gin.Context) int64 {
+	if h.minioP == nil {
+		return 0
+	}
+	policy := h.minioP.DefaultPolicy()
+	if boardID, err := strconv.ParseUint(c.Query("board_id"), 10, 64); err == nil && h.boardSvc != nil {
+		if b, err := h.boardSvc.GetBoardByID(boardID); err == nil {
+			policy = b.FilePolicy(policy)
+		}
+	}
+	return policy.MaxFileSize*int64(policy.MaxFiles) + multipartOverhead
+}
+
 func isTmpObject(objectName string) bool {
 	return len(objectName) >= 4 && objectName[:4] == "tmp/"
 }
@@ -1,5 +1,7 @@
 package upload
 
+import "backend/internal/utils"
+
 type ConfirmFilesRequest struct {
 	FileIDs []string `json:"file_ids"`
 }
@@ -8,6 +10,4 @@ type ConfirmFilesResponse struct {
 	Files []UploadedFileResponse `json:"files"`
 }
 
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
+type ErrorResponse = utils.ErrorResponse
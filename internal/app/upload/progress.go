@@ -0,0 +1,80 @@
+package upload
+
+import (
+	"io"
+	"mime/multipart"
+	"time"
+
+	"backend/internal/utils"
+)
+
+const (
+	progressInterval = 250 * time.Millisecond
+	progressStep     = 5
+)
+
+// progressReader reports how much of a file has been streamed to storage.
+// Events are throttled to one per progressInterval or progressStep percent,
+// whichever comes first.
+type progressReader struct {
+	src      multipart.File
+	report   func(read int64, percent int)
+	total    int64
+	read     int64
+	lastPct  int
+	lastSent time.Time
+}
+
+func newProgressReader(src multipart.File, total int64, report func(read int64, percent int)) *progressReader {
+	return &progressReader{src: src, total: total, report: report, lastPct: -1}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.src.Read(b)
+	p.read += int64(n)
+
+	pct := 100
+	if p.total > 0 {
+		pct = int(p.read * 100 / p.total)
+	}
+	if pct >= p.lastPct+progressStep || time.Since(p.lastSent) >= progressInterval || (err == io.EOF && pct != p.lastPct) {
+		p.lastPct = pct
+		p.lastSent = time.Now()
+		p.report(p.read, pct)
+	}
+	return n, err
+}
+
+// Seek lets the storage layer rewind the file when it retries an upload;
+// progress restarts from the new offset.
+func (p *progressReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := p.src.Seek(offset, whence)
+	if err == nil {
+		p.read = pos
+		p.lastPct = -1
+	}
+	return pos, err
+}
+
+type progressPublisher struct {
+	eventBus *utils.EventBus
+	userID   uint64
+	uploadID string
+}
+
+func (p *progressPublisher) publish(index int, filename, status string, read, total int64, percent int) {
+	if p == nil {
+		return
+	}
+	p.eventBus.Publish(utils.UploadProgress{
+		UserID:    p.userID,
+		UploadID:  p.uploadID,
+		FileIndex: index,
+		FileName:  filename,
+		Status:    status,
+		Bytes:     read,
+		Total:     total,
+		Percent:   percent,
+		Timestamp: time.Now().Unix(),
+	})
+}
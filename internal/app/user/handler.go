@@ -2,6 +2,7 @@ package user
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"regexp"
@@ -27,6 +28,9 @@ type Handler interface {
 	GetUser(c *gin.Context)
 	UpdateNickname(c *gin.Context)
 	GetCooldown(c *gin.Context)
+	GetBoardStats(c *gin.Context)
+	GetSettings(c *gin.Context)
+	UpdateSettings(c *gin.Context)
 }
 
 func NewHandler(
@@ -50,24 +54,24 @@ func NewHandler(
 // @Tags User
 // @Accept json
 // @Produce json
-// @Param session_key query string true "Session key"
+// @Security BearerAuth
 // @Success 200 {object} UserResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Router /api/user [get]
 func (h *handler) GetUser(c *gin.Context) {
-	sessionKey := c.Query("session_key")
+	sessionKey := session.Key(c)
 	if sessionKey == "" {
-		h.logger.Warnw("GetUser: session_key missing")
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "session_key is required"})
+		h.logger.Warnw("GetUser: session missing")
+		utils.RespondError(c, http.StatusBadRequest, "session is required")
 		return
 	}
 
 	ctx := c.Request.Context()
 	userResp, err := h.service.GetUserWithSession(ctx, sessionKey)
 	if err != nil {
-		h.logger.Warnw("GetUser: failed to get user", "session_key", sessionKey, "error", err)
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "user not found"})
+		h.logger.Warnw("GetUser: failed to get user", "error", err)
+		utils.RespondError(c, http.StatusNotFound, "user not found")
 		return
 	}
 
@@ -80,65 +84,80 @@ func (h *handler) GetUser(c *gin.Context) {
 // @Tags User
 // @Accept json
 // @Produce json
+// @Security BearerAuth
 // @Param request body UpdateNicknameRequest true "Nickname update request"
 // @Success 200 {object} NicknameUpdateResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Router /api/user/nickname [patch]
 func (h *handler) UpdateNickname(c *gin.Context) {
 	var req UpdateNicknameRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.logger.Warnw("UpdateNickname: invalid request", "error", err)
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Ник должен быть 1-16 символов"})
+		utils.RespondError(c, http.StatusBadRequest, "Ник должен быть 1-16 символов")
 		return
 	}
 
 	matched, err := regexp.MatchString(`^[\p{L}\p{N}]+$`, req.Nickname)
 	if err != nil {
 		h.logger.Errorw("UpdateNickname: regex failed", "error", err)
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to validate nickname"})
+		utils.RespondError(c, http.StatusInternalServerError, "failed to validate nickname")
 		return
 	}
 	if !matched {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Ник должен содержать только буквы и цифры (без пробелов и символов)"})
+		utils.RespondError(c, http.StatusBadRequest, "Ник должен содержать только буквы и цифры (без пробелов и символов)")
+		return
+	}
+
+	sessionKey := session.KeyOr(c, req.SessionKey)
+	if sessionKey == "" {
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
 		return
 	}
 
-	session, err := h.sessionSvc.GetSessionByKey(req.SessionKey)
+	session, err := h.sessionSvc.GetSessionByKey(sessionKey)
 	if err != nil {
-		h.logger.Warnw("UpdateNickname: session not found", "session_key", req.SessionKey)
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "session not found"})
+		h.logger.Warnw("UpdateNickname: session not found")
+		utils.RespondError(c, http.StatusNotFound, "session not found")
 		return
 	}
 
 	if err := h.service.UpdateNickname(session.UserID, req.Nickname); err != nil {
-		if err.Error() == "nickname can only be changed once per minute" {
+		var cooldownErr *utils.CooldownError
+		if errors.As(err, &cooldownErr) {
 			h.logger.Warnw("UpdateNickname: rate limited", "user_id", session.UserID)
-			c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: "Менять ник можно не чаще раза в минуту"})
+			utils.SetCooldownHeaders(c.Writer.Header(), cooldownErr.Remaining)
+			c.JSON(http.StatusTooManyRequests, ErrorResponse{
+				Code:    utils.CodeCooldown,
+				Message: fmt.Sprintf("Менять ник можно не чаще раза в %s", h.service.NicknameCooldown()),
+				Details: gin.H{"seconds_left": cooldownErr.SecondsLeft()},
+			})
 			return
 		}
 		h.logger.Errorw("UpdateNickname: failed to update in DB", "user_id", session.UserID, "error", err)
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to update nickname"})
+		utils.RespondError(c, http.StatusInternalServerError, "failed to update nickname")
 		return
 	}
 
-	cacheKey := fmt.Sprintf("user:session:%s", req.SessionKey)
-	h.redisP.Del(context.Background(), cacheKey)
+	cacheKey := fmt.Sprintf("user:%d", session.UserID)
+	h.redisP.CachedDel(context.Background(), cacheKey)
 
 	h.logger.Infow("UpdateNickname: DB updated", "user_id", session.UserID, "new_nickname", req.Nickname)
-	eventData := map[string]interface{}{
-		"user_id":   int(session.UserID),
-		"nickname":  req.Nickname,
-		"timestamp": time.Now().UTC().Unix(),
+	event := utils.NicknameUpdated{
+		UserID:    session.UserID,
+		Nickname:  req.Nickname,
+		Timestamp: time.Now().UTC().Unix(),
 	}
-	h.logger.Infow("UpdateNickname: publishing event", "event", "nickname_updated", "data", eventData)
-	h.eventBus.Publish("nickname_updated", eventData)
+	h.logger.Infow("UpdateNickname: publishing event", "event", event.EventName(), "data", event, "request_id", c.GetString("request_id"))
+	h.eventBus.PublishWithContext(c.Request.Context(), event)
 
+	utils.SetCooldownHeaders(c.Writer.Header(), h.service.NicknameCooldown())
 	c.JSON(http.StatusOK, NicknameUpdateResponse{
 		ID:                     session.UserID,
 		Nickname:               req.Nickname,
 		CreatedAt:              time.Now().UTC(),
-		SessionKey:             req.SessionKey,
+		SessionKey:             sessionKey,
 		MessagesCount:          0,
 		ThreadsCount:           0,
 		LastNicknameChangeUnix: time.Now().UTC().Unix(),
@@ -146,33 +165,33 @@ func (h *handler) UpdateNickname(c *gin.Context) {
 }
 
 // @Summary Get nickname change cooldown
-// @Description Get the timestamp of the last nickname change
+// @Description Get the timestamp of the last nickname change and the current cooldown length
 // @Tags User
 // @Accept json
 // @Produce json
-// @Param session_key query string true "Session key"
+// @Security BearerAuth
 // @Success 200 {object} CooldownResponse
 // @Failure 401 {object} ErrorResponse
 // @Router /api/user/cooldown [get]
 func (h *handler) GetCooldown(c *gin.Context) {
-	sessionKey := c.Query("session_key")
+	sessionKey := session.Key(c)
 	if sessionKey == "" {
-		h.logger.Warnw("GetCooldown: session_key missing")
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "session_key is required"})
+		h.logger.Warnw("GetCooldown: session missing")
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
 		return
 	}
 
 	session, err := h.sessionSvc.GetSessionByKey(sessionKey)
 	if err != nil {
-		h.logger.Warnw("GetCooldown: session not found", "session_key", sessionKey)
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "session not found"})
+		h.logger.Warnw("GetCooldown: session not found")
+		utils.RespondError(c, http.StatusNotFound, "session not found")
 		return
 	}
 
 	lastChange, err := h.service.GetUserLastNicknameChange(session.UserID)
 	if err != nil {
 		h.logger.Errorw("GetCooldown: failed to get last nickname change", "user_id", session.UserID, "error", err)
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to get last nickname change"})
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get last nickname change")
 		return
 	}
 
@@ -184,5 +203,111 @@ func (h *handler) GetCooldown(c *gin.Context) {
 
 	c.JSON(http.StatusOK, CooldownResponse{
 		LastNicknameChangeUnix: lastChangeUnix,
+		CooldownSeconds:        int64(h.service.NicknameCooldown().Seconds()),
 	})
 }
+
+// @Summary Get per-board user statistics
+// @Description Get the current user's thread and message counts broken down by board, most active first
+// @Tags User
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} BoardStatsResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/user/stats/boards [get]
+func (h *handler) GetBoardStats(c *gin.Context) {
+	sessionKey := session.Key(c)
+	if sessionKey == "" {
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
+		return
+	}
+
+	sess, err := h.sessionSvc.GetSessionByKey(sessionKey)
+	if err != nil {
+		utils.RespondError(c, http.StatusNotFound, "session not found")
+		return
+	}
+
+	stats, err := h.service.GetBoardStats(sess.UserID)
+	if err != nil {
+		h.logger.Errorw("GetBoardStats: failed to get stats", "user_id", sess.UserID, "error", err)
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get board stats")
+		return
+	}
+
+	c.JSON(http.StatusOK, BoardStatsResponse{Boards: stats})
+}
+
+// @Summary Get user settings
+// @Description Get the current user's preferences (theme, NSFW visibility, hidden boards, timezone), shared by all of their sessions
+// @Tags User
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} Settings
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/user/settings [get]
+func (h *handler) GetSettings(c *gin.Context) {
+	sessionKey := session.Key(c)
+	if sessionKey == "" {
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
+		return
+	}
+
+	sess, err := h.sessionSvc.GetSessionByKey(sessionKey)
+	if err != nil {
+		utils.RespondError(c, http.StatusNotFound, "session not found")
+		return
+	}
+
+	settings, err := h.service.GetSettings(sess.UserID)
+	if err != nil {
+		h.logger.Errorw("GetSettings: failed to get settings", "user_id", sess.UserID, "error", err)
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get settings")
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// @Summary Update user settings
+// @Description Replace the current user's preferences; every device of the user gets them with GET /api/user
+// @Tags User
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body UpdateSettingsRequest true "New settings"
+// @Success 200 {object} Settings
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/user/settings [put]
+func (h *handler) UpdateSettings(c *gin.Context) {
+	var req UpdateSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	sessionKey := session.Key(c)
+	if sessionKey == "" {
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
+		return
+	}
+
+	sess, err := h.sessionSvc.GetSessionByKey(sessionKey)
+	if err != nil {
+		utils.RespondError(c, http.StatusNotFound, "session not found")
+		return
+	}
+
+	settings, err := h.service.UpdateSettings(c.Request.Context(), sess.UserID, req)
+	if err != nil {
+		h.logger.Warnw("UpdateSettings: failed", "user_id", sess.UserID, "error", err)
+		utils.WriteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
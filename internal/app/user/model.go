@@ -1,10 +1,14 @@
 package user
 
-import "time"
+import (
+	"time"
+
+	"backend/internal/utils"
+)
 
 type User struct {
 	ID                   uint64     `gorm:"primaryKey"`
-	IP                   string     `gorm:"type:inet;not null;unique"`
+	IP                   string     `gorm:"type:text;not null;unique"`
 	Nickname             string     `gorm:"not null;default:'Аноним'"`
 	LastNicknameChangeAt *time.Time `gorm:"column:last_nickname_change"`
 	CreatedAt            time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP"`
@@ -25,8 +29,82 @@ func (UserActivity) TableName() string {
 	return "user_activity"
 }
 
+// UserBoardActivity is UserActivity broken down by board. The posting
+// transactions keep it up to date alongside user_activity.
+type UserBoardActivity struct {
+	UserID        uint64 `gorm:"primaryKey"`
+	BoardID       uint64 `gorm:"primaryKey;index"`
+	ThreadCount   int    `gorm:"not null;default:0"`
+	MessageCount  int    `gorm:"not null;default:0"`
+	LastThreadAt  *time.Time
+	LastMessageAt *time.Time
+	CreatedAt     time.Time `gorm:"not null;default:CURRENT_TIMESTAMP"`
+	UpdatedAt     time.Time `gorm:"not null;default:CURRENT_TIMESTAMP"`
+}
+
+func (UserBoardActivity) TableName() string {
+	return "user_board_activity"
+}
+
+// BoardActivitySelect computes user_board_activity rows (user_id, board_id,
+// thread_count, message_count, last_thread_at, last_message_at) from the
+// threads and messages tables, for rebuilding and seeding the counters.
+const BoardActivitySelect = `
+	SELECT user_id, board_id, SUM(threads) AS thread_count, SUM(messages) AS message_count,
+		MAX(last_thread_at) AS last_thread_at, MAX(last_message_at) AS last_message_at
+	FROM (
+		SELECT sessions.user_id, threads.board_id, 1 AS threads, 0 AS messages,
+			threads.created_at AS last_thread_at, NULL::timestamptz AS last_message_at
+		FROM threads JOIN sessions ON sessions.id = threads.created_by_session_id
+		UNION ALL
+		SELECT sessions.user_id, threads.board_id, 0, 1, NULL, messages.created_at
+		FROM messages
+		JOIN threads ON threads.id = messages.thread_id
+		JOIN sessions ON sessions.id = messages.created_by_session_id
+	) posts
+	GROUP BY user_id, board_id`
+
+// Settings are a user's client preferences, kept on the server so every
+// device of the same anon gets them. A user without a row has the defaults.
+type Settings struct {
+	UserID       uint64    `json:"-" gorm:"primaryKey"`
+	Theme        string    `json:"theme" gorm:"type:varchar(32);not null;default:''"`
+	ShowNSFW     bool      `json:"show_nsfw" gorm:"column:show_nsfw;not null;default:false"`
+	HiddenBoards []string  `json:"hidden_boards" gorm:"type:jsonb;serializer:json"`
+	Timezone     string    `json:"timezone" gorm:"type:varchar(64);not null;default:''"`
+	UpdatedAt    time.Time `json:"updated_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
+}
+
+func (Settings) TableName() string {
+	return "user_settings"
+}
+
+// UpdateSettingsRequest replaces all of the user's settings. Timezone is an
+// IANA name such as "Europe/Moscow"; empty leaves it to the client.
+type UpdateSettingsRequest struct {
+	Theme        string   `json:"theme" binding:"max=32"`
+	ShowNSFW     bool     `json:"show_nsfw"`
+	HiddenBoards []string `json:"hidden_boards" binding:"max=100,dive,min=1,max=32"`
+	Timezone     string   `json:"timezone" binding:"max=64"`
+}
+
+type BoardStats struct {
+	BoardID       uint64     `json:"board_id"`
+	BoardSlug     string     `json:"board_slug"`
+	BoardTitle    string     `json:"board_title"`
+	ThreadCount   int        `json:"thread_count"`
+	MessageCount  int        `json:"message_count"`
+	LastThreadAt  *time.Time `json:"last_thread_at,omitempty"`
+	LastMessageAt *time.Time `json:"last_message_at,omitempty"`
+}
+
+type BoardStatsResponse struct {
+	Boards []*BoardStats `json:"boards"`
+}
+
 type UpdateNicknameRequest struct {
-	SessionKey string `json:"session_key" binding:"required"`
+	// Deprecated: send the key in the Authorization header or session cookie.
+	SessionKey string `json:"session_key,omitempty"`
 	Nickname   string `json:"nickname" binding:"required,min=1,max=16"`
 }
 
@@ -42,8 +120,7 @@ type NicknameUpdateResponse struct {
 
 type CooldownResponse struct {
 	LastNicknameChangeUnix *int64 `json:"lastNicknameChangeUnix"`
+	CooldownSeconds        int64  `json:"cooldownSeconds"`
 }
 
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
+type ErrorResponse = utils.ErrorResponse
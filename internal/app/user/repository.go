@@ -4,18 +4,19 @@ import (
 	"database/sql"
 	"time"
 
-	"backend/internal/app/session"
-
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository interface {
-	GetSessionByKey(sessionKey string) (*session.Session, error)
 	GetUserByID(id uint64) (*User, error)
 	UpdateUserNickname(userID uint64, nickname string) error
 	GetUserActivityByUserID(userID uint64) (*UserActivity, error)
 	GetUserLastNicknameChange(userID uint64) (*time.Time, error)
 	GetUserLastThreadTime(userID uint64) (*time.Time, error)
+	GetBoardStats(userID uint64) ([]*BoardStats, error)
+	GetSettings(userID uint64) (*Settings, error)
+	UpsertSettings(settings *Settings) error
 }
 
 type repository struct {
@@ -26,12 +27,6 @@ func NewRepository(db *gorm.DB) Repository {
 	return &repository{db: db}
 }
 
-func (r *repository) GetSessionByKey(sessionKey string) (*session.Session, error) {
-	var session session.Session
-	err := r.db.Where("session_key = ?", sessionKey).First(&session).Error
-	return &session, err
-}
-
 func (r *repository) GetUserByID(id uint64) (*User, error) {
 	var user User
 	err := r.db.Where("id = ?", id).First(&user).Error
@@ -79,3 +74,35 @@ func (r *repository) GetUserLastThreadTime(userID uint64) (*time.Time, error) {
 
 	return &lastThreadTime.Time, nil
 }
+
+func (r *repository) GetBoardStats(userID uint64) ([]*BoardStats, error) {
+	var stats []*BoardStats
+	err := r.db.Table("user_board_activity").
+		Select(`
+			user_board_activity.board_id,
+			boards.slug AS board_slug,
+			boards.title AS board_title,
+			user_board_activity.thread_count,
+			user_board_activity.message_count,
+			user_board_activity.last_thread_at,
+			user_board_activity.last_message_at
+		`).
+		Joins("JOIN boards ON boards.id = user_board_activity.board_id").
+		Where("user_board_activity.user_id = ?", userID).
+		Order("user_board_activity.thread_count + user_board_activity.message_count DESC, boards.slug ASC").
+		Scan(&stats).Error
+	return stats, err
+}
+
+func (r *repository) GetSettings(userID uint64) (*Settings, error) {
+	var settings Settings
+	err := r.db.Where("user_id = ?", userID).First(&settings).Error
+	return &settings, err
+}
+
+func (r *repository) UpsertSettings(settings *Settings) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"theme", "show_nsfw", "hidden_boards", "timezone", "updated_at"}),
+	}).Create(settings).Error
+}
@@ -8,5 +8,8 @@ func RegisterRoutes(rg *gin.RouterGroup, handler Handler) {
 		users.GET("", handler.GetUser)
 		users.PATCH("/nickname", handler.UpdateNickname)
 		users.GET("/cooldown", handler.GetCooldown)
+		users.GET("/stats/boards", handler.GetBoardStats)
+		users.GET("/settings", handler.GetSettings)
+		users.PUT("/settings", handler.UpdateSettings)
 	}
 }
@@ -3,17 +3,23 @@ package user
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"backend/internal/app/session"
+	"backend/internal/app/settings"
 	"backend/internal/providers/redis"
+	"backend/internal/utils"
 
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 const userCacheTTL = 5 * time.Minute
 
+var ErrNicknameCooldown = errors.New("nickname can only be changed")
+
 type UserResponse struct {
 	ID               uint64    `json:"id"`
 	Nickname         string    `json:"nickname"`
@@ -22,52 +28,69 @@ type UserResponse struct {
 	SessionKey       string    `json:"session_key"`
 	MessagesCount    int       `json:"messages_count"`
 	ThreadsCount     int       `json:"threads_count"`
+	Settings         *Settings `json:"settings"`
 }
 
 type Service interface {
 	GetUserWithSession(ctx context.Context, sessionKey string) (*UserResponse, error)
 	UpdateNickname(userID uint64, nickname string) error
 	GetStatsBySessionKey(sessionKey string) (*UserActivity, error)
+	GetBoardStats(userID uint64) ([]*BoardStats, error)
 	GetUserLastThreadTime(userID uint64) (*time.Time, error)
 	GetUserLastNicknameChange(userID uint64) (*time.Time, error)
+	NicknameCooldown() time.Duration
+	GetSettings(userID uint64) (*Settings, error)
+	UpdateSettings(ctx context.Context, userID uint64, req UpdateSettingsRequest) (*Settings, error)
 }
 
 type service struct {
-	repo       Repository
-	sessionSvc session.Service
-	redisP     *redis.RedisProvider
-	logger     *zap.SugaredLogger
+	repo        Repository
+	sessionSvc  session.Service
+	settingsSvc settings.Service
+	redisP      *redis.RedisProvider
+	logger      *zap.SugaredLogger
 }
 
-func NewService(repo Repository, sessionSvc session.Service, redisP *redis.RedisProvider, logger *zap.Logger) Service {
+func NewService(repo Repository, sessionSvc session.Service, settingsSvc settings.Service, redisP *redis.RedisProvider, logger *zap.Logger) Service {
 	return &service{
-		repo:       repo,
-		sessionSvc: sessionSvc,
-		redisP:     redisP,
-		logger:     logger.Sugar(),
+		repo:        repo,
+		sessionSvc:  sessionSvc,
+		settingsSvc: settingsSvc,
+		redisP:      redisP,
+		logger:      logger.Sugar(),
 	}
 }
 
+func (s *service) NicknameCooldown() time.Duration {
+	return time.Duration(s.settingsSvc.Current().NicknameCooldown)
+}
+
 func (s *service) GetUserWithSession(ctx context.Context, sessionKey string) (*UserResponse, error) {
 	if sessionKey == "" {
 		return nil, fmt.Errorf("session_key is required")
 	}
 
-	cacheKey := fmt.Sprintf("user:session:%s", sessionKey)
+	// Checked before the cache so a revoked or expired token stops working
+	// at once; for signed tokens this does not touch the database.
+	sess, err := s.sessionSvc.GetSessionByKey(sessionKey)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
 
-	cached, err := s.redisP.Get(ctx, cacheKey).Result()
+	// Cached per user, since a user may have several sessions; the session
+	// fields are filled in per request.
+	cacheKey := fmt.Sprintf("user:%d", sess.UserID)
+
+	cached, err := s.redisP.CachedGet(ctx, cacheKey)
 	if err == nil && cached != "" {
 		var userResp UserResponse
 		if json.Unmarshal([]byte(cached), &userResp) == nil {
+			userResp.SessionStartedAt = sess.StartedAt
+			userResp.SessionKey = sessionKey
 			return &userResp, nil
 		}
 	}
 
-	sess, err := s.sessionSvc.GetSessionByKey(sessionKey)
-	if err != nil {
-		return nil, fmt.Errorf("session not found: %w", err)
-	}
-
 	user, err := s.repo.GetUserByID(sess.UserID)
 	if err != nil {
 		return nil, fmt.Errorf("user not found: %w", err)
@@ -78,24 +101,25 @@ func (s *service) GetUserWithSession(ctx context.Context, sessionKey string) (*U
 		stats = &UserActivity{UserID: user.ID, ThreadCount: 0, MessageCount: 0}
 	}
 
-	startedAt, err := s.sessionSvc.GetSessionStartedAtBySessionKey(sessionKey)
+	settings, err := s.GetSettings(sess.UserID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get session started at: %w", err)
+		return nil, fmt.Errorf("failed to get settings: %w", err)
 	}
 
 	userResp := &UserResponse{
 		ID:               user.ID,
 		Nickname:         user.Nickname,
 		CreatedAt:        user.CreatedAt,
-		SessionStartedAt: startedAt,
+		SessionStartedAt: sess.StartedAt,
 		SessionKey:       sessionKey,
 		MessagesCount:    stats.MessageCount,
 		ThreadsCount:     stats.ThreadCount,
+		Settings:         settings,
 	}
 
 	data, err := json.Marshal(userResp)
 	if err == nil {
-		s.redisP.SetEX(ctx, cacheKey, data, userCacheTTL)
+		s.redisP.CachedSet(ctx, cacheKey, data, userCacheTTL)
 	}
 
 	return userResp, nil
@@ -108,19 +132,34 @@ func (s *service) UpdateNickname(userID uint64, nickname string) error {
 	}
 
 	now := time.Now().UTC()
-	if lastChange != nil && now.Sub(*lastChange) < time.Minute {
-		return fmt.Errorf("nickname can only be changed once per minute")
+	if cooldown := s.NicknameCooldown(); lastChange != nil && now.Sub(*lastChange) < cooldown {
+		return fmt.Errorf("%w: %w", ErrNicknameCooldown, &utils.CooldownError{
+			Action:    "nickname change",
+			Cooldown:  cooldown,
+			Remaining: cooldown - now.Sub(*lastChange),
+		})
 	}
 
 	return s.repo.UpdateUserNickname(userID, nickname)
 }
 
 func (s *service) GetStatsBySessionKey(sessionKey string) (*UserActivity, error) {
-	session, err := s.repo.GetSessionByKey(sessionKey)
+	sess, err := s.sessionSvc.GetSessionByKey(sessionKey)
 	if err != nil {
 		return nil, fmt.Errorf("session not found: %w", err)
 	}
-	return s.repo.GetUserActivityByUserID(session.UserID)
+	return s.repo.GetUserActivityByUserID(sess.UserID)
+}
+
+func (s *service) GetBoardStats(userID uint64) ([]*BoardStats, error) {
+	stats, err := s.repo.GetBoardStats(userID)
+	if err != nil {
+		return nil, err
+	}
+	if stats == nil {
+		stats = []*BoardStats{}
+	}
+	return stats, nil
 }
 
 func (s *service) GetUserLastThreadTime(userID uint64) (*time.Time, error) {
@@ -130,3 +169,52 @@ func (s *service) GetUserLastThreadTime(userID uint64) (*time.Time, error) {
 func (s *service) GetUserLastNicknameChange(userID uint64) (*time.Time, error) {
 	return s.repo.GetUserLastNicknameChange(userID)
 }
+
+// GetSettings returns the user's settings, or the defaults when they have
+// never saved any.
+func (s *service) GetSettings(userID uint64) (*Settings, error) {
+	settings, err := s.repo.GetSettings(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &Settings{UserID: userID, HiddenBoards: []string{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if settings.HiddenBoards == nil {
+		settings.HiddenBoards = []string{}
+	}
+	return settings, nil
+}
+
+func (s *service) UpdateSettings(ctx context.Context, userID uint64, req UpdateSettingsRequest) (*Settings, error) {
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil || req.Timezone == "Local" {
+			return nil, utils.Invalid("timezone", "unknown timezone %q", req.Timezone)
+		}
+	}
+
+	hidden := make([]string, 0, len(req.HiddenBoards))
+	seen := make(map[string]bool, len(req.HiddenBoards))
+	for _, slug := range req.HiddenBoards {
+		if !seen[slug] {
+			seen[slug] = true
+			hidden = append(hidden, slug)
+		}
+	}
+
+	settings := &Settings{
+		UserID:       userID,
+		Theme:        req.Theme,
+		ShowNSFW:     req.ShowNSFW,
+		HiddenBoards: hidden,
+		Timezone:     req.Timezone,
+		UpdatedAt:    time.Now().UTC(),
+	}
+	if err := s.repo.UpsertSettings(settings); err != nil {
+		return nil, fmt.Errorf("failed to save settings: %w", err)
+	}
+
+	// The settings ride along in the cached user profile.
+	s.redisP.CachedDel(ctx, fmt.Sprintf("user:%d", userID))
+	return settings, nil
+}
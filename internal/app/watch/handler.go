@@ -0,0 +1,195 @@
+package watch
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"backend/internal/app/session"
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	List(c *gin.Context)
+	Watch(c *gin.Context)
+	Unwatch(c *gin.Context)
+	MarkRead(c *gin.Context)
+	UnreadSummary(c *gin.Context)
+}
+
+type handler struct {
+	service    Service
+	sessionSvc session.Service
+}
+
+func NewHandler(service Service, sessionSvc session.Service) Handler {
+	return &handler{
+		service:    service,
+		sessionSvc: sessionSvc,
+	}
+}
+
+// @Summary List watched threads
+// @Description Get the threads the current user follows with unread reply counts
+// @Tags Watch
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} WatchListResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/watch [get]
+func (h *handler) List(c *gin.Context) {
+	userID, ok := h.currentUserID(c)
+	if !ok {
+		return
+	}
+
+	threads, err := h.service.List(c.Request.Context(), userID)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get watched threads")
+		return
+	}
+	c.JSON(http.StatusOK, WatchListResponse{Threads: threads})
+}
+
+// @Summary Watch a thread
+// @Description Follow a thread to receive watched_thread_reply events for new replies
+// @Tags Watch
+// @Produce json
+// @Param thread_id path int true "Thread ID"
+// @Security BearerAuth
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/watch/{thread_id} [post]
+func (h *handler) Watch(c *gin.Context) {
+	threadID, ok := parseThreadID(c)
+	if !ok {
+		return
+	}
+	userID, ok := h.currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Watch(c.Request.Context(), userID, threadID); err != nil {
+		if errors.Is(err, ErrWatchLimit) {
+			utils.RespondError(c, http.StatusConflict, err.Error())
+			return
+		}
+		utils.RespondError(c, http.StatusNotFound, "thread not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Unwatch a thread
+// @Description Stop following a thread
+// @Tags Watch
+// @Produce json
+// @Param thread_id path int true "Thread ID"
+// @Security BearerAuth
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Router /api/watch/{thread_id} [delete]
+func (h *handler) Unwatch(c *gin.Context) {
+	threadID, ok := parseThreadID(c)
+	if !ok {
+		return
+	}
+	userID, ok := h.currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Unwatch(c.Request.Context(), userID, threadID); err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to unwatch thread")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Mark a thread as read
+// @Description Store the last read message of a thread, same as the websocket mark_read command
+// @Tags Watch
+// @Accept json
+// @Produce json
+// @Param thread_id path int true "Thread ID"
+// @Security BearerAuth
+// @Param request body MarkReadRequest true "Last read message"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Router /api/watch/{thread_id}/read [post]
+func (h *handler) MarkRead(c *gin.Context) {
+	threadID, ok := parseThreadID(c)
+	if !ok {
+		return
+	}
+
+	var req MarkReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	userID, ok := h.currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.MarkRead(c.Request.Context(), userID, threadID, req.MessageID); err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to mark thread as read")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Get unread replies summary
+// @Description Get unread reply counts across watched threads
+// @Tags Watch
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} UnreadSummaryResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/watch/unread [get]
+func (h *handler) UnreadSummary(c *gin.Context) {
+	userID, ok := h.currentUserID(c)
+	if !ok {
+		return
+	}
+
+	summary, err := h.service.UnreadSummary(c.Request.Context(), userID)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "failed to get unread summary")
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+func (h *handler) currentUserID(c *gin.Context) (uint64, bool) {
+	sessionKey := session.Key(c)
+	if sessionKey == "" {
+		utils.RespondError(c, http.StatusUnauthorized, "session is required")
+		return 0, false
+	}
+
+	user, err := h.sessionSvc.GetUserBySessionKey(sessionKey)
+	if err != nil {
+		utils.RespondError(c, http.StatusNotFound, "user not found")
+		return 0, false
+	}
+	return user.ID, true
+}
+
+func parseThreadID(c *gin.Context) (uint64, bool) {
+	threadID, err := strconv.ParseUint(c.Param("thread_id"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid thread ID")
+		return 0, false
+	}
+	return threadID, true
+}
@@ -0,0 +1,50 @@
+package watch
+
+import (
+	"time"
+
+	"backend/internal/utils"
+)
+
+type Watch struct {
+	ID        uint64    `json:"-" gorm:"primaryKey"`
+	UserID    uint64    `json:"-" gorm:"not null;uniqueIndex:idx_thread_watch_user_thread"`
+	ThreadID  uint64    `json:"thread_id" gorm:"not null;uniqueIndex:idx_thread_watch_user_thread;index"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
+}
+
+func (Watch) TableName() string {
+	return "thread_watches"
+}
+
+type WatchedThread struct {
+	ThreadID          uint64     `json:"thread_id"`
+	BoardSlug         string     `json:"board_slug"`
+	Title             string     `json:"title"`
+	ArchivedAt        *time.Time `json:"archived_at,omitempty"`
+	WatchedAt         time.Time  `json:"watched_at"`
+	LastReadMessageID uint64     `json:"last_read_message_id"`
+	LatestMessageID   uint64     `json:"latest_message_id"`
+	UnreadReplies     int64      `json:"unread_replies"`
+}
+
+type UnreadCount struct {
+	ThreadID        uint64 `json:"thread_id"`
+	UnreadReplies   int64  `json:"unread_replies"`
+	LatestMessageID uint64 `json:"latest_message_id"`
+}
+
+type WatchListResponse struct {
+	Threads []*WatchedThread `json:"threads"`
+}
+
+type UnreadSummaryResponse struct {
+	TotalUnread int64          `json:"total_unread"`
+	Threads     []*UnreadCount `json:"threads"`
+}
+
+type MarkReadRequest struct {
+	MessageID uint64 `json:"message_id" binding:"required"`
+}
+
+type ErrorResponse = utils.ErrorResponse
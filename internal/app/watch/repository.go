@@ -0,0 +1,91 @@
+package watch
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository interface {
+	Watch(userID, threadID uint64) error
+	Unwatch(userID, threadID uint64) error
+	CountByUser(userID uint64) (int64, error)
+	ListByUser(userID uint64) ([]*WatchedThread, error)
+	WatcherIDs(threadID uint64) ([]uint64, error)
+	CountUnread(positions map[uint64]uint64) ([]*UnreadCount, error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) Watch(userID, threadID uint64) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&Watch{UserID: userID, ThreadID: threadID}).Error
+}
+
+func (r *repository) Unwatch(userID, threadID uint64) error {
+	return r.db.Where("user_id = ? AND thread_id = ?", userID, threadID).Delete(&Watch{}).Error
+}
+
+func (r *repository) CountByUser(userID uint64) (int64, error) {
+	var count int64
+	err := r.db.Model(&Watch{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *repository) ListByUser(userID uint64) ([]*WatchedThread, error) {
+	var threads []*WatchedThread
+	err := r.db.Table("thread_watches").
+		Select(`
+			thread_watches.thread_id,
+			boards.slug as board_slug,
+			threads.title,
+			threads.archived_at,
+			thread_watches.created_at as watched_at
+		`).
+		Joins("JOIN threads ON threads.id = thread_watches.thread_id").
+		Joins("JOIN boards ON boards.id = threads.board_id").
+		Where("thread_watches.user_id = ? AND threads.deleted_at IS NULL", userID).
+		Order("thread_watches.created_at DESC").
+		Scan(&threads).Error
+	return threads, err
+}
+
+func (r *repository) WatcherIDs(threadID uint64) ([]uint64, error) {
+	var ids []uint64
+	err := r.db.Model(&Watch{}).Where("thread_id = ?", threadID).Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// CountUnread counts messages after the given read position in each thread.
+func (r *repository) CountUnread(positions map[uint64]uint64) ([]*UnreadCount, error) {
+	if len(positions) == 0 {
+		return nil, nil
+	}
+
+	values := make([]string, 0, len(positions))
+	args := make([]interface{}, 0, 2*len(positions))
+	for threadID, lastRead := range positions {
+		values = append(values, "(?::bigint, ?::bigint)")
+		args = append(args, threadID, lastRead)
+	}
+
+	var counts []*UnreadCount
+	err := r.db.Raw(`
+		SELECT
+			v.thread_id,
+			COUNT(m.id) AS unread_replies,
+			COALESCE((SELECT MAX(id) FROM messages WHERE messages.thread_id = v.thread_id AND messages.deleted_at IS NULL), 0) AS latest_message_id
+		FROM (VALUES `+strings.Join(values, ", ")+`) AS v(thread_id, last_read)
+		LEFT JOIN messages m ON m.thread_id = v.thread_id AND m.id > v.last_read AND m.deleted_at IS NULL
+		GROUP BY v.thread_id
+		ORDER BY v.thread_id
+	`, args...).Scan(&counts).Error
+	return counts, err
+}
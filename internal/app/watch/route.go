@@ -0,0 +1,14 @@
+package watch
+
+import "github.com/gin-gonic/gin"
+
+func RegisterRoutes(rg *gin.RouterGroup, handler Handler) {
+	watch := rg.Group("/watch")
+	{
+		watch.GET("", handler.List)
+		watch.GET("/unread", handler.UnreadSummary)
+		watch.POST("/:thread_id", handler.Watch)
+		watch.DELETE("/:thread_id", handler.Unwatch)
+		watch.POST("/:thread_id/read", handler.MarkRead)
+	}
+}
@@ -0,0 +1,184 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/internal/app/thread"
+	"backend/internal/providers/redis"
+	"backend/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+const maxWatchedThreads = 200
+
+var ErrWatchLimit = errors.New("watch list is full")
+
+type Service interface {
+	Watch(ctx context.Context, userID, threadID uint64) error
+	Unwatch(ctx context.Context, userID, threadID uint64) error
+	List(ctx context.Context, userID uint64) ([]*WatchedThread, error)
+	UnreadSummary(ctx context.Context, userID uint64) (*UnreadSummaryResponse, error)
+	MarkRead(ctx context.Context, userID, threadID, messageID uint64) error
+	NotifyReply(ctx context.Context, threadID, messageID, authorUserID uint64, content string)
+}
+
+// Pusher reaches users who may not have the site open, e.g. via web push.
+type Pusher interface {
+	PushToUsers(ctx context.Context, userIDs []uint64, notifType string, data map[string]interface{})
+}
+
+type service struct {
+	repo      Repository
+	threadSvc thread.Service
+	redisP    *redis.RedisProvider
+	eventBus  *utils.EventBus
+	pusher    Pusher
+	logger    *zap.SugaredLogger
+}
+
+func NewService(repo Repository, threadSvc thread.Service, redisP *redis.RedisProvider, eventBus *utils.EventBus, pusher Pusher, logger *zap.Logger) Service {
+	return &service{
+		repo:      repo,
+		threadSvc: threadSvc,
+		redisP:    redisP,
+		eventBus:  eventBus,
+		pusher:    pusher,
+		logger:    logger.Sugar(),
+	}
+}
+
+func (s *service) Watch(ctx context.Context, userID, threadID uint64) error {
+	if _, err := s.threadSvc.GetThreadByID(ctx, threadID); err != nil {
+		return fmt.Errorf("thread not found: %w", err)
+	}
+
+	count, err := s.repo.CountByUser(userID)
+	if err != nil {
+		return fmt.Errorf("failed to count watched threads: %w", err)
+	}
+	if count >= maxWatchedThreads {
+		return ErrWatchLimit
+	}
+
+	return s.repo.Watch(userID, threadID)
+}
+
+func (s *service) Unwatch(ctx context.Context, userID, threadID uint64) error {
+	return s.repo.Unwatch(userID, threadID)
+}
+
+func (s *service) List(ctx context.Context, userID uint64) ([]*WatchedThread, error) {
+	threads, err := s.repo.ListByUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list watched threads: %w", err)
+	}
+
+	counts, positions, err := s.unreadCounts(ctx, userID, threadIDs(threads))
+	if err != nil {
+		return nil, err
+	}
+	byThread := make(map[uint64]*UnreadCount, len(counts))
+	for _, c := range counts {
+		byThread[c.ThreadID] = c
+	}
+
+	for _, t := range threads {
+		t.LastReadMessageID = positions[t.ThreadID]
+		if c, ok := byThread[t.ThreadID]; ok {
+			t.UnreadReplies = c.UnreadReplies
+			t.LatestMessageID = c.LatestMessageID
+		}
+	}
+	return threads, nil
+}
+
+func (s *service) UnreadSummary(ctx context.Context, userID uint64) (*UnreadSummaryResponse, error) {
+	threads, err := s.repo.ListByUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list watched threads: %w", err)
+	}
+
+	counts, _, err := s.unreadCounts(ctx, userID, threadIDs(threads))
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &UnreadSummaryResponse{Threads: make([]*UnreadCount, 0, len(counts))}
+	for _, c := range counts {
+		if c.UnreadReplies == 0 {
+			continue
+		}
+		summary.TotalUnread += c.UnreadReplies
+		summary.Threads = append(summary.Threads, c)
+	}
+	return summary, nil
+}
+
+// unreadCounts returns unread reply counts for the threads along with the
+// read positions they were computed from. Unmarked threads count from zero.
+func (s *service) unreadCounts(ctx context.Context, userID uint64, ids []uint64) ([]*UnreadCount, map[uint64]uint64, error) {
+	positions, err := s.redisP.ReadPositions(ctx, userID, ids)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load read positions: %w", err)
+	}
+
+	all := make(map[uint64]uint64, len(ids))
+	for _, id := range ids {
+		all[id] = positions[id]
+	}
+
+	counts, err := s.repo.CountUnread(all)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to count unread replies: %w", err)
+	}
+	return counts, positions, nil
+}
+
+func (s *service) MarkRead(ctx context.Context, userID, threadID, messageID uint64) error {
+	return s.redisP.MarkRead(ctx, userID, threadID, messageID)
+}
+
+// NotifyReply sends watched_thread_reply to everyone watching the thread
+// except the reply's author, over the websocket and web push.
+func (s *service) NotifyReply(ctx context.Context, threadID, messageID, authorUserID uint64, content string) {
+	watchers, err := s.repo.WatcherIDs(threadID)
+	if err != nil {
+		s.logger.Errorw("Failed to load thread watchers", "thread_id", threadID, "error", err)
+		return
+	}
+
+	userIDs := make([]uint64, 0, len(watchers))
+	for _, id := range watchers {
+		if id != authorUserID {
+			userIDs = append(userIDs, id)
+		}
+	}
+	if len(userIDs) == 0 {
+		return
+	}
+
+	s.eventBus.PublishWithContext(ctx, utils.WatchedThreadReply{
+		UserIDs:   userIDs,
+		ThreadID:  threadID,
+		MessageID: messageID,
+		Timestamp: time.Now().UTC().Unix(),
+	})
+	if s.pusher != nil {
+		s.pusher.PushToUsers(ctx, userIDs, utils.EventWatchedThreadReply, map[string]interface{}{
+			"thread_id":  threadID,
+			"message_id": messageID,
+		})
+	}
+}
+
+func threadIDs(threads []*WatchedThread) []uint64 {
+	ids := make([]uint64, len(threads))
+	for i, t := range threads {
+		ids[i] = t.ThreadID
+	}
+	return ids
+}
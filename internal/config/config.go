@@ -1,91 +1,437 @@
 package config
 
 import (
+	"errors"
 	"fmt"
-	"os"
-	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	DBHost          string
-	DBPort          string
-	DBUser          string
-	DBPass          string
-	DBName          string
-	ServerPort      string
-	RedisURL        string
-	Env             string
-	RedisTTL        time.Duration
-	MinioURL        string
-	MinioPublicURL  string
-	MinioUser       string
-	MinioPassword   string
-	MinioBucket     string
-	MaxFileSize     int64
-	MaxFilesPerPost int
-	AdminAPIKey     string
+	DBHost             string
+	DBPort             string
+	DBUser             string
+	DBPass             string
+	DBName             string
+	ServerPort         string
+	RedisURL           string
+	RedisUser          string
+	RedisPassword      string
+	RedisCACert        string
+	Env                string
+	RedisTTL           time.Duration
+	MinioURL           string
+	MinioPublicURL     string
+	MinioUser          string
+	MinioPassword      string
+	MinioBucket        string
+	MinioPrivate       bool
+	MinioTimeout       time.Duration
+	MinioUploadTimeout time.Duration
+	MinioRetries       int
+	MaxFileSize        int64
+	MaxFilesPerPost    int
+	AdminAPIKey        string
+
+	// MaxBodySize caps request bodies other than file uploads, which are
+	// capped by the file policy of the board instead.
+	MaxBodySize int64
+
+	// SessionSecret signs session tokens; every instance needs the same one,
+	// and changing it signs everyone out.
+	SessionSecret string
+
+	// SessionCookieSecure marks the session cookie Secure; turn it on
+	// whenever the API is served over HTTPS.
+	SessionCookieSecure bool
+
+	// IPHashSalt, when set, makes users stored by a salted hash of their IP
+	// instead of the IP itself. Changing it splits every returning visitor
+	// from their old user.
+	IPHashSalt string
+
+	// IDRotation, when positive, gives each IP a new user every period so
+	// its posts cannot be linked across periods. It needs IPHashSalt.
+	IDRotation time.Duration
+
+	// TrustedProxies are the addresses and CIDR ranges of the reverse
+	// proxies in front of the server. X-Forwarded-For and X-Real-IP are
+	// believed only from them; a client talking to the server directly
+	// could otherwise claim any address. Empty trusts no proxy.
+	TrustedProxies []string
+
+	// TorExitList and ASNDatabase are local files the IP reputation lists
+	// are read from, re-read when they change; IPReputationRefresh is how
+	// often that is checked. Networks in DatacenterASNs, or a built-in list
+	// when empty, count as datacenters.
+	TorExitList         string
+	ASNDatabase         string
+	DatacenterASNs      []string
+	IPReputationRefresh time.Duration
+
+	// CaptchaSecret verifies the captcha posts from Tor and datacenters
+	// solve on boards that ask for one, at CaptchaVerifyURL. Without it
+	// such boards refuse those posts.
+	CaptchaSecret    string
+	CaptchaVerifyURL string
+
+	// SpamThreshold is the spam score at which a new thread or reply is
+	// refused; 0 only logs the scores. PostMinDelay is how long a person
+	// takes at least between opening the form and posting, and FormTokenTTL
+	// how long a form token is good for.
+	SpamThreshold int
+	PostMinDelay  time.Duration
+	FormTokenTTL  time.Duration
+
+	// IdempotencyTTL is how long a create response is kept for replay to a
+	// retry with the same Idempotency-Key.
+	IdempotencyTTL time.Duration
+
+	// APIDocs serves the OpenAPI document and Swagger UI at /api/docs.
+	APIDocs bool
+
+	// Postgres connection pool; DBMaxOpenConns 0 means unlimited and
+	// DBPoolStatsInterval 0 turns the periodic pool stats log off.
+	DBMaxOpenConns      int
+	DBMaxIdleConns      int
+	DBConnMaxLifetime   time.Duration
+	DBConnMaxIdleTime   time.Duration
+	DBPoolStatsInterval time.Duration
+	// DBReplicas are read-only Postgres servers, as URLs such as
+	// "postgres://replica1:5432/db_404chan". They share DB_USER, DB_PASSWORD
+	// and the pool settings with the primary.
+	DBReplicas []string
+
+	// L1CacheSize is how many hot Redis values (boards, threads, users by
+	// session) each instance also keeps in memory, for at most L1CacheTTL;
+	// 0 turns the in-process cache off.
+	L1CacheSize int
+	L1CacheTTL  time.Duration
+
+	// Runtime settings: these are only defaults, the admin settings API and
+	// a SIGHUP reload can change them while the server is running.
+	ThreadCooldown     time.Duration
+	MessageCooldown    time.Duration
+	NicknameCooldown   time.Duration
+	ThreadEditWindow   time.Duration
+	DuplicateWindow    time.Duration
+	ProxyPolicy        string
+	BumpLimit          int
+	PreviewReplies     int
+	WordFilter         []WordFilterRule
+	GeoPolicies        map[string]string
+	MaintenanceMode    bool
+	MaintenanceMessage string
+	// AnonNames gives new users a generated pseudonym instead of "Аноним".
+	AnonNames bool
+
+	NotificationWebhookTimeout time.Duration
+	VAPIDPublicKey             string
+	VAPIDPrivateKey            string
+	VAPIDSubject               string
+
+	// LinkPreviews fetches a title, description and image for the links in
+	// new replies. LinkPreviewTimeout bounds each page fetch and
+	// LinkPreviewCacheTTL is how long a fetched preview is reused.
+	LinkPreviews        bool
+	LinkPreviewTimeout  time.Duration
+	LinkPreviewCacheTTL time.Duration
+
+	EventBroker        string
+	EventFanoutChannel string
+	NATSURL            string
+	KafkaRESTURL       string
+	EventLogMaxLen     int64
+
+	WSMaxConnsPerIP      int
+	WSMaxConnsPerSession int
+
+	// DB_USER, DB_PASSWORD, REDIS_PASSWORD, MINIO_USER and MINIO_PASSWORD may
+	// be secret references such as "vault:secret/data/404chan#db_password".
+	SecretsCacheTTL time.Duration
+	VaultAddr       string
+	VaultToken      string
+	VaultNamespace  string
+	AWSRegion       string
+
+	JobTmpCleanupSchedule    string
+	JobSessionExpirySchedule string
+	JobArchiveSchedule       string
+	JobPurgeDeletedSchedule  string
+	JobPurgeArchivedSchedule string
+	JobStatsSchedule         string
+	JobStorageStatsSchedule  string
+	JobHourlyPostsSchedule   string
+	JobTopThreadsSchedule    string
+	JobTrendingSchedule      string
+	JobAnnouncementsSchedule string
+	TmpFileMaxAge            time.Duration
+	SessionMaxAge            time.Duration
+	ThreadArchiveAfter       time.Duration
+	DeletedRetention         time.Duration
+	ArchiveRetention         time.Duration
+	TopThreadsHalfLife       time.Duration
+	TrendingHalfLife         time.Duration
+
+	// Demo fills the boards with generated users, threads and replies on
+	// startup (see seeder.SeedDemo); meant for development and load tests.
+	Demo                   bool
+	DemoUsers              int
+	DemoThreadsPerBoard    int
+	DemoMaxReplies         int
+	DemoAttachmentsPercent int
+	DemoSeed               int64
+
+	// ExportBoard and ExportFile are only read by the export-board command,
+	// the Import settings only by import.
+	ExportBoard    string
+	ExportFile     string
+	ImportBoard    string
+	ImportFile     string
+	ImportReupload bool
+	ImportFilesURL string
 }
 
-func LoadConfig() Config {
-	ttlStr := getEnv("REDIS_TTL", "5m")
-	ttl, err := time.ParseDuration(ttlStr)
+// LoadConfig builds the configuration from command-line flags, environment
+// variables and an optional config file, in that order of precedence (see
+// Usage), and validates it. Every malformed, unknown or missing value is
+// reported, not just the first one, so a broken deployment can be fixed in
+// one go.
+func LoadConfig(args []string) (Config, error) {
+	l, err := newLoader(args)
 	if err != nil {
-		ttl = 5 * time.Minute
+		return Config{}, err
 	}
 
-	maxFileSize := getEnvAsInt64("MAX_FILE_SIZE", 10*1024*1024)
-	maxFilesPerPost := getEnvAsInt("MAX_FILES_PER_POST", 5)
-
-	return Config{
-		DBHost:          getEnv("DB_HOST", "postgres"),
-		DBPort:          getEnv("DB_PORT", "5432"),
-		DBUser:          getEnv("DB_USER", "postgres"),
-		DBPass:          getEnv("DB_PASSWORD", "password"),
-		DBName:          getEnv("DB_NAME", "db_404chan"),
-		ServerPort:      getEnv("SERVER_PORT", "8080"),
-		RedisURL:        getEnv("REDIS_URL", "redis:6379"),
-		Env:             getEnv("ENV", "dev"),
-		RedisTTL:        ttl,
-		MinioURL:        getEnv("MINIO_URL", "localhost:9000"),
-		MinioPublicURL:  getEnv("MINIO_PUBLIC_URL", ""),
-		MinioUser:       getEnv("MINIO_USER", "minioadmin"),
-		MinioPassword:   getEnv("MINIO_PASSWORD", "minioadmin"),
-		MinioBucket:     getEnv("MINIO_BUCKET", "404chan-files"),
-		MaxFileSize:     maxFileSize,
-		MaxFilesPerPost: maxFilesPerPost,
-		AdminAPIKey:     getEnv("ADMIN_API_KEY", ""),
+	// EVENT_FANOUT predates EVENT_BROKER and still picks between the Redis
+	// relay and the in-process bus when EVENT_BROKER is unset.
+	eventBroker := l.str("EVENT_BROKER", "")
+	fanout := l.bool("EVENT_FANOUT", true)
+	if eventBroker == "" {
+		eventBroker = "memory"
+		if fanout {
+			eventBroker = "redis"
+		}
 	}
-}
 
-func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+	cfg := Config{
+		DBHost:             l.str("DB_HOST", "postgres"),
+		DBPort:             l.str("DB_PORT", "5432"),
+		DBUser:             l.str("DB_USER", "postgres"),
+		DBPass:             l.str("DB_PASSWORD", "password"),
+		DBName:             l.str("DB_NAME", "db_404chan"),
+		ServerPort:         l.str("SERVER_PORT", "8080"),
+		RedisURL:           l.str("REDIS_URL", "redis:6379"),
+		RedisUser:          l.str("REDIS_USER", ""),
+		RedisPassword:      l.str("REDIS_PASSWORD", ""),
+		RedisCACert:        l.str("REDIS_CA_CERT", ""),
+		Env:                l.str("ENV", "dev"),
+		RedisTTL:           l.duration("REDIS_TTL", 5*time.Minute),
+		MinioURL:           l.str("MINIO_URL", "localhost:9000"),
+		MinioPublicURL:     l.str("MINIO_PUBLIC_URL", ""),
+		MinioUser:          l.str("MINIO_USER", "minioadmin"),
+		MinioPassword:      l.str("MINIO_PASSWORD", "minioadmin"),
+		MinioBucket:        l.str("MINIO_BUCKET", "404chan-files"),
+		MinioPrivate:       l.bool("MINIO_PRIVATE_BUCKET", false),
+		MinioTimeout:       l.duration("MINIO_TIMEOUT", 10*time.Second),
+		MinioUploadTimeout: l.duration("MINIO_UPLOAD_TIMEOUT", 5*time.Minute),
+		MinioRetries:       l.int("MINIO_MAX_RETRIES", 3),
+		MaxFileSize:        l.size("MAX_FILE_SIZE", 10*1024*1024),
+		MaxFilesPerPost:    l.int("MAX_FILES_PER_POST", 5),
+		AdminAPIKey:        l.str("ADMIN_API_KEY", ""),
+
+		MaxBodySize: l.size("MAX_BODY_SIZE", 1024*1024),
+
+		SessionSecret: l.str("SESSION_SECRET", ""),
+		IPHashSalt:    l.str("IP_HASH_SALT", ""),
+		IDRotation:    l.duration("ID_ROTATION", 0),
+
+		TrustedProxies: l.listOr("TRUSTED_PROXIES", defaultTrustedProxies),
+
+		SessionCookieSecure: l.bool("SESSION_COOKIE_SECURE", false),
+
+		IdempotencyTTL: l.duration("IDEMPOTENCY_TTL", 24*time.Hour),
+
+		TorExitList:         l.str("TOR_EXIT_LIST", ""),
+		ASNDatabase:         l.str("ASN_DATABASE", ""),
+		DatacenterASNs:      l.list("DATACENTER_ASNS"),
+		IPReputationRefresh: l.duration("IP_REPUTATION_REFRESH", 10*time.Minute),
+
+		CaptchaSecret:    l.str("CAPTCHA_SECRET", ""),
+		CaptchaVerifyURL: l.str("CAPTCHA_VERIFY_URL", "https://api.hcaptcha.com/siteverify"),
+
+		SpamThreshold: l.int("SPAM_THRESHOLD", 60),
+		PostMinDelay:  l.duration("POST_MIN_DELAY", 3*time.Second),
+		FormTokenTTL:  l.duration("FORM_TOKEN_TTL", 24*time.Hour),
+
+		APIDocs: l.bool("API_DOCS", false),
+
+		DBMaxOpenConns:      l.int("DB_MAX_OPEN_CONNS", 25),
+		DBMaxIdleConns:      l.int("DB_MAX_IDLE_CONNS", 10),
+		DBConnMaxLifetime:   l.duration("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+		DBConnMaxIdleTime:   l.duration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+		DBPoolStatsInterval: l.duration("DB_POOL_STATS_INTERVAL", time.Minute),
+		DBReplicas:          l.list("DB_REPLICAS"),
+
+		L1CacheSize: l.int("L1_CACHE_SIZE", 10000),
+		L1CacheTTL:  l.duration("L1_CACHE_TTL", 30*time.Second),
+
+		ThreadCooldown:     l.duration("THREAD_COOLDOWN", 5*time.Minute),
+		MessageCooldown:    l.duration("MESSAGE_COOLDOWN", 10*time.Second),
+		NicknameCooldown:   l.duration("NICKNAME_COOLDOWN", time.Minute),
+		ThreadEditWindow:   l.duration("THREAD_EDIT_WINDOW", 15*time.Minute),
+		DuplicateWindow:    l.duration("DUPLICATE_WINDOW", 5*time.Minute),
+		ProxyPolicy:        l.str("PROXY_POLICY", "allow"),
+		BumpLimit:          l.int("BUMP_LIMIT", 500),
+		PreviewReplies:     l.int("PREVIEW_REPLIES", 3),
+		WordFilter:         l.wordFilter("WORDFILTER"),
+		GeoPolicies:        l.geoPolicies("GEO_POLICIES"),
+		MaintenanceMode:    l.bool("MAINTENANCE_MODE", false),
+		MaintenanceMessage: l.str("MAINTENANCE_MESSAGE", "The site is in maintenance mode, posting is temporarily disabled"),
+		AnonNames:          l.bool("ANON_NAMES", false),
+
+		NotificationWebhookTimeout: l.duration("NOTIFICATION_WEBHOOK_TIMEOUT", 5*time.Second),
+		VAPIDPublicKey:             l.str("VAPID_PUBLIC_KEY", ""),
+		VAPIDPrivateKey:            l.str("VAPID_PRIVATE_KEY", ""),
+		VAPIDSubject:               l.str("VAPID_SUBJECT", "mailto:admin@404chan.local"),
+		LinkPreviews:               l.bool("LINK_PREVIEWS", false),
+		LinkPreviewTimeout:         l.duration("LINK_PREVIEW_TIMEOUT", 5*time.Second),
+		LinkPreviewCacheTTL:        l.duration("LINK_PREVIEW_CACHE_TTL", 24*time.Hour),
+
+		EventBroker:        eventBroker,
+		EventFanoutChannel: l.str("EVENT_FANOUT_CHANNEL", "404chan:events"),
+		NATSURL:            l.str("NATS_URL", "nats://nats:4222"),
+		KafkaRESTURL:       l.str("KAFKA_REST_URL", ""),
+		EventLogMaxLen:     l.int64("EVENT_LOG_MAX_LEN", 10000),
+
+		WSMaxConnsPerIP:      l.int("WS_MAX_CONNS_PER_IP", 20),
+		WSMaxConnsPerSession: l.int("WS_MAX_CONNS_PER_SESSION", 5),
+
+		SecretsCacheTTL: l.duration("SECRETS_CACHE_TTL", 5*time.Minute),
+		VaultAddr:       l.str("VAULT_ADDR", ""),
+		VaultToken:      l.str("VAULT_TOKEN", ""),
+		VaultNamespace:  l.str("VAULT_NAMESPACE", ""),
+		AWSRegion:       l.str("AWS_REGION", ""),
+
+		JobTmpCleanupSchedule:    l.str("JOB_TMP_CLEANUP_SCHEDULE", "@every 15m"),
+		JobSessionExpirySchedule: l.str("JOB_SESSION_EXPIRY_SCHEDULE", "@every 1h"),
+		JobArchiveSchedule:       l.str("JOB_ARCHIVE_SCHEDULE", "*/10 * * * *"),
+		JobPurgeDeletedSchedule:  l.str("JOB_PURGE_DELETED_SCHEDULE", "@every 1h"),
+		JobPurgeArchivedSchedule: l.str("JOB_PURGE_ARCHIVED_SCHEDULE", "@every 1h"),
+		JobStatsSchedule:         l.str("JOB_STATS_SCHEDULE", "@every 1m"),
+		JobStorageStatsSchedule:  l.str("JOB_STORAGE_STATS_SCHEDULE", "@hourly"),
+		JobHourlyPostsSchedule:   l.str("JOB_HOURLY_POSTS_SCHEDULE", "@every 5m"),
+		JobTopThreadsSchedule:    l.str("JOB_TOP_THREADS_SCHEDULE", "@every 1m"),
+		JobTrendingSchedule:      l.str("JOB_TRENDING_SCHEDULE", "@every 5m"),
+		JobAnnouncementsSchedule: l.str("JOB_ANNOUNCEMENTS_SCHEDULE", "@every 1m"),
+		TmpFileMaxAge:            l.duration("TMP_FILE_MAX_AGE", time.Hour),
+		SessionMaxAge:            l.duration("SESSION_MAX_AGE", 7*24*time.Hour),
+		ThreadArchiveAfter:       l.duration("THREAD_ARCHIVE_AFTER", 7*24*time.Hour),
+		DeletedRetention:         l.duration("DELETED_RETENTION", 30*24*time.Hour),
+		ArchiveRetention:         l.duration("ARCHIVE_RETENTION", 90*24*time.Hour),
+		TopThreadsHalfLife:       l.duration("TOP_THREADS_HALF_LIFE", 24*time.Hour),
+		TrendingHalfLife:         l.duration("TRENDING_HALF_LIFE", 6*time.Hour),
+
+		Demo:                   l.bool("DEMO", false),
+		DemoUsers:              l.int("DEMO_USERS", 200),
+		DemoThreadsPerBoard:    l.int("DEMO_THREADS_PER_BOARD", 30),
+		DemoMaxReplies:         l.int("DEMO_MAX_REPLIES", 50),
+		DemoAttachmentsPercent: l.int("DEMO_ATTACHMENTS_PERCENT", 20),
+		DemoSeed:               l.int64("DEMO_SEED", 0),
+
+		ExportBoard:    l.str("EXPORT_BOARD", ""),
+		ExportFile:     l.str("EXPORT_FILE", ""),
+		ImportBoard:    l.str("IMPORT_BOARD", ""),
+		ImportFile:     l.str("IMPORT_FILE", ""),
+		ImportReupload: l.bool("IMPORT_REUPLOAD", false),
+		ImportFilesURL: l.str("IMPORT_FILES_URL", ""),
 	}
-	return fallback
+
+	errs := append(l.finish(), cfg.Validate())
+	return cfg, errors.Join(errs...)
+}
+
+// defaultTrustedProxies are loopback and the private networks, where the
+// proxy of a container or local deployment lives.
+var defaultTrustedProxies = []string{
+	"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "::1/128", "fc00::/7",
 }
 
-func getEnvAsInt(key string, fallback int) int {
-	if value, exists := os.LookupEnv(key); exists {
-		if v, err := strconv.Atoi(value); err == nil {
-			return v
+// WordFilterRule replaces whole-word, case-insensitive occurrences of Pattern
+// in posted text with Replacement.
+type WordFilterRule struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// ParseWordFilter reads rules written as "pattern=replacement", separated by
+// ";", e.g. "foo=bar;baz=***".
+func ParseWordFilter(value string) ([]WordFilterRule, error) {
+	var rules []WordFilterRule
+	for _, entry := range strings.Split(value, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		pattern, replacement, ok := strings.Cut(entry, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("rule %q must look like pattern=replacement", entry)
 		}
+		rules = append(rules, WordFilterRule{Pattern: pattern, Replacement: strings.TrimSpace(replacement)})
 	}
-	return fallback
+	return rules, nil
 }
 
-func getEnvAsInt64(key string, fallback int64) int64 {
-	if value, exists := os.LookupEnv(key); exists {
-		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
-			return v
+// Geo policies restrict what clients from a country, by the network their
+// address belongs to, may do: GeoBlock refuses their new threads and replies,
+// GeoCaptcha takes them with a solved captcha, and GeoReadOnly refuses every
+// write.
+const (
+	GeoBlock    = "block"
+	GeoCaptcha  = "captcha"
+	GeoReadOnly = "readonly"
+)
+
+// ParseGeoPolicies reads policies written as "country=policy", separated by
+// ",", e.g. "KP=readonly,CN=captcha". Countries are ISO 3166 alpha-2 codes.
+func ParseGeoPolicies(value string) (map[string]string, error) {
+	policies := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		country, policy, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("policy %q must look like country=policy", entry)
 		}
+		country = strings.ToUpper(strings.TrimSpace(country))
+		policy = strings.ToLower(strings.TrimSpace(policy))
+		if err := CheckGeoPolicy(country, policy); err != nil {
+			return nil, err
+		}
+		policies[country] = policy
+	}
+	return policies, nil
+}
+
+// CheckGeoPolicy reports whether country is an upper-case alpha-2 code and
+// policy one of the geo policies.
+func CheckGeoPolicy(country, policy string) error {
+	if len(country) != 2 || country[0] < 'A' || country[0] > 'Z' || country[1] < 'A' || country[1] > 'Z' {
+		return fmt.Errorf("%q is not a two-letter upper-case country code", country)
+	}
+	switch policy {
+	case GeoBlock, GeoCaptcha, GeoReadOnly:
+		return nil
 	}
-	return fallback
+	return fmt.Errorf("policy for %s must be block, captcha or readonly, got %q", country, policy)
 }
 
+// PostgresDSN leaves out the credentials, which may be secret references;
+// db.Connect fills them in per connection.
 func (c *Config) PostgresDSN() string {
 	return fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		c.DBHost, c.DBUser, c.DBPass, c.DBName, c.DBPort,
+		"host=%s dbname=%s port=%s sslmode=disable",
+		c.DBHost, c.DBName, c.DBPort,
 	)
 }
@@ -0,0 +1,357 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Usage documents where settings come from; main prints it for --help.
+const Usage = `Usage: 404chan [command] [--config FILE] [--setting-name VALUE ...]
+
+Without a command the server starts. Commands run a maintenance task and exit:
+
+  rebuild-counters   Recompute thread, reply, user and per-board user activity
+                     counters from the threads and messages tables.
+  hash-ips           Replace the raw IPs stored for users with salted hashes;
+                     needs IP_HASH_SALT.
+  export-board       Write a board's threads, messages and attachment metadata
+                     as newline-delimited JSON: --export-board SLUG, and
+                     --export-file PATH (stdout when empty).
+  import             Load a 404chan export or 4chan API thread JSON from
+                     --import-file PATH (stdin when empty) into the board
+                     --import-board SLUG (for an export, its own board by
+                     default). --import-reupload copies the files into MinIO;
+                     4chan files are fetched from --import-files-url.
+
+Every setting can be given in three ways. The first one found wins:
+
+  1. Command-line flag:     --server-port 8080   (or --server-port=8080)
+  2. Environment variable:  SERVER_PORT=8080     (.env is loaded into the environment)
+  3. Config file:           server:
+                              port: 8080
+
+Settings that appear nowhere keep their built-in defaults (see .env.example).
+
+The config file is read from --config or CONFIG_FILE. YAML (.yaml, .yml) and
+TOML (.toml) are supported. Nested keys are joined with "_", so the YAML above
+and "server_port: 8080" both set SERVER_PORT. Unknown flags and file keys are
+rejected.
+`
+
+// loader resolves settings from flags, the environment and the config file.
+// It collects parse errors instead of silently falling back to defaults; the
+// fallback is used only when a setting is not given anywhere.
+type loader struct {
+	flags    map[string]string
+	file     map[string]string
+	fileName string
+	used     map[string]bool
+	errs     []error
+}
+
+func newLoader(args []string) (*loader, error) {
+	l := &loader{used: make(map[string]bool)}
+
+	flags, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+	l.flags = flags
+
+	path, fromFlag := flags["CONFIG"]
+	if fromFlag {
+		delete(flags, "CONFIG")
+	} else {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		file, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		l.file, l.fileName = file, path
+	}
+	return l, nil
+}
+
+// parseFlags accepts --name=value, --name value and a bare --name (which means
+// "true"). Names map to settings by upper-casing and replacing "-" with "_".
+func parseFlags(args []string) (map[string]string, error) {
+	flags := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-h" || arg == "-help" || arg == "--help" {
+			return nil, flag.ErrHelp
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" || arg == "--" {
+			return nil, fmt.Errorf("unexpected argument %q", arg)
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !hasValue {
+			value = "true"
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				value = args[i+1]
+				i++
+			}
+		}
+		flags[strings.ToUpper(strings.ReplaceAll(name, "-", "_"))] = value
+	}
+	return flags, nil
+}
+
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+
+	var tree map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	if err := flatten("", tree, values); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+func flatten(prefix string, tree map[string]interface{}, out map[string]string) error {
+	for key, value := range tree {
+		name := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if err := flatten(name, v, out); err != nil {
+				return err
+			}
+		case []interface{}:
+			return fmt.Errorf("%s: lists are not supported", strings.ToLower(name))
+		case nil:
+			out[name] = ""
+		case time.Time:
+			return fmt.Errorf("%s: quote the value, dates are not supported", strings.ToLower(name))
+		default:
+			out[name] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// lookup returns the value for key and a description of where it came from,
+// used in error messages.
+func (l *loader) lookup(key string) (value, origin string, ok bool) {
+	l.used[key] = true
+	if v, ok := l.flags[key]; ok {
+		return v, "--" + strings.ToLower(strings.ReplaceAll(key, "_", "-")), true
+	}
+	if v, ok := os.LookupEnv(key); ok {
+		return v, key, true
+	}
+	if v, ok := l.file[key]; ok {
+		return v, fmt.Sprintf("%s (%s)", key, l.fileName), true
+	}
+	return "", "", false
+}
+
+// finish reports flags and file keys that no setting consumed, which are
+// almost always typos.
+func (l *loader) finish() []error {
+	var unknown []string
+	for key := range l.flags {
+		if !l.used[key] {
+			unknown = append(unknown, "flag --"+strings.ToLower(strings.ReplaceAll(key, "_", "-")))
+		}
+	}
+	for key := range l.file {
+		if !l.used[key] {
+			unknown = append(unknown, fmt.Sprintf("key %s in %s", strings.ToLower(key), l.fileName))
+		}
+	}
+	sort.Strings(unknown)
+
+	errs := l.errs
+	for _, u := range unknown {
+		errs = append(errs, fmt.Errorf("unknown setting: %s", u))
+	}
+	return errs
+}
+
+func (l *loader) fail(origin, value, want string, err error) {
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %q is not a valid %s: %v", origin, value, want, err))
+		return
+	}
+	l.errs = append(l.errs, fmt.Errorf("%s: %q is not a valid %s", origin, value, want))
+}
+
+func (l *loader) str(key, fallback string) string {
+	if value, _, ok := l.lookup(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// list splits a comma-separated value, dropping empty entries.
+func (l *loader) list(key string) []string {
+	var items []string
+	for _, item := range strings.Split(l.str(key, ""), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// listOr is list with a fallback for when key is not set at all; set to
+// an empty value it gives an empty list.
+func (l *loader) listOr(key string, fallback []string) []string {
+	if _, _, ok := l.lookup(key); !ok {
+		return fallback
+	}
+	return l.list(key)
+}
+
+func (l *loader) int(key string, fallback int) int {
+	value, origin, ok := l.lookup(key)
+	if !ok {
+		return fallback
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		l.fail(origin, value, "integer", nil)
+		return fallback
+	}
+	return v
+}
+
+func (l *loader) int64(key string, fallback int64) int64 {
+	value, origin, ok := l.lookup(key)
+	if !ok {
+		return fallback
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		l.fail(origin, value, "integer", nil)
+		return fallback
+	}
+	return v
+}
+
+func (l *loader) bool(key string, fallback bool) bool {
+	value, origin, ok := l.lookup(key)
+	if !ok {
+		return fallback
+	}
+	v, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		l.fail(origin, value, "boolean (want true or false)", nil)
+		return fallback
+	}
+	return v
+}
+
+func (l *loader) duration(key string, fallback time.Duration) time.Duration {
+	value, origin, ok := l.lookup(key)
+	if !ok {
+		return fallback
+	}
+	v, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		l.fail(origin, value, "duration (e.g. 30s, 5m, 2h)", nil)
+		return fallback
+	}
+	return v
+}
+
+// size accepts a plain byte count or a number with a unit suffix: KB/MB/GB
+// are powers of 1000, KiB/MiB/GiB powers of 1024.
+func (l *loader) size(key string, fallback int64) int64 {
+	value, origin, ok := l.lookup(key)
+	if !ok {
+		return fallback
+	}
+	v, err := parseSize(value)
+	if err != nil {
+		l.fail(origin, value, "size (e.g. 10485760, 10MiB, 500KB)", err)
+		return fallback
+	}
+	return v
+}
+
+func (l *loader) wordFilter(key string) []WordFilterRule {
+	value, origin, ok := l.lookup(key)
+	if !ok {
+		return nil
+	}
+	rules, err := ParseWordFilter(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", origin, err))
+		return nil
+	}
+	return rules
+}
+
+func (l *loader) geoPolicies(key string) map[string]string {
+	value, origin, ok := l.lookup(key)
+	if !ok {
+		return nil
+	}
+	policies, err := ParseGeoPolicies(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", origin, err))
+		return nil
+	}
+	return policies
+}
+
+var sizeUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9},
+	{"B", 1},
+}
+
+func parseSize(value string) (int64, error) {
+	s := strings.TrimSpace(value)
+	factor := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(strings.ToUpper(s), strings.ToUpper(u.suffix)) {
+			s, factor = strings.TrimSpace(s[:len(s)-len(u.suffix)]), u.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("not a whole number")
+	}
+	if n > math.MaxInt64/factor {
+		return 0, fmt.Errorf("too large")
+	}
+	return n * factor, nil
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/internal/providers/secrets"
+	"backend/internal/scheduler"
+)
+
+var eventBrokers = []string{"memory", "redis", "nats", "kafka"}
+
+// Validate checks the values that parsed fine but still cannot work. Errors
+// name the environment variable they came from.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+		}
+	}
+	required := func(key, value string) {
+		check(strings.TrimSpace(value) != "", key, "is required")
+	}
+	port := func(key, value string) {
+		n, err := strconv.Atoi(value)
+		check(err == nil && n >= 1 && n <= 65535, key, "must be a port number between 1 and 65535, got %q", value)
+	}
+	positive := func(key string, d time.Duration) {
+		check(d > 0, key, "must be a positive duration, got %s", d)
+	}
+	schedule := func(key, spec string) {
+		if spec == "" || spec == "off" {
+			return
+		}
+		if _, err := scheduler.ParseSchedule(spec); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+
+	required("DB_HOST", c.DBHost)
+	port("DB_PORT", c.DBPort)
+	required("DB_USER", c.DBUser)
+	required("DB_NAME", c.DBName)
+	check(c.DBMaxOpenConns >= 0, "DB_MAX_OPEN_CONNS", "must not be negative (0 means unlimited), got %d", c.DBMaxOpenConns)
+	check(c.DBMaxIdleConns >= 0, "DB_MAX_IDLE_CONNS", "must not be negative, got %d", c.DBMaxIdleConns)
+	check(c.DBMaxOpenConns == 0 || c.DBMaxIdleConns <= c.DBMaxOpenConns, "DB_MAX_IDLE_CONNS",
+		"must not exceed DB_MAX_OPEN_CONNS (%d), got %d", c.DBMaxOpenConns, c.DBMaxIdleConns)
+	positive("DB_CONN_MAX_LIFETIME", c.DBConnMaxLifetime)
+	positive("DB_CONN_MAX_IDLE_TIME", c.DBConnMaxIdleTime)
+	for _, dsn := range c.DBReplicas {
+		u, err := url.Parse(dsn)
+		check(err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") && u.Host != "", "DB_REPLICAS",
+			"entries must look like postgres://host:5432/dbname, got %q", dsn)
+	}
+	check(c.DBPoolStatsInterval >= 0, "DB_POOL_STATS_INTERVAL", "must not be negative (0 disables it), got %s", c.DBPoolStatsInterval)
+	port("SERVER_PORT", c.ServerPort)
+	required("REDIS_URL", c.RedisURL)
+	positive("REDIS_TTL", c.RedisTTL)
+	check(c.L1CacheSize >= 0, "L1_CACHE_SIZE", "must not be negative (0 disables it), got %d", c.L1CacheSize)
+	if c.L1CacheSize > 0 {
+		positive("L1_CACHE_TTL", c.L1CacheTTL)
+	}
+
+	required("MINIO_URL", c.MinioURL)
+	required("MINIO_USER", c.MinioUser)
+	required("MINIO_PASSWORD", c.MinioPassword)
+	required("MINIO_BUCKET", c.MinioBucket)
+	if c.MinioPublicURL != "" {
+		u, err := url.Parse(c.MinioPublicURL)
+		check(err == nil && u.Scheme != "" && u.Host != "", "MINIO_PUBLIC_URL", "must be an absolute URL, got %q", c.MinioPublicURL)
+	}
+	positive("MINIO_TIMEOUT", c.MinioTimeout)
+	positive("MINIO_UPLOAD_TIMEOUT", c.MinioUploadTimeout)
+	check(c.MinioRetries >= 0, "MINIO_MAX_RETRIES", "must not be negative, got %d", c.MinioRetries)
+	check(c.MaxFileSize > 0, "MAX_FILE_SIZE", "must be greater than zero, got %d", c.MaxFileSize)
+	check(c.MaxBodySize > 0, "MAX_BODY_SIZE", "must be greater than zero, got %d", c.MaxBodySize)
+	positive("IDEMPOTENCY_TTL", c.IdempotencyTTL)
+	check(c.SpamThreshold >= 0, "SPAM_THRESHOLD", "must not be negative (0 only logs scores), got %d", c.SpamThreshold)
+	check(c.PostMinDelay >= 0, "POST_MIN_DELAY", "must not be negative, got %s", c.PostMinDelay)
+	positive("FORM_TOKEN_TTL", c.FormTokenTTL)
+	positive("IP_REPUTATION_REFRESH", c.IPReputationRefresh)
+	check(len(c.SessionSecret) >= 32, "SESSION_SECRET", "must be at least 32 characters long, got %d", len(c.SessionSecret))
+	check(c.IDRotation == 0 || c.IDRotation >= time.Hour, "ID_ROTATION", "must be 0 (off) or at least 1h, got %s", c.IDRotation)
+	check(c.IDRotation == 0 || c.IPHashSalt != "", "ID_ROTATION", "needs IP_HASH_SALT to be set")
+	for _, proxy := range c.TrustedProxies {
+		_, errPrefix := netip.ParsePrefix(proxy)
+		_, errAddr := netip.ParseAddr(proxy)
+		check(errPrefix == nil || errAddr == nil, "TRUSTED_PROXIES", "%q is not an IP address or CIDR range", proxy)
+	}
+	check(c.IPHashSalt == "" || len(c.IPHashSalt) >= 16, "IP_HASH_SALT", "must be empty or at least 16 characters long, got %d", len(c.IPHashSalt))
+	check(c.MaxFilesPerPost > 0, "MAX_FILES_PER_POST", "must be greater than zero, got %d", c.MaxFilesPerPost)
+	for key, d := range map[string]time.Duration{
+		"THREAD_COOLDOWN":   c.ThreadCooldown,
+		"MESSAGE_COOLDOWN":  c.MessageCooldown,
+		"NICKNAME_COOLDOWN": c.NicknameCooldown,
+	} {
+		check(d >= 0, key, "must not be negative (0 disables the cooldown), got %s", d)
+	}
+	check(c.ThreadEditWindow >= 0, "THREAD_EDIT_WINDOW", "must not be negative (0 disables editing), got %s", c.ThreadEditWindow)
+	check(c.ProxyPolicy == "allow" || c.ProxyPolicy == "captcha" || c.ProxyPolicy == "block", "PROXY_POLICY", "must be allow, captcha or block, got %q", c.ProxyPolicy)
+	check(c.DuplicateWindow >= 0, "DUPLICATE_WINDOW", "must not be negative (0 allows duplicates), got %s", c.DuplicateWindow)
+	check(c.BumpLimit >= 0, "BUMP_LIMIT", "must not be negative (0 disables it), got %d", c.BumpLimit)
+	check(c.PreviewReplies >= 0 && c.PreviewReplies <= 10, "PREVIEW_REPLIES", "must be between 0 and 10, got %d", c.PreviewReplies)
+	check(c.Env != "prod" || c.AdminAPIKey != "", "ADMIN_API_KEY", "is required when ENV=prod")
+
+	positive("NOTIFICATION_WEBHOOK_TIMEOUT", c.NotificationWebhookTimeout)
+	positive("LINK_PREVIEW_TIMEOUT", c.LinkPreviewTimeout)
+	positive("LINK_PREVIEW_CACHE_TTL", c.LinkPreviewCacheTTL)
+	check((c.VAPIDPublicKey == "") == (c.VAPIDPrivateKey == ""), "VAPID_PRIVATE_KEY",
+		"must be set together with VAPID_PUBLIC_KEY")
+	if c.VAPIDPublicKey != "" {
+		check(strings.HasPrefix(c.VAPIDSubject, "mailto:") || strings.HasPrefix(c.VAPIDSubject, "https://"),
+			"VAPID_SUBJECT", "must be a mailto: or https:// URI, got %q", c.VAPIDSubject)
+	}
+
+	validBroker := false
+	for _, kind := range eventBrokers {
+		validBroker = validBroker || c.EventBroker == kind
+	}
+	check(validBroker, "EVENT_BROKER", "must be one of %s, got %q", strings.Join(eventBrokers, ", "), c.EventBroker)
+	required("EVENT_FANOUT_CHANNEL", c.EventFanoutChannel)
+	if c.EventBroker == "nats" {
+		u, err := url.Parse(c.NATSURL)
+		check(err == nil && (u.Scheme == "nats" || u.Scheme == "tls") && u.Host != "", "NATS_URL", "must look like nats://host:4222 or tls://host:4222, got %q", c.NATSURL)
+	}
+	if c.EventBroker == "kafka" {
+		u, err := url.Parse(c.KafkaRESTURL)
+		check(err == nil && u.Scheme != "" && u.Host != "", "KAFKA_REST_URL", "is required for EVENT_BROKER=kafka and must be an absolute URL, got %q", c.KafkaRESTURL)
+	}
+	check(c.EventLogMaxLen > 0, "EVENT_LOG_MAX_LEN", "must be greater than zero, got %d", c.EventLogMaxLen)
+
+	check(c.WSMaxConnsPerIP >= 0, "WS_MAX_CONNS_PER_IP", "must not be negative (0 disables the limit), got %d", c.WSMaxConnsPerIP)
+	check(c.WSMaxConnsPerSession >= 0, "WS_MAX_CONNS_PER_SESSION", "must not be negative (0 disables the limit), got %d", c.WSMaxConnsPerSession)
+
+	positive("SECRETS_CACHE_TTL", c.SecretsCacheTTL)
+	for _, secret := range []struct{ key, value string }{
+		{"DB_USER", c.DBUser},
+		{"DB_PASSWORD", c.DBPass},
+		{"REDIS_PASSWORD", c.RedisPassword},
+		{"MINIO_USER", c.MinioUser},
+		{"MINIO_PASSWORD", c.MinioPassword},
+	} {
+		ref, ok := secrets.ParseRef(secret.value)
+		if !ok {
+			continue
+		}
+		check(ref.Path != "", secret.key, "secret reference %q has no path", secret.value)
+		switch ref.Scheme {
+		case secrets.SchemeVault:
+			check(c.VaultAddr != "" && c.VaultToken != "", secret.key, "uses Vault, so VAULT_ADDR and VAULT_TOKEN are required")
+		case secrets.SchemeSecretsManager, secrets.SchemeSSM:
+			check(c.AWSRegion != "", secret.key, "uses AWS, so AWS_REGION is required")
+		}
+	}
+
+	schedule("JOB_TMP_CLEANUP_SCHEDULE", c.JobTmpCleanupSchedule)
+	schedule("JOB_SESSION_EXPIRY_SCHEDULE", c.JobSessionExpirySchedule)
+	schedule("JOB_ARCHIVE_SCHEDULE", c.JobArchiveSchedule)
+	schedule("JOB_STATS_SCHEDULE", c.JobStatsSchedule)
+	schedule("JOB_STORAGE_STATS_SCHEDULE", c.JobStorageStatsSchedule)
+	schedule("JOB_TOP_THREADS_SCHEDULE", c.JobTopThreadsSchedule)
+	schedule("JOB_TRENDING_SCHEDULE", c.JobTrendingSchedule)
+	schedule("JOB_PURGE_DELETED_SCHEDULE", c.JobPurgeDeletedSchedule)
+	schedule("JOB_PURGE_ARCHIVED_SCHEDULE", c.JobPurgeArchivedSchedule)
+	schedule("JOB_HOURLY_POSTS_SCHEDULE", c.JobHourlyPostsSchedule)
+	schedule("JOB_ANNOUNCEMENTS_SCHEDULE", c.JobAnnouncementsSchedule)
+	positive("TMP_FILE_MAX_AGE", c.TmpFileMaxAge)
+	positive("SESSION_MAX_AGE", c.SessionMaxAge)
+	positive("THREAD_ARCHIVE_AFTER", c.ThreadArchiveAfter)
+	positive("DELETED_RETENTION", c.DeletedRetention)
+	check(c.ArchiveRetention >= 0, "ARCHIVE_RETENTION", "must not be negative (0 keeps archived threads forever), got %s", c.ArchiveRetention)
+	positive("TOP_THREADS_HALF_LIFE", c.TopThreadsHalfLife)
+	positive("TRENDING_HALF_LIFE", c.TrendingHalfLife)
+
+	if c.ImportFilesURL != "" {
+		u, err := url.Parse(c.ImportFilesURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "IMPORT_FILES_URL",
+			"must be an http(s) URL, got %q", c.ImportFilesURL)
+	}
+
+	if c.Demo {
+		check(c.DemoUsers > 0, "DEMO_USERS", "must be greater than zero, got %d", c.DemoUsers)
+		check(c.DemoUsers <= 131072, "DEMO_USERS", "must not exceed 131072, the size of the demo address range, got %d", c.DemoUsers)
+		check(c.DemoThreadsPerBoard >= 0, "DEMO_THREADS_PER_BOARD", "must not be negative, got %d", c.DemoThreadsPerBoard)
+		check(c.DemoMaxReplies >= 0, "DEMO_MAX_REPLIES", "must not be negative, got %d", c.DemoMaxReplies)
+		check(c.DemoAttachmentsPercent >= 0 && c.DemoAttachmentsPercent <= 100, "DEMO_ATTACHMENTS_PERCENT",
+			"must be between 0 and 100, got %d", c.DemoAttachmentsPercent)
+	}
+
+	return errors.Join(errs...)
+}
@@ -1,61 +1,360 @@
 package db
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+
+	"backend/internal/app/announcement"
+	"backend/internal/app/apikey"
 	"backend/internal/app/attachment"
 	"backend/internal/app/board"
+	"backend/internal/app/bookmark"
+	"backend/internal/app/filter"
+	"backend/internal/app/linkpreview"
 	"backend/internal/app/message"
+	"backend/internal/app/notification"
 	"backend/internal/app/session"
+	"backend/internal/app/stats"
 	"backend/internal/app/thread"
 	"backend/internal/app/user"
+	"backend/internal/app/watch"
 	"backend/internal/config"
+	"backend/internal/db/resolver"
+	"backend/internal/providers/secrets"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"go.uber.org/zap"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-func Connect(cfg *config.Config, logger *zap.Logger) (*gorm.DB, error) {
-	dsn := cfg.PostgresDSN()
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
+// Connect opens the pool. DB_USER and DB_PASSWORD are resolved through the
+// secrets manager for every new connection, so rotated credentials are used
+// as soon as the cached secret expires. Replicas from DB_REPLICAS are
+// registered with the resolver plugin and only serve reads marked with
+// resolver.Read.
+func Connect(cfg *config.Config, secretsM *secrets.Manager, logger *zap.Logger) (*gorm.DB, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := secretsM.Check(ctx, cfg.DBUser, cfg.DBPass); err != nil {
 		return nil, err
 	}
 
-	sqlDB, err := db.DB()
+	sqlDB, err := openPool(ctx, cfg, cfg.PostgresDSN(), secretsM)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := sqlDB.Ping(); err != nil {
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{})
+	if err != nil {
 		return nil, err
 	}
 
 	logger.Info("Connected to PostgreSQL",
 		zap.String("host", cfg.DBHost),
 		zap.String("database", cfg.DBName),
+		zap.Int("max_open_conns", cfg.DBMaxOpenConns),
+		zap.Int("max_idle_conns", cfg.DBMaxIdleConns),
 	)
 
+	replicas := make([]*sql.DB, 0, len(cfg.DBReplicas))
+	for _, dsn := range cfg.DBReplicas {
+		replica, err := openPool(ctx, cfg, dsn, secretsM)
+		if err != nil {
+			// A missing replica only costs read capacity, the primary can
+			// serve its share.
+			logger.Warn("Skipping unreachable PostgreSQL replica", zap.String("replica", redactDSN(dsn)), zap.Error(err))
+			continue
+		}
+		replicas = append(replicas, replica)
+		logger.Info("Connected to PostgreSQL replica", zap.String("replica", redactDSN(dsn)))
+	}
+	if err := db.Use(resolver.New(replicas...)); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
-func Migrate(db *gorm.DB, logger *zap.Logger) error {
-	logger.Info("Running database migrations...")
+func openPool(ctx context.Context, cfg *config.Config, dsn string, secretsM *secrets.Manager) (*sql.DB, error) {
+	connConfig, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database settings: %w", err)
+	}
+	sqlDB := stdlib.OpenDB(*connConfig, stdlib.OptionBeforeConnect(func(ctx context.Context, cc *pgx.ConnConfig) error {
+		user, err := secretsM.Resolve(ctx, cfg.DBUser)
+		if err != nil {
+			return err
+		}
+		password, err := secretsM.Resolve(ctx, cfg.DBPass)
+		if err != nil {
+			return err
+		}
+		cc.User, cc.Password = user, password
+		return nil
+	}))
+	sqlDB.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.DBConnMaxIdleTime)
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return sqlDB, nil
+}
+
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil {
+		return u.Redacted()
+	}
+	return dsn
+}
 
-	err := db.AutoMigrate(
+// LogPoolStats logs the pool's usage every interval until ctx is done. A
+// growing wait_count means DB_MAX_OPEN_CONNS is too low for the load.
+func LogPoolStats(ctx context.Context, db *gorm.DB, interval time.Duration, logger *zap.Logger) {
+	sqlDB, err := db.DB()
+	if err != nil || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last sql.DBStats
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats := sqlDB.Stats()
+			logger.Info("Database pool stats",
+				zap.Int("open", stats.OpenConnections),
+				zap.Int("in_use", stats.InUse),
+				zap.Int("idle", stats.Idle),
+				zap.Int("max_open", stats.MaxOpenConnections),
+				zap.Int64("wait_count", stats.WaitCount-last.WaitCount),
+				zap.Duration("wait_duration", stats.WaitDuration-last.WaitDuration),
+				zap.Int64("max_idle_closed", stats.MaxIdleClosed-last.MaxIdleClosed),
+				zap.Int64("max_idle_time_closed", stats.MaxIdleTimeClosed-last.MaxIdleTimeClosed),
+				zap.Int64("max_lifetime_closed", stats.MaxLifetimeClosed-last.MaxLifetimeClosed),
+			)
+			last = stats
+		}
+	}
+}
+
+// models lists every table AutoMigrate manages, in dependency order.
+func models() []interface{} {
+	return []interface{}{
 		&user.User{},
 		&user.UserActivity{},
+		&user.UserBoardActivity{},
+		&user.Settings{},
 		&session.Session{},
 		&board.Board{},
+		&board.BoardChange{},
+		&board.Rule{},
+		&board.Moderator{},
 		&thread.Thread{},
 		&thread.ThreadActivity{},
 		&message.Message{},
 		&attachment.Attachment{},
-	)
+		&notification.Preference{},
+		&notification.Notification{},
+		&notification.PushSubscription{},
+		&apikey.APIKey{},
+		&watch.Watch{},
+		&filter.HiddenThread{},
+		&filter.Rule{},
+		&bookmark.ThreadBookmark{},
+		&bookmark.BoardBookmark{},
+		&announcement.Announcement{},
+		&stats.HourlyPosts{},
+	}
+}
+
+func Migrate(db *gorm.DB, logger *zap.Logger) error {
+	logger.Info("Running database migrations...")
+
+	if err := textIPColumn(db); err != nil {
+		logger.Error("Migrations failed", zap.Error(err))
+		return err
+	}
+
+	// Replies posted before replies_count existed are counted once, when the
+	// column is added.
+	countReplies := db.Migrator().HasTable(&message.Message{}) && !db.Migrator().HasColumn(&message.Message{}, "RepliesCount")
+	// Likewise media links posted before embeds existed are parsed once.
+	parseEmbeds := db.Migrator().HasTable(&message.Message{}) && !db.Migrator().HasColumn(&message.Message{}, "Embeds")
+
+	err := db.AutoMigrate(models()...)
 	if err != nil {
 		logger.Error("Migrations failed", zap.Error(err))
 		return err
 	}
 
+	if countReplies {
+		if err := db.Exec(message.RecountReplies).Error; err != nil {
+			logger.Error("Migrations failed", zap.Error(err))
+			return err
+		}
+	}
+
+	if parseEmbeds {
+		if err := backfillEmbeds(db); err != nil {
+			logger.Error("Migrations failed", zap.Error(err))
+			return err
+		}
+	}
+
+	if err := backfillLastMessageAt(db); err != nil {
+		logger.Error("Migrations failed", zap.Error(err))
+		return err
+	}
+
+	if err := backfillPostNumbers(db); err != nil {
+		logger.Error("Migrations failed", zap.Error(err))
+		return err
+	}
+
+	if err := parentForeignKey(db); err != nil {
+		logger.Error("Migrations failed", zap.Error(err))
+		return err
+	}
+
+	// In-thread search matches to_tsvector('simple', content); the 'simple'
+	// configuration neither stems nor drops stop words, so it suits every
+	// board's language alike.
+	if err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_messages_content_search
+		ON messages USING GIN (to_tsvector('simple', content))`).Error; err != nil {
+		logger.Error("Migrations failed", zap.Error(err))
+		return err
+	}
+
 	logger.Info("Database migrations completed successfully")
 	return nil
 }
+
+// textIPColumn turns users.ip from inet into text so it can hold salted
+// hashes. AutoMigrate would cast with ::text, which appends the netmask and
+// stops the stored IPs from matching, so the change is made here with host().
+func textIPColumn(db *gorm.DB) error {
+	var dataType string
+	err := db.Raw(`SELECT data_type FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'ip'`).Scan(&dataType).Error
+	if err != nil || dataType != "inet" {
+		return err
+	}
+	return db.Exec(`ALTER TABLE users ALTER COLUMN ip TYPE text USING host(ip)`).Error
+}
+
+// backfillLastMessageAt fills user_activity.last_message_at for users who
+// posted before message creation started recording it; the message cooldown
+// is checked against it. Once filled no row matches and this is a no-op.
+func backfillLastMessageAt(db *gorm.DB) error {
+	return db.Exec(`
+		UPDATE user_activity SET last_message_at = last_posts.created_at
+		FROM (
+			SELECT sessions.user_id, MAX(messages.created_at) AS created_at
+			FROM messages JOIN sessions ON sessions.id = messages.created_by_session_id
+			WHERE sessions.user_id IN (
+				SELECT user_id FROM user_activity WHERE message_count > 0 AND last_message_at IS NULL
+			)
+			GROUP BY sessions.user_id
+		) last_posts
+		WHERE user_activity.user_id = last_posts.user_id AND user_activity.last_message_at IS NULL
+	`).Error
+}
+
+// backfillEmbeds fills messages.embeds for the messages that mention a
+// media host, in batches so a large table is not loaded at once.
+func backfillEmbeds(db *gorm.DB) error {
+	var batch []*message.Message
+	return db.Select("id", "content").
+		Where("content ~* ?", `youtu\.?be|vimeo\.com|soundcloud\.com`).
+		FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+			for _, m := range batch {
+				embeds := linkpreview.Embeds(m.Content)
+				if len(embeds) == 0 {
+					continue
+				}
+				if err := db.Model(&message.Message{ID: m.ID}).Select("Embeds").Updates(&message.Message{Embeds: embeds}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// backfillPostNumbers numbers the threads and messages posted before boards
+// had post numbers, per board in posting order and after any numbers already
+// given out. Once numbered no post has post_no 0 and this is a no-op.
+func backfillPostNumbers(db *gorm.DB) error {
+	return db.Exec(`
+		WITH posts AS (
+			SELECT 'thread' AS kind, id, board_id, created_at FROM threads WHERE post_no = 0
+			UNION ALL
+			SELECT 'message', messages.id, threads.board_id, messages.created_at
+			FROM messages JOIN threads ON threads.id = messages.thread_id
+			WHERE messages.post_no = 0
+		), numbered AS (
+			SELECT posts.kind, posts.id, posts.board_id,
+				boards.last_post_no + ROW_NUMBER() OVER (
+					PARTITION BY posts.board_id ORDER BY posts.created_at, posts.kind DESC, posts.id
+				) AS post_no
+			FROM posts JOIN boards ON boards.id = posts.board_id
+		), numbered_threads AS (
+			UPDATE threads SET post_no = numbered.post_no
+			FROM numbered WHERE numbered.kind = 'thread' AND threads.id = numbered.id
+		), numbered_messages AS (
+			UPDATE messages SET post_no = numbered.post_no
+			FROM numbered WHERE numbered.kind = 'message' AND messages.id = numbered.id
+		)
+		UPDATE boards SET last_post_no = last.post_no
+		FROM (SELECT board_id, MAX(post_no) AS post_no FROM numbered GROUP BY board_id) last
+		WHERE boards.id = last.board_id
+	`).Error
+}
+
+// parentForeignKey makes messages.parent_id reference messages.id, first
+// clearing the parent of replies whose parent is gone or in another thread.
+// ON DELETE SET NULL lets the purge jobs remove a parent and keep its
+// replies. Once the constraint exists this is a no-op.
+func parentForeignKey(db *gorm.DB) error {
+	var exists bool
+	err := db.Raw(`SELECT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_messages_parent')`).Scan(&exists).Error
+	if err != nil || exists {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			UPDATE messages SET parent_id = NULL
+			WHERE parent_id IS NOT NULL AND NOT EXISTS (
+				SELECT 1 FROM messages parent
+				WHERE parent.id = messages.parent_id AND parent.thread_id = messages.thread_id
+			)
+		`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`ALTER TABLE messages ADD CONSTRAINT fk_messages_parent
+			FOREIGN KEY (parent_id) REFERENCES messages (id) ON DELETE SET NULL`).Error
+	})
+}
+
+// CheckMigrations reports the first table that AutoMigrate should have
+// created but is missing, e.g. because another instance rolled back.
+func CheckMigrations(ctx context.Context, db *gorm.DB) error {
+	migrator := db.WithContext(ctx).Migrator()
+	for _, model := range models() {
+		if !migrator.HasTable(model) {
+			return fmt.Errorf("missing table for %T", model)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+
+	"backend/internal/app/user"
+	"backend/internal/utils"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const hashIPsBatchSize = 500
+
+// HashUserIPs replaces every raw IP in users.ip with hasher.Hash of it. A
+// user whose hash is already taken, because the visitor came back after
+// hashing was turned on and got a new user, is left alone and counted in
+// skipped.
+func HashUserIPs(ctx context.Context, db *gorm.DB, hasher utils.IPHasher, logger *zap.Logger) (hashed, skipped int, err error) {
+	var lastID uint64
+	for {
+		var users []user.User
+		err := db.WithContext(ctx).Select("id", "ip").
+			Where("id > ? AND ip NOT LIKE ?", lastID, utils.HashedIPPrefix+"%").
+			Order("id").Limit(hashIPsBatchSize).Find(&users).Error
+		if err != nil {
+			return hashed, skipped, err
+		}
+		if len(users) == 0 {
+			return hashed, skipped, nil
+		}
+
+		for _, u := range users {
+			lastID = u.ID
+			hash := hasher.Hash(u.IP)
+			res := db.WithContext(ctx).Exec(
+				`UPDATE users SET ip = ? WHERE id = ? AND NOT EXISTS (SELECT 1 FROM users WHERE ip = ?)`,
+				hash, u.ID, hash,
+			)
+			if res.Error != nil {
+				return hashed, skipped, res.Error
+			}
+			if res.RowsAffected == 0 {
+				logger.Warn("IP hash already belongs to another user, keeping the raw IP", zap.Uint64("user_id", u.ID))
+				skipped++
+				continue
+			}
+			hashed++
+		}
+		logger.Info("Hashed user IPs", zap.Int("hashed", hashed), zap.Int("skipped", skipped))
+	}
+}
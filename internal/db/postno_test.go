@@ -0,0 +1,188 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"backend/internal/app/board"
+	"backend/internal/app/message"
+	"backend/internal/app/session"
+	"backend/internal/app/thread"
+	"backend/internal/app/user"
+
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB connects to the database in TEST_DATABASE_URL and migrates it. The
+// test is skipped without one, since post numbering is only meaningful
+// against PostgreSQL's row locks.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := Migrate(db, zap.NewNop()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// TestConcurrentPostNumbers posts threads and replies on one board at once
+// and checks that every post got its own number, that the numbers run from 1
+// with no gaps, and that no two rows share an ID.
+func TestConcurrentPostNumbers(t *testing.T) {
+	db := testDB(t)
+
+	const threads, messages = 20, 60
+	suffix := time.Now().UnixNano()
+
+	b := &board.Board{Slug: fmt.Sprintf("t%d", suffix), Title: "post numbers"}
+	if err := db.Create(b).Error; err != nil {
+		t.Fatalf("create board: %v", err)
+	}
+	u := &user.User{IP: fmt.Sprintf("test-%d", suffix)}
+	if err := db.Create(u).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	s := &session.Session{SessionKey: fmt.Sprintf("test-%d", suffix), UserID: u.ID}
+	if err := db.Create(s).Error; err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM messages WHERE thread_id IN (SELECT id FROM threads WHERE board_id = ?)`, b.ID)
+		db.Exec(`DELETE FROM threads_activity WHERE thread_id IN (SELECT id FROM threads WHERE board_id = ?)`, b.ID)
+		db.Exec(`DELETE FROM threads WHERE board_id = ?`, b.ID)
+		db.Exec(`DELETE FROM user_board_activity WHERE user_id = ?`, u.ID)
+		db.Exec(`DELETE FROM user_activity WHERE user_id = ?`, u.ID)
+		db.Exec(`DELETE FROM sessions WHERE id = ?`, s.ID)
+		db.Exec(`DELETE FROM users WHERE id = ?`, u.ID)
+		db.Exec(`DELETE FROM boards WHERE id = ?`, b.ID)
+	})
+
+	threadRepo := thread.NewRepository(db)
+	messageRepo := message.NewRepository(db)
+
+	newThread := func(i int) *thread.Thread {
+		now := time.Now()
+		return &thread.Thread{
+			BoardID:            b.ID,
+			Title:              fmt.Sprintf("thread %d", i),
+			Content:            "content",
+			CreatedBySessionID: s.ID,
+			AuthorNickname:     u.Nickname,
+			CreatedAt:          now,
+			UpdatedAt:          now,
+		}
+	}
+	first := newThread(0)
+	if err := threadRepo.CreateThread(first, u.ID); err != nil {
+		t.Fatalf("create thread: %v", err)
+	}
+
+	var (
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		threadIDs  = []uint64{first.ID}
+		messageIDs []uint64
+		errs       []error
+	)
+	record := func(ids *[]uint64, id uint64, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		*ids = append(*ids, id)
+	}
+	for i := 1; i <= threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			th := newThread(i)
+			err := threadRepo.CreateThread(th, u.ID)
+			record(&threadIDs, th.ID, err)
+		}()
+	}
+	for i := 0; i < messages; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m, _, err := messageRepo.CreateMessage(b.ID, first.ID, u.ID, s.ID, nil, fmt.Sprintf("reply %d", i), nil, u.Nickname, false, message.BumpPolicy{})
+			var id uint64
+			if m != nil {
+				id = m.ID
+			}
+			record(&messageIDs, id, err)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		t.Errorf("create post: %v", err)
+	}
+	if t.Failed() {
+		return
+	}
+
+	assertUnique(t, "thread", threadIDs)
+	assertUnique(t, "message", messageIDs)
+
+	var postNos []uint64
+	err := db.Raw(`
+		SELECT post_no FROM threads WHERE board_id = @board
+		UNION ALL
+		SELECT messages.post_no FROM messages JOIN threads ON threads.id = messages.thread_id WHERE threads.board_id = @board
+		ORDER BY post_no
+	`, map[string]any{"board": b.ID}).Scan(&postNos).Error
+	if err != nil {
+		t.Fatalf("list post numbers: %v", err)
+	}
+	total := 1 + threads + messages
+	if len(postNos) != total {
+		t.Fatalf("got %d posts, want %d", len(postNos), total)
+	}
+	for i, postNo := range postNos {
+		if postNo != uint64(i+1) {
+			t.Fatalf("post numbers are not 1..%d without gaps or repeats: got %d at position %d", total, postNo, i+1)
+		}
+	}
+
+	var last uint64
+	if err := db.Raw(`SELECT last_post_no FROM boards WHERE id = ?`, b.ID).Scan(&last).Error; err != nil {
+		t.Fatalf("get last post number: %v", err)
+	}
+	if last != uint64(total) {
+		t.Errorf("boards.last_post_no = %d, want %d", last, total)
+	}
+}
+
+func assertUnique(t *testing.T, kind string, ids []uint64) {
+	t.Helper()
+	sorted := slices.Clone(ids)
+	slices.Sort(sorted)
+	for i, id := range sorted {
+		if id == 0 {
+			t.Errorf("%s created without an ID", kind)
+		}
+		if i > 0 && id == sorted[i-1] {
+			t.Errorf("%s ID %d returned twice", kind, id)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package resolver
+
+import (
+	"database/sql"
+	"errors"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+// Name is the key the plugin is registered under in gorm.Config.Plugins.
+const Name = "resolver"
+
+const readKey = "resolver:read"
+
+// Resolver is a gorm plugin that sends reads marked with Read to one of the
+// replicas, round robin. Everything else, including every statement inside a
+// transaction, stays on the primary. Reads are opt-in rather than automatic
+// because replicas lag: a handler that reads back what it just wrote must see
+// it.
+type Resolver struct {
+	replicas []*sql.DB
+	next     atomic.Uint64
+}
+
+func New(replicas ...*sql.DB) *Resolver {
+	return &Resolver{replicas: replicas}
+}
+
+func (r *Resolver) Name() string {
+	return Name
+}
+
+func (r *Resolver) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Query().Before("gorm:query").Register("resolver:query", r.route); err != nil {
+		return err
+	}
+	return db.Callback().Row().Before("gorm:row").Register("resolver:row", r.route)
+}
+
+// Replicas returns the replica pools, e.g. for health checks and pool stats.
+func (r *Resolver) Replicas() []*sql.DB {
+	return r.replicas
+}
+
+func (r *Resolver) Close() error {
+	var errs []error
+	for _, replica := range r.replicas {
+		errs = append(errs, replica.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Resolver) route(db *gorm.DB) {
+	if len(r.replicas) == 0 {
+		return
+	}
+	if read, ok := db.Get(readKey); !ok || read != true {
+		return
+	}
+	if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); inTx {
+		return
+	}
+	db.Statement.ConnPool = r.replicas[r.next.Add(1)%uint64(len(r.replicas))]
+}
+
+// Read marks the queries built on db as safe to serve from a replica. Use it
+// for listings that tolerate a little replication lag; without replicas it
+// changes nothing.
+func Read(db *gorm.DB) *gorm.DB {
+	return db.Set(readKey, true)
+}
+
+// Of returns the resolver registered on db, or nil.
+func Of(db *gorm.DB) *Resolver {
+	r, _ := db.Config.Plugins[Name].(*Resolver)
+	return r
+}
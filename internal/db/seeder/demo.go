@@ -0,0 +1,377 @@
+package seeder
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"backend/internal/app/attachment"
+	"backend/internal/app/board"
+	"backend/internal/app/message"
+	"backend/internal/app/session"
+	"backend/internal/app/thread"
+	"backend/internal/app/user"
+	"backend/internal/providers/minio"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// demoIP gives demo user i an address from 198.18.0.0/15, the range reserved
+// for benchmarking. The first one, raw or hashed, also tells the seeder
+// whether demo data already exists.
+func demoIP(i int) string {
+	return fmt.Sprintf("198.%d.%d.%d", 18+i/65536%2, i/256%256, i%256)
+}
+
+type DemoOptions struct {
+	Users           int
+	ThreadsPerBoard int
+	MaxReplies      int
+	// AttachmentsPercent of posts get a generated image.
+	AttachmentsPercent int
+	// Seed makes the generated data reproducible; 0 picks a random one.
+	Seed uint64
+}
+
+type demoUser struct {
+	user    user.User
+	session session.Session
+}
+
+// SeedDemo fills every board with fake users, sessions, threads, replies and
+// attachments spread over the last two weeks. It does nothing when demo data
+// is already present. storage may be nil, in which case no attachments are
+// created.
+func (s *Seeder) SeedDemo(opts DemoOptions, storage *minio.MinioProvider) error {
+	var existing int64
+	first := demoIP(0)
+	if err := s.db.Model(&user.User{}).Where("ip IN ?", []string{first, s.ips.Hash(first)}).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		s.logger.Info("Demo data already exists, skipping demo seed")
+		return nil
+	}
+
+	var boards []board.Board
+	if err := s.db.Find(&boards).Error; err != nil {
+		return err
+	}
+	if len(boards) == 0 || opts.Users <= 0 {
+		return nil
+	}
+
+	seed := opts.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	rng := rand.New(rand.NewPCG(seed, seed>>1|1))
+	s.logger.Info("Seeding demo data",
+		zap.Int("users", opts.Users),
+		zap.Int("boards", len(boards)),
+		zap.Int("threads_per_board", opts.ThreadsPerBoard),
+		zap.Uint64("seed", seed),
+	)
+
+	started := time.Now()
+	var threadsCount, messagesCount, attachmentsCount int
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		users, err := s.seedDemoUsers(tx, rng, opts.Users)
+		if err != nil {
+			return err
+		}
+
+		threadCounts := make(map[uint64]int)
+		messageCounts := make(map[uint64]int)
+		lastThreadAt := make(map[uint64]time.Time)
+		lastMessageAt := make(map[uint64]time.Time)
+
+		for _, b := range boards {
+			for i := 0; i < opts.ThreadsPerBoard; i++ {
+				op := users[rng.IntN(len(users))]
+				createdAt := started.Add(-time.Duration(rng.Int64N(int64(14 * 24 * time.Hour))))
+
+				postNo, err := board.NextPostNo(tx, b.ID)
+				if err != nil {
+					return err
+				}
+				t := thread.Thread{
+					BoardID:            b.ID,
+					PostNo:             postNo,
+					Title:              demoTitle(rng),
+					Content:            demoText(rng, nil),
+					CreatedBySessionID: op.session.ID,
+					AuthorNickname:     op.user.Nickname,
+					CreatedAt:          createdAt,
+					UpdatedAt:          createdAt,
+				}
+				if err := tx.Create(&t).Error; err != nil {
+					return err
+				}
+				threadsCount++
+				threadCounts[op.user.ID]++
+				if createdAt.After(lastThreadAt[op.user.ID]) {
+					lastThreadAt[op.user.ID] = createdAt
+				}
+
+				if storage != nil && rng.IntN(100) < opts.AttachmentsPercent {
+					if err := s.seedDemoAttachment(tx, rng, storage, &t.ID, nil, createdAt); err != nil {
+						return err
+					}
+					attachmentsCount++
+				}
+
+				replies := 0
+				if opts.MaxReplies > 0 {
+					replies = rng.IntN(opts.MaxReplies + 1)
+				}
+				postedAt := createdAt
+				var postIDs, postNos []uint64
+				for j := 0; j < replies; j++ {
+					author := users[rng.IntN(len(users))]
+					if rng.IntN(8) == 0 {
+						author = op
+					}
+					postedAt = postedAt.Add(time.Duration(rng.Int64N(int64(3 * time.Hour))))
+					if postedAt.After(started) {
+						break
+					}
+
+					postNo, err := board.NextPostNo(tx, b.ID)
+					if err != nil {
+						return err
+					}
+					m := message.Message{
+						ThreadID:           t.ID,
+						PostNo:             postNo,
+						CreatedBySessionID: author.session.ID,
+						Content:            demoText(rng, postNos),
+						CreatedAt:          postedAt,
+						UpdatedAt:          postedAt,
+						AuthorNickname:     author.user.Nickname,
+						IsAuthor:           author.session.ID == op.session.ID && rng.IntN(2) == 0,
+					}
+					if len(postIDs) > 0 && rng.IntN(4) == 0 {
+						parentID := postIDs[rng.IntN(len(postIDs))]
+						m.ParentID = &parentID
+					}
+					if err := tx.Create(&m).Error; err != nil {
+						return err
+					}
+					if m.ParentID != nil {
+						if err := tx.Exec(`UPDATE messages SET replies_count = replies_count + 1 WHERE id = ?`, *m.ParentID).Error; err != nil {
+							return err
+						}
+					}
+					postIDs = append(postIDs, m.ID)
+					postNos = append(postNos, m.PostNo)
+					messagesCount++
+					messageCounts[author.user.ID]++
+					if postedAt.After(lastMessageAt[author.user.ID]) {
+						lastMessageAt[author.user.ID] = postedAt
+					}
+
+					if storage != nil && rng.IntN(100) < opts.AttachmentsPercent {
+						if err := s.seedDemoAttachment(tx, rng, storage, &t.ID, &m.ID, postedAt); err != nil {
+							return err
+						}
+						attachmentsCount++
+					}
+				}
+
+				if err := tx.Exec(`
+					INSERT INTO threads_activity (thread_id, message_count, bump_at, created_at, updated_at)
+					VALUES (?, ?, ?, ?, ?)
+				`, t.ID, len(postIDs), postedAt, createdAt, postedAt).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, u := range users {
+			id := u.user.ID
+			if threadCounts[id] == 0 && messageCounts[id] == 0 {
+				continue
+			}
+			activity := user.UserActivity{
+				UserID:       id,
+				ThreadCount:  threadCounts[id],
+				MessageCount: messageCounts[id],
+			}
+			if t, ok := lastThreadAt[id]; ok {
+				activity.LastThreadAt = &t
+			}
+			if t, ok := lastMessageAt[id]; ok {
+				activity.LastMessageAt = &t
+			}
+			if err := tx.Create(&activity).Error; err != nil {
+				return err
+			}
+		}
+
+		userIDs := make([]uint64, 0, len(users))
+		for _, u := range users {
+			userIDs = append(userIDs, u.user.ID)
+		}
+		return tx.Exec(`
+			INSERT INTO user_board_activity (user_id, board_id, thread_count, message_count, last_thread_at, last_message_at, created_at, updated_at)
+			SELECT user_id, board_id, thread_count, message_count, last_thread_at, last_message_at, NOW(), NOW()
+			FROM (`+user.BoardActivitySelect+`) stats
+			WHERE user_id IN ?
+		`, userIDs).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to seed demo data: %w", err)
+	}
+
+	s.logger.Info("Seeded demo data",
+		zap.Int("threads", threadsCount),
+		zap.Int("messages", messagesCount),
+		zap.Int("attachments", attachmentsCount),
+		zap.Duration("took", time.Since(started)),
+	)
+	return nil
+}
+
+func (s *Seeder) seedDemoUsers(tx *gorm.DB, rng *rand.Rand, count int) ([]demoUser, error) {
+	users := make([]demoUser, 0, count)
+	for i := 0; i < count; i++ {
+		createdAt := time.Now().Add(-time.Duration(rng.Int64N(int64(30 * 24 * time.Hour))))
+		u := user.User{
+			IP:        s.ips.Hash(demoIP(i)),
+			Nickname:  demoNicknames[rng.IntN(len(demoNicknames))],
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+		}
+		if err := tx.Create(&u).Error; err != nil {
+			return nil, err
+		}
+
+		userAgent := demoUserAgents[rng.IntN(len(demoUserAgents))]
+		sess := session.Session{
+			SessionKey: uuid.New().String(),
+			StartedAt:  createdAt,
+			UserAgent:  &userAgent,
+			UserID:     u.ID,
+			CreatedAt:  createdAt,
+			UpdatedAt:  createdAt,
+		}
+		if err := tx.Create(&sess).Error; err != nil {
+			return nil, err
+		}
+		users = append(users, demoUser{user: u, session: sess})
+	}
+	return users, nil
+}
+
+func (s *Seeder) seedDemoAttachment(tx *gorm.DB, rng *rand.Rand, storage *minio.MinioProvider, threadID, messageID *uint64, createdAt time.Time) error {
+	data, err := demoImage(rng)
+	if err != nil {
+		return err
+	}
+
+	fileID := uuid.New().String()
+	uploaded, err := storage.UploadFromReader(bytes.NewReader(data), "demo/"+fileID+".png", "image/png", int64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&attachment.Attachment{
+		ThreadID:    threadID,
+		MessageID:   messageID,
+		FileID:      fileID,
+		FileName:    fmt.Sprintf("image_%d.png", rng.IntN(100000)),
+		FileURL:     uploaded.URL,
+		FileSize:    uploaded.Size,
+		ContentType: uploaded.ContentType,
+		ObjectName:  uploaded.ObjectName,
+		CreatedAt:   createdAt,
+	}).Error
+}
+
+// demoImage draws a small two-colour gradient so every attachment is a real,
+// distinct PNG.
+func demoImage(rng *rand.Rand) ([]byte, error) {
+	w, h := 160+rng.IntN(320), 120+rng.IntN(240)
+	from := color.RGBA{uint8(rng.IntN(256)), uint8(rng.IntN(256)), uint8(rng.IntN(256)), 255}
+	to := color.RGBA{uint8(rng.IntN(256)), uint8(rng.IntN(256)), uint8(rng.IntN(256)), 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			t := float64(x+y) / float64(w+h)
+			img.Set(x, y, color.RGBA{
+				R: uint8(float64(from.R)*(1-t) + float64(to.R)*t),
+				G: uint8(float64(from.G)*(1-t) + float64(to.G)*t),
+				B: uint8(float64(from.B)*(1-t) + float64(to.B)*t),
+				A: 255,
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func demoTitle(rng *rand.Rand) string {
+	title := demoTitles[rng.IntN(len(demoTitles))]
+	if rng.IntN(3) == 0 {
+		title += " #" + fmt.Sprint(rng.IntN(200)+2)
+	}
+	return title
+}
+
+// demoText builds a post from a few sentences, sometimes quoting earlier
+// posts in the thread (>>post_no) or adding greentext.
+func demoText(rng *rand.Rand, quotable []uint64) string {
+	var lines []string
+	if len(quotable) > 0 && rng.IntN(3) == 0 {
+		lines = append(lines, fmt.Sprintf(">>%d", quotable[rng.IntN(len(quotable))]))
+	}
+	if rng.IntN(5) == 0 {
+		lines = append(lines, ">"+demoSentences[rng.IntN(len(demoSentences))])
+	}
+	for n := 1 + rng.IntN(3); n > 0; n-- {
+		lines = append(lines, demoSentences[rng.IntN(len(demoSentences))])
+	}
+	return strings.Join(lines, "\n")
+}
+
+var demoNicknames = []string{
+	"Аноним", "Аноним", "Аноним", "Аноним", "Кот", "Сенпай", "Вахтёр", "Гость",
+	"anon", "lurker", "oldfag", "newfag", "Программист", "Студент", "Меломан", "Физик",
+}
+
+var demoUserAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15",
+	"Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0",
+	"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148",
+	"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Mobile Safari/537.36",
+}
+
+var demoTitles = []string{
+	"Что сейчас смотрите?", "Тред музыки на вечер", "Посоветуйте книгу", "Go или Rust?",
+	"Фото вашего рабочего места", "Лучшее аниме сезона", "Тред котов", "Почему небо голубое?",
+	"Как выучить английский", "Ваш первый язык программирования", "Тред ночных мыслей",
+	"Обсуждаем новый релиз", "Что приготовить на ужин", "Тред бессонницы", "Какой сейчас год?",
+}
+
+var demoSentences = []string{
+	"Согласен, тоже так думаю.", "Нет, всё совсем не так.", "Пруфы будут?", "Лол, двачую.",
+	"Попробуй перезагрузить.", "Вчера как раз об этом думал.", "Это база.", "Зависит от задачи.",
+	"Сначала прочитай документацию.", "Кто-нибудь ещё тут?", "Бамп.", "Годный тред.",
+	"Слушаю это уже неделю на повторе.", "В оригинале было лучше.", "А мне понравилось.",
+	"Скинь ссылку, пожалуйста.", "Вот тут ты ошибаешься.", "Спасибо, помогло.",
+	"Уже третий раз пересматриваю.", "Не покупай, не стоит своих денег.",
+}
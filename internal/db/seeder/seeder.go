@@ -2,6 +2,7 @@ package seeder
 
 import (
 	"backend/internal/app/board"
+	"backend/internal/utils"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -9,12 +10,14 @@ import (
 
 type Seeder struct {
 	db     *gorm.DB
+	ips    utils.IPHasher
 	logger *zap.Logger
 }
 
-func NewSeeder(db *gorm.DB, logger *zap.Logger) *Seeder {
+func NewSeeder(db *gorm.DB, ips utils.IPHasher, logger *zap.Logger) *Seeder {
 	return &Seeder{
 		db:     db,
+		ips:    ips,
 		logger: logger,
 	}
 }
@@ -4,6 +4,9 @@ import (
 	"net/http"
 	"time"
 
+	"backend/internal/app/session"
+	"backend/internal/utils"
+
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
@@ -14,24 +17,38 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin:     func(r *http.Request) bool { return true },
 }
 
+// @Summary Open a websocket
+// @Description Upgrades to a websocket that streams board, thread and user events; see the README for the message types
+// @Tags WebSocket
+// @Security BearerAuth
+// @Success 101
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 503 {object} utils.ErrorResponse
+// @Router /ws [get]
 func (h *Hub) ServeWS(c *gin.Context) {
-	sessionKey := c.Query("session_key")
+	sessionKey := session.Key(c)
 	if sessionKey == "" {
-		h.logger.Warnw("WebSocket connection rejected: session_key missing",
+		h.logger.Warnw("WebSocket connection rejected: session missing",
 			"client_ip", c.ClientIP(),
 			"user_agent", c.GetHeader("User-Agent"),
 		)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "session_key is required"})
+		utils.RespondError(c, http.StatusBadRequest, "session is required")
+		return
+	}
+
+	if h.closing.Load() {
+		c.Header("Retry-After", "5")
+		utils.RespondError(c, http.StatusServiceUnavailable, "server is shutting down")
 		return
 	}
 
 	session, err := h.sessionSvc.GetSessionByKey(sessionKey)
 	if err != nil {
 		h.logger.Warnw("WebSocket connection rejected: session not found",
-			"session_key", sessionKey,
 			"client_ip", c.ClientIP(),
 		)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "session not found"})
+		utils.RespondError(c, http.StatusUnauthorized, "session not found")
 		return
 	}
 
@@ -39,16 +56,16 @@ func (h *Hub) ServeWS(c *gin.Context) {
 	if err != nil {
 		h.logger.Warnw("WebSocket connection rejected: user not found",
 			"user_id", session.UserID,
-			"session_key", sessionKey,
+			"session_id", session.ID,
 		)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		utils.RespondError(c, http.StatusUnauthorized, "user not found")
 		return
 	}
 
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		h.logger.Errorw("Failed to upgrade connection",
-			"session_key", sessionKey,
+			"session_id", session.ID,
 			"error", err,
 		)
 		return
@@ -56,19 +73,20 @@ func (h *Hub) ServeWS(c *gin.Context) {
 	defer conn.Close()
 
 	client := &Client{
-		hub:        h,
-		conn:       conn,
-		ID:         generateClientID(),
-		SessionID:  session.ID,
-		UserID:     user.ID,
-		SessionKey: sessionKey,
+		hub:       h,
+		conn:      conn,
+		ID:        generateClientID(),
+		SessionID: session.ID,
+		UserID:    user.ID,
+		IP:        c.ClientIP(),
+		rooms:     make(map[string]bool),
+		send:      make(chan []byte, sendQueueSize),
 	}
 
 	h.logger.Infow("WebSocket connection established",
 		"client_id", client.ID,
 		"user_id", client.UserID,
 		"session_id", client.SessionID,
-		"session_key", client.SessionKey,
 		"client_ip", c.ClientIP(),
 		"user_agent", c.GetHeader("User-Agent"),
 	)
@@ -85,7 +103,7 @@ func (h *Hub) ServeWS(c *gin.Context) {
 				"nickname":  user.Nickname,
 				"timestamp": lastChange.Unix(),
 			}
-			if err := conn.WriteJSON(msg); err != nil {
+			if err := client.write(msg); err != nil {
 				h.logger.Errorw("ServeWS: failed to send initial nickname_updated", "user_id", user.ID, "error", err)
 			} else {
 				elapsed := now.Sub(*lastChange)
@@ -101,13 +119,37 @@ func (h *Hub) ServeWS(c *gin.Context) {
 		}
 	}
 
+	client.heartbeat.touch()
+	conn.SetReadLimit(maxCommandSize)
+	conn.SetReadDeadline(pongDeadline())
+	conn.SetPongHandler(func(string) error {
+		client.heartbeat.touch()
+		return conn.SetReadDeadline(pongDeadline())
+	})
+
 	h.register <- client
 
+	if lastEventID := c.Query("last_event_id"); lastEventID != "" {
+		cmd := Command{Action: "replay", LastEventID: lastEventID}
+		if reply := validateCommand(cmd); reply != nil {
+			h.outbound <- outbound{client: client, msg: reply}
+		} else {
+			h.commands <- command{client: client, cmd: cmd}
+		}
+	}
+
 	for {
-		_, _, err := conn.ReadMessage()
+		_, data, err := conn.ReadMessage()
 		if err != nil {
 			break
 		}
+
+		cmd, reply := parseCommand(data)
+		if reply != nil {
+			h.outbound <- outbound{client: client, msg: reply}
+			continue
+		}
+		h.commands <- command{client: client, cmd: cmd}
 	}
 	h.unregister <- client
 }
@@ -0,0 +1,57 @@
+package websocket
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// writeWait bounds every write so a stalled peer cannot block the hub.
+	writeWait = 10 * time.Second
+	// pingPeriod is how often the server pings each client.
+	pingPeriod = 30 * time.Second
+	// maxMissedPongs is how many consecutive pings may go unanswered before
+	// the hub drops the connection.
+	maxMissedPongs = 3
+)
+
+// pongDeadline is the read deadline backstop: any frame or pong from the
+// client pushes it forward.
+func pongDeadline() time.Time {
+	return time.Now().Add(pingPeriod*maxMissedPongs + writeWait)
+}
+
+type heartbeat struct {
+	lastPong atomic.Int64
+}
+
+func (hb *heartbeat) touch() {
+	hb.lastPong.Store(time.Now().UnixNano())
+}
+
+func (hb *heartbeat) missedPongs() int {
+	return int(time.Since(time.Unix(0, hb.lastPong.Load())) / pingPeriod)
+}
+
+func (c *Client) write(msg interface{}) error {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		return err
+	}
+	return c.conn.WriteJSON(msg)
+}
+
+// reapDeadClients drops connections that stopped answering pings. Closing
+// the connection also unblocks the client's read loop.
+func (h *Hub) reapDeadClients() {
+	for client := range h.clients {
+		if missed := client.heartbeat.missedPongs(); missed >= maxMissedPongs {
+			h.logger.Infow("Dropping unresponsive client",
+				"client_id", client.ID,
+				"user_id", client.UserID,
+				"missed_pongs", missed,
+			)
+			h.removeClient(client, "missed pongs")
+			client.conn.Close()
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package websocket
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"backend/internal/app/session"
@@ -12,20 +16,36 @@ import (
 	"backend/internal/providers/redis"
 	"backend/internal/utils"
 
+	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 )
 
 type Client struct {
-	hub        *Hub
-	conn       ClientConn
-	ID         string
-	SessionID  uint64
-	UserID     uint64
-	SessionKey string
+	hub       *Hub
+	conn      ClientConn
+	ID        string
+	SessionID uint64
+	UserID    uint64
+	IP        string
+
+	// rooms is owned by the hub goroutine.
+	rooms     map[string]bool
+	heartbeat heartbeat
+	send      chan []byte
+	replaying bool
+	held      []heldFrame
+
+	// closeCode and closeText are sent in the close frame once send is
+	// closed; they are set before the close, so the write pump sees them.
+	closeCode int
+	closeText string
 }
 
 type ClientConn interface {
 	WriteJSON(v interface{}) error
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetWriteDeadline(t time.Time) error
 	ReadMessage() (messageType int, p []byte, err error)
 	Close() error
 }
@@ -40,13 +60,30 @@ func generateClientID() string {
 
 type Hub struct {
 	clients    map[*Client]bool
+	rooms      map[string]map[*Client]bool
 	register   chan *Client
 	unregister chan *Client
+	commands   chan command
+	outbound   chan outbound
+	replays    chan replayResult
 	logger     *zap.SugaredLogger
 	sessionSvc session.Service
 	eventBus   *utils.EventBus
+	events     *utils.Subscription
 	userRepo   user.Repository
 	redisP     *redis.RedisProvider
+	eventLog   *redis.EventLog
+
+	presence       *redis.Presence
+	presenceCounts chan presenceResult
+
+	limits         Limits
+	connsByIP      map[string]int
+	connsBySession map[uint64]int
+
+	shutdown chan shutdownRequest
+	closing  atomic.Bool
+	pending  sync.WaitGroup
 }
 
 func NewHub(
@@ -55,319 +92,373 @@ func NewHub(
 	eventBus *utils.EventBus,
 	userRepo user.Repository,
 	redisP *redis.RedisProvider,
+	eventLog *redis.EventLog,
+	presence *redis.Presence,
+	limits Limits,
 ) *Hub {
 	hub := &Hub{
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		commands:   make(chan command),
+		outbound:   make(chan outbound, 64),
+		replays:    make(chan replayResult),
 		clients:    make(map[*Client]bool),
+		rooms:      make(map[string]map[*Client]bool),
 		logger:     logger.Sugar(),
 		sessionSvc: sessionSvc,
 		eventBus:   eventBus,
+		events:     eventBus.Subscribe("websocket_hub"),
 		userRepo:   userRepo,
 		redisP:     redisP,
-	}
+		eventLog:   eventLog,
 
-	hub.eventBus.Subscribe("nickname_updated", func(event utils.Event) {
-		hub.logger.Infow("EventBus: nickname_updated triggered")
-		hub.handleNicknameUpdated(event)
-	})
+		presence:       presence,
+		presenceCounts: make(chan presenceResult),
 
-	hub.eventBus.Subscribe("thread_created", func(event utils.Event) {
-		hub.logger.Infow("EventBus: thread_created triggered")
-		hub.handleThreadCreated(event)
-	})
+		limits:         limits,
+		connsByIP:      make(map[string]int),
+		connsBySession: make(map[uint64]int),
 
-	hub.eventBus.Subscribe("message_created", func(event utils.Event) {
-		hub.logger.Infow("EventBus: message_created triggered")
-		hub.handleMessageCreated(event)
-	})
-
-	hub.eventBus.Subscribe("stats_updated", func(event utils.Event) {
-		hub.logger.Infow("EventBus: stats_updated triggered")
-		hub.handleStatsUpdated(event)
-	})
+		shutdown: make(chan shutdownRequest),
+	}
 
 	return hub
 }
 
 func (h *Hub) Run() {
 	h.logger.Info("WebSocket Hub started")
-	eventCh := h.eventBus.SubscribeCh()
+	reaper := time.NewTicker(pingPeriod)
+	defer reaper.Stop()
+	presenceTicker := time.NewTicker(presenceInterval)
+	defer presenceTicker.Stop()
 
 	for {
 		select {
+		case <-reaper.C:
+			h.reapDeadClients()
+
+		case <-presenceTicker.C:
+			h.snapshotPresence()
+
+		case r := <-h.presenceCounts:
+			h.broadcastPresence(r)
+
+		case req := <-h.shutdown:
+			h.closeAll(req)
+
 		case client := <-h.register:
+			if h.closing.Load() {
+				h.rejectClient(client, websocket.CloseServiceRestart, "server restarting")
+				continue
+			}
+			if reason, ok := h.admit(client); !ok {
+				h.logger.Warnw("WebSocket connection rejected: limit reached",
+					"client_id", client.ID,
+					"user_id", client.UserID,
+					"client_ip", client.IP,
+					"reason", reason,
+				)
+				h.rejectClient(client, closeTooManyConnections, reason)
+				continue
+			}
 			h.clients[client] = true
+			h.track(client.writePump)
 			h.logger.Infow("Client connected",
 				"client_id", client.ID,
 				"user_id", client.UserID,
 				"session_id", client.SessionID,
-				"session_key", client.SessionKey,
 				"clients_count", len(h.clients),
 			)
 
 		case client := <-h.unregister:
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
+			h.removeClient(client, "disconnected")
 
-				h.logger.Infow("Client disconnected",
-					"client_id", client.ID,
-					"user_id", client.UserID,
-					"session_id", client.SessionID,
-					"clients_count", len(h.clients),
-				)
+		case c := <-h.commands:
+			h.dispatch(c)
 
-				go func() {
-					if err := h.sessionSvc.UpdateSessionEndedAt(client.SessionID); err != nil {
-						h.logger.Errorw("Failed to close session on disconnect",
-							"session_id", client.SessionID,
-							"user_id", client.UserID,
-							"error", err,
-						)
-					} else {
-						h.logger.Debugw("Session ended_at updated",
-							"session_id", client.SessionID,
-							"user_id", client.UserID,
-						)
-					}
-				}()
-
-				go func() {
-					ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-					defer cancel()
-
-					cacheKey := fmt.Sprintf("user:%d:session:%d", client.UserID, client.SessionID)
-					if err := h.redisP.Client.Del(ctx, cacheKey).Err(); err != nil {
-						h.logger.Errorw("Failed to delete Redis cache on disconnect",
-							"cache_key", cacheKey,
-							"error", err,
-						)
-					} else {
-						h.logger.Debugw("Redis cache deleted on disconnect",
-							"cache_key", cacheKey,
-						)
-					}
-				}()
-			}
+		case r := <-h.replays:
+			h.finishReplay(r)
 
-		case event := <-eventCh:
-			h.logger.Infow("EventBus: Received event", "event", event.Event, "data", event.Data)
+		case out := <-h.outbound:
+			h.sendTo(out.client, out.msg)
+
+		case event := <-h.events.C():
+			h.logger.Infow("EventBus: Received event", "event", event.Event, "request_id", event.RequestID, "data", event.Data)
 			h.handleEvent(event)
 		}
 	}
 }
 
+// removeClient detaches a client from the hub. It runs only on the hub
+// goroutine and is idempotent, so broadcast failures, eviction and reaping
+// can drop clients in place instead of sending on h.unregister, which the
+// hub itself would have to receive.
+func (h *Hub) removeClient(client *Client, reason string) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	delete(h.clients, client)
+	h.release(client)
+	h.leaveAllRooms(client)
+	close(client.send)
+
+	h.logger.Infow("Client disconnected",
+		"client_id", client.ID,
+		"user_id", client.UserID,
+		"session_id", client.SessionID,
+		"reason", reason,
+		"clients_count", len(h.clients),
+	)
+
+	h.track(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		cacheKey := fmt.Sprintf("user:%d:session:%d", client.UserID, client.SessionID)
+		if err := h.redisP.Client.Del(ctx, cacheKey).Err(); err != nil {
+			h.logger.Errorw("Failed to delete Redis cache on disconnect",
+				"cache_key", cacheKey,
+				"error", err,
+			)
+		} else {
+			h.logger.Debugw("Redis cache deleted on disconnect",
+				"cache_key", cacheKey,
+			)
+		}
+	})
+}
+
 func (h *Hub) handleEvent(event utils.Event) {
-	switch event.Event {
-	case "nickname_updated":
-		h.handleNicknameUpdated(event)
-	case "thread_created":
-		h.handleThreadCreated(event)
-	case "message_created":
-		h.handleMessageCreated(event)
-	case "stats_updated":
-		h.handleStatsUpdated(event)
+	switch p := event.Data.(type) {
+	case utils.NicknameUpdated:
+		h.handleNicknameUpdated(event, p)
+	case utils.ThreadCreated, utils.ThreadUpdated, utils.MessageCreated, utils.LinkPreviews:
+		h.handleRoomEvent(event)
+	case utils.StatsUpdated:
+		h.handleStatsUpdated(p)
+	case utils.Notification:
+		h.handleNotification(event, p)
+	case utils.UploadProgress:
+		h.handleUploadProgress(p)
+	case utils.WatchedThreadReply:
+		h.handleWatchedThreadReply(event, p)
+	case utils.SettingsUpdated:
+		// Consumed by the settings service; nothing to tell clients.
+	case utils.SessionRevoked:
+		h.handleSessionRevoked(p)
+	case utils.BoardCreated:
+		h.handleBoardCreated(event, p)
+	case utils.Announcement:
+		h.handleAnnouncement(p)
+	case utils.MaintenanceMode:
+		h.handleMaintenanceMode(p)
 	default:
-		h.logger.Warnw("Unknown event type", "event", event.Event)
+		if event.Event == utils.EventResync {
+			h.handleResync()
+			return
+		}
+		h.logger.Warnw("Unknown event type", "event", event.Event, "data_type", fmt.Sprintf("%T", event.Data))
 	}
 }
 
-func (h *Hub) handleThreadCreated(event utils.Event) {
-	data, ok := event.Data.(map[string]interface{})
+func (h *Hub) handleRoomEvent(event utils.Event) {
+	msg, rooms, ok := h.roomEventMessage(event)
 	if !ok {
-		h.logger.Errorw("handleThreadCreated: invalid data type",
-			"data_type", fmt.Sprintf("%T", event.Data),
-			"data", event.Data)
 		return
 	}
 
-	timestamp, hasTimestamp := data["timestamp"]
-	if !hasTimestamp {
-		h.logger.Errorw("handleThreadCreated: missing timestamp in event data")
-		return
-	}
+	sent := h.broadcastEvent(h.roomRecipients(rooms...), event.ID, msg)
+	h.logger.Infow("Room event broadcast completed", "event", event.Event, "request_id", event.RequestID, "sent_to_clients", sent)
+}
 
-	threadID, hasThreadID := data["thread_id"]
-	if !hasThreadID {
-		h.logger.Errorw("handleThreadCreated: missing thread_id in event data")
-		return
+// roomEventMessage formats room-scoped events, live or replayed, as the
+// flat JSON object clients expect and returns the rooms they belong to.
+func (h *Hub) roomEventMessage(event utils.Event) (map[string]interface{}, []string, bool) {
+	var rooms []string
+	switch p := event.Data.(type) {
+	case utils.ThreadCreated:
+		rooms = []string{boardRoom(p.BoardID)}
+	case utils.ThreadUpdated:
+		rooms = []string{threadRoom(p.ThreadID), boardRoom(p.BoardID)}
+	case utils.MessageCreated:
+		rooms = []string{threadRoom(p.ThreadID), boardRoom(p.BoardID)}
+	case utils.LinkPreviews:
+		rooms = []string{threadRoom(p.ThreadID)}
+	default:
+		return nil, nil, false
 	}
 
-	boardID, hasBoardID := data["board_id"]
-	if !hasBoardID {
-		h.logger.Errorw("handleThreadCreated: missing board_id in event data")
-		return
+	msg, err := flattenPayload(event.Data)
+	if err != nil {
+		h.logger.Errorw("Failed to format event", "event", event.Event, "error", err)
+		return nil, nil, false
+	}
+	msg["event"] = event.Event
+	if event.RequestID != "" {
+		msg["request_id"] = event.RequestID
+	}
+	if event.ID != "" {
+		msg["event_id"] = event.ID
 	}
+	return msg, rooms, true
+}
 
+func (h *Hub) handleNicknameUpdated(event utils.Event, p utils.NicknameUpdated) {
 	msg := map[string]interface{}{
-		"event":     "thread_created",
-		"thread_id": threadID,
-		"board_id":  boardID,
-		"timestamp": timestamp,
+		"event":     utils.EventNicknameUpdated,
+		"user_id":   p.UserID,
+		"nickname":  p.Nickname,
+		"timestamp": p.Timestamp,
 	}
-
-	for k, v := range data {
-		if k != "thread_id" && k != "board_id" && k != "timestamp" {
-			msg[k] = v
-		}
+	if event.RequestID != "" {
+		msg["request_id"] = event.RequestID
 	}
 
-	sent := 0
-	for client := range h.clients {
-		if err := client.conn.WriteJSON(msg); err != nil {
-			h.logger.Errorw("Failed to send thread_created to client",
-				"client_id", client.ID,
-				"user_id", client.UserID,
-				"error", err)
-			client.conn.Close()
-			h.unregister <- client
-		} else {
-			h.logger.Debugw("Sent thread_created to client",
-				"client_id", client.ID,
-				"user_id", client.UserID)
-			sent++
-		}
+	sent := h.broadcast(h.userClients(p.UserID), msg)
+	h.logger.Infow("nickname_updated broadcast completed", "request_id", event.RequestID, "sent_to_clients", sent)
+}
+
+func (h *Hub) handleStatsUpdated(p utils.StatsUpdated) {
+	msg := map[string]interface{}{
+		"event": utils.EventStatsUpdated,
+		"data":  p,
 	}
 
-	h.logger.Infow("thread_created broadcast completed", "sent_to_clients", sent)
+	sent := h.broadcast(h.clients, msg)
+	h.logger.Infow("stats_updated broadcast completed", "sent_to_clients", sent)
 }
 
-func (h *Hub) handleMessageCreated(event utils.Event) {
-	data, ok := event.Data.(map[string]interface{})
-	if !ok {
-		h.logger.Errorw("handleMessageCreated: invalid data type",
-			"data_type", fmt.Sprintf("%T", event.Data),
-			"data", event.Data)
-		return
+func (h *Hub) handleBoardCreated(event utils.Event, p utils.BoardCreated) {
+	msg := map[string]interface{}{
+		"event": utils.EventBoardCreated,
+		"data":  p,
 	}
-
-	timestamp, hasTimestamp := data["timestamp"]
-	if !hasTimestamp {
-		h.logger.Errorw("handleMessageCreated: missing timestamp in event data")
-		return
+	if event.RequestID != "" {
+		msg["request_id"] = event.RequestID
 	}
 
-	messageID, hasMessageID := data["message_id"]
-	if !hasMessageID {
-		h.logger.Errorw("handleMessageCreated: missing message_id in event data")
-		return
-	}
+	sent := h.broadcast(h.clients, msg)
+	h.logger.Infow("board_created broadcast completed", "board_id", p.BoardID, "request_id", event.RequestID, "sent_to_clients", sent)
+}
 
-	threadID, hasThreadID := data["thread_id"]
-	if !hasThreadID {
-		h.logger.Errorw("handleMessageCreated: missing thread_id in event data")
-		return
+func (h *Hub) handleAnnouncement(p utils.Announcement) {
+	msg := map[string]interface{}{
+		"event": utils.EventAnnouncement,
+		"data":  p,
 	}
 
+	sent := h.broadcast(h.clients, msg)
+	h.logger.Infow("announcement broadcast completed", "announcement_id", p.ID, "active", p.Active, "sent_to_clients", sent)
+}
+
+func (h *Hub) handleMaintenanceMode(p utils.MaintenanceMode) {
 	msg := map[string]interface{}{
-		"event":      "message_created",
-		"message_id": messageID,
-		"thread_id":  threadID,
-		"timestamp":  timestamp,
+		"event": utils.EventMaintenanceMode,
+		"data":  p,
 	}
 
-	for k, v := range data {
-		if k != "message_id" && k != "thread_id" && k != "timestamp" {
-			msg[k] = v
-		}
-	}
+	sent := h.broadcast(h.clients, msg)
+	h.logger.Infow("maintenance_mode broadcast completed", "enabled", p.Enabled, "sent_to_clients", sent)
+}
 
-	sent := 0
-	for client := range h.clients {
-		if err := client.conn.WriteJSON(msg); err != nil {
-			h.logger.Errorw("Failed to send message_created to client",
-				"client_id", client.ID,
-				"user_id", client.UserID,
-				"error", err)
-			client.conn.Close()
-			h.unregister <- client
-		} else {
-			sent++
-		}
+func (h *Hub) handleNotification(event utils.Event, p utils.Notification) {
+	msg := map[string]interface{}{
+		"event":     utils.EventNotification,
+		"id":        p.ID,
+		"type":      p.Type,
+		"data":      p.Data,
+		"timestamp": p.Timestamp,
 	}
 
-	h.logger.Infow("message_created broadcast completed", "sent_to_clients", sent)
+	sent := h.broadcast(h.userClients(p.UserID), msg)
+	h.logger.Infow("notification delivery completed", "user_id", p.UserID, "type", p.Type, "request_id", event.RequestID, "sent_to_clients", sent)
 }
 
-func (h *Hub) handleNicknameUpdated(event utils.Event) {
-	data, ok := event.Data.(map[string]interface{})
-	if !ok {
-		h.logger.Errorw("handleNicknameUpdated: invalid data type",
-			"data_type", fmt.Sprintf("%T", event.Data),
-			"data", event.Data)
-		return
+func (h *Hub) handleUploadProgress(p utils.UploadProgress) {
+	msg := map[string]interface{}{
+		"event":      utils.EventUploadProgress,
+		"upload_id":  p.UploadID,
+		"file_index": p.FileIndex,
+		"file_name":  p.FileName,
+		"status":     p.Status,
+		"bytes":      p.Bytes,
+		"total":      p.Total,
+		"percent":    p.Percent,
+		"timestamp":  p.Timestamp,
 	}
 
-	userIDRaw, exists := data["user_id"]
-	if !exists {
-		h.logger.Errorw("handleNicknameUpdated: missing user_id in event")
-		return
+	h.broadcast(h.userClients(p.UserID), msg)
+}
+
+// handleSessionRevoked closes every connection of a revoked session with
+// closeSessionRevoked, so the device is signed out at once rather than when
+// it next calls the API.
+func (h *Hub) handleSessionRevoked(p utils.SessionRevoked) {
+	closed := 0
+	for client := range h.clients {
+		if client.SessionID != p.SessionID {
+			continue
+		}
+		client.closeCode = closeSessionRevoked
+		client.closeText = "session revoked"
+		h.removeClient(client, "session revoked")
+		closed++
 	}
+	if closed > 0 {
+		h.logger.Infow("Closed connections of revoked session", "session_id", p.SessionID, "user_id", p.UserID, "closed", closed)
+	}
+}
 
-	var userID uint64
-	switch v := userIDRaw.(type) {
-	case float64:
-		userID = uint64(v)
-	case int:
-		userID = uint64(v)
-	case int64:
-		userID = uint64(v)
-	case uint64:
-		userID = v
-	default:
-		h.logger.Errorw("handleNicknameUpdated: unsupported user_id type",
-			"user_id_value", v,
-			"user_id_type", fmt.Sprintf("%T", v))
-		return
+// handleResync closes every connection after the hub fell so far behind the
+// event bus that events were dropped. Clients reconnect with last_event_id
+// and get what they missed from the event log, which the hub cannot resend
+// itself.
+func (h *Hub) handleResync() {
+	h.logger.Warnw("Event bus dropped events for the hub, closing connections to resync", "clients_count", len(h.clients))
+	for client := range h.clients {
+		client.closeCode = websocket.CloseTryAgainLater
+		client.closeText = "missed events, reconnect"
+		h.removeClient(client, "resync")
 	}
+}
 
-	nickname, _ := data["nickname"].(string)
-	timestamp, _ := data["timestamp"]
+func (h *Hub) handleWatchedThreadReply(event utils.Event, p utils.WatchedThreadReply) {
+	watchers := make(map[uint64]bool, len(p.UserIDs))
+	for _, id := range p.UserIDs {
+		watchers[id] = true
+	}
 
 	msg := map[string]interface{}{
-		"event":     "nickname_updated",
-		"user_id":   userID,
-		"nickname":  nickname,
-		"timestamp": timestamp,
+		"event":      utils.EventWatchedThreadReply,
+		"thread_id":  p.ThreadID,
+		"message_id": p.MessageID,
+		"timestamp":  p.Timestamp,
 	}
 
-	sent := 0
+	recipients := make(map[*Client]bool)
 	for client := range h.clients {
-		if client.UserID == userID {
-			if err := client.conn.WriteJSON(msg); err != nil {
-				h.logger.Errorw("Failed to send nickname_updated to client",
-					"client_id", client.ID,
-					"user_id", client.UserID,
-					"error", err)
-				client.conn.Close()
-				h.unregister <- client
-			} else {
-				h.logger.Debugw("Sent nickname_updated to client",
-					"client_id", client.ID,
-					"user_id", client.UserID,
-					"nickname", nickname)
-				sent++
-			}
+		if watchers[client.UserID] {
+			recipients[client] = true
 		}
 	}
-	h.logger.Infow("nickname_updated broadcast completed", "sent_to_clients", sent)
+
+	sent := h.broadcast(recipients, msg)
+	h.logger.Infow("watched_thread_reply delivery completed", "thread_id", p.ThreadID, "request_id", event.RequestID, "sent_to_clients", sent)
 }
 
-func (h *Hub) handleStatsUpdated(event utils.Event) {
-	msg := map[string]interface{}{
-		"event": "stats_updated",
-		"data":  event.Data,
+// flattenPayload turns a payload struct into a map so envelope fields can be
+// added alongside its own. Numbers are kept as json.Number to stay exact.
+func flattenPayload(p utils.Payload) (map[string]interface{}, error) {
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
 	}
 
-	sent := 0
-	for client := range h.clients {
-		if err := client.conn.WriteJSON(msg); err != nil {
-			h.logger.Errorw("Failed to send stats_updated", "client_id", client.ID, "error", err)
-			client.conn.Close()
-			h.unregister <- client
-		} else {
-			sent++
-		}
+	var msg map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&msg); err != nil {
+		return nil, err
 	}
-	h.logger.Infow("stats_updated broadcast completed", "sent_to_clients", sent)
+	return msg, nil
 }
@@ -0,0 +1,41 @@
+package websocket
+
+import "fmt"
+
+// closeTooManyConnections is sent when a connection would exceed a limit.
+// Clients should not reconnect automatically on it.
+const closeTooManyConnections = 4029
+
+// closeSessionRevoked is sent when the connection's session is signed out.
+// Clients should drop the token and not reconnect with it.
+const closeSessionRevoked = 4001
+
+// Limits caps concurrent connections; zero disables a cap.
+type Limits struct {
+	PerIP      int
+	PerSession int
+}
+
+// admit counts the client against its IP and session, or reports which
+// cap it would exceed. It runs on the hub goroutine.
+func (h *Hub) admit(client *Client) (string, bool) {
+	if h.limits.PerIP > 0 && h.connsByIP[client.IP] >= h.limits.PerIP {
+		return fmt.Sprintf("too many connections from this IP (max %d)", h.limits.PerIP), false
+	}
+	if h.limits.PerSession > 0 && h.connsBySession[client.SessionID] >= h.limits.PerSession {
+		return fmt.Sprintf("too many connections for this session (max %d)", h.limits.PerSession), false
+	}
+
+	h.connsByIP[client.IP]++
+	h.connsBySession[client.SessionID]++
+	return "", true
+}
+
+func (h *Hub) release(client *Client) {
+	if h.connsByIP[client.IP]--; h.connsByIP[client.IP] <= 0 {
+		delete(h.connsByIP, client.IP)
+	}
+	if h.connsBySession[client.SessionID]--; h.connsBySession[client.SessionID] <= 0 {
+		delete(h.connsBySession, client.SessionID)
+	}
+}
@@ -0,0 +1,90 @@
+package websocket
+
+import (
+	"context"
+	"time"
+
+	"backend/internal/providers/redis"
+)
+
+// presenceInterval is how often the hub refreshes presence in Redis and
+// pushes online_count events.
+const presenceInterval = 15 * time.Second
+
+type presenceResult struct {
+	counts map[string]int64
+}
+
+// snapshotPresence runs on the hub goroutine and hands the Redis round trip
+// to a goroutine, which reports back through h.presenceCounts.
+func (h *Hub) snapshotPresence() {
+	if h.presence == nil {
+		return
+	}
+
+	rooms := map[string][]uint64{redis.PresenceAll: nil}
+	seen := make(map[string]map[uint64]bool)
+	for client := range h.clients {
+		for _, room := range append([]string{redis.PresenceAll}, client.roomList()...) {
+			if seen[room] == nil {
+				seen[room] = make(map[uint64]bool)
+			}
+			if !seen[room][client.SessionID] {
+				seen[room][client.SessionID] = true
+				rooms[room] = append(rooms[room], client.SessionID)
+			}
+		}
+	}
+	for room := range h.rooms {
+		if _, ok := rooms[room]; !ok {
+			rooms[room] = nil
+		}
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		if err := h.presence.Touch(ctx, rooms); err != nil {
+			h.logger.Errorw("Failed to update presence", "error", err)
+			return
+		}
+
+		names := make([]string, 0, len(rooms))
+		for room := range rooms {
+			names = append(names, room)
+		}
+		counts, err := h.presence.Counts(ctx, names...)
+		if err != nil {
+			h.logger.Errorw("Failed to read presence counts", "error", err)
+			return
+		}
+		h.presenceCounts <- presenceResult{counts: counts}
+	}()
+}
+
+// broadcastPresence sends every client the site-wide count plus the counts
+// of the rooms it is subscribed to.
+func (h *Hub) broadcastPresence(r presenceResult) {
+	now := time.Now().UTC().Unix()
+	for client := range h.clients {
+		rooms := make(map[string]int64, len(client.rooms))
+		for room := range client.rooms {
+			rooms[room] = r.counts[room]
+		}
+		h.sendTo(client, map[string]interface{}{
+			"event":     "online_count",
+			"total":     r.counts[redis.PresenceAll],
+			"rooms":     rooms,
+			"timestamp": now,
+		})
+	}
+}
+
+func (c *Client) roomList() []string {
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
@@ -0,0 +1,149 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"backend/internal/providers/redis"
+)
+
+const maxCommandSize = 4096
+
+// Command is a client-to-server message. ID is optional and echoed back in
+// the ack or error so clients can correlate replies.
+type Command struct {
+	ID        string `json:"id,omitempty"`
+	Action    string `json:"action"`
+	Room      string `json:"room,omitempty"`
+	ThreadID  uint64 `json:"thread_id,omitempty"`
+	MessageID uint64 `json:"message_id,omitempty"`
+
+	LastEventID string `json:"last_event_id,omitempty"`
+}
+
+type command struct {
+	client *Client
+	cmd    Command
+}
+
+type outbound struct {
+	client *Client
+	msg    interface{}
+}
+
+const (
+	errCodeInvalidJSON    = "invalid_json"
+	errCodeUnknownAction  = "unknown_action"
+	errCodeInvalidRoom    = "invalid_room"
+	errCodeTooManyRooms   = "too_many_rooms"
+	errCodeInvalidPayload = "invalid_payload"
+	errCodeInternal       = "internal_error"
+)
+
+// parseCommand decodes and validates a raw client frame. On failure it
+// returns the error reply to send back.
+func parseCommand(data []byte) (Command, map[string]interface{}) {
+	var cmd Command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return cmd, errorReply(cmd, errCodeInvalidJSON, "message must be a JSON object")
+	}
+	return cmd, validateCommand(cmd)
+}
+
+func validateCommand(cmd Command) map[string]interface{} {
+	switch cmd.Action {
+	case "subscribe", "unsubscribe":
+		if !validRoom(cmd.Room) {
+			return errorReply(cmd, errCodeInvalidRoom, "room must be board:<id> or thread:<id>")
+		}
+	case "mark_read":
+		if cmd.ThreadID == 0 || cmd.MessageID == 0 {
+			return errorReply(cmd, errCodeInvalidPayload, "thread_id and message_id are required")
+		}
+	case "replay":
+		if !redis.ValidStreamID(cmd.LastEventID) {
+			return errorReply(cmd, errCodeInvalidPayload, "last_event_id must be an event ID")
+		}
+	case "ping":
+	case "":
+		return errorReply(cmd, errCodeInvalidPayload, "action is required")
+	default:
+		return errorReply(cmd, errCodeUnknownAction, fmt.Sprintf("unknown action %q", cmd.Action))
+	}
+	return nil
+}
+
+func ackReply(cmd Command, extra map[string]interface{}) map[string]interface{} {
+	msg := map[string]interface{}{
+		"event":  "ack",
+		"action": cmd.Action,
+	}
+	if cmd.ID != "" {
+		msg["id"] = cmd.ID
+	}
+	for k, v := range extra {
+		msg[k] = v
+	}
+	return msg
+}
+
+func errorReply(cmd Command, code, message string) map[string]interface{} {
+	msg := map[string]interface{}{
+		"event": "error",
+		"code":  code,
+		"error": message,
+	}
+	if cmd.Action != "" {
+		msg["action"] = cmd.Action
+	}
+	if cmd.ID != "" {
+		msg["id"] = cmd.ID
+	}
+	return msg
+}
+
+// dispatch runs on the hub goroutine. Commands that need I/O hand off to a
+// goroutine and reply through h.outbound.
+func (h *Hub) dispatch(c command) {
+	client, cmd := c.client, c.cmd
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+
+	switch cmd.Action {
+	case "subscribe":
+		if code, err := h.joinRoom(client, cmd.Room); err != "" {
+			h.sendTo(client, errorReply(cmd, code, err))
+			return
+		}
+		h.sendTo(client, ackReply(cmd, map[string]interface{}{"room": cmd.Room}))
+	case "unsubscribe":
+		h.leaveRoom(client, cmd.Room)
+		h.sendTo(client, ackReply(cmd, map[string]interface{}{"room": cmd.Room}))
+	case "ping":
+		reply := ackReply(cmd, map[string]interface{}{"timestamp": time.Now().UTC().Unix()})
+		reply["event"] = "pong"
+		h.sendTo(client, reply)
+	case "mark_read":
+		go h.markRead(client, cmd)
+	case "replay":
+		h.startReplay(client, cmd)
+	}
+}
+
+// markRead stores the client's read position off the hub goroutine.
+func (h *Hub) markRead(client *Client, cmd Command) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := h.redisP.MarkRead(ctx, client.UserID, cmd.ThreadID, cmd.MessageID)
+
+	reply := ackReply(cmd, map[string]interface{}{"thread_id": cmd.ThreadID, "message_id": cmd.MessageID})
+	if err != nil {
+		h.logger.Errorw("mark_read failed", "client_id", client.ID, "user_id", client.UserID, "error", err)
+		reply = errorReply(cmd, errCodeInternal, "failed to store read position")
+	}
+	h.outbound <- outbound{client: client, msg: reply}
+}
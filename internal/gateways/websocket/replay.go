@@ -0,0 +1,101 @@
+package websocket
+
+import (
+	"context"
+	"time"
+
+	"backend/internal/providers/redis"
+	"backend/internal/utils"
+)
+
+// replayLimit caps how many missed events one replay delivers; clients that
+// fell further behind get replay_truncated and should refetch over HTTP.
+const replayLimit = 500
+
+type heldFrame struct {
+	eventID string
+	payload []byte
+}
+
+type replayResult struct {
+	client    *Client
+	cmd       Command
+	events    []utils.Event
+	truncated bool
+	err       error
+}
+
+// startReplay runs on the hub goroutine. Live frames for the client are held
+// back until the stream read completes so missed events arrive first.
+func (h *Hub) startReplay(client *Client, cmd Command) {
+	if h.eventLog == nil {
+		h.sendTo(client, errorReply(cmd, errCodeInternal, "event replay is not available"))
+		return
+	}
+	if client.replaying {
+		h.sendTo(client, errorReply(cmd, errCodeInvalidPayload, "replay already in progress"))
+		return
+	}
+	client.replaying = true
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		events, truncated, err := h.eventLog.Since(ctx, cmd.LastEventID, replayLimit)
+		h.replays <- replayResult{client: client, cmd: cmd, events: events, truncated: truncated, err: err}
+	}()
+}
+
+func (h *Hub) finishReplay(r replayResult) {
+	client := r.client
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+
+	client.replaying = false
+	held := client.held
+	client.held = nil
+
+	lastID := r.cmd.LastEventID
+	replayed := 0
+	if r.err != nil {
+		h.logger.Errorw("Event replay failed", "client_id", client.ID, "error", r.err)
+		h.sendTo(client, errorReply(r.cmd, errCodeInternal, "failed to read missed events"))
+	} else {
+		for _, event := range r.events {
+			lastID = event.ID
+
+			msg, rooms, ok := h.roomEventMessage(event)
+			if !ok || !client.receives(rooms) {
+				continue
+			}
+			h.sendTo(client, msg)
+			replayed++
+		}
+		if r.truncated {
+			h.sendTo(client, map[string]interface{}{"event": "replay_truncated"})
+		}
+		h.sendTo(client, ackReply(r.cmd, map[string]interface{}{"replayed": replayed, "last_event_id": lastID}))
+	}
+
+	for _, frame := range held {
+		if frame.eventID != "" && redis.CompareStreamIDs(frame.eventID, lastID) <= 0 {
+			continue
+		}
+		h.enqueue(client, frame.payload)
+	}
+}
+
+// receives mirrors roomRecipients for a single client.
+func (c *Client) receives(rooms []string) bool {
+	if len(c.rooms) == 0 {
+		return true
+	}
+	for _, room := range rooms {
+		if c.rooms[room] {
+			return true
+		}
+	}
+	return false
+}
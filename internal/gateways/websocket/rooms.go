@@ -0,0 +1,79 @@
+package websocket
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const maxRoomsPerClient = 50
+
+func boardRoom(boardID uint64) string {
+	return fmt.Sprintf("board:%d", boardID)
+}
+
+func threadRoom(threadID uint64) string {
+	return fmt.Sprintf("thread:%d", threadID)
+}
+
+// validRoom accepts "board:<id>" and "thread:<id>".
+func validRoom(room string) bool {
+	kind, id, ok := strings.Cut(room, ":")
+	if !ok || (kind != "board" && kind != "thread") {
+		return false
+	}
+	_, err := strconv.ParseUint(id, 10, 64)
+	return err == nil
+}
+
+// joinRoom returns an error code and message when the join is refused.
+func (h *Hub) joinRoom(client *Client, room string) (string, string) {
+	if !client.rooms[room] && len(client.rooms) >= maxRoomsPerClient {
+		return errCodeTooManyRooms, fmt.Sprintf("at most %d subscriptions per connection", maxRoomsPerClient)
+	}
+
+	members, ok := h.rooms[room]
+	if !ok {
+		members = make(map[*Client]bool)
+		h.rooms[room] = members
+	}
+	members[client] = true
+	client.rooms[room] = true
+
+	h.logger.Debugw("Client joined room", "client_id", client.ID, "room", room)
+	return "", ""
+}
+
+func (h *Hub) leaveRoom(client *Client, room string) {
+	delete(client.rooms, room)
+	if members, ok := h.rooms[room]; ok {
+		delete(members, client)
+		if len(members) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+}
+
+func (h *Hub) leaveAllRooms(client *Client) {
+	for room := range client.rooms {
+		h.leaveRoom(client, room)
+	}
+}
+
+// roomRecipients returns the members of the given rooms. Clients that never
+// subscribed to anything keep receiving every broadcast, so older frontends
+// work unchanged.
+func (h *Hub) roomRecipients(rooms ...string) map[*Client]bool {
+	recipients := make(map[*Client]bool)
+	for client := range h.clients {
+		if len(client.rooms) == 0 {
+			recipients[client] = true
+		}
+	}
+	for _, room := range rooms {
+		for client := range h.rooms[room] {
+			recipients[client] = true
+		}
+	}
+	return recipients
+}
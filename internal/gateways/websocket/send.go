@@ -0,0 +1,132 @@
+package websocket
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// sendQueueSize is how many outgoing frames a client may have pending before
+// it is considered too slow and evicted.
+const sendQueueSize = 256
+
+// writePump is the only goroutine that writes data frames to the
+// connection. It exits when the hub closes the send queue or a write fails.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case payload, ok := <-c.send:
+			if !ok {
+				code := c.closeCode
+				if code == 0 {
+					code = websocket.CloseNormalClosure
+				}
+				c.conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(code, c.closeText),
+					time.Now().Add(writeWait))
+				return
+			}
+			if err := c.writeRaw(payload); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) writeRaw(payload []byte) error {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		return err
+	}
+	return c.conn.WriteMessage(websocket.TextMessage, payload)
+}
+
+// enqueue hands a frame to the client's write pump without blocking. A full
+// queue means the client cannot keep up, so it is evicted on the spot.
+func (h *Hub) enqueue(client *Client, payload []byte) bool {
+	return h.enqueueEvent(client, "", payload)
+}
+
+// enqueueEvent is enqueue for frames carrying an event ID, which lets a
+// pending replay drop live frames it has already delivered.
+func (h *Hub) enqueueEvent(client *Client, eventID string, payload []byte) bool {
+	if _, ok := h.clients[client]; !ok {
+		return false
+	}
+
+	if client.replaying {
+		if len(client.held) < sendQueueSize {
+			client.held = append(client.held, heldFrame{eventID: eventID, payload: payload})
+			return true
+		}
+		h.logger.Warnw("Evicting client: too many frames held during replay", "client_id", client.ID)
+		h.removeClient(client, "replay backlog full")
+		client.conn.Close()
+		return false
+	}
+
+	select {
+	case client.send <- payload:
+		return true
+	default:
+		h.logger.Warnw("Evicting slow client: send queue full",
+			"client_id", client.ID,
+			"user_id", client.UserID,
+			"queue_size", sendQueueSize,
+		)
+		h.removeClient(client, "send queue full")
+		client.conn.Close()
+		return false
+	}
+}
+
+func (h *Hub) sendTo(client *Client, msg interface{}) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		h.logger.Errorw("Failed to encode websocket message", "client_id", client.ID, "error", err)
+		return
+	}
+	h.enqueue(client, payload)
+}
+
+// broadcast encodes msg once and queues it for every recipient, returning
+// how many clients accepted it.
+func (h *Hub) broadcast(recipients map[*Client]bool, msg interface{}) int {
+	return h.broadcastEvent(recipients, "", msg)
+}
+
+func (h *Hub) broadcastEvent(recipients map[*Client]bool, eventID string, msg interface{}) int {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		h.logger.Errorw("Failed to encode websocket broadcast", "error", err)
+		return 0
+	}
+
+	sent := 0
+	for client := range recipients {
+		if h.enqueueEvent(client, eventID, payload) {
+			sent++
+		}
+	}
+	return sent
+}
+
+func (h *Hub) userClients(userID uint64) map[*Client]bool {
+	clients := make(map[*Client]bool)
+	for client := range h.clients {
+		if client.UserID == userID {
+			clients[client] = true
+		}
+	}
+	return clients
+}
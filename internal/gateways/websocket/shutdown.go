@@ -0,0 +1,94 @@
+package websocket
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Clients are told to wait a random delay in this window before
+// reconnecting, so a restart does not bring every socket back at once.
+const (
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = 10 * time.Second
+)
+
+type shutdownRequest struct {
+	done chan struct{}
+}
+
+// Shutdown stops accepting connections, sends every client a reconnect hint
+// followed by a 1012 (service restart) close frame, and waits until their
+// write pumps have flushed and their disconnect cleanup has finished.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	if !h.closing.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	req := shutdownRequest{done: make(chan struct{})}
+	select {
+	case h.shutdown <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-req.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		h.pending.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		h.logger.Info("WebSocket Hub shut down")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// closeAll runs on the hub goroutine.
+func (h *Hub) closeAll(req shutdownRequest) {
+	h.logger.Infow("Closing websocket clients for shutdown", "clients_count", len(h.clients))
+
+	for client := range h.clients {
+		client.closeCode = websocket.CloseServiceRestart
+		client.closeText = "server restarting"
+
+		delay := reconnectMinDelay + rand.N(reconnectMaxDelay-reconnectMinDelay)
+		h.sendTo(client, map[string]interface{}{
+			"event":              "reconnect",
+			"reason":             "server_shutdown",
+			"reconnect_after_ms": delay.Milliseconds(),
+		})
+		h.removeClient(client, "server shutdown")
+	}
+	close(req.done)
+}
+
+// rejectClient turns away a connection that was never registered. Its write
+// pump is not tracked: Shutdown may already be waiting.
+func (h *Hub) rejectClient(client *Client, code int, text string) {
+	client.closeCode = code
+	client.closeText = text
+	close(client.send)
+	go client.writePump()
+}
+
+// track runs fn in a goroutine that Shutdown waits for. It is only called
+// from the hub goroutine before closeAll finishes, which keeps every Add
+// ahead of the Wait in Shutdown.
+func (h *Hub) track(fn func()) {
+	h.pending.Add(1)
+	go func() {
+		defer h.pending.Done()
+		fn()
+	}()
+}
@@ -3,24 +3,21 @@ package middleware
 import (
 	"net/http"
 
+	"backend/internal/utils"
+
 	"github.com/gin-gonic/gin"
 )
 
 func AdminAPIKeyMiddleware(adminAPIKey string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if adminAPIKey == "" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "cleanup not configured"})
+			utils.RespondError(c, http.StatusForbidden, "admin api not configured")
 			c.Abort()
 			return
 		}
 
-		apiKey := c.GetHeader("X-Admin-API-Key")
-		if apiKey == "" {
-			apiKey = c.Query("api_key")
-		}
-
-		if apiKey != adminAPIKey {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid api key"})
+		if !isAdmin(c, adminAPIKey) {
+			utils.RespondError(c, http.StatusUnauthorized, "invalid api key")
 			c.Abort()
 			return
 		}
@@ -28,3 +25,12 @@ func AdminAPIKeyMiddleware(adminAPIKey string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// isAdmin reports whether the request carries the admin API key.
+func isAdmin(c *gin.Context, adminAPIKey string) bool {
+	apiKey := c.GetHeader("X-Admin-API-Key")
+	if apiKey == "" {
+		apiKey = c.Query("api_key")
+	}
+	return adminAPIKey != "" && apiKey == adminAPIKey
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"backend/internal/app/apikey"
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyMiddleware authenticates third-party clients that present an
+// X-API-Key header. Requests without the header pass through untouched;
+// keyed requests are limited to read-only methods and their key's quota.
+func APIKeyMiddleware(service apikey.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rawKey := c.GetHeader("X-API-Key")
+		if rawKey == "" {
+			c.Next()
+			return
+		}
+
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead && c.Request.Method != http.MethodOptions {
+			utils.RespondError(c, http.StatusForbidden, "api keys are read-only")
+			c.Abort()
+			return
+		}
+
+		key, quota, err := service.Authorize(c.Request.Context(), rawKey)
+		if quota != nil {
+			var retryAfter time.Duration
+			if errors.Is(err, apikey.ErrQuotaExceeded) {
+				retryAfter = quota.RetryAfter
+			}
+			utils.SetRateLimitHeaders(c.Writer.Header(), quota.Limit, quota.Remaining, retryAfter)
+		}
+
+		switch {
+		case errors.Is(err, apikey.ErrQuotaExceeded):
+			utils.RespondError(c, http.StatusTooManyRequests, err.Error())
+			c.Abort()
+			return
+		case err != nil:
+			utils.RespondError(c, http.StatusUnauthorized, err.Error())
+			c.Abort()
+			return
+		}
+
+		c.Set("api_key_id", key.ID)
+		c.Next()
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"backend/internal/app/board"
+	"backend/internal/app/session"
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BoardModeratorMiddleware lets through requests that carry the admin API key
+// or come from a session of a moderator of the board named by :slug.
+func BoardModeratorMiddleware(adminAPIKey string, boards board.Service, sessions session.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isAdmin(c, adminAPIKey) {
+			board.SetModerator(c, "admin")
+			c.Next()
+			return
+		}
+
+		sessionKey := session.Key(c)
+		if sessionKey == "" {
+			utils.RespondError(c, http.StatusUnauthorized, "session is required")
+			c.Abort()
+			return
+		}
+		user, err := sessions.GetUserBySessionKey(sessionKey)
+		if err != nil {
+			utils.RespondError(c, http.StatusUnauthorized, "invalid session")
+			c.Abort()
+			return
+		}
+
+		ok, err := boards.IsModerator(c.Param("slug"), user.ID)
+		switch {
+		case errors.Is(err, utils.ErrNotFound):
+			utils.RespondError(c, http.StatusNotFound, "board not found")
+			c.Abort()
+			return
+		case err != nil:
+			utils.RespondError(c, http.StatusInternalServerError, "failed to check moderator rights")
+			c.Abort()
+			return
+		case !ok:
+			utils.RespondError(c, http.StatusForbidden, "only board moderators can do this")
+			c.Abort()
+			return
+		}
+
+		board.SetModerator(c, fmt.Sprintf("user:%d", user.ID))
+		c.Next()
+	}
+}
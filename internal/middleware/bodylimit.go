@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BodyLimitMiddleware caps request bodies before any handler reads them:
+// multipart forms at multipartLimit(c), which knows the file policy of the
+// board being posted to, and every other body at maxBody. A declared
+// Content-Length over the limit is refused with 413 up front; a body without
+// one is cut off at the limit, so the handler fails to read it.
+func BodyLimitMiddleware(maxBody int64, multipartLimit func(c *gin.Context) int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		limit := maxBody
+		if strings.HasPrefix(c.ContentType(), "multipart/form-data") && multipartLimit != nil {
+			if l := multipartLimit(c); l > 0 {
+				limit = l
+			}
+		}
+
+		if c.Request.ContentLength > limit {
+			c.JSON(http.StatusRequestEntityTooLarge, utils.ErrorResponse{
+				Code:    utils.CodeTooLarge,
+				Message: "request body too large",
+				Details: gin.H{"max_bytes": limit},
+			})
+			c.Abort()
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"backend/internal/app/session"
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientKeyMiddleware puts the hashed client IP into the request context
+// for limits that must hold across identity rotation; see
+// utils.ClientKeyFromContext.
+func ClientKeyMiddleware(ips utils.IPHasher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ip := session.ClientIP(c); ip != "" {
+			c.Request = c.Request.WithContext(utils.ContextWithClientKey(c.Request.Context(), ips.Hash(ip)))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"backend/internal/app/session"
+	"backend/internal/providers/redis"
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	goredis "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	idempotencyHeader       = "Idempotency-Key"
+	idempotencyMaxKeyLength = 255
+	idempotencyPending      = "pending"
+)
+
+// idempotentPaths are the create endpoints a retried request could
+// double-post on.
+var idempotentPaths = map[string]bool{
+	"/api/threads/:board_id":   true,
+	"/api/messages/:thread_id": true,
+	"/api/upload":              true,
+}
+
+type storedResponse struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware makes thread, message and upload creation safe to
+// retry. A POST with an Idempotency-Key header runs once per key, session
+// and route within ttl; later requests with the same key get the stored
+// response back with Idempotent-Replayed: true, or 409 while the first one
+// is still running. Only successful responses are kept, so a request that
+// failed can be retried with the same key.
+func IdempotencyMiddleware(redisP *redis.RedisProvider, ttl time.Duration, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyHeader)
+		if key == "" || c.Request.Method != http.MethodPost || !idempotentPaths[c.FullPath()] {
+			c.Next()
+			return
+		}
+		if len(key) > idempotencyMaxKeyLength {
+			utils.RespondError(c, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			c.Abort()
+			return
+		}
+
+		ctx := c.Request.Context()
+		redisKey := idempotencyKey(c, key)
+
+		ok, err := redisP.Client.SetNX(ctx, redisKey, idempotencyPending, ttl).Result()
+		if err != nil {
+			logger.Warn("Idempotency check failed", zap.String("key", redisKey), zap.Error(err))
+			c.Next()
+			return
+		}
+		if !ok {
+			replayStored(c, redisP, redisKey)
+			return
+		}
+
+		w := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		// The request context may already be cancelled by now.
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		status := w.Status()
+		if status < 200 || status >= 300 {
+			redisP.Client.Del(ctx, redisKey)
+			return
+		}
+		data, err := json.Marshal(storedResponse{
+			Status:      status,
+			ContentType: w.Header().Get("Content-Type"),
+			Body:        w.body.Bytes(),
+		})
+		if err == nil {
+			err = redisP.Client.Set(ctx, redisKey, data, goredis.KeepTTL).Err()
+		}
+		if err != nil {
+			logger.Warn("Failed to store idempotent response", zap.String("key", redisKey), zap.Error(err))
+			redisP.Client.Del(ctx, redisKey)
+		}
+	}
+}
+
+func replayStored(c *gin.Context, redisP *redis.RedisProvider, redisKey string) {
+	defer c.Abort()
+
+	data, err := redisP.Client.Get(c.Request.Context(), redisKey).Result()
+	if errors.Is(err, goredis.Nil) || data == idempotencyPending {
+		utils.RespondError(c, http.StatusConflict, "a request with this Idempotency-Key is still in progress")
+		return
+	}
+	var stored storedResponse
+	if err == nil {
+		err = json.Unmarshal([]byte(data), &stored)
+	}
+	if err != nil {
+		c.Error(err)
+		utils.RespondError(c, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(stored.Status, stored.ContentType, stored.Body)
+}
+
+// idempotencyKey scopes the client's key to its session (or address, for
+// requests without one) and route, so two clients picking the same key do
+// not see each other's responses.
+func idempotencyKey(c *gin.Context, key string) string {
+	client := session.Key(c)
+	if client == "" {
+		client = c.ClientIP()
+	}
+	sum := sha256.Sum256([]byte(client + "\x00" + c.Request.URL.Path + "\x00" + key))
+	return "idempotency:" + hex.EncodeToString(sum[:])
+}
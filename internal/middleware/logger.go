@@ -18,6 +18,7 @@ func LoggerMiddleware(zapLogger *zap.Logger) gin.HandlerFunc {
 			zap.Int("status", c.Writer.Status()),
 			zap.Duration("duration", time.Since(start)),
 			zap.String("client_ip", c.ClientIP()),
+			zap.String("request_id", c.GetString("request_id")),
 		)
 	}
 }
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"backend/internal/app/settings"
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaintenanceMiddleware rejects writes with 503 while maintenance mode is on.
+// Reads keep working, and admin routes stay open so the switch can be turned
+// back off.
+func MaintenanceMiddleware(service settings.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if strings.HasPrefix(c.Request.URL.Path, "/api/admin") {
+			c.Next()
+			return
+		}
+
+		current := service.Current()
+		if current.MaintenanceMode {
+			utils.RespondError(c, http.StatusServiceUnavailable, current.MaintenanceMessage)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"backend/internal/app/antispam"
+	"backend/internal/app/ipreputation"
+	"backend/internal/app/session"
+	"backend/internal/app/settings"
+	"backend/internal/config"
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const captchaTokenHeader = "X-Captcha-Token"
+
+// OriginMiddleware looks up the client IP of every write in the reputation
+// lists, applies the geo policy of its country and puts the result into the
+// request context, where the services check it against the board's proxy
+// policy. Admin and session routes are left alone, so nobody is locked out
+// of reading.
+//
+// New threads and replies from Tor, a datacenter or a country with the
+// captcha policy may carry a captcha response in captcha_token (or the
+// X-Captcha-Token header), which is verified here; captcha may be nil, and
+// then no response is ever accepted. Every geo policy decision is counted in
+// audit.
+func OriginMiddleware(
+	reputation ipreputation.Service,
+	captcha antispam.CaptchaVerifier,
+	settingsSvc settings.Service,
+	audit ipreputation.Audit,
+	logger *zap.Logger,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		path := c.Request.URL.Path
+		if strings.HasPrefix(path, "/api/admin") || strings.HasPrefix(path, "/api/session") {
+			c.Next()
+			return
+		}
+
+		ip := session.ClientIP(c)
+		origin := reputation.Lookup(ip)
+		var policy string
+		if origin.Country != "" {
+			policy = settingsSvc.Current().GeoPolicies[origin.Country]
+		}
+		if policy == config.GeoReadOnly {
+			audit.Record(c.Request.Context(), origin.Country, ipreputation.DecisionReadOnly)
+			refuse(c, utils.CodeGeoBlocked, "the site is read-only from your country")
+			return
+		}
+
+		if c.Request.Method == http.MethodPost && spamCheckedPaths[c.FullPath()] {
+			if policy == config.GeoBlock {
+				audit.Record(c.Request.Context(), origin.Country, ipreputation.DecisionBlocked)
+				refuse(c, utils.CodeGeoBlocked, "posting from your country is not allowed")
+				return
+			}
+			if captcha != nil && (origin.Anonymized() || policy == config.GeoCaptcha) {
+				token := c.GetHeader(captchaTokenHeader)
+				if token == "" {
+					fields, ok := readPostFields(c)
+					if !ok {
+						return
+					}
+					token = fields.CaptchaToken
+				}
+				if token != "" {
+					passed, err := captcha.Verify(c.Request.Context(), token, ip)
+					if err != nil {
+						logger.Warn("Failed to verify captcha", zap.Error(err),
+							zap.String("request_id", utils.RequestIDFromContext(c.Request.Context())))
+					}
+					origin.CaptchaPassed = passed
+				}
+			}
+			if policy == config.GeoCaptcha {
+				if !origin.CaptchaPassed {
+					audit.Record(c.Request.Context(), origin.Country, ipreputation.DecisionCaptchaRequired)
+					refuse(c, utils.CodeCaptcha, "posts from your country need a solved captcha")
+					return
+				}
+				audit.Record(c.Request.Context(), origin.Country, ipreputation.DecisionCaptchaPassed)
+			}
+		}
+
+		c.Request = c.Request.WithContext(utils.ContextWithOrigin(c.Request.Context(), origin))
+		c.Next()
+	}
+}
+
+func refuse(c *gin.Context, code, message string) {
+	c.JSON(http.StatusForbidden, utils.ErrorResponse{Code: code, Message: message})
+	c.Abort()
+}
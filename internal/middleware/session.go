@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"backend/internal/app/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionMiddleware puts the request's session key into the gin context for
+// handlers to read with session.Key. Keys in the query string still work but
+// get Deprecation and Warning headers, since they end up in access logs and
+// Referer headers.
+func SessionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, fromQuery := session.KeyFromRequest(c.Request)
+		if key != "" {
+			session.SetKey(c, key)
+		}
+		if fromQuery {
+			c.Header("Deprecation", "true")
+			c.Header("Warning", `299 - "session_key query parameter is deprecated; send Authorization: Bearer <key> or the session_key cookie"`)
+		}
+		c.Next()
+	}
+}
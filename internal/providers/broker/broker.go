@@ -0,0 +1,67 @@
+package broker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"backend/internal/providers/redis"
+	"backend/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+const (
+	KindMemory = "memory"
+	KindRedis  = "redis"
+	KindNATS   = "nats"
+	KindKafka  = "kafka"
+)
+
+// Broker relays EventBus events beyond this process: locally published events
+// come in through Forward, and events from elsewhere are injected back into
+// the bus by Run.
+type Broker interface {
+	utils.Forwarder
+	Run(ctx context.Context)
+}
+
+type Options struct {
+	Kind         string
+	Topic        string
+	NATSURL      string
+	KafkaRESTURL string
+}
+
+// envelope tags every relayed event with the instance that published it so
+// an instance can skip its own events when they come back.
+type envelope struct {
+	Origin string      `json:"origin"`
+	Event  utils.Event `json:"event"`
+}
+
+// New builds the broker selected by opts.Kind. The in-process bus needs no
+// broker, so KindMemory returns nil.
+func New(opts Options, redisP *redis.RedisProvider, bus *utils.EventBus, logger *zap.Logger) (Broker, error) {
+	switch opts.Kind {
+	case KindMemory, "":
+		return nil, nil
+	case KindRedis:
+		return redis.NewEventBridge(redisP, bus, opts.Topic, logger), nil
+	case KindNATS:
+		return NewNATSBroker(opts.NATSURL, opts.Topic, bus, logger)
+	case KindKafka:
+		return NewKafkaBroker(opts.KafkaRESTURL, opts.Topic, bus, logger)
+	default:
+		return nil, fmt.Errorf("unknown event broker %q", opts.Kind)
+	}
+}
+
+func instanceID() string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	host, _ := os.Hostname()
+	return host + "-" + hex.EncodeToString(suffix)
+}
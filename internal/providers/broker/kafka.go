@@ -0,0 +1,227 @@
+package broker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"backend/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+const (
+	kafkaContentType  = "application/vnd.kafka.v2+json"
+	kafkaJSONType     = "application/vnd.kafka.json.v2+json"
+	kafkaBatchSize    = 100
+	kafkaPollTimeout  = time.Second
+	kafkaRetryBackoff = 5 * time.Second
+)
+
+var kafkaTopicPattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+
+// KafkaBroker talks to Kafka through a Confluent-compatible REST Proxy (v2
+// API). Every instance consumes with its own consumer group so each one sees
+// all events, the same way the Redis and NATS brokers behave.
+type KafkaBroker struct {
+	baseURL    string
+	topic      string
+	bus        *utils.EventBus
+	instanceID string
+	client     *http.Client
+	outgoing   chan utils.Event
+	logger     *zap.SugaredLogger
+}
+
+type kafkaRecord struct {
+	Value json.RawMessage `json:"value"`
+}
+
+func NewKafkaBroker(restURL, topic string, bus *utils.EventBus, logger *zap.Logger) (*KafkaBroker, error) {
+	if restURL == "" {
+		return nil, fmt.Errorf("KAFKA_REST_URL is required for the kafka event broker")
+	}
+	if !kafkaTopicPattern.MatchString(topic) {
+		return nil, fmt.Errorf("invalid Kafka topic %q", topic)
+	}
+
+	return &KafkaBroker{
+		baseURL:    strings.TrimRight(restURL, "/"),
+		topic:      topic,
+		bus:        bus,
+		instanceID: instanceID(),
+		client:     &http.Client{Timeout: 10 * time.Second},
+		outgoing:   make(chan utils.Event, 256),
+		logger:     logger.Sugar(),
+	}, nil
+}
+
+func (b *KafkaBroker) Forward(event utils.Event) {
+	select {
+	case b.outgoing <- event:
+	default:
+		b.logger.Warnw("KafkaBroker: outgoing queue full, dropping event", "event", event.Event)
+	}
+}
+
+func (b *KafkaBroker) Run(ctx context.Context) {
+	b.logger.Infow("KafkaBroker started", "rest_url", b.baseURL, "topic", b.topic, "instance_id", b.instanceID)
+	go b.consume(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-b.outgoing:
+			batch := []utils.Event{event}
+		drain:
+			for len(batch) < kafkaBatchSize {
+				select {
+				case event := <-b.outgoing:
+					batch = append(batch, event)
+				default:
+					break drain
+				}
+			}
+			if err := b.produce(ctx, batch); err != nil {
+				b.logger.Errorw("KafkaBroker: failed to publish events", "count", len(batch), "error", err)
+			}
+		}
+	}
+}
+
+func (b *KafkaBroker) produce(ctx context.Context, events []utils.Event) error {
+	records := make([]kafkaRecord, 0, len(events))
+	for _, event := range events {
+		value, err := json.Marshal(envelope{Origin: b.instanceID, Event: event})
+		if err != nil {
+			b.logger.Errorw("KafkaBroker: failed to encode event", "event", event.Event, "error", err)
+			continue
+		}
+		records = append(records, kafkaRecord{Value: value})
+	}
+
+	return b.call(ctx, http.MethodPost, b.baseURL+"/topics/"+b.topic, kafkaJSONType,
+		map[string]interface{}{"records": records}, nil)
+}
+
+// consume keeps a REST Proxy consumer instance alive and polls it, recreating
+// it whenever the proxy forgets it (e.g. after a proxy restart).
+func (b *KafkaBroker) consume(ctx context.Context) {
+	group := "404chan-" + b.instanceID
+	for ctx.Err() == nil {
+		instanceURL, err := b.createConsumer(ctx, group)
+		if err == nil {
+			err = b.poll(ctx, instanceURL)
+			b.deleteConsumer(instanceURL)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		b.logger.Warnw("KafkaBroker: consumer failed, retrying", "error", err, "retry_in", kafkaRetryBackoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(kafkaRetryBackoff):
+		}
+	}
+}
+
+func (b *KafkaBroker) createConsumer(ctx context.Context, group string) (string, error) {
+	var created struct {
+		BaseURI string `json:"base_uri"`
+	}
+	err := b.call(ctx, http.MethodPost, b.baseURL+"/consumers/"+group, kafkaContentType, map[string]string{
+		"name":              b.instanceID,
+		"format":            "json",
+		"auto.offset.reset": "latest",
+	}, &created)
+	if err != nil {
+		return "", fmt.Errorf("failed to create consumer: %w", err)
+	}
+
+	err = b.call(ctx, http.MethodPost, created.BaseURI+"/subscription", kafkaContentType, map[string][]string{
+		"topics": {b.topic},
+	}, nil)
+	if err != nil {
+		b.deleteConsumer(created.BaseURI)
+		return "", fmt.Errorf("failed to subscribe consumer: %w", err)
+	}
+	return created.BaseURI, nil
+}
+
+func (b *KafkaBroker) poll(ctx context.Context, instanceURL string) error {
+	recordsURL := fmt.Sprintf("%s/records?timeout=%d", instanceURL, kafkaPollTimeout.Milliseconds())
+	for ctx.Err() == nil {
+		var records []kafkaRecord
+		if err := b.call(ctx, http.MethodGet, recordsURL, kafkaJSONType, nil, &records); err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			var env envelope
+			if err := json.Unmarshal(record.Value, &env); err != nil {
+				b.logger.Warnw("KafkaBroker: malformed message", "error", err)
+				continue
+			}
+			if env.Origin == b.instanceID {
+				continue
+			}
+			b.bus.Inject(env.Event)
+		}
+	}
+	return ctx.Err()
+}
+
+func (b *KafkaBroker) deleteConsumer(instanceURL string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.call(ctx, http.MethodDelete, instanceURL, kafkaContentType, nil, nil); err != nil {
+		b.logger.Debugw("KafkaBroker: failed to delete consumer", "error", err)
+	}
+}
+
+// call sends body as JSON with the given media type and decodes the response
+// into out when it is non-nil.
+func (b *KafkaBroker) call(ctx context.Context, method, url, mediaType string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", mediaType)
+	}
+	req.Header.Set("Accept", mediaType)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: status %d: %s", method, url, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
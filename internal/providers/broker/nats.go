@@ -0,0 +1,287 @@
+package broker
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+const (
+	natsDialTimeout  = 5 * time.Second
+	natsPingInterval = 30 * time.Second
+	natsMaxBackoff   = 30 * time.Second
+)
+
+// NATSBroker speaks the NATS core text protocol directly: one PUB per
+// forwarded event and a single SUB on the topic for events from elsewhere.
+// It reconnects with backoff and drops outgoing events while disconnected.
+//
+// The connection is upgraded to TLS for a tls:// URL or when the server
+// requires it; the server certificate is checked against the system roots
+// (SSL_CERT_FILE adds a private CA). Only what fan-out needs is implemented:
+// there is no JetStream, no headers (HMSG), no client certificates, no NKey,
+// JWT or credentials-file auth, and no failover to the cluster URLs the
+// server advertises, so the one server in NATS_URL must be reachable.
+type NATSBroker struct {
+	addr       string
+	tls        *tls.Config
+	user       string
+	pass       string
+	token      string
+	subject    string
+	bus        *utils.EventBus
+	instanceID string
+	outgoing   chan utils.Event
+	logger     *zap.SugaredLogger
+}
+
+func NewNATSBroker(rawURL, subject string, bus *utils.EventBus, logger *zap.Logger) (*NATSBroker, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid NATS URL %q", rawURL)
+	}
+	if strings.ContainsAny(subject, " \t\r\n*>") {
+		return nil, fmt.Errorf("invalid NATS subject %q", subject)
+	}
+
+	b := &NATSBroker{
+		addr:       u.Host,
+		subject:    subject,
+		bus:        bus,
+		instanceID: instanceID(),
+		outgoing:   make(chan utils.Event, 256),
+		logger:     logger.Sugar(),
+	}
+	if u.Port() == "" {
+		b.addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if u.Scheme == "tls" {
+		b.tls = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			b.user, b.pass = u.User.Username(), pass
+		} else {
+			b.token = u.User.Username()
+		}
+	}
+	return b, nil
+}
+
+func (b *NATSBroker) Forward(event utils.Event) {
+	select {
+	case b.outgoing <- event:
+	default:
+		b.logger.Warnw("NATSBroker: outgoing queue full, dropping event", "event", event.Event)
+	}
+}
+
+func (b *NATSBroker) Run(ctx context.Context) {
+	b.logger.Infow("NATSBroker started", "addr", b.addr, "subject", b.subject, "instance_id", b.instanceID)
+
+	backoff := time.Second
+	for ctx.Err() == nil {
+		started := time.Now()
+		err := b.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > natsMaxBackoff {
+			backoff = time.Second
+		}
+		b.logger.Warnw("NATSBroker: connection lost, reconnecting", "error", err, "retry_in", backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, natsMaxBackoff)
+	}
+}
+
+// natsInfo is the part of the server's INFO greeting the broker acts on.
+type natsInfo struct {
+	TLSRequired bool  `json:"tls_required"`
+	MaxPayload  int64 `json:"max_payload"`
+}
+
+// session runs one connection until it fails or ctx is cancelled.
+func (b *NATSBroker) session(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: natsDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", b.addr)
+	if err != nil {
+		return err
+	}
+	defer func() { conn.Close() }()
+
+	reader := bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(natsDialTimeout))
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read INFO: %w", err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected greeting: %q", strings.TrimSpace(line))
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info); err != nil {
+		return fmt.Errorf("malformed INFO: %w", err)
+	}
+
+	// The server greets in plain text and the client then starts TLS on the
+	// same connection, before CONNECT carries any credentials.
+	if b.tls != nil || info.TLSRequired {
+		config := b.tls
+		if config == nil {
+			host, _, _ := net.SplitHostPort(b.addr)
+			config = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("TLS handshake failed: %w", err)
+		}
+		conn = tlsConn
+		reader = bufio.NewReader(conn)
+	}
+	conn.SetDeadline(time.Time{})
+
+	connectOpts := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "404chan-" + b.instanceID,
+		"lang":     "go",
+		"protocol": 0,
+	}
+	if b.user != "" {
+		connectOpts["user"], connectOpts["pass"] = b.user, b.pass
+	}
+	if b.token != "" {
+		connectOpts["auth_token"] = b.token
+	}
+	connectJSON, _ := json.Marshal(connectOpts)
+
+	var writeMu sync.Mutex
+	write := func(data []byte) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(natsDialTimeout))
+		_, err := conn.Write(data)
+		return err
+	}
+
+	handshake := "CONNECT " + string(connectJSON) + "\r\nSUB " + b.subject + " 1\r\nPING\r\n"
+	if err := write([]byte(handshake)); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- b.readLoop(conn, reader, write)
+		cancel()
+	}()
+
+	ping := time.NewTicker(natsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			select {
+			case err := <-readErr:
+				return err
+			default:
+				return ctx.Err()
+			}
+
+		case <-ping.C:
+			if err := write([]byte("PING\r\n")); err != nil {
+				return err
+			}
+
+		case event := <-b.outgoing:
+			payload, err := json.Marshal(envelope{Origin: b.instanceID, Event: event})
+			if err != nil {
+				b.logger.Errorw("NATSBroker: failed to encode event", "event", event.Event, "error", err)
+				continue
+			}
+			if info.MaxPayload > 0 && int64(len(payload)) > info.MaxPayload {
+				// The server would answer with -ERR and close the connection.
+				b.logger.Warnw("NATSBroker: event exceeds the server's max_payload, dropping it", "event", event.Event, "size", len(payload), "max_payload", info.MaxPayload)
+				continue
+			}
+			frame := "PUB " + b.subject + " " + strconv.Itoa(len(payload)) + "\r\n" + string(payload) + "\r\n"
+			if err := write([]byte(frame)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readLoop handles server frames. Our own PINGs guarantee a PONG at least
+// every natsPingInterval, so a silent connection is treated as dead.
+func (b *NATSBroker) readLoop(conn net.Conn, reader *bufio.Reader, write func([]byte) error) error {
+	for {
+		conn.SetReadDeadline(time.Now().Add(2 * natsPingInterval))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			fields := strings.Fields(line)
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || size < 0 {
+				return fmt.Errorf("malformed MSG line: %q", line)
+			}
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return err
+			}
+			b.inject(payload[:size])
+
+		case line == "PING":
+			if err := write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+
+		case strings.HasPrefix(line, "-ERR"):
+			b.logger.Warnw("NATSBroker: server error", "error", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (b *NATSBroker) inject(payload []byte) {
+	var env envelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		b.logger.Warnw("NATSBroker: malformed message", "error", err)
+		return
+	}
+	if env.Origin == b.instanceID {
+		return
+	}
+	b.bus.Inject(env.Event)
+}
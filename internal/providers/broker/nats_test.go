@@ -0,0 +1,280 @@
+package broker
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+// natsPeer is the server side of one broker connection in a test.
+type natsPeer struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// acceptNATS waits for the broker to connect to ln and greets it with info.
+func acceptNATS(t *testing.T, ln net.Listener, info string) *natsPeer {
+	t.Helper()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	p := &natsPeer{t: t, conn: conn, reader: bufio.NewReader(conn)}
+	p.send("INFO " + info + "\r\n")
+	return p
+}
+
+func (p *natsPeer) send(s string) {
+	p.t.Helper()
+	if _, err := io.WriteString(p.conn, s); err != nil {
+		p.t.Fatalf("write: %v", err)
+	}
+}
+
+func (p *natsPeer) line() string {
+	p.t.Helper()
+	line, err := p.reader.ReadString('\n')
+	if err != nil {
+		p.t.Fatalf("read: %v", err)
+	}
+	if !strings.HasSuffix(line, "\r\n") {
+		p.t.Fatalf("line not terminated by CRLF: %q", line)
+	}
+	return strings.TrimSuffix(line, "\r\n")
+}
+
+// handshake reads CONNECT, SUB and PING, answers the PING and returns the
+// CONNECT options.
+func (p *natsPeer) handshake() map[string]any {
+	p.t.Helper()
+	line := p.line()
+	if !strings.HasPrefix(line, "CONNECT ") {
+		p.t.Fatalf("got %q, want CONNECT", line)
+	}
+	var opts map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "CONNECT ")), &opts); err != nil {
+		p.t.Fatalf("CONNECT options: %v", err)
+	}
+	if line := p.line(); line != "SUB events 1" {
+		p.t.Fatalf("got %q, want SUB events 1", line)
+	}
+	if line := p.line(); line != "PING" {
+		p.t.Fatalf("got %q, want PING", line)
+	}
+	p.send("PONG\r\n")
+	return opts
+}
+
+// pub reads one PUB frame and returns its payload.
+func (p *natsPeer) pub() envelope {
+	p.t.Helper()
+	fields := strings.Fields(p.line())
+	if len(fields) != 3 || fields[0] != "PUB" || fields[1] != "events" {
+		p.t.Fatalf("got %q, want PUB events <size>", strings.Join(fields, " "))
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		p.t.Fatalf("PUB size: %v", err)
+	}
+	payload := make([]byte, size+2)
+	if _, err := io.ReadFull(p.reader, payload); err != nil {
+		p.t.Fatalf("read payload: %v", err)
+	}
+	if string(payload[size:]) != "\r\n" {
+		p.t.Fatalf("payload not followed by CRLF")
+	}
+	var env envelope
+	if err := json.Unmarshal(payload[:size], &env); err != nil {
+		p.t.Fatalf("payload: %v", err)
+	}
+	return env
+}
+
+func (p *natsPeer) msg(env envelope) {
+	p.t.Helper()
+	payload, err := json.Marshal(env)
+	if err != nil {
+		p.t.Fatalf("encode: %v", err)
+	}
+	p.send("MSG events 1 " + strconv.Itoa(len(payload)) + "\r\n" + string(payload) + "\r\n")
+}
+
+func startNATS(t *testing.T, rawURL string, bus *utils.EventBus) *NATSBroker {
+	t.Helper()
+	b, err := NewNATSBroker(rawURL, "events", bus, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewNATSBroker: %v", err)
+	}
+	return b
+}
+
+func run(t *testing.T, b *NATSBroker) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		b.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln
+}
+
+func receiveEvent(t *testing.T, sub *utils.Subscription) utils.Event {
+	t.Helper()
+	select {
+	case e := <-sub.C():
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event injected into the bus")
+		return utils.Event{}
+	}
+}
+
+func TestNATSBrokerProtocol(t *testing.T) {
+	ln := listen(t)
+	bus := utils.NewEventBus()
+	sub := bus.Subscribe("test")
+	defer bus.Unsubscribe(sub)
+
+	b := startNATS(t, "nats://alice:secret@"+ln.Addr().String(), bus)
+	run(t, b)
+	p := acceptNATS(t, ln, `{"server_id":"test","max_payload":1048576}`)
+
+	opts := p.handshake()
+	if opts["user"] != "alice" || opts["pass"] != "secret" || opts["verbose"] != false {
+		t.Errorf("CONNECT options = %v", opts)
+	}
+
+	b.Forward(utils.Event{Event: utils.EventStatsUpdated, Data: utils.StatsUpdated{Boards: 3}})
+	env := p.pub()
+	if env.Origin != b.instanceID || env.Event.Event != utils.EventStatsUpdated {
+		t.Errorf("published %+v", env)
+	}
+
+	p.send("PING\r\n")
+	if line := p.line(); line != "PONG" {
+		t.Errorf("got %q, want PONG", line)
+	}
+
+	// An event of our own coming back is skipped; the one after it, from
+	// another instance, is injected.
+	p.msg(envelope{Origin: b.instanceID, Event: utils.Event{Event: utils.EventStatsUpdated, Data: utils.StatsUpdated{}}})
+	p.msg(envelope{Origin: "other", Event: utils.Event{Event: utils.EventSettingsUpdated, Data: utils.SettingsUpdated{Timestamp: 7}}})
+	e := receiveEvent(t, sub)
+	if data, ok := e.Data.(utils.SettingsUpdated); !ok || data.Timestamp != 7 {
+		t.Errorf("injected %+v", e)
+	}
+}
+
+func TestNATSBrokerToken(t *testing.T) {
+	ln := listen(t)
+	b := startNATS(t, "nats://s3cret@"+ln.Addr().String(), utils.NewEventBus())
+	run(t, b)
+	p := acceptNATS(t, ln, `{}`)
+
+	opts := p.handshake()
+	if opts["auth_token"] != "s3cret" {
+		t.Errorf("CONNECT options = %v, want auth_token", opts)
+	}
+	if _, ok := opts["user"]; ok {
+		t.Errorf("CONNECT options = %v, want no user", opts)
+	}
+}
+
+func TestNATSBrokerSkipsOversizedEvents(t *testing.T) {
+	ln := listen(t)
+	b := startNATS(t, "nats://"+ln.Addr().String(), utils.NewEventBus())
+	run(t, b)
+	p := acceptNATS(t, ln, `{"max_payload":200}`)
+	p.handshake()
+
+	b.Forward(utils.Event{Event: utils.EventAnnouncement, Data: utils.Announcement{Text: strings.Repeat("x", 500)}})
+	b.Forward(utils.Event{Event: utils.EventSettingsUpdated, Data: utils.SettingsUpdated{}})
+	if env := p.pub(); env.Event.Event != utils.EventSettingsUpdated {
+		t.Errorf("published %q, want the oversized event skipped", env.Event.Event)
+	}
+}
+
+func TestNATSBrokerTLS(t *testing.T) {
+	cert, pool := testCertificate(t)
+	ln := listen(t)
+
+	b := startNATS(t, "tls://"+ln.Addr().String(), utils.NewEventBus())
+	b.tls.RootCAs = pool
+	run(t, b)
+
+	raw := acceptNATS(t, ln, `{"tls_required":true}`)
+	conn := tls.Server(raw.conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err := conn.Handshake(); err != nil {
+		t.Fatalf("TLS handshake: %v", err)
+	}
+	p := &natsPeer{t: t, conn: conn, reader: bufio.NewReader(conn)}
+	p.handshake()
+
+	b.Forward(utils.Event{Event: utils.EventSettingsUpdated, Data: utils.SettingsUpdated{}})
+	if env := p.pub(); env.Event.Event != utils.EventSettingsUpdated {
+		t.Errorf("published %q over TLS", env.Event.Event)
+	}
+}
+
+// testCertificate makes a self-signed certificate for 127.0.0.1 and a pool
+// that trusts it.
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "nats-test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
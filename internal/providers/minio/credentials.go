@@ -0,0 +1,55 @@
+package minio
+
+import (
+	"context"
+	"time"
+
+	"backend/internal/providers/secrets"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// secretCredentials resolves the access and secret keys through the secrets
+// manager and asks minio-go to fetch them again once they are older than
+// refresh, which is how rotated keys reach the client.
+type secretCredentials struct {
+	secretsM  *secrets.Manager
+	accessKey string
+	secretKey string
+	refresh   time.Duration
+	fetchedAt time.Time
+}
+
+func newSecretCredentials(secretsM *secrets.Manager, accessKey, secretKey string, refresh time.Duration) *credentials.Credentials {
+	return credentials.New(&secretCredentials{
+		secretsM:  secretsM,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		refresh:   refresh,
+	})
+}
+
+func (c *secretCredentials) Retrieve() (credentials.Value, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	accessKey, err := c.secretsM.Resolve(ctx, c.accessKey)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	secretKey, err := c.secretsM.Resolve(ctx, c.secretKey)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	c.fetchedAt = time.Now()
+	return credentials.Value{
+		AccessKeyID:     accessKey,
+		SecretAccessKey: secretKey,
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
+
+func (c *secretCredentials) IsExpired() bool {
+	return time.Since(c.fetchedAt) >= c.refresh
+}
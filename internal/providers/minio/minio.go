@@ -2,32 +2,42 @@ package minio
 
 import (
 	"backend/internal/config"
+	"backend/internal/providers/secrets"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
 	"go.uber.org/zap"
 )
 
 type MinioProvider struct {
 	client    *minio.Client
 	bucket    string
-	maxSize   int64
-	maxFiles  int
+	maxSize   atomic.Int64
+	maxFiles  atomic.Int64
 	logger    *zap.Logger
 	publicURL string
+	private   bool
+	retry     RetryPolicy
 }
 
-func NewMinioProvider(cfg *config.Config, logger *zap.Logger) (*MinioProvider, error) {
+func NewMinioProvider(cfg *config.Config, secretsM *secrets.Manager, logger *zap.Logger) (*MinioProvider, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := secretsM.Check(ctx, cfg.MinioUser, cfg.MinioPassword); err != nil {
+		return nil, err
+	}
+
 	client, err := minio.New(cfg.MinioURL, &minio.Options{
-		Creds:  credentials.NewStaticV4(cfg.MinioUser, cfg.MinioPassword, ""),
+		Creds:  newSecretCredentials(secretsM, cfg.MinioUser, cfg.MinioPassword, cfg.SecretsCacheTTL),
 		Secure: false,
 	})
 	if err != nil {
@@ -36,18 +46,30 @@ func NewMinioProvider(cfg *config.Config, logger *zap.Logger) (*MinioProvider, e
 
 	publicURL := cfg.MinioPublicURL
 	if publicURL == "" {
-		publicURL = fmt.Sprintf("http://%s/%s", cfg.MinioURL, cfg.MinioBucket)
+		if cfg.MinioPrivate {
+			publicURL = "/api/files"
+		} else {
+			publicURL = fmt.Sprintf("http://%s/%s", cfg.MinioURL, cfg.MinioBucket)
+		}
 	}
 
 	provider := &MinioProvider{
 		client:    client,
 		bucket:    cfg.MinioBucket,
-		maxSize:   cfg.MaxFileSize,
-		maxFiles:  cfg.MaxFilesPerPost,
 		logger:    logger,
 		publicURL: publicURL,
+		private:   cfg.MinioPrivate,
+		retry: RetryPolicy{
+			OpTimeout:     cfg.MinioTimeout,
+			UploadTimeout: cfg.MinioUploadTimeout,
+			MaxRetries:    cfg.MinioRetries,
+			BaseBackoff:   200 * time.Millisecond,
+			MaxBackoff:    5 * time.Second,
+		},
 	}
 
+	provider.SetLimits(cfg.MaxFileSize, cfg.MaxFilesPerPost)
+
 	if err := provider.ensureBucket(); err != nil {
 		return nil, err
 	}
@@ -58,20 +80,32 @@ func NewMinioProvider(cfg *config.Config, logger *zap.Logger) (*MinioProvider, e
 func (m *MinioProvider) ensureBucket() error {
 	ctx := context.Background()
 
-	exists, err := m.client.BucketExists(ctx, m.bucket)
+	var exists bool
+	err := m.do(ctx, "BucketExists", m.retry.OpTimeout, func(ctx context.Context) error {
+		var err error
+		exists, err = m.client.BucketExists(ctx, m.bucket)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("failed to check bucket: %w", err)
 	}
 
 	if !exists {
-		err := m.client.MakeBucket(ctx, m.bucket, minio.MakeBucketOptions{})
+		err := m.do(ctx, "MakeBucket", m.retry.OpTimeout, func(ctx context.Context) error {
+			return m.client.MakeBucket(ctx, m.bucket, minio.MakeBucketOptions{})
+		})
 		if err != nil {
 			return fmt.Errorf("failed to create bucket: %w", err)
 		}
 		m.logger.Info("Created MinIO bucket", zap.String("bucket", m.bucket))
 	}
 
-	if err := m.setBucketPolicy(ctx); err != nil {
+	if m.private {
+		return nil
+	}
+
+	err = m.do(ctx, "SetBucketPolicy", m.retry.OpTimeout, m.setBucketPolicy)
+	if err != nil {
 		m.logger.Warn("Failed to set bucket policy", zap.Error(err))
 	}
 
@@ -94,9 +128,13 @@ func (m *MinioProvider) setBucketPolicy(ctx context.Context) error {
 	return m.client.SetBucketPolicy(ctx, m.bucket, policy)
 }
 
-func (m *MinioProvider) UploadFile(file *multipart.FileHeader) (*UploadedFile, error) {
-	if file.Size > m.maxSize {
-		return nil, fmt.Errorf("file size exceeds maximum allowed size of %d MB", m.maxSize/(1024*1024))
+func (m *MinioProvider) UploadFile(file *multipart.FileHeader, policy FilePolicy) (*UploadedFile, error) {
+	contentType, err := SniffFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.ValidateFile(file.Filename, file.Size, contentType); err != nil {
+		return nil, err
 	}
 
 	src, err := file.Open()
@@ -105,14 +143,14 @@ func (m *MinioProvider) UploadFile(file *multipart.FileHeader) (*UploadedFile, e
 	}
 	defer src.Close()
 
-	ext := filepath.Ext(file.Filename)
-	contentType := detectContentType(ext)
-
 	objectName := GenerateObjectName(file.Filename)
 	tmpObjectName := "tmp/" + objectName
 
-	_, err = m.client.PutObject(context.Background(), m.bucket, tmpObjectName, src, file.Size, minio.PutObjectOptions{
-		ContentType: contentType,
+	err = m.doUpload(context.Background(), "PutObject", src, func(ctx context.Context) error {
+		_, err := m.client.PutObject(ctx, m.bucket, tmpObjectName, src, file.Size, minio.PutObjectOptions{
+			ContentType: contentType,
+		})
+		return err
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload file: %w", err)
@@ -135,12 +173,6 @@ func (m *MinioProvider) UploadFile(file *multipart.FileHeader) (*UploadedFile, e
 }
 
 func (m *MinioProvider) ConfirmTmpObject(tmpObjectName string) (string, error) {
-	src, err := m.client.GetObject(context.Background(), m.bucket, tmpObjectName, minio.GetObjectOptions{})
-	if err != nil {
-		return "", fmt.Errorf("failed to get tmp object: %w", err)
-	}
-	defer src.Close()
-
 	permanentObjectName := strings.TrimPrefix(tmpObjectName, "tmp/")
 
 	dest := minio.CopyDestOptions{
@@ -153,7 +185,10 @@ func (m *MinioProvider) ConfirmTmpObject(tmpObjectName string) (string, error) {
 		Object: tmpObjectName,
 	}
 
-	_, err = m.client.CopyObject(context.Background(), dest, srcOpts)
+	err := m.do(context.Background(), "CopyObject", m.retry.OpTimeout, func(ctx context.Context) error {
+		_, err := m.client.CopyObject(ctx, dest, srcOpts)
+		return err
+	})
 	if err != nil {
 		return "", fmt.Errorf("failed to copy object: %w", err)
 	}
@@ -180,39 +215,60 @@ func (m *MinioProvider) DeleteTmpFilesOlderThan(maxAge time.Duration) error {
 		Recursive: true,
 	})
 
+	var expired []string
 	for object := range objectsCh {
 		if object.Err != nil {
 			return object.Err
 		}
 
-		objectTime := object.LastModified
-		if time.Since(objectTime) > maxAge {
-			if err := m.DeleteFile(object.Key); err != nil {
-				m.logger.Warn("Failed to delete old tmp file",
-					zap.String("object", object.Key),
-					zap.Error(err),
-				)
-			} else {
-				m.logger.Info("Deleted old tmp file",
-					zap.String("object", object.Key),
-					zap.Duration("age", time.Since(objectTime)),
-				)
-			}
+		if time.Since(object.LastModified) > maxAge {
+			expired = append(expired, object.Key)
 		}
 	}
 
+	if err := m.DeleteFiles(expired); err != nil {
+		m.logger.Warn("Failed to delete old tmp files", zap.Error(err))
+	} else if len(expired) > 0 {
+		m.logger.Info("Deleted old tmp files", zap.Int("count", len(expired)))
+	}
+
 	return nil
 }
 
-func (m *MinioProvider) UploadMultiple(files []*multipart.FileHeader) ([]*UploadedFile, error) {
-	if len(files) > m.maxFiles {
-		return nil, fmt.Errorf("maximum %d files allowed per post", m.maxFiles)
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// WalkObjects calls fn for every object under prefix, stopping at the first
+// listing or callback error.
+func (m *MinioProvider) WalkObjects(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	objectsCh := m.client.ListObjects(ctx, m.bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	})
+
+	for object := range objectsCh {
+		if object.Err != nil {
+			return object.Err
+		}
+		if err := fn(ObjectInfo{Key: object.Key, Size: object.Size, LastModified: object.LastModified}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MinioProvider) UploadMultiple(files []*multipart.FileHeader, policy FilePolicy) ([]*UploadedFile, error) {
+	if err := policy.ValidateCount(len(files)); err != nil {
+		return nil, err
 	}
 
 	uploaded := make([]*UploadedFile, 0, len(files))
 
 	for _, file := range files {
-		result, err := m.UploadFile(file)
+		result, err := m.UploadFile(file, policy)
 		if err != nil {
 			return nil, err
 		}
@@ -223,9 +279,9 @@ func (m *MinioProvider) UploadMultiple(files []*multipart.FileHeader) ([]*Upload
 }
 
 func (m *MinioProvider) DeleteFile(objectName string) error {
-	ctx := context.Background()
-
-	err := m.client.RemoveObject(ctx, m.bucket, objectName, minio.RemoveObjectOptions{})
+	err := m.do(context.Background(), "RemoveObject", m.retry.OpTimeout, func(ctx context.Context) error {
+		return m.client.RemoveObject(ctx, m.bucket, objectName, minio.RemoveObjectOptions{})
+	})
 	if err != nil {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
@@ -234,15 +290,98 @@ func (m *MinioProvider) DeleteFile(objectName string) error {
 	return nil
 }
 
+// deleteChunkSize is how many objects go into one RemoveObjects call, the
+// most a single S3 multi-object delete takes.
+const deleteChunkSize = 1000
+
+// DeleteFiles removes objects in chunks through RemoveObjects. Each chunk
+// gets its own timeout and retries, so a large batch neither times out as a
+// whole nor starts over; only the objects that failed are retried, and the
+// returned error aggregates every object that could not be deleted.
 func (m *MinioProvider) DeleteFiles(objectNames []string) error {
-	for _, name := range objectNames {
-		if err := m.DeleteFile(name); err != nil {
-			return err
+	if len(objectNames) == 0 {
+		return nil
+	}
+
+	var failed int
+	var errs []error
+	for start := 0; start < len(objectNames); start += deleteChunkSize {
+		chunk := objectNames[start:min(start+deleteChunkSize, len(objectNames))]
+		pending, err := m.deleteChunk(chunk)
+		if err != nil {
+			failed += len(pending)
+			errs = append(errs, err)
 		}
 	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to delete %d of %d files: %w", failed, len(objectNames), errors.Join(errs...))
+	}
+
+	m.logger.Info("Files deleted successfully", zap.Int("count", len(objectNames)))
 	return nil
 }
 
+// deleteChunk removes one chunk and returns the objects still left on
+// error.
+func (m *MinioProvider) deleteChunk(objectNames []string) ([]string, error) {
+	pending := objectNames
+	err := m.do(context.Background(), "RemoveObjects", m.retry.OpTimeout, func(ctx context.Context) error {
+		objectsCh := make(chan minio.ObjectInfo)
+		go func() {
+			defer close(objectsCh)
+			for _, name := range pending {
+				select {
+				case objectsCh <- minio.ObjectInfo{Key: name}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		var failed []string
+		var errs []error
+		for rErr := range m.client.RemoveObjects(ctx, m.bucket, objectsCh, minio.RemoveObjectsOptions{}) {
+			failed = append(failed, rErr.ObjectName)
+			errs = append(errs, fmt.Errorf("%s: %w", rErr.ObjectName, rErr.Err))
+		}
+		if err := ctx.Err(); err != nil && len(errs) == 0 {
+			return err
+		}
+
+		pending = failed
+		return errors.Join(errs...)
+	})
+	return pending, err
+}
+
+// GetObject opens an object for streaming. The returned object implements
+// io.ReadSeeker, so callers can serve byte ranges from it.
+func (m *MinioProvider) GetObject(ctx context.Context, objectName string) (*minio.Object, minio.ObjectInfo, error) {
+	var (
+		obj  *minio.Object
+		info minio.ObjectInfo
+	)
+	// The object streams under the caller's ctx, so the attempt context only
+	// bounds retries; the first Stat is what actually hits the server.
+	err := m.do(ctx, "GetObject", m.retry.OpTimeout, func(context.Context) error {
+		o, err := m.client.GetObject(ctx, m.bucket, objectName, minio.GetObjectOptions{})
+		if err != nil {
+			return err
+		}
+		info, err = o.Stat()
+		if err != nil {
+			o.Close()
+			return err
+		}
+		obj = o
+		return nil
+	})
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+	return obj, info, nil
+}
+
 func (m *MinioProvider) GetClient() *minio.Client {
 	return m.client
 }
@@ -319,8 +458,11 @@ func (m *MinioProvider) GeneratePresignedURL(objectName string, expiry time.Dura
 }
 
 func (m *MinioProvider) UploadFromReader(reader io.Reader, objectName, contentType string, size int64) (*UploadedFile, error) {
-	_, err := m.client.PutObject(context.Background(), m.bucket, objectName, reader, size, minio.PutObjectOptions{
-		ContentType: contentType,
+	err := m.doUpload(context.Background(), "PutObject", reader, func(ctx context.Context) error {
+		_, err := m.client.PutObject(ctx, m.bucket, objectName, reader, size, minio.PutObjectOptions{
+			ContentType: contentType,
+		})
+		return err
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload file: %w", err)
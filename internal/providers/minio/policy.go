@@ -0,0 +1,97 @@
+package minio
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+type FilePolicy struct {
+	MaxFileSize         int64
+	MaxFiles            int
+	AllowedContentTypes []string
+}
+
+func (m *MinioProvider) DefaultPolicy() FilePolicy {
+	return FilePolicy{
+		MaxFileSize: m.maxSize.Load(),
+		MaxFiles:    int(m.maxFiles.Load()),
+	}
+}
+
+// SetLimits changes the global file limits; it is safe to call while
+// uploads are in flight.
+func (m *MinioProvider) SetLimits(maxFileSize int64, maxFiles int) {
+	m.maxSize.Store(maxFileSize)
+	m.maxFiles.Store(int64(maxFiles))
+}
+
+// Allows reports whether contentType is accepted. An empty allow list accepts
+// everything; entries ending in "/*" match a whole media type family.
+func (p FilePolicy) Allows(contentType string) bool {
+	if len(p.AllowedContentTypes) == 0 {
+		return true
+	}
+	contentType = strings.ToLower(contentType)
+	for _, allowed := range p.AllowedContentTypes {
+		if allowed == contentType {
+			return true
+		}
+		if strings.HasSuffix(allowed, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p FilePolicy) ValidateCount(count int) error {
+	if p.MaxFiles > 0 && count > p.MaxFiles {
+		return fmt.Errorf("maximum %d files allowed per post", p.MaxFiles)
+	}
+	return nil
+}
+
+func (p FilePolicy) ValidateFile(filename string, size int64, contentType string) error {
+	if p.MaxFileSize > 0 && size > p.MaxFileSize {
+		return fmt.Errorf("file %s exceeds maximum allowed size of %d MB", filename, p.MaxFileSize/(1024*1024))
+	}
+	if !p.Allows(contentType) {
+		return fmt.Errorf("file type %s is not allowed", contentType)
+	}
+	return nil
+}
+
+// ResolveContentType sniffs the type from head, the first bytes of the
+// file, and falls back to the file extension only when the bytes match no
+// known format. The type the client declared is never trusted: it is what
+// the file is later served as.
+func ResolveContentType(filename string, head []byte) string {
+	sniffed := http.DetectContentType(head)
+	if mediaType, _, err := mime.ParseMediaType(sniffed); err == nil {
+		sniffed = mediaType
+	}
+	if sniffed != "application/octet-stream" {
+		return sniffed
+	}
+	return detectContentType(filepath.Ext(filename))
+}
+
+// SniffFile resolves the content type of an uploaded file from its first
+// 512 bytes, the most http.DetectContentType looks at.
+func SniffFile(file *multipart.FileHeader) (string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return ResolveContentType(file.Filename, head[:n]), nil
+}
@@ -0,0 +1,112 @@
+package minio
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+type RetryPolicy struct {
+	OpTimeout     time.Duration
+	UploadTimeout time.Duration
+	MaxRetries    int
+	BaseBackoff   time.Duration
+	MaxBackoff    time.Duration
+}
+
+// do runs fn with a per-attempt timeout, retrying transient failures with
+// exponential backoff and jitter. Permanent errors are returned immediately.
+func (m *MinioProvider) do(ctx context.Context, op string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		err = fn(attemptCtx)
+		cancel()
+
+		if err == nil || attempt >= m.retry.MaxRetries || ctx.Err() != nil || !IsTransient(err) {
+			return err
+		}
+
+		backoff := m.backoff(attempt)
+		m.logger.Warn("MinIO operation failed, retrying",
+			zap.String("op", op),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// doUpload is like do but rewinds seekable readers before each retry. Plain
+// readers cannot be replayed, so they get a single attempt.
+func (m *MinioProvider) doUpload(ctx context.Context, op string, reader io.Reader, fn func(ctx context.Context) error) error {
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		attemptCtx, cancel := context.WithTimeout(ctx, m.retry.UploadTimeout)
+		defer cancel()
+		return fn(attemptCtx)
+	}
+
+	first := true
+	return m.do(ctx, op, m.retry.UploadTimeout, func(ctx context.Context) error {
+		if !first {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		first = false
+		return fn(ctx)
+	})
+}
+
+func (m *MinioProvider) backoff(attempt int) time.Duration {
+	d := m.retry.BaseBackoff << attempt
+	if d > m.retry.MaxBackoff || d <= 0 {
+		d = m.retry.MaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// IsTransient reports whether err is worth retrying: timeouts, network
+// failures, throttling and 5xx responses.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var resp minio.ErrorResponse
+	if !errors.As(err, &resp) {
+		return false
+	}
+	switch resp.Code {
+	case "SlowDown", "InternalError", "RequestTimeout", "ServiceUnavailable", "RequestTimeTooSkewed", "XMinioServerNotInitialized":
+		return true
+	case "NoSuchKey", "NoSuchBucket", "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+		return false
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
@@ -0,0 +1,43 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+// CooldownLeft returns how long the cooldown stored under key still runs,
+// or zero when there is none.
+func (r *RedisProvider) CooldownLeft(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.Client.PTTL(ctx, key).Result()
+	if err != nil || ttl < 0 {
+		return 0, err
+	}
+	return ttl, nil
+}
+
+// StartCooldown starts a cooldown of d under key.
+func (r *RedisProvider) StartCooldown(ctx context.Context, key string, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	return r.Client.Set(ctx, key, 1, d).Err()
+}
+
+// ClaimCooldown starts a cooldown of d under key unless one is running, in
+// which case it returns how long that one still runs. Unlike CooldownLeft
+// followed by StartCooldown, two concurrent claims cannot both succeed.
+func (r *RedisProvider) ClaimCooldown(ctx context.Context, key string, d time.Duration) (time.Duration, error) {
+	if d <= 0 {
+		return 0, nil
+	}
+	ok, err := r.Client.SetNX(ctx, key, 1, d).Result()
+	if err != nil || ok {
+		return 0, err
+	}
+	left, err := r.CooldownLeft(ctx, key)
+	if err == nil && left <= 0 {
+		// The key expired between the two calls; the post is no duplicate.
+		return r.ClaimCooldown(ctx, key, d)
+	}
+	return left, err
+}
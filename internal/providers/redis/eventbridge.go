@@ -0,0 +1,95 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+
+	"backend/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+type bridgeEnvelope struct {
+	Origin string      `json:"origin"`
+	Event  utils.Event `json:"event"`
+}
+
+// EventBridge fans EventBus events out over Redis pub/sub so websocket
+// clients connected to any instance see events published on every other.
+type EventBridge struct {
+	redisP     *RedisProvider
+	bus        *utils.EventBus
+	channel    string
+	instanceID string
+	outgoing   chan utils.Event
+	logger     *zap.SugaredLogger
+}
+
+func NewEventBridge(redisP *RedisProvider, bus *utils.EventBus, channel string, logger *zap.Logger) *EventBridge {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	host, _ := os.Hostname()
+
+	return &EventBridge{
+		redisP:     redisP,
+		bus:        bus,
+		channel:    channel,
+		instanceID: host + "-" + hex.EncodeToString(suffix),
+		outgoing:   make(chan utils.Event, 256),
+		logger:     logger.Sugar(),
+	}
+}
+
+// Forward queues a locally published event for other instances. Like the
+// EventBus itself it never blocks the publisher and drops when saturated.
+func (b *EventBridge) Forward(event utils.Event) {
+	select {
+	case b.outgoing <- event:
+	default:
+		b.logger.Warnw("EventBridge: outgoing queue full, dropping event", "event", event.Event)
+	}
+}
+
+// Run publishes forwarded events and injects events from other instances
+// into the local bus until ctx is cancelled.
+func (b *EventBridge) Run(ctx context.Context) {
+	sub := b.redisP.Client.Subscribe(ctx, b.channel)
+	defer sub.Close()
+
+	incoming := sub.Channel()
+	b.logger.Infow("EventBridge started", "channel", b.channel, "instance_id", b.instanceID)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case event := <-b.outgoing:
+			payload, err := json.Marshal(bridgeEnvelope{Origin: b.instanceID, Event: event})
+			if err != nil {
+				b.logger.Errorw("EventBridge: failed to encode event", "event", event.Event, "error", err)
+				continue
+			}
+			if err := b.redisP.Client.Publish(ctx, b.channel, payload).Err(); err != nil {
+				b.logger.Errorw("EventBridge: failed to publish event", "event", event.Event, "error", err)
+			}
+
+		case msg, ok := <-incoming:
+			if !ok {
+				return
+			}
+			var env bridgeEnvelope
+			if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+				b.logger.Warnw("EventBridge: malformed message", "error", err)
+				continue
+			}
+			if env.Origin == b.instanceID {
+				continue
+			}
+			b.bus.Inject(env.Event)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"backend/internal/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// EventLog keeps recent public events in a capped Redis stream so websocket
+// clients can catch up on what they missed while disconnected. Stream entry
+// IDs double as event IDs.
+type EventLog struct {
+	redisP *RedisProvider
+	key    string
+	maxLen int64
+	events map[string]bool
+}
+
+func NewEventLog(redisP *RedisProvider, key string, maxLen int64, events ...string) *EventLog {
+	recorded := make(map[string]bool, len(events))
+	for _, e := range events {
+		recorded[e] = true
+	}
+	return &EventLog{redisP: redisP, key: key, maxLen: maxLen, events: recorded}
+}
+
+// Record appends the event to the stream and returns its ID. Events outside
+// the recorded set are skipped and get no ID.
+func (l *EventLog) Record(event utils.Event) (string, error) {
+	if !l.events[event.Event] {
+		return "", nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	return l.redisP.Client.XAdd(ctx, &redis.XAddArgs{
+		Stream: l.key,
+		MaxLen: l.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{"event": payload},
+	}).Result()
+}
+
+// Since returns up to limit events recorded after lastID. truncated reports
+// that some missed events are no longer available, either because the
+// stream was trimmed past lastID or because more than limit are pending.
+func (l *EventLog) Since(ctx context.Context, lastID string, limit int64) (events []utils.Event, truncated bool, err error) {
+	entries, err := l.redisP.Client.XRangeN(ctx, l.key, "("+lastID, "+", limit+1).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read event log: %w", err)
+	}
+	if int64(len(entries)) > limit {
+		entries = entries[:limit]
+		truncated = true
+	}
+
+	first, err := l.redisP.Client.XRangeN(ctx, l.key, "-", "+", 1).Result()
+	if err == nil && len(first) > 0 && CompareStreamIDs(first[0].ID, lastID) > 0 {
+		truncated = true
+	}
+
+	events = make([]utils.Event, 0, len(entries))
+	for _, entry := range entries {
+		raw, _ := entry.Values["event"].(string)
+		var event utils.Event
+		if err := json.Unmarshal([]byte(raw), &event); err != nil {
+			continue
+		}
+		event.ID = entry.ID
+		events = append(events, event)
+	}
+	return events, truncated, nil
+}
+
+// CompareStreamIDs orders Redis stream IDs ("<ms>-<seq>"), returning -1, 0
+// or 1. Malformed IDs sort first.
+func CompareStreamIDs(a, b string) int {
+	var aMs, aSeq, bMs, bSeq uint64
+	fmt.Sscanf(a, "%d-%d", &aMs, &aSeq)
+	fmt.Sscanf(b, "%d-%d", &bMs, &bSeq)
+
+	switch {
+	case aMs < bMs || (aMs == bMs && aSeq < bSeq):
+		return -1
+	case aMs == bMs && aSeq == bSeq:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// ValidStreamID reports whether id has the "<ms>-<seq>" shape.
+func ValidStreamID(id string) bool {
+	var ms, seq uint64
+	n, err := fmt.Sscanf(id, "%d-%d", &ms, &seq)
+	return err == nil && n == 2 && fmt.Sprintf("%d-%d", ms, seq) == id
+}
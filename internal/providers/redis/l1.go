@@ -0,0 +1,185 @@
+package redis
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// l1InvalidateChannel carries the keys one instance deleted so the others
+// drop their local copies too.
+const l1InvalidateChannel = "cache:l1:invalidate"
+
+type l1Entry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+}
+
+type l1Invalidation struct {
+	Origin string   `json:"origin"`
+	Keys   []string `json:"keys"`
+}
+
+// l1Cache is a small LRU of Redis values kept in process memory. Entries
+// never outlive ttl, which bounds how stale a copy can get if an
+// invalidation message from another instance is lost.
+type l1Cache struct {
+	mu         sync.Mutex
+	size       int
+	ttl        time.Duration
+	ll         *list.List
+	items      map[string]*list.Element
+	instanceID string
+}
+
+// EnableL1 puts an in-process LRU of up to size entries in front of the
+// Cached* methods. Call RunL1 to receive invalidations from other instances.
+func (r *RedisProvider) EnableL1(size int, ttl time.Duration) {
+	if size <= 0 {
+		return
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	host, _ := os.Hostname()
+
+	r.l1 = &l1Cache{
+		size:       size,
+		ttl:        ttl,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element, size),
+		instanceID: host + "-" + hex.EncodeToString(suffix),
+	}
+	r.logger.Infow("L1 cache enabled", "size", size, "ttl", ttl.String())
+}
+
+// CachedGet returns key from the L1 cache, or from Redis on a miss, keeping
+// the Redis value locally. Like Get it returns redis.Nil for a missing key.
+func (r *RedisProvider) CachedGet(ctx context.Context, key string) (string, error) {
+	if value, ok := r.l1.get(key); ok {
+		return value, nil
+	}
+	value, err := r.Client.Get(ctx, key).Result()
+	if err != nil {
+		return "", err
+	}
+	r.l1.set(key, value, 0)
+	return value, nil
+}
+
+// CachedSet writes key to Redis and to the L1 cache.
+func (r *RedisProvider) CachedSet(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := r.Client.Set(ctx, key, value, ttl).Err(); err != nil {
+		return err
+	}
+	r.l1.set(key, string(value), ttl)
+	return nil
+}
+
+// CachedDel deletes keys from Redis and from the L1 cache of every instance.
+func (r *RedisProvider) CachedDel(ctx context.Context, keys ...string) error {
+	err := r.Client.Del(ctx, keys...).Err()
+	if r.l1 == nil {
+		return err
+	}
+	r.l1.remove(keys...)
+	payload, _ := json.Marshal(l1Invalidation{Origin: r.l1.instanceID, Keys: keys})
+	if pubErr := r.Client.Publish(ctx, l1InvalidateChannel, payload).Err(); pubErr != nil {
+		r.logger.Warnw("Failed to publish L1 invalidation", "keys", keys, "error", pubErr)
+	}
+	return err
+}
+
+// RunL1 applies invalidations published by other instances until ctx is
+// cancelled. It returns at once when the L1 cache is disabled.
+func (r *RedisProvider) RunL1(ctx context.Context) {
+	if r.l1 == nil {
+		return
+	}
+	sub := r.Client.Subscribe(ctx, l1InvalidateChannel)
+	defer sub.Close()
+
+	incoming := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-incoming:
+			if !ok {
+				return
+			}
+			var inv l1Invalidation
+			if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+				r.logger.Warnw("Malformed L1 invalidation", "error", err)
+				continue
+			}
+			if inv.Origin != r.l1.instanceID {
+				r.l1.remove(inv.Keys...)
+			}
+		}
+	}
+}
+
+func (c *l1Cache) get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	entry := el.Value.(*l1Entry)
+	if time.Now().After(entry.expiresAt) {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		return "", false
+	}
+	c.ll.MoveToFront(el)
+	return entry.value, true
+}
+
+// set stores value for the L1 ttl, or for ttl when that is shorter.
+func (c *l1Cache) set(key, value string, ttl time.Duration) {
+	if c == nil {
+		return
+	}
+	if ttl <= 0 || ttl > c.ttl {
+		ttl = c.ttl
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(ttl)
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*l1Entry)
+		entry.value, entry.expiresAt = value, expiresAt
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&l1Entry{key: key, value: value, expiresAt: expiresAt})
+	if c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*l1Entry).key)
+	}
+}
+
+func (c *l1Cache) remove(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := c.items[key]; ok {
+			c.ll.Remove(el)
+			delete(c.items, key)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// PresenceAll is the pseudo-room every connected session belongs to.
+const PresenceAll = "all"
+
+// Presence tracks which sessions are online per room in sorted sets scored
+// by last heartbeat, so counts stay correct across instances.
+type Presence struct {
+	redisP *RedisProvider
+	ttl    time.Duration
+}
+
+func NewPresence(redisP *RedisProvider, ttl time.Duration) *Presence {
+	return &Presence{redisP: redisP, ttl: ttl}
+}
+
+func presenceKey(room string) string {
+	return "presence:" + room
+}
+
+// Touch marks the given sessions as online in each room and drops entries
+// older than the TTL.
+func (p *Presence) Touch(ctx context.Context, rooms map[string][]uint64) error {
+	now := time.Now()
+	cutoff := strconv.FormatInt(now.Add(-p.ttl).Unix(), 10)
+
+	pipe := p.redisP.Client.Pipeline()
+	for room, sessions := range rooms {
+		key := presenceKey(room)
+		members := make([]redis.Z, 0, len(sessions))
+		for _, id := range sessions {
+			members = append(members, redis.Z{Score: float64(now.Unix()), Member: id})
+		}
+		if len(members) > 0 {
+			pipe.ZAdd(ctx, key, members...)
+		}
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+cutoff)
+		pipe.Expire(ctx, key, 2*p.ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Counts returns the number of online sessions per room.
+func (p *Presence) Counts(ctx context.Context, rooms ...string) (map[string]int64, error) {
+	min := strconv.FormatInt(time.Now().Add(-p.ttl).Unix(), 10)
+
+	pipe := p.redisP.Client.Pipeline()
+	cmds := make(map[string]*redis.IntCmd, len(rooms))
+	for _, room := range rooms {
+		cmds[room] = pipe.ZCount(ctx, presenceKey(room), min, "+inf")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rooms))
+	for room, cmd := range cmds {
+		counts[room] = cmd.Val()
+	}
+	return counts, nil
+}
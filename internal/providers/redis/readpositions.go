@@ -0,0 +1,60 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var markReadScript = redis.NewScript(`
+local current = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+if tonumber(ARGV[2]) > current then
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+func readPositionsKey(userID uint64) string {
+	return fmt.Sprintf("user:%d:read_positions", userID)
+}
+
+// MarkRead stores the last message a user has read in a thread. Positions
+// only move forward, so out-of-order updates from several tabs are harmless.
+func (r *RedisProvider) MarkRead(ctx context.Context, userID, threadID, messageID uint64) error {
+	return markReadScript.Run(ctx, r.Client,
+		[]string{readPositionsKey(userID)},
+		strconv.FormatUint(threadID, 10), messageID,
+	).Err()
+}
+
+// ReadPositions returns the last read message ID per thread; threads the
+// user never marked are absent.
+func (r *RedisProvider) ReadPositions(ctx context.Context, userID uint64, threadIDs []uint64) (map[uint64]uint64, error) {
+	positions := make(map[uint64]uint64, len(threadIDs))
+	if len(threadIDs) == 0 {
+		return positions, nil
+	}
+
+	fields := make([]string, len(threadIDs))
+	for i, id := range threadIDs {
+		fields[i] = strconv.FormatUint(id, 10)
+	}
+
+	values, err := r.Client.HMGet(ctx, readPositionsKey(userID), fields...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+			positions[threadIDs[i]] = n
+		}
+	}
+	return positions, nil
+}
@@ -2,23 +2,61 @@ package redis
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
 	"net"
+	"os"
 	"strings"
 	"time"
 
+	"backend/internal/providers/secrets"
+
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
+// NotFound is cached in place of a value to remember, for NotFoundTTL, that
+// a lookup found nothing, so clients retrying a deleted or never-existing ID
+// do not each reach Postgres.
+const (
+	NotFound    = "!notfound"
+	NotFoundTTL = 30 * time.Second
+)
+
 type RedisProvider struct {
 	Client          *redis.Client
 	URL             string
 	logger          *zap.SugaredLogger
 	ttl             time.Duration
 	lastErrorLogged bool
+	stopMonitor     context.CancelFunc
+	l1              *l1Cache
 }
 
-func NewRedisProvider(redisURL string, logger *zap.Logger, ttl time.Duration) *RedisProvider {
+// Options are the connection settings for NewRedisProvider.
+type Options struct {
+	// URL is redis:// or, for TLS, rediss://.
+	URL string
+	// Username and Password replace the ones in URL when set, for Redis 6
+	// ACL users. Password may be a secret reference; it is resolved on every
+	// new connection so a rotated password is picked up without a restart.
+	Username string
+	Password string
+	// CACertFile is a PEM bundle to verify the server certificate with, for
+	// managed Redis signed by a private CA. Setting it turns TLS on even
+	// for a redis:// URL.
+	CACertFile string
+	TTL        time.Duration
+}
+
+// NewRedisProvider connects to the Redis server described by o. Only a
+// CA certificate that cannot be loaded is an error; an unreachable server
+// is logged and retried by the connection monitor.
+func NewRedisProvider(o Options, secretsM *secrets.Manager, logger *zap.Logger) (*RedisProvider, error) {
+	redisURL, ttl := o.URL, o.TTL
 	opts, err := redis.ParseURL(redisURL)
 	if err != nil {
 		logger.Error("Failed to parse Redis URL", zap.Error(err))
@@ -28,6 +66,34 @@ func NewRedisProvider(redisURL string, logger *zap.Logger, ttl time.Duration) *R
 		}
 	}
 
+	if o.CACertFile != "" {
+		pem, err := os.ReadFile(o.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Redis CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in Redis CA certificate %s", o.CACertFile)
+		}
+		if opts.TLSConfig == nil {
+			host, _, _ := net.SplitHostPort(opts.Addr)
+			opts.TLSConfig = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+		}
+		opts.TLSConfig.RootCAs = pool
+	}
+
+	if o.Username != "" {
+		opts.Username = o.Username
+	}
+	if password := o.Password; password != "" {
+		username := opts.Username
+		opts.Password = ""
+		opts.CredentialsProviderContext = func(ctx context.Context) (string, string, error) {
+			resolved, err := secretsM.Resolve(ctx, password)
+			return username, resolved, err
+		}
+	}
+
 	opts.Network = "tcp4"
 
 	client := redis.NewClient(opts)
@@ -46,7 +112,9 @@ func NewRedisProvider(redisURL string, logger *zap.Logger, ttl time.Duration) *R
 
 	client.AddHook(&loggerHook{provider: provider})
 
-	go provider.startConnectionMonitor(context.Background())
+	monitorCtx, stopMonitor := context.WithCancel(context.Background())
+	provider.stopMonitor = stopMonitor
+	go provider.startConnectionMonitor(monitorCtx)
 
 	if err := client.Ping(context.Background()).Err(); err != nil {
 		provider.logger.Errorw("Redis connection failed at startup", "error", err)
@@ -56,12 +124,23 @@ func NewRedisProvider(redisURL string, logger *zap.Logger, ttl time.Duration) *R
 			"url", redisURL,
 			"db", opts.DB,
 			"username", opts.Username,
+			"tls", opts.TLSConfig != nil,
 			"default_ttl", ttl.String(),
 		)
 		provider.lastErrorLogged = false
 	}
 
-	return provider
+	return provider, nil
+}
+
+// Close stops the connection monitor and closes the client's pool.
+func (r *RedisProvider) Close() error {
+	r.stopMonitor()
+	if err := r.Client.Close(); err != nil {
+		return err
+	}
+	r.logger.Info("Redis connection closed")
+	return nil
 }
 
 func (r *RedisProvider) SetEX(ctx context.Context, key string, value interface{}, ttl time.Duration) *redis.StatusCmd {
@@ -260,3 +339,33 @@ func containsAny(s string, substrs ...string) bool {
 	}
 	return false
 }
+
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// TryLock takes a best-effort distributed lock. The returned release func
+// only deletes the key if this caller still owns it.
+func (r *RedisProvider) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, false, err
+	}
+	value := hex.EncodeToString(token)
+
+	ok, err := r.Client.SetNX(ctx, key, value, ttl).Result()
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := unlockScript.Run(ctx, r.Client, []string{key}, value).Err(); err != nil {
+			r.logger.Warnw("Failed to release lock", "key", key, "error", err)
+		}
+	}, true, nil
+}
@@ -0,0 +1,47 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SetTagged stores key like SetEX and also records it in the Redis set tag,
+// so everything cached under a tag can later be dropped with DeleteTagged
+// instead of a SCAN over the keyspace. Each write pushes the tag's expiry
+// out to ttl, so keys under one tag should share a TTL.
+func (r *RedisProvider) SetTagged(ctx context.Context, tag, key string, value interface{}, ttl time.Duration) error {
+	pipe := r.Client.TxPipeline()
+	pipe.Set(ctx, key, value, ttl)
+	pipe.SAdd(ctx, tag, key)
+	pipe.Expire(ctx, tag, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// DeleteTagged deletes every key recorded under the given tags, and the tags
+// themselves, and returns how many cached keys went. The tags are read and
+// dropped in one transaction, so a key tagged concurrently lands in a fresh
+// tag set instead of being lost.
+func (r *RedisProvider) DeleteTagged(ctx context.Context, tags ...string) (int, error) {
+	pipe := r.Client.TxPipeline()
+	members := make([]*redis.StringSliceCmd, len(tags))
+	for i, tag := range tags {
+		members[i] = pipe.SMembers(ctx, tag)
+	}
+	pipe.Del(ctx, tags...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	var keys []string
+	for _, cmd := range members {
+		keys = append(keys, cmd.Val()...)
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	n, err := r.Client.Del(ctx, keys...).Result()
+	return int(n), err
+}
@@ -0,0 +1,173 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// AWSSource calls Secrets Manager and SSM Parameter Store directly over their
+// JSON APIs with SigV4 signing. Credentials come from the standard
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables and
+// are re-read on every call, so an external process may rotate them.
+type AWSSource struct {
+	region string
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewAWSSource(region string) (*AWSSource, error) {
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "" || os.Getenv("AWS_SECRET_ACCESS_KEY") == "" {
+		return nil, fmt.Errorf("AWS_REGION is set but AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not")
+	}
+	return &AWSSource{
+		region: region,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}, nil
+}
+
+type awsSourceFunc func(ctx context.Context, path string) (map[string]string, error)
+
+func (f awsSourceFunc) Fetch(ctx context.Context, path string) (map[string]string, error) {
+	return f(ctx, path)
+}
+
+// SecretsManager returns JSON object secrets field by field; any other
+// secret string is returned whole under "".
+func (a *AWSSource) SecretsManager() Source {
+	return awsSourceFunc(func(ctx context.Context, secretID string) (map[string]string, error) {
+		var out struct {
+			SecretString string `json:"SecretString"`
+		}
+		if err := a.call(ctx, "secretsmanager", "secretsmanager.GetSecretValue", map[string]string{"SecretId": secretID}, &out); err != nil {
+			return nil, err
+		}
+
+		var fields map[string]interface{}
+		if json.Unmarshal([]byte(out.SecretString), &fields) != nil {
+			return map[string]string{"": out.SecretString}, nil
+		}
+		values := map[string]string{"": out.SecretString}
+		for key, value := range fields {
+			if s, ok := value.(string); ok {
+				values[key] = s
+			} else {
+				values[key] = fmt.Sprint(value)
+			}
+		}
+		return values, nil
+	})
+}
+
+// ParameterStore decrypts SecureString parameters.
+func (a *AWSSource) ParameterStore() Source {
+	return awsSourceFunc(func(ctx context.Context, name string) (map[string]string, error) {
+		var out struct {
+			Parameter struct {
+				Value string `json:"Value"`
+			} `json:"Parameter"`
+		}
+		err := a.call(ctx, "ssm", "AmazonSSM.GetParameter", map[string]interface{}{"Name": name, "WithDecryption": true}, &out)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"": out.Parameter.Value}, nil
+	})
+}
+
+func (a *AWSSource) call(ctx context.Context, service, target string, in, out interface{}) error {
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	host := fmt.Sprintf("%s.%s.amazonaws.com", service, a.region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	a.sign(req, host, service, payload)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %d: %s", target, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// sign adds an AWS Signature Version 4 Authorization header.
+func (a *AWSSource) sign(req *http.Request, host, service string, payload []byte) {
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	sessionToken := os.Getenv("AWS_SESSION_TOKEN")
+
+	now := a.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	headers := map[string]string{
+		"content-type": req.Header.Get("Content-Type"),
+		"host":         host,
+		"x-amz-date":   amzDate,
+		"x-amz-target": req.Header.Get("X-Amz-Target"),
+	}
+	names := []string{"content-type", "host", "x-amz-date"}
+	if sessionToken != "" {
+		headers["x-amz-security-token"] = sessionToken
+		names = append(names, "x-amz-security-token")
+	}
+	names = append(names, "x-amz-target")
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{
+		req.Method, "/", "", canonicalHeaders.String(), signedHeaders, hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := day + "/" + a.region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, a.region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,165 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	SchemeVault          = "vault"
+	SchemeSecretsManager = "awssm"
+	SchemeSSM            = "ssm"
+)
+
+// Source fetches one secret document. Documents with several fields (a Vault
+// KV entry, a JSON Secrets Manager secret) return them all; single values are
+// returned under the "" key.
+type Source interface {
+	Fetch(ctx context.Context, path string) (map[string]string, error)
+}
+
+// Ref points at a secret: "vault:secret/data/404chan#db_password",
+// "awssm:prod/404chan#db_password" or "ssm:/404chan/db_password".
+type Ref struct {
+	Scheme string
+	Path   string
+	Field  string
+}
+
+// ParseRef reports whether value is a secret reference rather than a literal.
+func ParseRef(value string) (Ref, bool) {
+	scheme, rest, ok := strings.Cut(value, ":")
+	if !ok || rest == "" {
+		return Ref{}, false
+	}
+	switch scheme {
+	case SchemeVault, SchemeSecretsManager, SchemeSSM:
+	default:
+		return Ref{}, false
+	}
+	path, field, _ := strings.Cut(rest, "#")
+	return Ref{Scheme: scheme, Path: path, Field: field}, true
+}
+
+func (r Ref) String() string {
+	if r.Field == "" {
+		return r.Scheme + ":" + r.Path
+	}
+	return r.Scheme + ":" + r.Path + "#" + r.Field
+}
+
+type Options struct {
+	CacheTTL       time.Duration
+	VaultAddr      string
+	VaultToken     string
+	VaultNamespace string
+	AWSRegion      string
+}
+
+type cachedSecret struct {
+	values    map[string]string
+	fetchedAt time.Time
+}
+
+// Manager resolves secret references and caches the fetched documents for
+// CacheTTL. Callers that resolve on every new connection therefore pick up
+// rotated credentials within one TTL without hammering the backend.
+type Manager struct {
+	sources map[string]Source
+	ttl     time.Duration
+	logger  *zap.SugaredLogger
+
+	mu    sync.Mutex
+	cache map[string]cachedSecret
+}
+
+func NewManager(opts Options, logger *zap.Logger) (*Manager, error) {
+	m := &Manager{
+		sources: make(map[string]Source),
+		ttl:     opts.CacheTTL,
+		logger:  logger.Sugar(),
+		cache:   make(map[string]cachedSecret),
+	}
+
+	if opts.VaultAddr != "" {
+		m.sources[SchemeVault] = NewVaultSource(opts.VaultAddr, opts.VaultToken, opts.VaultNamespace)
+	}
+	if opts.AWSRegion != "" {
+		aws, err := NewAWSSource(opts.AWSRegion)
+		if err != nil {
+			return nil, err
+		}
+		m.sources[SchemeSecretsManager] = aws.SecretsManager()
+		m.sources[SchemeSSM] = aws.ParameterStore()
+	}
+	return m, nil
+}
+
+// Resolve returns literal values unchanged and looks references up.
+func (m *Manager) Resolve(ctx context.Context, value string) (string, error) {
+	ref, ok := ParseRef(value)
+	if !ok {
+		return value, nil
+	}
+
+	values, err := m.document(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	secret, ok := values[ref.Field]
+	if !ok {
+		if ref.Field == "" {
+			return "", fmt.Errorf("secret %s has several fields, add #field to pick one", ref)
+		}
+		return "", fmt.Errorf("secret %s: field %q not found", ref, ref.Field)
+	}
+	return secret, nil
+}
+
+// Check resolves every value once so missing secrets fail startup instead of
+// the first connection attempt.
+func (m *Manager) Check(ctx context.Context, values ...string) error {
+	for _, value := range values {
+		if _, err := m.Resolve(ctx, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Manager) document(ctx context.Context, ref Ref) (map[string]string, error) {
+	key := ref.Scheme + ":" + ref.Path
+
+	m.mu.Lock()
+	cached, ok := m.cache[key]
+	m.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < m.ttl {
+		return cached.values, nil
+	}
+
+	source, configured := m.sources[ref.Scheme]
+	if !configured {
+		return nil, fmt.Errorf("secret %s: %s is not configured", ref, ref.Scheme)
+	}
+
+	values, err := source.Fetch(ctx, ref.Path)
+	if err != nil {
+		// A backend outage should not take down connections that only need
+		// the credentials they already had.
+		if ok {
+			m.logger.Warnw("Failed to refresh secret, using cached value", "secret", key, "error", err)
+			return cached.values, nil
+		}
+		return nil, fmt.Errorf("secret %s: %w", ref, err)
+	}
+
+	m.mu.Lock()
+	m.cache[key] = cachedSecret{values: values, fetchedAt: time.Now()}
+	m.mu.Unlock()
+	return values, nil
+}
@@ -1,17 +1,34 @@
 package router
 
 import (
+	"net/http"
+	"time"
+
+	"backend/internal/app/announcement"
+	"backend/internal/app/antispam"
+	"backend/internal/app/apikey"
 	"backend/internal/app/attachment"
+	"backend/internal/app/backup"
 	"backend/internal/app/board"
+	"backend/internal/app/bookmark"
 	"backend/internal/app/cleanup"
+	"backend/internal/app/files"
+	"backend/internal/app/filter"
 	"backend/internal/app/health"
+	"backend/internal/app/ipreputation"
 	"backend/internal/app/message"
+	"backend/internal/app/notification"
 	"backend/internal/app/session"
+	"backend/internal/app/settings"
+	"backend/internal/app/stats"
 	"backend/internal/app/thread"
 	"backend/internal/app/upload"
 	"backend/internal/app/user"
+	"backend/internal/app/watch"
 	"backend/internal/gateways/websocket"
 	"backend/internal/middleware"
+	"backend/internal/providers/redis"
+	"backend/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -25,14 +42,54 @@ type Router struct {
 
 func NewRouter(logger *zap.Logger) *Router {
 	engine := gin.New()
+	engine.Use(middleware.RequestIDMiddleware())
 	engine.Use(middleware.CORSMiddleware())
 	engine.Use(middleware.LoggerMiddleware(logger))
 	engine.Use(gin.Recovery())
 	return &Router{Engine: engine}
 }
 
+// TrustProxies makes gin's ClientIP, and so session.ClientIP, believe the
+// forwarding headers only from proxies.
+func (r *Router) TrustProxies(proxies []string) error {
+	return r.Engine.SetTrustedProxies(proxies)
+}
+
+func (r *Router) UseBodyLimit(maxBody int64, multipartLimit func(c *gin.Context) int64) {
+	r.Engine.Use(middleware.BodyLimitMiddleware(maxBody, multipartLimit))
+}
+
+func (r *Router) UseSession() {
+	r.Engine.Use(middleware.SessionMiddleware())
+}
+
+func (r *Router) UseClientKey(ips utils.IPHasher) {
+	r.Engine.Use(middleware.ClientKeyMiddleware(ips))
+}
+
+func (r *Router) UseIdempotency(redisP *redis.RedisProvider, ttl time.Duration, logger *zap.Logger) {
+	r.Engine.Use(middleware.IdempotencyMiddleware(redisP, ttl, logger))
+}
+
+func (r *Router) UseAntispam(service antispam.Service, logger *zap.Logger) {
+	r.Engine.Use(middleware.AntispamMiddleware(service, logger))
+}
+
+func (r *Router) UseOrigin(reputation ipreputation.Service, captcha antispam.CaptchaVerifier, settingsSvc settings.Service, audit ipreputation.Audit, logger *zap.Logger) {
+	r.Engine.Use(middleware.OriginMiddleware(reputation, captcha, settingsSvc, audit, logger))
+}
+
+func (r *Router) UseAPIKeyAuth(service apikey.Service) {
+	r.Engine.Use(middleware.APIKeyMiddleware(service))
+}
+
+func (r *Router) UseMaintenance(service settings.Service) {
+	r.Engine.Use(middleware.MaintenanceMiddleware(service))
+}
+
 func (r *Router) RegisterHealthRoutes(handler health.Handler) {
 	health.RegisterRoutes(r.Engine.Group("/api"), handler)
+	health.RegisterProbeRoutes(r.Engine, handler)
 }
 
 func (r *Router) RegisterWebSocketRoutes(hub *websocket.Hub) {
@@ -51,6 +108,33 @@ func (r *Router) RegisterBoardRoutes(handler board.Handler) {
 	board.RegisterRoutes(r.Engine.Group("/api"), handler)
 }
 
+func (r *Router) RegisterBoardModRoutes(handler board.Handler, boards board.Service, sessions session.Service, adminAPIKey string) {
+	mod := r.Engine.Group("/api")
+	mod.Use(middleware.BoardModeratorMiddleware(adminAPIKey, boards, sessions))
+	board.RegisterModRoutes(mod, handler)
+}
+
+// RegisterModerationRoutes registers thread and message moderation under
+// /api/boards/:slug for the board's moderators and admins.
+func (r *Router) RegisterModerationRoutes(threadHandler thread.Handler, messageHandler message.Handler, boards board.Service, sessions session.Service, adminAPIKey string) {
+	mod := r.Engine.Group("/api")
+	mod.Use(middleware.BoardModeratorMiddleware(adminAPIKey, boards, sessions))
+	thread.RegisterModRoutes(mod, threadHandler)
+	message.RegisterModRoutes(mod, messageHandler)
+}
+
+func (r *Router) RegisterBoardAdminRoutes(handler board.Handler, adminAPIKey string) {
+	admin := r.Engine.Group("/api/admin")
+	admin.Use(middleware.AdminAPIKeyMiddleware(adminAPIKey))
+	board.RegisterAdminRoutes(admin, handler)
+}
+
+func (r *Router) RegisterBackupRoutes(handler backup.Handler, adminAPIKey string) {
+	admin := r.Engine.Group("/api/admin")
+	admin.Use(middleware.AdminAPIKeyMiddleware(adminAPIKey))
+	backup.RegisterAdminRoutes(admin, handler)
+}
+
 func (r *Router) RegisterThreadRoutes(handler thread.Handler) {
 	thread.RegisterRoutes(r.Engine.Group("/api"), handler)
 }
@@ -63,18 +147,85 @@ func (r *Router) RegisterAttachmentRoutes(handler attachment.Handler) {
 	attachment.RegisterRoutes(r.Engine.Group("/api"), handler)
 }
 
+func (r *Router) RegisterFileRoutes(handler files.Handler) {
+	files.RegisterRoutes(r.Engine.Group("/api"), handler)
+}
+
 func (r *Router) RegisterUploadRoutes(handler *upload.Handler) {
 	upload.RegisterRoutes(r.Engine.Group("/api"), handler)
 }
 
+func (r *Router) RegisterNotificationRoutes(handler notification.Handler) {
+	notification.RegisterRoutes(r.Engine.Group("/api"), handler)
+}
+
+func (r *Router) RegisterWatchRoutes(handler watch.Handler) {
+	watch.RegisterRoutes(r.Engine.Group("/api"), handler)
+}
+
+func (r *Router) RegisterAntispamRoutes(handler antispam.Handler) {
+	antispam.RegisterRoutes(r.Engine.Group("/api"), handler)
+}
+
+func (r *Router) RegisterFilterRoutes(handler filter.Handler) {
+	filter.RegisterRoutes(r.Engine.Group("/api"), handler)
+}
+
+func (r *Router) RegisterBookmarkRoutes(handler bookmark.Handler) {
+	bookmark.RegisterRoutes(r.Engine.Group("/api"), handler)
+}
+
+func (r *Router) RegisterAnnouncementRoutes(handler announcement.Handler, adminAPIKey string) {
+	announcement.RegisterRoutes(r.Engine.Group("/api"), handler)
+
+	admin := r.Engine.Group("/api/admin")
+	admin.Use(middleware.AdminAPIKeyMiddleware(adminAPIKey))
+	announcement.RegisterAdminRoutes(admin, handler)
+}
+
 func (r *Router) RegisterCleanupRoutes(handler cleanup.Handler, adminAPIKey string) {
-	cleanup := r.Engine.Group("/api/cleanup")
-	cleanup.Use(middleware.AdminAPIKeyMiddleware(adminAPIKey))
-	cleanup.POST("", handler.Cleanup)
+	admin := r.Engine.Group("/api")
+	admin.Use(middleware.AdminAPIKeyMiddleware(adminAPIKey))
+	cleanup.RegisterRoutes(admin, handler)
+}
+
+func (r *Router) RegisterAPIKeyRoutes(handler apikey.Handler, adminAPIKey string) {
+	admin := r.Engine.Group("/api/admin")
+	admin.Use(middleware.AdminAPIKeyMiddleware(adminAPIKey))
+	apikey.RegisterRoutes(admin, handler)
+}
+
+func (r *Router) RegisterStatsRoutes(handler stats.Handler) {
+	stats.RegisterRoutes(r.Engine.Group("/api"), handler)
+}
+
+func (r *Router) RegisterStatsAdminRoutes(handler stats.Handler, adminAPIKey string) {
+	admin := r.Engine.Group("/api/admin")
+	admin.Use(middleware.AdminAPIKeyMiddleware(adminAPIKey))
+	stats.RegisterAdminRoutes(admin, handler)
+}
+
+func (r *Router) RegisterGeoAdminRoutes(handler ipreputation.Handler, adminAPIKey string) {
+	admin := r.Engine.Group("/api/admin")
+	admin.Use(middleware.AdminAPIKeyMiddleware(adminAPIKey))
+	ipreputation.RegisterAdminRoutes(admin, handler)
+}
+
+func (r *Router) RegisterSettingsRoutes(handler settings.Handler, adminAPIKey string) {
+	settings.RegisterRoutes(r.Engine.Group("/api"), handler)
+
+	admin := r.Engine.Group("/api/admin")
+	admin.Use(middleware.AdminAPIKeyMiddleware(adminAPIKey))
+	settings.RegisterAdminRoutes(admin, handler)
 }
 
-func (r *Router) RegisterSwaggerRoutes() {
-	r.Engine.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+// RegisterDocsRoutes serves Swagger UI at /api/docs and the OpenAPI document
+// that swag init generates into docs/ at /api/docs/doc.json.
+func (r *Router) RegisterDocsRoutes() {
+	r.Engine.GET("/api/docs", func(c *gin.Context) {
+		c.Redirect(http.StatusMovedPermanently, "/api/docs/index.html")
+	})
+	r.Engine.GET("/api/docs/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 }
 
 func (r *Router) Serve(addr string) error {
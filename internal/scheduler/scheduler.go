@@ -0,0 +1,248 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type JobFunc func(ctx context.Context) error
+
+// Locker provides cross-instance mutual exclusion so a job scheduled on
+// several backend replicas only runs on one of them at a time.
+type Locker interface {
+	TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error)
+}
+
+type JobStatus struct {
+	Name           string     `json:"name"`
+	Schedule       string     `json:"schedule"`
+	Running        bool       `json:"running"`
+	Runs           int64      `json:"runs"`
+	Failures       int64      `json:"failures"`
+	Skipped        int64      `json:"skipped"`
+	LastStartedAt  *time.Time `json:"last_started_at,omitempty"`
+	LastFinishedAt *time.Time `json:"last_finished_at,omitempty"`
+	LastDuration   string     `json:"last_duration,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextRunAt      *time.Time `json:"next_run_at,omitempty"`
+}
+
+type job struct {
+	name     string
+	spec     string
+	schedule Schedule
+	timeout  time.Duration
+	run      JobFunc
+	running  atomic.Bool
+
+	mu     sync.Mutex
+	status JobStatus
+}
+
+type Scheduler struct {
+	jobs    []*job
+	locker  Locker
+	logger  *zap.SugaredLogger
+	cancel  context.CancelFunc
+	loops   sync.WaitGroup
+	workers sync.WaitGroup
+}
+
+func New(logger *zap.Logger, locker Locker) *Scheduler {
+	return &Scheduler{
+		locker: locker,
+		logger: logger.Sugar(),
+	}
+}
+
+// Add registers a job. An empty spec disables the job so deployments can
+// switch individual jobs off through configuration.
+func (s *Scheduler) Add(name, spec string, timeout time.Duration, run JobFunc) error {
+	if spec == "" || spec == "off" {
+		s.logger.Infow("Scheduled job disabled", "job", name)
+		return nil
+	}
+
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+
+	s.jobs = append(s.jobs, &job{
+		name:     name,
+		spec:     spec,
+		schedule: schedule,
+		timeout:  timeout,
+		run:      run,
+		status:   JobStatus{Name: name, Schedule: spec},
+	})
+	return nil
+}
+
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, j := range s.jobs {
+		s.loops.Add(1)
+		go s.loop(ctx, j)
+	}
+	s.logger.Infow("Scheduler started", "jobs", len(s.jobs))
+}
+
+// Stop prevents new runs and waits for in-flight jobs until ctx expires.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	s.loops.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.logger.Info("Scheduler stopped")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("scheduler stop: %w", ctx.Err())
+	}
+}
+
+func (s *Scheduler) Status() []JobStatus {
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		j.mu.Lock()
+		st := j.status
+		j.mu.Unlock()
+		st.Running = j.running.Load()
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
+
+// overdueGrace is how late a job may start before Health flags its loop as
+// stuck.
+const overdueGrace = time.Minute
+
+// Health reports a stopped scheduler, jobs whose last run failed and jobs
+// that missed their start time.
+func (s *Scheduler) Health() error {
+	if s.cancel == nil {
+		return errors.New("scheduler is not running")
+	}
+
+	var errs []error
+	now := time.Now()
+	for _, st := range s.Status() {
+		if st.LastError != "" {
+			errs = append(errs, fmt.Errorf("job %s failed: %s", st.Name, st.LastError))
+		}
+		if !st.Running && st.NextRunAt != nil && now.Sub(*st.NextRunAt) > overdueGrace {
+			errs = append(errs, fmt.Errorf("job %s is overdue since %s", st.Name, st.NextRunAt.Format(time.RFC3339)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	defer s.loops.Done()
+
+	for {
+		next := j.schedule.Next(time.Now())
+		if next.IsZero() {
+			s.logger.Warnw("Scheduled job has no next run time", "job", j.name, "schedule", j.spec)
+			return
+		}
+
+		j.mu.Lock()
+		j.status.NextRunAt = &next
+		j.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.workers.Add(1)
+			go func() {
+				defer s.workers.Done()
+				s.runJob(ctx, j)
+			}()
+		}
+	}
+}
+
+func (s *Scheduler) runJob(ctx context.Context, j *job) {
+	if !j.running.CompareAndSwap(false, true) {
+		j.mu.Lock()
+		j.status.Skipped++
+		j.mu.Unlock()
+		s.logger.Warnw("Scheduled job still running, skipping", "job", j.name)
+		return
+	}
+	defer j.running.Store(false)
+
+	runCtx := ctx
+	if j.timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, j.timeout)
+		defer cancel()
+	}
+
+	if s.locker != nil {
+		ttl := j.timeout
+		if ttl <= 0 {
+			ttl = time.Hour
+		}
+		unlock, ok, err := s.locker.TryLock(runCtx, "scheduler:lock:"+j.name, ttl)
+		if err != nil {
+			s.logger.Warnw("Failed to acquire job lock, running without it", "job", j.name, "error", err)
+		} else if !ok {
+			j.mu.Lock()
+			j.status.Skipped++
+			j.mu.Unlock()
+			s.logger.Debugw("Scheduled job locked by another instance, skipping", "job", j.name)
+			return
+		} else {
+			defer unlock()
+		}
+	}
+
+	started := time.Now().UTC()
+	j.mu.Lock()
+	j.status.LastStartedAt = &started
+	j.mu.Unlock()
+
+	err := j.run(runCtx)
+
+	finished := time.Now().UTC()
+	j.mu.Lock()
+	j.status.Runs++
+	j.status.LastFinishedAt = &finished
+	j.status.LastDuration = finished.Sub(started).String()
+	if err != nil {
+		j.status.Failures++
+		j.status.LastError = err.Error()
+	} else {
+		j.status.LastError = ""
+	}
+	j.mu.Unlock()
+
+	if err != nil {
+		s.logger.Errorw("Scheduled job failed", "job", j.name, "duration", finished.Sub(started), "error", err)
+		return
+	}
+	s.logger.Debugw("Scheduled job completed", "job", j.name, "duration", finished.Sub(started))
+}
@@ -0,0 +1,32 @@
+package utils
+
+// Adjectives and nouns agree in gender and together stay within the 16
+// letters a nickname may have, with no spaces or symbols.
+var (
+	anonAdjectives = []string{
+		"Весёлый", "Сонный", "Хитрый", "Тихий", "Храбрый", "Ленивый", "Быстрый", "Мудрый",
+		"Дикий", "Грустный", "Смелый", "Добрый", "Злой", "Рыжий", "Серый", "Белый",
+		"Чёрный", "Пушистый", "Мрачный", "Гордый", "Скромный", "Важный", "Шумный", "Юный",
+		"Старый", "Толстый", "Тощий", "Лысый", "Сытый", "Голодный", "Странный", "Ночной",
+	}
+	anonNouns = []string{
+		"Ёж", "Кот", "Пёс", "Лис", "Волк", "Медведь", "Бобр", "Барсук",
+		"Енот", "Филин", "Ворон", "Голубь", "Кит", "Краб", "Окунь", "Карась",
+		"Тюлень", "Пингвин", "Хомяк", "Суслик", "Крот", "Заяц", "Лось", "Олень",
+		"Кабан", "Жук", "Паук", "Сом", "Дятел", "Гусь", "Индюк", "Тапир",
+	}
+)
+
+// AnonName returns a pseudonym such as "СонныйЁж" for seed. The same seed
+// always gives the same name.
+func AnonName(seed uint64) string {
+	// splitmix64 spreads consecutive seeds (user IDs) across the word lists.
+	h := seed + 0x9e3779b97f4a7c15
+	h = (h ^ (h >> 30)) * 0xbf58476d1ce4e5b9
+	h = (h ^ (h >> 27)) * 0x94d049bb133111eb
+	h ^= h >> 31
+
+	adjective := anonAdjectives[h%uint64(len(anonAdjectives))]
+	noun := anonNouns[(h/uint64(len(anonAdjectives)))%uint64(len(anonNouns))]
+	return adjective + noun
+}
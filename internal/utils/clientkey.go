@@ -0,0 +1,22 @@
+package utils
+
+import "context"
+
+type clientKeyKey struct{}
+
+// ContextWithClientKey stores the hashed IP of the client behind a request.
+// It stays the same when user identities rotate, so per-client limits such
+// as posting cooldowns can be enforced across rotations.
+func ContextWithClientKey(ctx context.Context, clientKey string) context.Context {
+	return context.WithValue(ctx, clientKeyKey{}, clientKey)
+}
+
+func ClientKeyFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if key, ok := ctx.Value(clientKeyKey{}).(string); ok {
+		return key
+	}
+	return ""
+}
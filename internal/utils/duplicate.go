@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// ContentFingerprint identifies a post for duplicate detection. The text is
+// compared case-insensitively, with runs of whitespace collapsed and
+// invisible format characters such as zero-width spaces dropped, so trivial
+// variations of the same text match. Attachments are part of the post: the
+// same text with other files is not a duplicate.
+func ContentFingerprint(content string, attachmentIDs []string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, content)
+	normalized = strings.Join(strings.Fields(normalized), " ")
+
+	h := sha256.New()
+	h.Write([]byte(normalized))
+	ids := slices.Clone(attachmentIDs)
+	slices.Sort(ids)
+	for _, id := range ids {
+		h.Write([]byte{0})
+		h.Write([]byte(id))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
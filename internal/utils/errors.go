@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Error codes are the machine-readable part of ErrorResponse; clients
+// should branch on them rather than on the message, which may be reworded
+// or localized.
+const (
+	CodeBadRequest   = "bad_request"
+	CodeValidation   = "validation_failed"
+	CodeReference    = "invalid_reference"
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+	CodeSpam         = "spam_suspected"
+	CodeCaptcha      = "captcha_required"
+	CodeProxyBlocked = "proxy_blocked"
+	CodeGeoBlocked   = "geo_blocked"
+	CodeNotFound     = "not_found"
+	CodeConflict     = "conflict"
+	CodeTooLarge     = "payload_too_large"
+	CodeCooldown     = "cooldown"
+	CodeDuplicate    = "duplicate_post"
+	CodeRateLimited  = "rate_limited"
+	CodeInternal     = "internal_error"
+	CodeBadGateway   = "bad_gateway"
+	CodeUnavailable  = "unavailable"
+)
+
+// ErrorResponse is the body of every error the API returns.
+type ErrorResponse struct {
+	Code    string `json:"code" example:"not_found"`
+	Message string `json:"message" example:"thread not found"`
+	Details any    `json:"details,omitempty" swaggertype:"object"`
+}
+
+// ErrNotFound matches every NotFoundError with errors.Is.
+var ErrNotFound = errors.New("not found")
+
+// NotFoundError reports that the named resource does not exist.
+type NotFoundError struct {
+	Resource string
+}
+
+func NotFound(resource string) *NotFoundError {
+	return &NotFoundError{Resource: resource}
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Resource + " not found"
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// ValidationError reports input a service refused; Field names the
+// offending request field when there is one.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func Invalid(field, format string, args ...any) *ValidationError {
+	return &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// ReferenceError reports a well-formed request that points at a record it
+// cannot use, such as a reply to a post in another thread.
+type ReferenceError struct {
+	Field   string
+	Message string
+}
+
+func BadReference(field, format string, args ...any) *ReferenceError {
+	return &ReferenceError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *ReferenceError) Error() string {
+	return e.Message
+}
+
+// DuplicateError is returned when a user posts the same content again
+// within the duplicate window; Remaining is how long until the same post is
+// accepted.
+type DuplicateError struct {
+	Remaining time.Duration
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("duplicate post: the same content was posted less than %d seconds ago", e.SecondsLeft())
+}
+
+// SecondsLeft is Remaining rounded up to whole seconds.
+func (e *DuplicateError) SecondsLeft() int64 {
+	return ceilSeconds(e.Remaining)
+}
+
+// PolicyError reports a post refused by a board's policy. Code tells the
+// client what, if anything, it can do about it, such as solve a captcha.
+type PolicyError struct {
+	Code    string
+	Message string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Message
+}
+
+// RespondError writes an error with the code that goes with status.
+func RespondError(c *gin.Context, status int, message string) {
+	c.JSON(status, ErrorResponse{Code: codeForStatus(status), Message: message})
+}
+
+// WriteError answers with the status and envelope for a service error:
+// 429 with rate limit headers for a CooldownError, 409 for a
+// DuplicateError, 403 with its own code for a PolicyError, 400 for a
+// ValidationError, 422 for a ReferenceError, 404 for a NotFoundError or a
+// missing row, and a generic 500 for anything else, whose text is not
+// shown to clients.
+func WriteError(c *gin.Context, err error) {
+	var (
+		cooldown   *CooldownError
+		duplicate  *DuplicateError
+		policy     *PolicyError
+		validation *ValidationError
+		reference  *ReferenceError
+		notFound   *NotFoundError
+	)
+	switch {
+	case errors.As(err, &cooldown):
+		SetCooldownHeaders(c.Writer.Header(), cooldown.Remaining)
+		c.JSON(http.StatusTooManyRequests, ErrorResponse{
+			Code:    CodeCooldown,
+			Message: cooldown.Error(),
+			Details: gin.H{"seconds_left": cooldown.SecondsLeft()},
+		})
+	case errors.As(err, &duplicate):
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Code:    CodeDuplicate,
+			Message: duplicate.Error(),
+			Details: gin.H{"seconds_left": duplicate.SecondsLeft()},
+		})
+	case errors.As(err, &policy):
+		c.JSON(http.StatusForbidden, ErrorResponse{Code: policy.Code, Message: policy.Message})
+	case errors.As(err, &validation):
+		resp := ErrorResponse{Code: CodeValidation, Message: validation.Message}
+		if validation.Field != "" {
+			resp.Details = gin.H{"field": validation.Field}
+		}
+		c.JSON(http.StatusBadRequest, resp)
+	case errors.As(err, &reference):
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{
+			Code:    CodeReference,
+			Message: reference.Message,
+			Details: gin.H{"field": reference.Field},
+		})
+	case errors.As(err, &notFound):
+		RespondError(c, http.StatusNotFound, notFound.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		RespondError(c, http.StatusNotFound, "not found")
+	default:
+		c.Error(err)
+		RespondError(c, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusBadGateway:
+		return CodeBadGateway
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
@@ -1,43 +1,280 @@
 package utils
 
 import (
+	"context"
+	"sort"
 	"sync"
+	"sync/atomic"
 )
 
+// subscriberQueueLimit bounds how far a stalled subscriber may fall behind
+// before its backlog is dropped for an EventResync instead of growing memory
+// without limit.
+const subscriberQueueLimit = 65536
+
+// EventResync is delivered, with no data, in place of the events a
+// subscription fell too far behind to receive. Whatever the subscriber keeps
+// in step with events must be reloaded; later events follow as usual.
+const EventResync = "resync"
+
 type Event struct {
-	Event string      `json:"event"`
-	Data  interface{} `json:"data"`
+	ID        string  `json:"id,omitempty"`
+	Event     string  `json:"event"`
+	Data      Payload `json:"data"`
+	RequestID string  `json:"request_id,omitempty"`
+}
+
+// Forwarder receives every locally published event, e.g. to relay it to
+// other instances.
+type Forwarder interface {
+	Forward(event Event)
 }
 
-type Handler func(event Event)
+// Recorder persists events before delivery and returns the ID to stamp on
+// them, or "" for events it does not keep.
+type Recorder interface {
+	Record(event Event) (string, error)
+}
 
+// EventBus fans published events out to subscriptions. Each subscription
+// has its own queue, so a slow consumer neither blocks publishers nor makes
+// other subscribers miss events.
 type EventBus struct {
-	subscribers map[string][]Handler
-	events      chan Event
-	mu          sync.RWMutex
+	subscriptions map[*Subscription]bool
+	published     map[string]uint64
+	forwarder     Forwarder
+	recorder      Recorder
+	mu            sync.RWMutex
+	statsMu       sync.Mutex
 }
 
 func NewEventBus() *EventBus {
 	return &EventBus{
-		subscribers: make(map[string][]Handler),
-		events:      make(chan Event, 100),
+		subscriptions: make(map[*Subscription]bool),
+		published:     make(map[string]uint64),
 	}
 }
 
-func (eb *EventBus) Publish(event string, data interface{}) {
-	e := Event{Event: event, Data: data}
-	select {
-	case eb.events <- e:
-	default:
+func (eb *EventBus) Publish(payload Payload) {
+	eb.publish(Event{Event: payload.EventName(), Data: payload})
+}
+
+// PublishWithContext tags the event with the request ID carried by ctx so
+// delivery can be traced back to the HTTP request that caused it.
+func (eb *EventBus) PublishWithContext(ctx context.Context, payload Payload) {
+	eb.publish(Event{Event: payload.EventName(), Data: payload, RequestID: RequestIDFromContext(ctx)})
+}
+
+func (eb *EventBus) publish(e Event) {
+	eb.mu.RLock()
+	forwarder, recorder := eb.forwarder, eb.recorder
+	eb.mu.RUnlock()
+
+	if recorder != nil {
+		if id, err := recorder.Record(e); err == nil {
+			e.ID = id
+		}
+	}
+
+	eb.Inject(e)
+	if forwarder != nil {
+		forwarder.Forward(e)
+	}
+}
+
+// Inject delivers an event to local subscribers only. Forwarders use it for
+// events that originated elsewhere so they are not relayed again.
+func (eb *EventBus) Inject(e Event) {
+	eb.statsMu.Lock()
+	eb.published[e.Event]++
+	eb.statsMu.Unlock()
+
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+	for sub := range eb.subscriptions {
+		sub.push(e)
 	}
 }
 
-func (eb *EventBus) Subscribe(event string, handler Handler) {
+func (eb *EventBus) SetForwarder(f Forwarder) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	eb.forwarder = f
+}
+
+func (eb *EventBus) SetRecorder(r Recorder) {
 	eb.mu.Lock()
 	defer eb.mu.Unlock()
-	eb.subscribers[event] = append(eb.subscribers[event], handler)
+	eb.recorder = r
+}
+
+// Subscribe registers a named consumer for the given events, or for every
+// event when none are listed. Events arrive on the subscription's channel in
+// publish order; EventResync is delivered whatever the filter.
+func (eb *EventBus) Subscribe(name string, events ...string) *Subscription {
+	sub := &Subscription{
+		name: name,
+		out:  make(chan Event),
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	if len(events) > 0 {
+		sub.events = make(map[string]bool, len(events))
+		for _, e := range events {
+			sub.events[e] = true
+		}
+	}
+	go sub.pump()
+
+	eb.mu.Lock()
+	eb.subscriptions[sub] = true
+	eb.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe stops delivery and closes the subscription's channel. Queued
+// events that were not yet received are discarded.
+func (eb *EventBus) Unsubscribe(sub *Subscription) {
+	eb.mu.Lock()
+	if !eb.subscriptions[sub] {
+		eb.mu.Unlock()
+		return
+	}
+	delete(eb.subscriptions, sub)
+	eb.mu.Unlock()
+
+	close(sub.done)
+}
+
+type SubscriberMetrics struct {
+	Name      string `json:"name"`
+	Delivered uint64 `json:"delivered"`
+	Pending   int64  `json:"pending"`
+	Dropped   uint64 `json:"dropped"`
+	Resyncs   uint64 `json:"resyncs"`
+}
+
+type BusMetrics struct {
+	Published   map[string]uint64   `json:"published"`
+	Subscribers []SubscriberMetrics `json:"subscribers"`
+}
+
+func (eb *EventBus) Metrics() BusMetrics {
+	eb.statsMu.Lock()
+	published := make(map[string]uint64, len(eb.published))
+	for name, n := range eb.published {
+		published[name] = n
+	}
+	eb.statsMu.Unlock()
+
+	eb.mu.RLock()
+	subscribers := make([]SubscriberMetrics, 0, len(eb.subscriptions))
+	for sub := range eb.subscriptions {
+		subscribers = append(subscribers, SubscriberMetrics{
+			Name:      sub.name,
+			Delivered: sub.delivered.Load(),
+			Pending:   sub.pending.Load(),
+			Dropped:   sub.dropped.Load(),
+			Resyncs:   sub.resyncs.Load(),
+		})
+	}
+	eb.mu.RUnlock()
+
+	sort.Slice(subscribers, func(i, j int) bool { return subscribers[i].Name < subscribers[j].Name })
+	return BusMetrics{Published: published, Subscribers: subscribers}
+}
+
+// Subscription is one consumer's view of the bus. Publishers append to an
+// internal queue and a pump goroutine feeds C, so publishing never blocks on
+// the consumer. A consumer that lets subscriberQueueLimit events pile up
+// loses them and receives EventResync instead; delivery is lossless only up
+// to that point.
+type Subscription struct {
+	name   string
+	events map[string]bool
+	out    chan Event
+	wake   chan struct{}
+	done   chan struct{}
+
+	mu    sync.Mutex
+	queue []Event
+
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+	resyncs   atomic.Uint64
+	pending   atomic.Int64
+}
+
+func (s *Subscription) C() <-chan Event {
+	return s.out
+}
+
+func (s *Subscription) push(e Event) {
+	if s.events != nil && !s.events[e.Event] {
+		return
+	}
+
+	s.mu.Lock()
+	if len(s.queue) >= subscriberQueueLimit {
+		s.overflow(e)
+	} else {
+		s.queue = append(s.queue, e)
+		s.pending.Add(1)
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// overflow replaces the backlog and e, which the subscriber can no longer
+// catch up on, with a single EventResync. An EventResync already queued is
+// among the dropped events, so there is never more than one. Called with
+// s.mu held.
+func (s *Subscription) overflow(e Event) {
+	dropped := len(s.queue) + 1
+	if s.queue[0].Event == EventResync {
+		dropped--
+	} else {
+		s.resyncs.Add(1)
+	}
+	s.dropped.Add(uint64(dropped))
+	s.pending.Add(int64(1 - len(s.queue)))
+	s.queue = []Event{{Event: EventResync}}
 }
 
-func (eb *EventBus) SubscribeCh() <-chan Event {
-	return eb.events
+// pump takes queued events one at a time, so an overflow can still replace
+// everything not yet handed to the consumer.
+func (s *Subscription) pump() {
+	defer close(s.out)
+	for {
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+
+		for {
+			s.mu.Lock()
+			if len(s.queue) == 0 {
+				s.queue = nil
+				s.mu.Unlock()
+				break
+			}
+			e := s.queue[0]
+			s.queue[0] = Event{}
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+
+			select {
+			case s.out <- e:
+				s.pending.Add(-1)
+				s.delivered.Add(1)
+			case <-s.done:
+				return
+			}
+		}
+	}
 }
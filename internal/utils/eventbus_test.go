@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case e := <-sub.C():
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event delivered")
+		return Event{}
+	}
+}
+
+// TestSubscriptionOverflowResyncs stalls a subscriber past the queue limit
+// and checks that its backlog is replaced by one EventResync, that the events
+// published after the overflow still arrive, and that every event is either
+// delivered or counted as dropped.
+func TestSubscriptionOverflowResyncs(t *testing.T) {
+	eb := NewEventBus()
+	sub := eb.Subscribe("slow")
+	defer eb.Unsubscribe(sub)
+
+	total := subscriberQueueLimit + 10
+	for range total {
+		eb.Publish(StatsUpdated{})
+	}
+
+	var received, resyncs int
+	for eb.Metrics().Subscribers[0].Pending > 0 {
+		switch e := receive(t, sub); e.Event {
+		case EventResync:
+			resyncs++
+			if received > 1 {
+				t.Errorf("resync after %d events, want it first", received)
+			}
+		case EventStatsUpdated:
+			received++
+		default:
+			t.Fatalf("unexpected event %q", e.Event)
+		}
+	}
+
+	m := eb.Metrics().Subscribers[0]
+	if resyncs != 1 || m.Resyncs != 1 {
+		t.Errorf("got %d resync events, %d counted, want 1", resyncs, m.Resyncs)
+	}
+	if received == 0 {
+		t.Error("no events delivered after the resync")
+	}
+	if uint64(received)+m.Dropped != uint64(total) {
+		t.Errorf("delivered %d + dropped %d, want %d", received, m.Dropped, total)
+	}
+}
@@ -0,0 +1,238 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	EventThreadCreated      = "thread_created"
+	EventThreadUpdated      = "thread_updated"
+	EventMessageCreated     = "message_created"
+	EventLinkPreviews       = "link_previews"
+	EventNicknameUpdated    = "nickname_updated"
+	EventStatsUpdated       = "stats_updated"
+	EventNotification       = "notification"
+	EventUploadProgress     = "upload_progress"
+	EventWatchedThreadReply = "watched_thread_reply"
+	EventSettingsUpdated    = "settings_updated"
+	EventSessionRevoked     = "session_revoked"
+	EventBoardCreated       = "board_created"
+	EventAnnouncement       = "announcement"
+	EventMaintenanceMode    = "maintenance_mode"
+)
+
+// Payload is implemented by every typed event body. The event name travels
+// with the payload so publishers cannot pair a name with the wrong shape.
+type Payload interface {
+	EventName() string
+}
+
+type ThreadCreated struct {
+	ThreadID       uint64          `json:"thread_id"`
+	BoardID        uint64          `json:"board_id"`
+	PostNo         uint64          `json:"post_no"`
+	Title          string          `json:"title"`
+	Content        string          `json:"content"`
+	Segments       json.RawMessage `json:"segments,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	CreatedBy      uint64          `json:"created_by"`
+	AuthorNickname string          `json:"author_nickname"`
+	MessagesCount  int             `json:"messages_count"`
+	Timestamp      int64           `json:"timestamp"`
+}
+
+// ThreadUpdated carries a thread's title and text after its author edited
+// them.
+type ThreadUpdated struct {
+	ThreadID  uint64          `json:"thread_id"`
+	BoardID   uint64          `json:"board_id"`
+	Title     string          `json:"title"`
+	Content   string          `json:"content"`
+	Segments  json.RawMessage `json:"segments,omitempty"`
+	EditedAt  time.Time       `json:"edited_at"`
+	Timestamp int64           `json:"timestamp"`
+}
+
+type MessageCreated struct {
+	MessageID      uint64          `json:"message_id"`
+	ThreadID       uint64          `json:"thread_id"`
+	BoardID        uint64          `json:"board_id"`
+	PostNo         uint64          `json:"post_no"`
+	Content        string          `json:"content"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	AuthorNickname string          `json:"author_nickname"`
+	IsAuthor       bool            `json:"is_author"`
+	Segments       json.RawMessage `json:"segments,omitempty"`
+	Embeds         json.RawMessage `json:"embeds,omitempty"`
+	Bumped         bool            `json:"bumped"`
+	UserID         uint64          `json:"user_id"`
+	Timestamp      int64           `json:"timestamp"`
+}
+
+// LinkPreviews carries the link previews of a reply, fetched after it was
+// posted. Previews is the JSON array stored in messages.link_previews.
+type LinkPreviews struct {
+	MessageID uint64          `json:"message_id"`
+	ThreadID  uint64          `json:"thread_id"`
+	BoardID   uint64          `json:"board_id"`
+	Previews  json.RawMessage `json:"link_previews"`
+	Timestamp int64           `json:"timestamp"`
+}
+
+type NicknameUpdated struct {
+	UserID    uint64 `json:"user_id"`
+	Nickname  string `json:"nickname"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type StatsUpdated struct {
+	Boards             int64     `json:"boards"`
+	Threads            int64     `json:"threads"`
+	Messages           int64     `json:"messages"`
+	Attachments        int64     `json:"attachments"`
+	StorageBytes       int64     `json:"storage_bytes"`
+	UniquePostersToday int64     `json:"unique_posters_today"`
+	PostsPerHour       int64     `json:"posts_per_hour"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+type Notification struct {
+	ID        uint64                 `json:"id"`
+	UserID    uint64                 `json:"user_id"`
+	Type      string                 `json:"type"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	Timestamp int64                  `json:"timestamp"`
+}
+
+type UploadProgress struct {
+	UserID    uint64 `json:"user_id"`
+	UploadID  string `json:"upload_id"`
+	FileIndex int    `json:"file_index"`
+	FileName  string `json:"file_name"`
+	Status    string `json:"status"`
+	Bytes     int64  `json:"bytes"`
+	Total     int64  `json:"total"`
+	Percent   int    `json:"percent"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type WatchedThreadReply struct {
+	UserIDs   []uint64 `json:"user_ids"`
+	ThreadID  uint64   `json:"thread_id"`
+	MessageID uint64   `json:"message_id"`
+	Timestamp int64    `json:"timestamp"`
+}
+
+// SettingsUpdated tells every instance to reload the runtime settings.
+type SettingsUpdated struct {
+	Timestamp int64 `json:"timestamp"`
+}
+
+// SessionRevoked tells every instance to drop the websocket connections of a
+// session that was signed out.
+type SessionRevoked struct {
+	SessionID uint64 `json:"session_id"`
+	UserID    uint64 `json:"user_id"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// BoardCreated announces a board added through the admin API, so clients
+// can refresh their board list.
+type BoardCreated struct {
+	BoardID     uint64    `json:"board_id"`
+	Slug        string    `json:"slug"`
+	Title       string    `json:"title"`
+	Description *string   `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	Timestamp   int64     `json:"timestamp"`
+}
+
+// Announcement shows a site-wide announcement to every client, or takes it
+// down when Active is false.
+type Announcement struct {
+	ID        uint64     `json:"id"`
+	Text      string     `json:"text"`
+	Level     string     `json:"level"`
+	StartsAt  time.Time  `json:"starts_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Active    bool       `json:"active"`
+	Timestamp int64      `json:"timestamp"`
+}
+
+// MaintenanceMode tells every client that the site went read-only or is
+// accepting posts again.
+type MaintenanceMode struct {
+	Enabled   bool   `json:"enabled"`
+	Message   string `json:"message,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+func (ThreadCreated) EventName() string      { return EventThreadCreated }
+func (ThreadUpdated) EventName() string      { return EventThreadUpdated }
+func (MessageCreated) EventName() string     { return EventMessageCreated }
+func (LinkPreviews) EventName() string       { return EventLinkPreviews }
+func (NicknameUpdated) EventName() string    { return EventNicknameUpdated }
+func (StatsUpdated) EventName() string       { return EventStatsUpdated }
+func (Notification) EventName() string       { return EventNotification }
+func (UploadProgress) EventName() string     { return EventUploadProgress }
+func (WatchedThreadReply) EventName() string { return EventWatchedThreadReply }
+func (SettingsUpdated) EventName() string    { return EventSettingsUpdated }
+func (SessionRevoked) EventName() string     { return EventSessionRevoked }
+func (BoardCreated) EventName() string       { return EventBoardCreated }
+func (Announcement) EventName() string       { return EventAnnouncement }
+func (MaintenanceMode) EventName() string    { return EventMaintenanceMode }
+
+var payloadDecoders = map[string]func(json.RawMessage) (Payload, error){
+	EventThreadCreated:      decodePayload[ThreadCreated],
+	EventThreadUpdated:      decodePayload[ThreadUpdated],
+	EventMessageCreated:     decodePayload[MessageCreated],
+	EventLinkPreviews:       decodePayload[LinkPreviews],
+	EventNicknameUpdated:    decodePayload[NicknameUpdated],
+	EventStatsUpdated:       decodePayload[StatsUpdated],
+	EventNotification:       decodePayload[Notification],
+	EventUploadProgress:     decodePayload[UploadProgress],
+	EventWatchedThreadReply: decodePayload[WatchedThreadReply],
+	EventSettingsUpdated:    decodePayload[SettingsUpdated],
+	EventSessionRevoked:     decodePayload[SessionRevoked],
+	EventBoardCreated:       decodePayload[BoardCreated],
+	EventAnnouncement:       decodePayload[Announcement],
+	EventMaintenanceMode:    decodePayload[MaintenanceMode],
+}
+
+func decodePayload[T Payload](raw json.RawMessage) (Payload, error) {
+	var p T
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// UnmarshalJSON restores the typed payload of events read back from the
+// event log or received from other instances.
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		ID        string          `json:"id"`
+		Event     string          `json:"event"`
+		Data      json.RawMessage `json:"data"`
+		RequestID string          `json:"request_id"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	decode, ok := payloadDecoders[raw.Event]
+	if !ok {
+		return fmt.Errorf("unknown event %q", raw.Event)
+	}
+	data, err := decode(raw.Data)
+	if err != nil {
+		return fmt.Errorf("invalid %s payload: %w", raw.Event, err)
+	}
+
+	*e = Event{ID: raw.ID, Event: raw.Event, Data: data, RequestID: raw.RequestID}
+	return nil
+}
@@ -2,12 +2,22 @@ package utils
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"time"
 
+	"github.com/minio/minio-go/v7"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
+const (
+	healthHistorySize = 10
+	// eventBacklogWarn is the per-subscriber queue depth at which the event
+	// bus is reported as falling behind.
+	eventBacklogWarn = 1000
+)
+
 type HealthStatus struct {
 	Status    string    `json:"status"`
 	Timestamp time.Time `json:"timestamp"`
@@ -15,47 +25,132 @@ type HealthStatus struct {
 }
 
 type Service struct {
-	Name    string `json:"name"`
-	Status  string `json:"status"`
-	Message string `json:"message,omitempty"`
+	Name        string        `json:"name"`
+	Status      string        `json:"status"`
+	Message     string        `json:"message,omitempty"`
+	Critical    bool          `json:"critical"`
+	LatencyMs   float64       `json:"latency_ms"`
+	LastSuccess *time.Time    `json:"last_success,omitempty"`
+	History     []CheckResult `json:"history,omitempty"`
+}
+
+type CheckResult struct {
+	Status    string    `json:"status"`
+	LatencyMs float64   `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type LivenessStatus struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Uptime    string    `json:"uptime"`
+}
+
+// JobsChecker reports scheduler problems, e.g. *scheduler.Scheduler.
+type JobsChecker interface {
+	Health() error
 }
 
 type HealthChecker struct {
-	DB    *gorm.DB
-	Redis *redis.Client
+	DB          *gorm.DB
+	Redis       *redis.Client
+	MinIO       *minio.Client
+	MinioBucket string
+	// MinioInitError is reported as a down service when the provider could
+	// not be created at startup and MinIO is therefore nil.
+	MinioInitError error
+	// Migrations, when set, verifies that the schema is in place.
+	Migrations func(ctx context.Context) error
+	EventBus   *EventBus
+	Jobs       JobsChecker
+	StartedAt  time.Time
+
+	mu      sync.Mutex
+	history map[string]*serviceHistory
+}
+
+type serviceHistory struct {
+	lastSuccess *time.Time
+	results     []CheckResult
 }
 
+// Live reports that the process is up without touching any dependency, so a
+// database outage never gets the pod restarted.
+func (h *HealthChecker) Live() LivenessStatus {
+	now := time.Now().UTC()
+	return LivenessStatus{
+		Status:    "alive",
+		Timestamp: now,
+		Uptime:    now.Sub(h.StartedAt).Round(time.Second).String(),
+	}
+}
+
+// Check probes every configured dependency. A critical service that is down
+// makes the result "degraded" (not ready); problems in non-critical ones such
+// as the event bus or scheduler only raise "warning".
 func (h *HealthChecker) Check(ctx context.Context) HealthStatus {
 	var services []Service
-	overallStatus := "healthy"
 
 	if h.DB != nil {
-		service := Service{Name: "PostgreSQL"}
-		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
-		sqlDB, _ := h.DB.DB()
-		if err := sqlDB.PingContext(ctx); err != nil {
-			service.Status = "down"
-			service.Message = err.Error()
-			overallStatus = "degraded"
-		} else {
-			service.Status = "up"
-		}
-		services = append(services, service)
-		cancel()
+		services = append(services, h.probe(ctx, "PostgreSQL", true, func(ctx context.Context) (string, error) {
+			sqlDB, err := h.DB.DB()
+			if err != nil {
+				return "", err
+			}
+			return "", sqlDB.PingContext(ctx)
+		}))
 	}
 
 	if h.Redis != nil {
-		service := Service{Name: "Redis"}
-		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
-		if err := h.Redis.Ping(ctx).Err(); err != nil {
-			service.Status = "down"
-			service.Message = err.Error()
+		services = append(services, h.probe(ctx, "Redis", true, func(ctx context.Context) (string, error) {
+			return "", h.Redis.Ping(ctx).Err()
+		}))
+	}
+
+	if h.MinIO == nil && h.MinioInitError != nil {
+		services = append(services, h.probe(ctx, "MinIO", true, func(context.Context) (string, error) {
+			return "", h.MinioInitError
+		}))
+	}
+
+	if h.MinIO != nil {
+		services = append(services, h.probe(ctx, "MinIO", true, func(ctx context.Context) (string, error) {
+			exists, err := h.MinIO.BucketExists(ctx, h.MinioBucket)
+			if err == nil && !exists {
+				err = fmt.Errorf("bucket %q does not exist", h.MinioBucket)
+			}
+			return "", err
+		}))
+	}
+
+	if h.Migrations != nil {
+		services = append(services, h.probe(ctx, "Migrations", true, func(ctx context.Context) (string, error) {
+			return "", h.Migrations(ctx)
+		}))
+	}
+
+	if h.EventBus != nil {
+		services = append(services, h.probe(ctx, "EventBus", false, func(context.Context) (string, error) {
+			return checkEventBacklog(h.EventBus.Metrics())
+		}))
+	}
+
+	if h.Jobs != nil {
+		services = append(services, h.probe(ctx, "Scheduler", false, func(context.Context) (string, error) {
+			return "", h.Jobs.Health()
+		}))
+	}
+
+	overallStatus := "healthy"
+	for _, s := range services {
+		if s.Status == "up" {
+			continue
+		}
+		if s.Critical {
 			overallStatus = "degraded"
-		} else {
-			service.Status = "up"
+		} else if overallStatus == "healthy" {
+			overallStatus = "warning"
 		}
-		services = append(services, service)
-		cancel()
 	}
 
 	return HealthStatus{
@@ -64,3 +159,67 @@ func (h *HealthChecker) Check(ctx context.Context) HealthStatus {
 		Services:  services,
 	}
 }
+
+// probe runs one check with a timeout and records its latency and outcome
+// in the service's rolling history.
+func (h *HealthChecker) probe(ctx context.Context, name string, critical bool, check func(ctx context.Context) (string, error)) Service {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	started := time.Now()
+	message, err := check(ctx)
+	latency := float64(time.Since(started).Microseconds()) / 1000
+
+	service := Service{Name: name, Status: "up", Message: message, Critical: critical, LatencyMs: latency}
+	if err != nil {
+		service.Status = "down"
+		if !critical {
+			service.Status = "warning"
+		}
+		service.Message = err.Error()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.history == nil {
+		h.history = make(map[string]*serviceHistory)
+	}
+	hist, ok := h.history[name]
+	if !ok {
+		hist = &serviceHistory{}
+		h.history[name] = hist
+	}
+
+	now := time.Now().UTC()
+	if err == nil {
+		hist.lastSuccess = &now
+	}
+	hist.results = append(hist.results, CheckResult{Status: service.Status, LatencyMs: latency, CheckedAt: now})
+	if len(hist.results) > healthHistorySize {
+		hist.results = hist.results[len(hist.results)-healthHistorySize:]
+	}
+
+	service.LastSuccess = hist.lastSuccess
+	service.History = append([]CheckResult(nil), hist.results...)
+	return service
+}
+
+func checkEventBacklog(m BusMetrics) (string, error) {
+	var pending int64
+	var dropped uint64
+	var worst string
+	var worstPending int64
+	for _, s := range m.Subscribers {
+		pending += s.Pending
+		dropped += s.Dropped
+		if s.Pending > worstPending {
+			worst, worstPending = s.Name, s.Pending
+		}
+	}
+
+	summary := fmt.Sprintf("%d subscribers, %d pending, %d dropped", len(m.Subscribers), pending, dropped)
+	if worstPending >= eventBacklogWarn {
+		return "", fmt.Errorf("subscriber %q is %d events behind (%s)", worst, worstPending, summary)
+	}
+	return summary, nil
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HashedIPPrefix starts every stored IP hash.
+const HashedIPPrefix = "sha256:"
+
+// IPHasher turns a client IP into the value stored for it. With a salt it
+// is an HMAC-SHA256 of the IP, which maps the same address to the same
+// value every time, so users and bans still match by it; without one the IP
+// is stored as is.
+type IPHasher struct {
+	salt     []byte
+	rotation time.Duration
+}
+
+// NewIPHasher hashes with salt. A positive rotation makes Identity change
+// every rotation period; it needs a salt.
+func NewIPHasher(salt string, rotation time.Duration) IPHasher {
+	return IPHasher{salt: []byte(salt), rotation: rotation}
+}
+
+// Enabled reports whether IPs are hashed.
+func (h IPHasher) Enabled() bool {
+	return len(h.salt) > 0
+}
+
+// Rotates reports whether identities rotate.
+func (h IPHasher) Rotates() bool {
+	return h.Enabled() && h.rotation > 0
+}
+
+// Hash returns the stored form of ip. A value that is already hashed is
+// returned unchanged.
+func (h IPHasher) Hash(ip string) string {
+	if !h.Enabled() || IsHashedIP(ip) {
+		return ip
+	}
+	return HashedIPPrefix + hex.EncodeToString(h.mac(ip))
+}
+
+// Identity returns the key a user is stored and found under at now, and
+// when that key stops being used. Without rotation it is Hash(ip) and until
+// is zero. With rotation the same IP gets a new key, and so a new user,
+// every period; each IP switches at its own offset within the period so
+// users do not all rotate at the same moment.
+func (h IPHasher) Identity(ip string, now time.Time) (key string, until time.Time) {
+	if !h.Rotates() {
+		return h.Hash(ip), time.Time{}
+	}
+	period := int64(h.rotation)
+	offset := int64(binary.BigEndian.Uint64(h.mac(ip)) % uint64(period))
+	epoch := (now.UnixNano() + offset) / period
+
+	key = HashedIPPrefix + hex.EncodeToString(h.mac(ip+"@"+strconv.FormatInt(epoch, 10)))
+	return key, time.Unix(0, (epoch+1)*period-offset).UTC()
+}
+
+func (h IPHasher) mac(value string) []byte {
+	mac := hmac.New(sha256.New, h.salt)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// IsHashedIP tells a stored hash apart from a raw address.
+func IsHashedIP(value string) bool {
+	return strings.HasPrefix(value, HashedIPPrefix)
+}
@@ -0,0 +1,39 @@
+package utils
+
+import "context"
+
+// Origin is what the IP reputation lists say about the client behind a
+// post. Country is the ISO 3166 code of the address's network, when known.
+type Origin struct {
+	Tor        bool
+	Datacenter bool
+	ASN        uint32
+	Country    string
+	// CaptchaPassed is set when the request carried a captcha response
+	// the provider accepted.
+	CaptchaPassed bool
+}
+
+// Anonymized reports whether the post comes through Tor or a hosting
+// network, where VPNs and proxies live.
+func (o Origin) Anonymized() bool {
+	return o.Tor || o.Datacenter
+}
+
+type originKey struct{}
+
+// ContextWithOrigin stores the origin of a posting request for the
+// services to check against the board's policy.
+func ContextWithOrigin(ctx context.Context, origin Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// OriginFromContext returns the origin of the request, or the zero Origin,
+// which no policy restricts, when it was not looked up.
+func OriginFromContext(ctx context.Context) Origin {
+	if ctx == nil {
+		return Origin{}
+	}
+	origin, _ := ctx.Value(originKey{}).(Origin)
+	return origin
+}
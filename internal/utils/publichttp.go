@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"syscall"
+	"time"
+)
+
+const maxPublicRedirects = 3
+
+// ErrBlockedAddress is returned for a URL or connection that would reach a
+// loopback, private or otherwise non-public address.
+var ErrBlockedAddress = errors.New("address is not public")
+
+// blockedPrefixes are the special-purpose ranges netip has no predicate for.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// PublicAddr reports whether ip is an ordinary internet address: not
+// loopback, private, link-local (cloud metadata lives there), multicast or
+// reserved.
+func PublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewPublicClient returns a client for URLs that users choose, which only
+// connects to public addresses, and only on ports when any are given. The
+// check runs on the address actually dialed, after DNS resolution and for
+// every redirect, so neither a hostname pointing inside the network nor a
+// redirect there gets through. Proxies from the environment are ignored
+// since they would dial on the client's behalf.
+func NewPublicClient(timeout time.Duration, ports ...string) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, port, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if len(ports) > 0 && !slices.Contains(ports, port) {
+				return fmt.Errorf("port %s: %w", port, ErrBlockedAddress)
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil || !PublicAddr(ip) {
+				return fmt.Errorf("%s: %w", host, ErrBlockedAddress)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       time.Minute,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxPublicRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to %s scheme", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// CheckPublicURL refuses, before it is saved, a user-supplied URL whose
+// host is or resolves to a non-public address. NewPublicClient checks again
+// when it connects, since DNS can change in between.
+func CheckPublicURL(ctx context.Context, u *url.URL) error {
+	host := u.Hostname()
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !PublicAddr(ip) {
+			return ErrBlockedAddress
+		}
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", host, err)
+	}
+	for _, ip := range ips {
+		if !PublicAddr(ip) {
+			return ErrBlockedAddress
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CooldownError is returned when an action is refused because the same
+// user did it less than Cooldown ago; Remaining is how long until it is
+// allowed again.
+type CooldownError struct {
+	Action    string
+	Cooldown  time.Duration
+	Remaining time.Duration
+}
+
+func (e *CooldownError) Error() string {
+	return fmt.Sprintf("%s cooldown: %d seconds left", e.Action, e.SecondsLeft())
+}
+
+// SecondsLeft is Remaining rounded up to whole seconds.
+func (e *CooldownError) SecondsLeft() int64 {
+	return ceilSeconds(e.Remaining)
+}
+
+// SetRateLimitHeaders reports a client's standing against a limit:
+// X-RateLimit-Limit and X-RateLimit-Remaining always, and Retry-After in
+// whole seconds when retryAfter is positive.
+func SetRateLimitHeaders(h http.Header, limit, remaining int, retryAfter time.Duration) {
+	h.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	if retryAfter > 0 {
+		h.Set("Retry-After", strconv.FormatInt(ceilSeconds(retryAfter), 10))
+	}
+}
+
+// SetCooldownHeaders describes a cooldown as a limit of one action per
+// window: remaining is 0 while the cooldown runs and Retry-After says when
+// it ends. Send it after a successful action too, with remaining equal to
+// the full cooldown, so clients can count down without asking.
+func SetCooldownHeaders(h http.Header, remaining time.Duration) {
+	if remaining > 0 {
+		SetRateLimitHeaders(h, 1, 0, remaining)
+		return
+	}
+	SetRateLimitHeaders(h, 1, 1, 0)
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
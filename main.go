@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -22,11 +26,11 @@ import (
 // @version 1.0
 // @description API for 404chan imageboard application
 // @host localhost:8080
-// @BasePath /api
+// @BasePath /
 // @securityDefinitions.apikey BearerAuth
 // @in header
 // @name Authorization
-// @description Type "Bearer" followed by a space and JWT token.
+// @description Type "Bearer" followed by a space and the session key.
 // @securityDefinitions.apikey ApiKeyAuth
 // @in header
 // @name X-Admin-API-Key
@@ -41,7 +45,27 @@ func main() {
 
 	utils.LoadEnv(logger)
 
-	cfg := config.LoadConfig()
+	// "404chan <command> [flags]" runs a maintenance command and exits.
+	args, command := os.Args[1:], ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	cfg, err := config.LoadConfig(args)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Print(config.Usage)
+		return
+	}
+	if err != nil {
+		logger.Fatal("Invalid configuration", zap.Error(err))
+	}
+
+	if command != "" {
+		if err := app.RunCommand(context.Background(), command, &cfg, logger); err != nil {
+			logger.Fatal("Command failed", zap.String("command", command), zap.Error(err))
+		}
+		return
+	}
 
 	logger.Info("Config loaded",
 		zap.String("server_port", cfg.ServerPort),
@@ -61,10 +85,24 @@ func main() {
 		Handler: application.Router.Engine,
 	}
 
-	logger.Info("Server started", zap.String("addr", "localhost"+addr))
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		logger.Fatal("Server stopped with error", zap.Error(err))
-	}
+	go func() {
+		logger.Info("Server started", zap.String("addr", "localhost"+addr))
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Fatal("Server stopped with error", zap.Error(err))
+		}
+	}()
+
+	// SIGHUP reloads the runtime settings from the config file without
+	// restarting, so websocket connections survive.
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if _, err := application.Settings.Reload(context.Background()); err != nil {
+				logger.Error("Failed to reload settings", zap.Error(err))
+			}
+		}
+	}()
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -74,8 +112,14 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// srv.Shutdown stops new requests and waits for in-flight ones; the
+	// hijacked websocket connections are left to application.Shutdown.
 	if err := srv.Shutdown(ctx); err != nil {
-		logger.Fatal("Server forced to shutdown", zap.Error(err))
+		logger.Error("Server forced to shutdown", zap.Error(err))
+	}
+
+	if err := application.Shutdown(ctx); err != nil {
+		logger.Fatal("Application did not shut down cleanly", zap.Error(err))
 	}
 
 	logger.Info("Server exited gracefully")